@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"ocr-web-api/auth"
+	"ocr-web-api/logging"
+	"ocr-web-api/redact"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// apiKeyHeader is the header an API key can be sent in, as an alternative
+// to an Authorization header with the Bearer scheme
+const apiKeyHeader = "X-API-Key"
+
+// corsAllowedHeaders are the request headers browsers may send to the API
+const corsAllowedHeaders = "Content-Type, Accept, Authorization, X-API-Key, X-Request-ID"
+
+// getAPIKeysFromEnv loads the API keys of the file named by API_KEYS_FILE.
+// Without it, authentication is disabled and every client is served.
+func getAPIKeysFromEnv(redactor *redact.Redactor) (*auth.Keys, error) {
+	path := os.Getenv("API_KEYS_FILE")
+	if path == "" {
+		AppLogger.Warn("API_KEYS_FILE is not set, API key authentication is disabled")
+		return nil, nil
+	}
+
+	keys, err := auth.Load(path, func(key *auth.Key) error {
+		return validateAPIKey(key, redactor)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_KEYS_FILE: %w", err)
+	}
+	AppLogger.Info("API key authentication enabled", "keys", keys.Len())
+	return keys, nil
+}
+
+// validateAPIKey checks the document types and redaction policy of a key
+func validateAPIKey(key *auth.Key, redactor *redact.Redactor) error {
+	for _, documentType := range key.DocumentTypes {
+		if documentType == DocumentTypeAuto || !isValidDocumentType(documentType) {
+			return fmt.Errorf("unsupported document type %s", documentType)
+		}
+	}
+
+	policy, err := parseRedactionPolicy(key.Redact)
+	if err != nil {
+		return fmt.Errorf("invalid redact: %w", err)
+	}
+	if policy.Uses(redact.ModeHash) && !redactor.CanHash() {
+		return errors.New("redact hashes fields but REDACTION_HASH_KEY is not set")
+	}
+	return nil
+}
+
+// reloadAPIKeysOnSIGHUP reloads the keys file whenever the process receives
+// SIGHUP. The previous keys stay in use when the file is invalid.
+func reloadAPIKeysOnSIGHUP(keys *auth.Keys) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := keys.Reload(); err != nil {
+				AppLogger.Error("Failed to reload API keys, keeping the previous keys", "error", err)
+				continue
+			}
+			AppLogger.Info("API keys reloaded", "keys", keys.Len())
+		}
+	}()
+}
+
+// allowCORS answers cross-origin requests to an endpoint that needs no key:
+// from any origin while authentication is disabled, and otherwise from the
+// origins of the configured keys
+func (h *OCRHandler) allowCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.apiKeys == nil {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if origin := r.Header.Get("Origin"); origin != "" && h.apiKeys.AllowsOrigin(origin) {
+			setAllowedOrigin(w, origin)
+		}
+		next(w, r)
+	}
+}
+
+// requireAPIKey serves only requests with a configured API key, from the
+// origins of the key and within its rate limit. The key is passed to next in
+// the request context, where it limits document types and redacts
+// responses. While authentication is disabled, every request is served.
+func (h *OCRHandler) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Preflight requests carry no key; the request that follows is checked
+		if h.apiKeys == nil || r.Method == http.MethodOptions {
+			h.allowCORS(next)(w, r)
+			return
+		}
+
+		// Errors are readable from every origin preflight requests are answered
+		// for, so that browsers can tell a rejected key from a network error
+		origin := r.Header.Get("Origin")
+		if origin != "" && h.apiKeys.AllowsOrigin(origin) {
+			setAllowedOrigin(w, origin)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		key, ok := h.apiKeys.Authenticate(apiKeyOf(r))
+		if !ok {
+			AppLogger.WarnContext(r.Context(), "Request without valid API key rejected", "remote_addr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ocr-web-api"`)
+			h.sendErrorResponse(w, newAPIError(http.StatusUnauthorized, ErrCodeUnauthorized, "missing or invalid API key"))
+			return
+		}
+		ctx := logging.With(auth.WithKey(r.Context(), key), slog.String("api_key", key.ID))
+
+		if origin != "" && !key.AllowsOrigin(origin) {
+			AppLogger.WarnContext(ctx, "Request from origin not allowed for API key rejected", "origin", origin)
+			h.sendErrorResponse(w, newAPIError(http.StatusForbidden, ErrCodeOriginNotAllowed, "API key is not allowed from origin "+origin))
+			return
+		}
+
+		if ok, wait := key.Allow(time.Now()); !ok {
+			AppLogger.WarnContext(ctx, "API key rate limit exceeded")
+			h.sendErrorResponse(w, rateLimitedError(w, wait))
+			return
+		}
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// rateLimitedError reports RATE_LIMITED, with the time to wait until the
+// next request in the Retry-After header
+func rateLimitedError(w http.ResponseWriter, wait time.Duration) *APIError {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return newAPIError(http.StatusTooManyRequests, ErrCodeRateLimited, "rate limit of API key exceeded, retry later")
+}
+
+// chargeBatchItem charges item n of a batch to the rate limit of the API key
+// of the request, if any, before the item is read. The first item is the
+// request itself, counted by requireAPIKey, so a batch costs one request per
+// item. Batches beyond the whole limit of the key are refused as too large,
+// since waiting would never let them through.
+func (h *OCRHandler) chargeBatchItem(w http.ResponseWriter, r *http.Request, n int) *APIError {
+	key, ok := auth.FromContext(r.Context())
+	if !ok || n <= 1 {
+		return nil
+	}
+	if limit := key.Limit(); limit > 0 && n > limit {
+		AppLogger.WarnContext(r.Context(), "Batch exceeds API key rate limit", "limit", limit)
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeBatchTooLarge,
+			fmt.Sprintf("batch exceeds the rate limit of %d requests of the API key", limit),
+			ErrorDetail{Field: "items", Reason: ReasonTooLarge})
+	}
+	if ok, wait := key.Allow(time.Now()); !ok {
+		AppLogger.WarnContext(r.Context(), "API key rate limit exceeded by batch", "items", n)
+		return rateLimitedError(w, wait)
+	}
+	return nil
+}
+
+// apiKeyOf returns the API key sent with a request
+func apiKeyOf(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// setAllowedOrigin lets browsers of origin read the response
+func setAllowedOrigin(w http.ResponseWriter, origin string) {
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+}
+
+// authorizeDocumentType checks that the API key of the request of ctx, if
+// any, may process a document type. Automatic detection is allowed to every
+// key; its result is checked once the document type is known.
+func authorizeDocumentType(ctx context.Context, documentType string) error {
+	key, ok := auth.FromContext(ctx)
+	if !ok || documentType == DocumentTypeAuto || key.AllowsDocumentType(documentType) {
+		return nil
+	}
+	return newAPIError(http.StatusForbidden, ErrCodeDocumentTypeNotAllowed, "API key is not allowed to process document type "+documentType,
+		ErrorDetail{Field: "documentType", Reason: ReasonForbidden})
+}
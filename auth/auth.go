@@ -0,0 +1,226 @@
+// Package auth authenticates API keys configured in a file. Each key names
+// the document types it may process, the browser origins it may be used
+// from and the rate its requests are limited to. Only hashes of the keys are
+// stored, and the file can be reloaded while the server runs.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HashPrefix starts every secret hash of the keys file
+const HashPrefix = "sha256:"
+
+// Wildcard allows every origin when listed in the origins of a key
+const Wildcard = "*"
+
+// Key is an API key of the keys file
+type Key struct {
+	ID            string   `json:"id"`                      // Name of the key in logs and job records
+	SecretHash    string   `json:"secretHash"`              // HashSecret of the key
+	DocumentTypes []string `json:"documentTypes,omitempty"` // Document types the key may process; all when empty
+	Origins       []string `json:"origins,omitempty"`       // Browser origins the key may be used from; none when empty
+	RateLimit     string   `json:"rateLimit,omitempty"`     // Requests per period, such as "60/m"; unlimited when empty
+	Redact        string   `json:"redact,omitempty"`        // Redaction policy of the responses to the key
+
+	limiter *limiter
+}
+
+// AllowsDocumentType reports whether the key may process a document type
+func (k *Key) AllowsDocumentType(documentType string) bool {
+	return len(k.DocumentTypes) == 0 || contains(k.DocumentTypes, documentType)
+}
+
+// AllowsOrigin reports whether the key may be used from a browser origin
+func (k *Key) AllowsOrigin(origin string) bool {
+	return contains(k.Origins, Wildcard) || contains(k.Origins, origin)
+}
+
+// Allow takes a request from the rate limit of the key. When the limit is
+// reached, it returns false and how long the client should wait.
+func (k *Key) Allow(now time.Time) (bool, time.Duration) {
+	if k.limiter == nil {
+		return true, 0
+	}
+	return k.limiter.allow(now)
+}
+
+// Limit returns the number of requests the key may make at once, or 0
+// without a rate limit. Larger batches are never allowed.
+func (k *Key) Limit() int {
+	if k.limiter == nil {
+		return 0
+	}
+	return int(k.limiter.capacity)
+}
+
+// keysFile is the format of the keys file
+type keysFile struct {
+	Keys []*Key `json:"keys"`
+}
+
+// Keys holds the API keys of a keys file
+type Keys struct {
+	path     string
+	validate func(*Key) error
+
+	mu       sync.RWMutex
+	bySecret map[string]*Key // By hex encoded secret hash
+	byID     map[string]*Key
+}
+
+// Load reads the keys file at path. validate checks the settings the package
+// does not know about, such as document types and redaction policies.
+func Load(path string, validate func(*Key) error) (*Keys, error) {
+	k := &Keys{path: path, validate: validate}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keys file again. The keys are only replaced when the
+// whole file is valid. Keys that keep their ID and rate limit keep the
+// requests they have used up, so that reloading does not reset limits.
+func (k *Keys) Reload() error {
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read keys file: %w", err)
+	}
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse keys file: %w", err)
+	}
+
+	bySecret := make(map[string]*Key, len(file.Keys))
+	byID := make(map[string]*Key, len(file.Keys))
+	for i, key := range file.Keys {
+		if key == nil || key.ID == "" {
+			return fmt.Errorf("keys[%d]: id is required", i)
+		}
+		if byID[key.ID] != nil {
+			return fmt.Errorf("key %s: duplicate id", key.ID)
+		}
+		secret, err := parseSecretHash(key.SecretHash)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key.ID, err)
+		}
+		if bySecret[secret] != nil {
+			return fmt.Errorf("key %s: same secret as key %s", key.ID, bySecret[secret].ID)
+		}
+		if key.RateLimit != "" {
+			if key.limiter, err = parseRateLimit(key.RateLimit); err != nil {
+				return fmt.Errorf("key %s: %w", key.ID, err)
+			}
+		}
+		if k.validate != nil {
+			if err := k.validate(key); err != nil {
+				return fmt.Errorf("key %s: %w", key.ID, err)
+			}
+		}
+		bySecret[secret] = key
+		byID[key.ID] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for id, key := range byID {
+		if previous := k.byID[id]; previous != nil && previous.RateLimit == key.RateLimit {
+			key.limiter = previous.limiter
+		}
+	}
+	k.bySecret, k.byID = bySecret, byID
+	return nil
+}
+
+// Len returns the number of keys
+func (k *Keys) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.byID)
+}
+
+// Authenticate returns the key a client sent, if it is configured
+func (k *Keys) Authenticate(secret string) (*Key, bool) {
+	if secret == "" {
+		return nil, false
+	}
+	sum := sha256.Sum256([]byte(secret))
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.bySecret[hex.EncodeToString(sum[:])]
+	return key, ok
+}
+
+// Get returns the key with the given ID, if it is still configured
+func (k *Keys) Get(id string) (*Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.byID[id]
+	return key, ok
+}
+
+// AllowsOrigin reports whether any key may be used from a browser origin.
+// Preflight requests carry no key, so they are answered for these origins.
+func (k *Keys) AllowsOrigin(origin string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.byID {
+		if key.AllowsOrigin(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// HashSecret returns the secret hash of a key, as written in the keys file
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return HashPrefix + hex.EncodeToString(sum[:])
+}
+
+// parseSecretHash returns the hex digits of a secret hash of the keys file
+func parseSecretHash(hash string) (string, error) {
+	digits, ok := strings.CutPrefix(hash, HashPrefix)
+	if !ok {
+		return "", fmt.Errorf("secretHash must start with %q", HashPrefix)
+	}
+	if decoded, err := hex.DecodeString(digits); err != nil || len(decoded) != sha256.Size {
+		return "", errors.New("secretHash must be a hex encoded SHA-256 hash")
+	}
+	return strings.ToLower(digits), nil
+}
+
+// contains reports whether list contains value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// keyKey is the context key of the key of a request
+type keyKey struct{}
+
+// WithKey returns a context carrying the key a request was authenticated with
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, keyKey{}, key)
+}
+
+// FromContext returns the key of the request of ctx, if it was authenticated
+func FromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(keyKey{}).(*Key)
+	return key, ok
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeKeys writes a keys file with the given content
+func writeKeys(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+}
+
+// TestKeys tests authentication, permissions and reloading of a keys file
+func TestKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys(t, path, `{"keys": [
+		{"id": "partner", "secretHash": "`+HashSecret("partner-secret")+`", "documentTypes": ["passport"], "origins": ["https://partner.example"], "rateLimit": "2/m"},
+		{"id": "internal", "secretHash": "`+strings.ToUpper(HashSecret("internal-secret")[len(HashPrefix):])+`"}
+	]}`)
+	if _, err := Load(path, nil); err == nil || !strings.Contains(err.Error(), "internal") {
+		t.Fatalf("Expected error for secret hash without prefix, got %v", err)
+	}
+
+	writeKeys(t, path, `{"keys": [
+		{"id": "partner", "secretHash": "`+HashSecret("partner-secret")+`", "documentTypes": ["passport"], "origins": ["https://partner.example"], "rateLimit": "2/m"},
+		{"id": "internal", "secretHash": "`+HashSecret("internal-secret")+`", "origins": ["*"]}
+	]}`)
+	keys, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+
+	partner, ok := keys.Authenticate("partner-secret")
+	if !ok || partner.ID != "partner" {
+		t.Fatalf("Expected partner key, got %+v", partner)
+	}
+	if _, ok := keys.Authenticate("partner-secret "); ok {
+		t.Error("Expected unknown secret to be rejected")
+	}
+	if !partner.AllowsDocumentType("passport") || partner.AllowsDocumentType("individual_number_card_jp") {
+		t.Error("Expected partner key to allow passports only")
+	}
+	if !partner.AllowsOrigin("https://partner.example") || partner.AllowsOrigin("https://other.example") {
+		t.Error("Expected partner key to allow its own origin only")
+	}
+	internal, _ := keys.Get("internal")
+	if !internal.AllowsDocumentType("individual_number_card_jp") || !internal.AllowsOrigin("https://other.example") {
+		t.Error("Expected internal key to allow every document type and origin")
+	}
+
+	// Reloading keeps the used up requests, and a failed reload keeps the keys
+	now := time.Now()
+	partner.Allow(now)
+	partner.Allow(now)
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Failed to reload keys: %v", err)
+	}
+	partner, _ = keys.Authenticate("partner-secret")
+	if ok, _ := partner.Allow(now); ok {
+		t.Error("Expected rate limit to survive reload")
+	}
+
+	writeKeys(t, path, `{"keys": [{"id": "partner", "secretHash": "sha256:00"}]}`)
+	if err := keys.Reload(); err == nil {
+		t.Error("Expected error for invalid secret hash")
+	}
+	if _, ok := keys.Authenticate("internal-secret"); !ok || keys.Len() != 2 {
+		t.Error("Expected failed reload to keep the previous keys")
+	}
+}
+
+// TestLoadValidate tests that keys are checked with the validate function
+func TestLoadValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys(t, path, `{"keys": [{"id": "partner", "secretHash": "`+HashSecret("secret")+`", "documentTypes": ["unknown"]}]}`)
+
+	invalid := errors.New("unknown document type")
+	if _, err := Load(path, func(*Key) error { return invalid }); !errors.Is(err, invalid) {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	for _, content := range []string{
+		`{"keys": [{"secretHash": "` + HashSecret("secret") + `"}]}`,
+		`{"keys": [{"id": "a", "secretHash": "` + HashSecret("secret") + `"}, {"id": "b", "secretHash": "` + HashSecret("secret") + `"}]}`,
+		`{"keys": [{"id": "a", "secretHash": "` + HashSecret("a") + `"}, {"id": "a", "secretHash": "` + HashSecret("b") + `"}]}`,
+		`{"keys": [{"id": "a", "secretHash": "` + HashSecret("a") + `", "rateLimit": "10/d"}]}`,
+	} {
+		writeKeys(t, path, content)
+		if _, err := Load(path, nil); err == nil {
+			t.Errorf("Expected error for keys file %s", content)
+		}
+	}
+}
+
+// TestLimiter tests that requests are limited and regained over time
+func TestLimiter(t *testing.T) {
+	l, err := parseRateLimit("2/s")
+	if err != nil {
+		t.Fatalf("Failed to parse rate limit: %v", err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow(now); !ok {
+			t.Fatalf("Expected request %d within the limit", i+1)
+		}
+	}
+	ok, wait := l.allow(now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("Expected limit with 500ms wait, got %v %v", ok, wait)
+	}
+	if ok, _ := l.allow(now.Add(500 * time.Millisecond)); !ok {
+		t.Error("Expected a request to be regained after 500ms")
+	}
+}
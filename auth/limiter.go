@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ratePeriods are the periods a rate limit can be given per
+var ratePeriods = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// limiter is a token bucket that holds up to the requests of one period and
+// refills continuously, so that a client can burst up to its limit
+type limiter struct {
+	mu       sync.Mutex
+	capacity float64
+	interval time.Duration // Time to regain one request
+	tokens   float64
+	last     time.Time
+}
+
+// parseRateLimit parses a rate limit such as "60/m" into a limiter
+func parseRateLimit(spec string) (*limiter, error) {
+	count, unit, ok := strings.Cut(spec, "/")
+	requests, err := strconv.Atoi(count)
+	period, known := ratePeriods[unit]
+	if !ok || err != nil || requests <= 0 || !known {
+		return nil, fmt.Errorf("invalid rateLimit %q: expected <requests>/<s|m|h>", spec)
+	}
+	return &limiter{
+		capacity: float64(requests),
+		interval: period / time.Duration(requests),
+		tokens:   float64(requests),
+	}, nil
+}
+
+// allow takes a token, or returns how long it takes until one is available
+func (l *limiter) allow(now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens = min(l.capacity, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) * float64(l.interval))
+	}
+	l.tokens--
+	return true, 0
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// contentTypeNDJSON streams one JSON document per line
+const contentTypeNDJSON = "application/x-ndjson"
+
+// HandleBatch processes several OCR requests with bounded concurrency. The
+// results are returned in item order, or streamed as NDJSON in the order
+// they complete when the client accepts application/x-ndjson.
+func (h *OCRHandler) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
+		h.sendErrorResponse(w, methodNotAllowedError("POST"))
+		return
+	}
+
+	var req BatchRequest
+	admit := func(items int) *APIError { return h.chargeBatchItem(w, r, items) }
+	if apiErr := decodeBatchRequest(w, r, &req, admit); apiErr != nil {
+		AppLogger.WarnContext(r.Context(), "Failed to read batch request", "error", apiErr)
+		h.sendErrorResponse(w, apiErr)
+		return
+	}
+
+	// Allow the response format and the fields to redact to be selected with query parameters as well
+	if req.Format == "" {
+		req.Format = r.URL.Query().Get("format")
+	}
+	if req.Redact == "" {
+		req.Redact = r.URL.Query().Get("redact")
+	}
+
+	if err := req.Validate(); err != nil {
+		AppLogger.WarnContext(r.Context(), "Batch request validation failed", "error", err)
+		h.sendErrorResponse(w, toAPIError(err))
+		return
+	}
+
+	AppLogger.InfoContext(r.Context(), "Batch received", "items", len(req.Items))
+
+	if acceptsNDJSON(r) {
+		h.streamBatch(w, r, &req)
+		return
+	}
+
+	response := BatchResponse{Results: make([]BatchItemResult, len(req.Items))}
+	h.processBatch(r.Context(), &req, func(index int, result BatchItemResult) {
+		response.Results[index] = result
+	})
+
+	// Nobody is left to read the results of a cancelled batch
+	if r.Context().Err() != nil {
+		AppLogger.WarnContext(r.Context(), "Batch cancelled by client")
+		return
+	}
+
+	for _, result := range response.Results {
+		if result.Error != nil {
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to encode batch response", "error", err)
+	}
+}
+
+// decodeBatchRequest decodes a batch body of at most maxBatchSize bytes one
+// item at a time. Before an item is read, admit is called with the number of
+// items so far including it, so that a batch beyond MaxBatchItems or the rate
+// limit of the client is refused without buffering the rest of the body.
+func decodeBatchRequest(w http.ResponseWriter, r *http.Request, req *BatchRequest, admit func(items int) *APIError) *APIError {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchSize)
+	if err := decodeBatch(json.NewDecoder(r.Body), req, admit); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			return apiErr
+		}
+		if tooLarge := requestTooLargeError(err, maxBatchSize); tooLarge != nil {
+			return tooLarge
+		}
+		return invalidJSONError(err)
+	}
+	return nil
+}
+
+// decodeBatch decodes the object of a batch request from dec. Keys match
+// case-insensitively and unknown keys are skipped, as with json.Unmarshal.
+func decodeBatch(dec *json.Decoder, req *BatchRequest, admit func(items int) *APIError) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch key, _ := token.(string); {
+		case strings.EqualFold(key, "items"):
+			err = decodeBatchItems(dec, req, admit)
+		case strings.EqualFold(key, "format"):
+			err = dec.Decode(&req.Format)
+		case strings.EqualFold(key, "redact"):
+			err = dec.Decode(&req.Redact)
+		default:
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// decodeBatchItems decodes the items array of a batch request, or null
+func decodeBatchItems(dec *json.Decoder, req *BatchRequest, admit func(items int) *APIError) error {
+	token, err := dec.Token()
+	if err != nil || token == nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("items must be an array, got %v", token)
+	}
+
+	for dec.More() {
+		if len(req.Items) == MaxBatchItems {
+			return batchTooLargeError()
+		}
+		if apiErr := admit(len(req.Items) + 1); apiErr != nil {
+			return apiErr
+		}
+		var item BatchItem
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		req.Items = append(req.Items, item)
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token of dec, which must be delim
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+// streamBatch writes each item result as a line of NDJSON as soon as it is done
+func (h *OCRHandler) streamBatch(w http.ResponseWriter, r *http.Request, req *BatchRequest) {
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	h.processBatch(r.Context(), req, func(_ int, result BatchItemResult) {
+		if err := encoder.Encode(result); err != nil {
+			AppLogger.ErrorContext(r.Context(), "Failed to stream batch result", "error", err)
+			return
+		}
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			AppLogger.ErrorContext(r.Context(), "Failed to flush batch result", "error", err)
+		}
+	})
+}
+
+// acceptsNDJSON reports whether the client asked for results as NDJSON
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			if mediaType, _, err := mime.ParseMediaType(mediaRange); err == nil && mediaType == contentTypeNDJSON {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// processBatch processes the items of a batch with at most batchConcurrency
+// items at a time and hands each result to done. Calls to done are
+// serialized, so done does not need to be safe for concurrent use.
+func (h *OCRHandler) processBatch(ctx context.Context, req *BatchRequest, done func(index int, result BatchItemResult)) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, h.batchConcurrency)
+	)
+
+	for i := range req.Items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(index int, item *BatchItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := h.processBatchItem(ctx, item, req.Format, req.Redact)
+
+			mu.Lock()
+			defer mu.Unlock()
+			done(index, result)
+		}(i, &req.Items[i])
+	}
+	wg.Wait()
+}
+
+// processBatchItem validates and processes a single batch item. Every item
+// gets the same 30-second timeout as a request to /ocr. Items without a
+// format or fields to redact take those of the batch.
+func (h *OCRHandler) processBatchItem(ctx context.Context, item *BatchItem, format, redact string) BatchItemResult {
+	if item.Format == "" {
+		item.Format = format
+	}
+	if item.Redact == "" {
+		item.Redact = redact
+	}
+
+	if err := item.Validate(); err != nil {
+		apiErr := toAPIError(err)
+		AppLogger.WarnContext(ctx, "Batch item validation failed", "item_id", item.ID, "code", apiErr.Code, "error", err)
+		recordRequest(endpointBatch, item.DocumentType, apiErr.Status)
+		return BatchItemResult{ID: item.ID, Error: apiErr}
+	}
+
+	defer trackInFlight(endpointBatch)()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	response, err := h.processOCRRequestWithTimeout(ctx, &item.OCRRequest)
+	if err != nil {
+		apiErr := processingError(ctx, err, 30*time.Second)
+		AppLogger.ErrorContext(ctx, "OCR processing error for batch item", "item_id", item.ID, "document_type", item.DocumentType, "code", apiErr.Code, "error", err)
+		recordRequest(endpointBatch, item.DocumentType, apiErr.Status)
+		return BatchItemResult{ID: item.ID, Error: apiErr}
+	}
+
+	recordRequest(endpointBatch, item.DocumentType, http.StatusOK)
+	return BatchItemResult{ID: item.ID, Result: response}
+}
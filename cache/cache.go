@@ -0,0 +1,98 @@
+// Package cache stores OCR results by the content of the request, so that
+// identical requests are answered without processing the image again.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"sync/atomic"
+)
+
+// ErrMiss is returned by Get for keys that are not cached or have expired
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores values under content-derived keys. Entries expire after the
+// TTL of the cache and may be evicted earlier to respect its size limit.
+type Cache interface {
+	// Get returns the value stored under key, or ErrMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores value under key, replacing any previous value
+	Set(ctx context.Context, key string, value []byte) error
+
+	// Stats returns the hit and size counters of the cache
+	Stats() Stats
+}
+
+// Stats describes the use of a cache
+type Stats struct {
+	Backend   string `json:"backend"`   // "memory" or "disk"
+	Hits      uint64 `json:"hits"`      // Get calls that found a value
+	Misses    uint64 `json:"misses"`    // Get calls that did not
+	Evictions uint64 `json:"evictions"` // Entries removed to respect the size limit
+	Entries   int    `json:"entries"`   // Entries currently stored
+	Bytes     int64  `json:"bytes"`     // Size of the stored values
+}
+
+// Key returns the cache key for a request. Every part is hashed with its
+// length, so different splits of the same bytes give different keys. The
+// version should change whenever processing may give different results for
+// the same input, e.g. when the pipeline or the parsers change.
+func Key(version string, parts ...[]byte) string {
+	h := sha256.New()
+	writePart(h, []byte(version))
+	for _, part := range parts {
+		writePart(h, part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writePart writes a length-prefixed part to h
+func writePart(h hash.Hash, part []byte) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(part)))
+	h.Write(length[:])
+	h.Write(part)
+}
+
+// validKey reports whether key has the form returned by Key. Backends that
+// use keys as file names refuse anything else.
+func validKey(key string) bool {
+	if len(key) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// counters keeps the hit, miss and eviction counts of a backend
+type counters struct {
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// record counts the result of a Get call
+func (c *counters) record(err error) {
+	if err == nil {
+		c.hits.Add(1)
+	} else if errors.Is(err, ErrMiss) {
+		c.misses.Add(1)
+	}
+}
+
+// stats returns the counters as Stats of the given backend
+func (c *counters) stats(backend string, entries int, bytes int64) Stats {
+	return Stats{
+		Backend:   backend,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Bytes:     bytes,
+	}
+}
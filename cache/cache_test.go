@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testClock is a settable clock for expiry tests
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+// TestCaches runs the same checks against every cache backend
+func TestCaches(t *testing.T) {
+	caches := map[string]func(t *testing.T, clock *testClock) Cache{
+		"memory": func(t *testing.T, clock *testClock) Cache {
+			c := NewMemory(time.Minute, 2, 10)
+			c.now = clock.Now
+			return c
+		},
+		"disk": func(t *testing.T, clock *testClock) Cache {
+			c, err := NewDisk(t.TempDir(), "secret", time.Minute, 2, 10)
+			if err != nil {
+				t.Fatalf("Failed to open disk cache: %v", err)
+			}
+			c.now = clock.Now
+			return c
+		},
+	}
+
+	for name, newCache := range caches {
+		newCache := newCache
+		t.Run(name, func(t *testing.T) {
+			clock := &testClock{now: time.Now()}
+			testCache(t, newCache(t, clock), clock)
+		})
+	}
+}
+
+// testCache tests hits, expiry and eviction of a cache whose entries live
+// for a minute and which holds at most 2 entries and 10 bytes
+func testCache(t *testing.T, c Cache, clock *testClock) {
+	ctx := context.Background()
+	a, b, d := Key("v1", []byte("a")), Key("v1", []byte("b")), Key("v1", []byte("d"))
+
+	if _, err := c.Get(ctx, a); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Expected miss on empty cache, got %v", err)
+	}
+	if err := c.Set(ctx, a, []byte("aaa")); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+	if value, err := c.Get(ctx, a); err != nil || string(value) != "aaa" {
+		t.Fatalf("Expected cached value, got %q (%v)", value, err)
+	}
+
+	// Using a makes b the least recently used entry, evicted for d
+	c.Set(ctx, b, []byte("bbb"))
+	c.Get(ctx, a)
+	c.Set(ctx, d, []byte("ddd"))
+	if _, err := c.Get(ctx, b); !errors.Is(err, ErrMiss) {
+		t.Errorf("Expected least recently used entry to be evicted, got %v", err)
+	}
+
+	// Exceeding the byte limit evicts as well, and values larger than the
+	// cache are not stored at all
+	c.Set(ctx, a, []byte("aaaaaaaa"))
+	if _, err := c.Get(ctx, d); !errors.Is(err, ErrMiss) {
+		t.Errorf("Expected entry beyond the byte limit to be evicted, got %v", err)
+	}
+	c.Set(ctx, b, []byte("bbbbbbbbbbbb"))
+	if _, err := c.Get(ctx, b); !errors.Is(err, ErrMiss) {
+		t.Errorf("Expected oversized value not to be stored, got %v", err)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 4 || stats.Evictions != 2 || stats.Entries != 1 || stats.Bytes != 8 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if _, err := c.Get(ctx, a); !errors.Is(err, ErrMiss) {
+		t.Errorf("Expected expired entry to miss, got %v", err)
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Expected expired entry to be removed, got %+v", stats)
+	}
+}
+
+// TestKey tests that keys depend on every part and on how the parts are split
+func TestKey(t *testing.T) {
+	key := Key("v1", []byte("ab"), []byte("c"))
+	if !validKey(key) {
+		t.Fatalf("Expected a valid key, got %q", key)
+	}
+	if key != Key("v1", []byte("ab"), []byte("c")) {
+		t.Error("Expected equal requests to give equal keys")
+	}
+	for _, other := range []string{
+		Key("v2", []byte("ab"), []byte("c")),
+		Key("v1", []byte("a"), []byte("bc")),
+		Key("v1", []byte("ab"), []byte("c"), nil),
+	} {
+		if other == key {
+			t.Errorf("Expected different requests to give different keys, got %q twice", key)
+		}
+	}
+}
+
+// TestDiskReopen tests that a disk cache keeps its entries across restarts
+// and refuses keys that are not hashes
+func TestDiskReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	key := Key("v1", []byte("image"))
+
+	c, err := NewDisk(dir, "secret", time.Hour, 10, 1024)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	if err := c.Set(ctx, key, []byte(`{"documentType":"passport"}`)); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+	if err := c.Set(ctx, "../escape", []byte("x")); err == nil {
+		t.Error("Expected invalid key to be refused")
+	}
+	os.WriteFile(filepath.Join(dir, "stray.tmp123"), []byte("partial"), 0o600)
+
+	c, err = NewDisk(dir, "secret", time.Hour, 10, 1024)
+	if err != nil {
+		t.Fatalf("Failed to reopen disk cache: %v", err)
+	}
+	if value, err := c.Get(ctx, key); err != nil || string(value) != `{"documentType":"passport"}` {
+		t.Errorf("Expected value to survive reopening, got %q (%v)", value, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stray.tmp123")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected leftover files to be removed, got %v", err)
+	}
+}
+
+// TestDiskEncryption tests that cache files do not hold the plaintext value
+// and that entries written with another key are dropped as misses
+func TestDiskEncryption(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	key := Key("v1", []byte("image"))
+	value := []byte(`{"individualNumber":"123456789012"}`)
+
+	if _, err := NewDisk(dir, "", time.Hour, 10, 1024); err == nil {
+		t.Error("Expected disk cache without a key to be refused")
+	}
+
+	c, err := NewDisk(dir, "secret", time.Hour, 10, 1024)
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	if err := c.Set(ctx, key, value); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		t.Fatalf("Failed to read cache file: %v", err)
+	}
+	if bytes.Contains(data, []byte("123456789012")) {
+		t.Error("Expected cache file to be encrypted")
+	}
+	if stats := c.Stats(); stats.Bytes != int64(len(value)) {
+		t.Errorf("Expected size of the value, got %d", stats.Bytes)
+	}
+
+	c, err = NewDisk(dir, "other", time.Hour, 10, 1024)
+	if err != nil {
+		t.Fatalf("Failed to reopen disk cache: %v", err)
+	}
+	if stats := c.Stats(); stats.Bytes != int64(len(value)) {
+		t.Errorf("Expected reopened size of the value, got %d", stats.Bytes)
+	}
+	if _, err := c.Get(ctx, key); !errors.Is(err, ErrMiss) {
+		t.Errorf("Expected miss with another key, got %v", err)
+	}
+	if _, err := os.Stat(c.path(key)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected unreadable file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"ocr-web-api/seal"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskFileExt is the file name extension of cached values
+const diskFileExt = ".cache"
+
+// Disk is an LRU cache that keeps each value in a file, so that entries
+// survive restarts. Files are replaced atomically. The index of entries is
+// kept in memory; on open it is rebuilt from the directory, with the
+// modification time of a file as its write and last use time.
+//
+// Values hold personal data, so files are encrypted with AES-256-GCM and
+// bound to their key. Files that cannot be decrypted, e.g. after the
+// encryption key changed, are treated as misses and removed.
+type Disk struct {
+	dir        string
+	box        *seal.Box
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int64
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // Front is the most recently used entry
+	bytes   int64
+	counters
+}
+
+// diskEntry is the index entry of a cached file
+type diskEntry struct {
+	key     string
+	size    int64
+	expires time.Time
+}
+
+// Ensure Disk satisfies the Cache interface
+var _ Cache = (*Disk)(nil)
+
+// NewDisk opens a disk cache in dir, creating the directory if needed.
+// Files are encrypted with a key derived from secret, which must not be empty.
+// Entries live for ttl, and the least recently used entries are evicted
+// once there are more than maxEntries entries or their values exceed maxBytes.
+func NewDisk(dir, secret string, ttl time.Duration, maxEntries int, maxBytes int64) (*Disk, error) {
+	box, err := seal.New(secret)
+	if err != nil {
+		return nil, fmt.Errorf("disk cache: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &Disk{
+		dir:        dir,
+		box:        box,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load rebuilds the index from the directory, dropping expired entries and
+// leftovers of interrupted writes
+func (c *Disk) load() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list cache directory: %w", err)
+	}
+
+	type file struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var found []file
+	for _, entry := range files {
+		key, ok := strings.CutSuffix(entry.Name(), diskFileExt)
+		info, err := entry.Info()
+		if !ok || !validKey(key) || err != nil || !c.now().Before(info.ModTime().Add(c.ttl)) {
+			os.Remove(filepath.Join(c.dir, entry.Name()))
+			continue
+		}
+		// Sizes count values, without the nonce and tag of the encryption
+		size := max(info.Size()-int64(c.box.Overhead()), 0)
+		found = append(found, file{key: key, size: size, modTime: info.ModTime()})
+	}
+
+	// Oldest first, so the newest files end up at the front
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+	for _, f := range found {
+		c.add(f.key, f.size, f.modTime.Add(c.ttl))
+	}
+	return c.evict()
+}
+
+// Get returns the value stored under key and marks it as recently used
+func (c *Disk) Get(_ context.Context, key string) ([]byte, error) {
+	value, err := c.get(key)
+	c.record(err)
+	return value, err
+}
+
+func (c *Disk) get(key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrMiss
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	if !c.now().Before(element.Value.(*diskEntry).expires) {
+		return nil, errors.Join(ErrMiss, c.remove(element))
+	}
+
+	sealed, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		c.remove(element)
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	value, err := c.box.Open(key, sealed)
+	if err != nil {
+		return nil, errors.Join(ErrMiss, err, c.remove(element))
+	}
+	c.lru.MoveToFront(element)
+	return value, nil
+}
+
+// Set stores value under key and evicts the least recently used entries
+// beyond the size limits. Values larger than the whole cache are not stored.
+func (c *Disk) Set(_ context.Context, key string, value []byte) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+	if int64(len(value)) > c.maxBytes {
+		return nil
+	}
+
+	sealed, err := c.box.Seal(key, value)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.writeFile(key, sealed); err != nil {
+		return err
+	}
+	if element, ok := c.entries[key]; ok {
+		c.bytes -= element.Value.(*diskEntry).size
+		c.lru.Remove(element)
+		delete(c.entries, key)
+	}
+	c.add(key, int64(len(value)), c.now().Add(c.ttl))
+	return c.evict()
+}
+
+// add puts an entry at the front of the index; the caller holds c.mu
+func (c *Disk) add(key string, size int64, expires time.Time) {
+	c.entries[key] = c.lru.PushFront(&diskEntry{key: key, size: size, expires: expires})
+	c.bytes += size
+}
+
+// evict removes the least recently used entries beyond the size limits;
+// the caller holds c.mu
+func (c *Disk) evict() error {
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		if err := c.remove(c.lru.Back()); err != nil {
+			return err
+		}
+		c.evictions.Add(1)
+	}
+	return nil
+}
+
+// remove deletes an entry and its file; the caller holds c.mu
+func (c *Disk) remove(element *list.Element) error {
+	entry := c.lru.Remove(element).(*diskEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+	if err := os.Remove(c.path(entry.key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove cache file: %w", err)
+	}
+	return nil
+}
+
+// path returns the file of a key
+func (c *Disk) path(key string) string {
+	return filepath.Join(c.dir, key+diskFileExt)
+}
+
+// writeFile replaces the file of a key by renaming a fully written temporary file over it
+func (c *Disk) writeFile(key string, value []byte) error {
+	tmp, err := os.CreateTemp(c.dir, key+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// Stats returns the hit and size counters of the cache
+func (c *Disk) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats("disk", c.lru.Len(), c.bytes)
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory LRU cache. Entries are lost when the server stops.
+type Memory struct {
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int64
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // Front is the most recently used entry
+	bytes   int64
+	counters
+}
+
+// memoryEntry is a cached value with its expiry time
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Ensure Memory satisfies the Cache interface
+var _ Cache = (*Memory)(nil)
+
+// NewMemory creates an LRU cache whose entries live for ttl. The least
+// recently used entries are evicted once there are more than maxEntries
+// entries or their values exceed maxBytes.
+func NewMemory(ttl time.Duration, maxEntries int, maxBytes int64) *Memory {
+	return &Memory{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get returns the value stored under key and marks it as recently used
+func (c *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	value, err := c.get(key)
+	c.record(err)
+	return value, err
+}
+
+func (c *Memory) get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	entry := element.Value.(*memoryEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil, ErrMiss
+	}
+	c.lru.MoveToFront(element)
+	return entry.value, nil
+}
+
+// Set stores value under key and evicts the least recently used entries
+// beyond the size limits. Values larger than the whole cache are not stored.
+func (c *Memory) Set(_ context.Context, key string, value []byte) error {
+	if int64(len(value)) > c.maxBytes {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key: key, value: value, expires: c.now().Add(c.ttl)})
+	c.bytes += int64(len(value))
+
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions.Add(1)
+	}
+	return nil
+}
+
+// remove deletes an entry; the caller holds c.mu
+func (c *Memory) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*memoryEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.value))
+}
+
+// Stats returns the hit and size counters of the cache
+func (c *Memory) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats("memory", c.lru.Len(), c.bytes)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+	"ocr-web-api/parser"
+	"time"
+)
+
+// Machine-readable error codes returned in error.code. Codes are stable;
+// messages may change and are meant for humans.
+const (
+	ErrCodeInvalidRequest           = "INVALID_REQUEST"
+	ErrCodeMethodNotAllowed         = "METHOD_NOT_ALLOWED"
+	ErrCodeUnauthorized             = "UNAUTHORIZED"
+	ErrCodeOriginNotAllowed         = "ORIGIN_NOT_ALLOWED"
+	ErrCodeDocumentTypeNotAllowed   = "DOCUMENT_TYPE_NOT_ALLOWED"
+	ErrCodeRateLimited              = "RATE_LIMITED"
+	ErrCodeUnsupportedMediaType     = "UNSUPPORTED_MEDIA_TYPE"
+	ErrCodeRequestTooLarge          = "REQUEST_TOO_LARGE"
+	ErrCodeRequiredFieldMissing     = "REQUIRED_FIELD_MISSING"
+	ErrCodeInvalidField             = "INVALID_FIELD"
+	ErrCodeInvalidBase64            = "INVALID_BASE64"
+	ErrCodeUnsupportedDocumentType  = "UNSUPPORTED_DOCUMENT_TYPE"
+	ErrCodeUnsupportedFormat        = "UNSUPPORTED_RESPONSE_FORMAT"
+	ErrCodeUnsupportedImageFormat   = "UNSUPPORTED_IMAGE_FORMAT"
+	ErrCodeImageTooLarge            = "IMAGE_TOO_LARGE"
+	ErrCodeInvalidImage             = "INVALID_IMAGE"
+	ErrCodeBatchTooLarge            = "BATCH_TOO_LARGE"
+	ErrCodeBackImageUnsupported     = "BACK_IMAGE_UNSUPPORTED"
+	ErrCodeCallbacksDisabled        = "CALLBACKS_DISABLED"
+	ErrCodeJobNotFound              = "JOB_NOT_FOUND"
+	ErrCodeQueueFull                = "QUEUE_FULL"
+	ErrCodeProcessingTimeout        = "PROCESSING_TIMEOUT"
+	ErrCodeCardNotDetected          = "CARD_NOT_DETECTED"
+	ErrCodeDocumentTypeUndetermined = "DOCUMENT_TYPE_UNDETERMINED"
+	ErrCodeNoTextDetected           = "NO_TEXT_DETECTED"
+	ErrCodeMRZNotFound              = "MRZ_NOT_FOUND"
+	ErrCodeOCRBusy                  = "OCR_BUSY"
+	ErrCodeOCREngineFailure         = "OCR_ENGINE_FAILURE"
+	ErrCodeInternal                 = "INTERNAL_ERROR"
+)
+
+// Reasons given in error details
+const (
+	ReasonMissing     = "missing"
+	ReasonInvalid     = "invalid"
+	ReasonUnsupported = "unsupported"
+	ReasonTooLarge    = "too_large"
+	ReasonDuplicate   = "duplicate"
+	ReasonForbidden   = "forbidden"
+)
+
+// newAPIError creates an API error with the given status, code and message
+func newAPIError(status int, code, message string, details ...ErrorDetail) *APIError {
+	return &APIError{Code: code, Status: status, Message: message, Details: details}
+}
+
+// requiredFieldError reports a request field that is missing
+func requiredFieldError(field string) *APIError {
+	return newAPIError(http.StatusBadRequest, ErrCodeRequiredFieldMissing, field+" field is required",
+		ErrorDetail{Field: field, Reason: ReasonMissing})
+}
+
+// invalidJSONError reports a request body that is not valid JSON
+func invalidJSONError(err error) *APIError {
+	return newAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON format: "+err.Error())
+}
+
+// methodNotAllowedError reports a request with a method the endpoint does not accept
+func methodNotAllowedError(allowed string) *APIError {
+	return newAPIError(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed. Use "+allowed+".")
+}
+
+// processingError converts an error of processOCRRequest into the error sent
+// to the client. timeout is the processing time limit that applied.
+func processingError(ctx context.Context, err error, timeout time.Duration) *APIError {
+	if ctx.Err() == context.DeadlineExceeded {
+		return newAPIError(http.StatusRequestTimeout, ErrCodeProcessingTimeout,
+			fmt.Sprintf("Request timeout: processing exceeded %d seconds", int(timeout.Seconds())))
+	}
+	return toAPIError(err)
+}
+
+// toAPIError converts an error into the error sent to the client. Only
+// messages written for clients are passed on; errors that may carry file
+// paths or command output are replaced by a generic message for their kind.
+func toAPIError(err error) *APIError {
+	var (
+		apiErr      *APIError
+		fieldErr    *parser.FieldError
+		unsupported *parser.UnsupportedDocumentTypeError
+	)
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, imageprocessor.ErrCardNotDetected):
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeCardNotDetected, cardNotDetectedMessage)
+	case errors.Is(err, imageprocessor.ErrInvalidBase64):
+		return newAPIError(http.StatusBadRequest, ErrCodeInvalidBase64, "invalid base64 encoding")
+	case errors.Is(err, imageprocessor.ErrInvalidImage):
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeInvalidImage, "image could not be decoded as PNG or JPEG")
+	case errors.Is(err, errDocumentTypeUndetermined):
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeDocumentTypeUndetermined, errDocumentTypeUndetermined.Error())
+	case errors.As(err, &unsupported):
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeUnsupportedDocumentType, unsupported.Error(),
+			ErrorDetail{Field: "documentType", Reason: ReasonUnsupported})
+	case errors.As(err, &fieldErr):
+		return fieldError(fieldErr)
+	case errors.Is(err, parser.ErrMRZNotFound):
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeMRZNotFound, parser.ErrMRZNotFound.Error())
+	case errors.Is(err, ocr.ErrNoText):
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeNoTextDetected, ocr.ErrNoText.Error())
+	case errors.Is(err, ocr.ErrPoolSaturated):
+		return newAPIError(http.StatusTooManyRequests, ErrCodeOCRBusy, "OCR workers are busy, retry later")
+	case errors.Is(err, ocr.ErrEngineFailure):
+		return newAPIError(http.StatusInternalServerError, ErrCodeOCREngineFailure, "OCR engine failed to process the image")
+	default:
+		return newAPIError(http.StatusInternalServerError, ErrCodeInternal, "internal server error")
+	}
+}
+
+// fieldError reports document fields that could not be read or are invalid
+func fieldError(err *parser.FieldError) *APIError {
+	code, reason := ErrCodeInvalidField, ReasonInvalid
+	if errors.Is(err, parser.ErrRequiredFieldMissing) {
+		code, reason = ErrCodeRequiredFieldMissing, ReasonMissing
+	}
+
+	details := make([]ErrorDetail, len(err.Fields))
+	for i, field := range err.Fields {
+		details[i] = ErrorDetail{Field: field, Reason: reason}
+	}
+	return newAPIError(http.StatusUnprocessableEntity, code, err.Error(), details...)
+}
@@ -3,35 +3,146 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"ocr-web-api/auth"
+	"ocr-web-api/cache"
 	"ocr-web-api/imageprocessor"
+	"ocr-web-api/metrics"
+	"ocr-web-api/ocr"
 	"ocr-web-api/parser"
-	"strings"
+	"ocr-web-api/redact"
+	"os"
+	"runtime"
+	"strconv"
 	"time"
 )
 
 // OCRHandler handles OCR API requests
 type OCRHandler struct {
-	parserFactory  *parser.ParserFactory
-	imageProcessor *imageprocessor.ImageProcessor
+	parserFactory    *parser.ParserFactory
+	imageProcessor   *imageprocessor.ImageProcessor
+	ocrPool          *ocr.Pool         // Bounds the Tesseract processes of all requests
+	batchConcurrency int               // Number of batch items processed at once
+	resultCache      cache.Cache       // Responses by request content; nil when caching is off
+	cacheConfig      string            // Processing configuration that is part of every cache key
+	metrics          *metrics.Registry // Metrics of the pool and cache, written after the process-wide ones
+	redaction        redact.Policy     // Server redaction policy applied to every response
+	redactor         *redact.Redactor  // Applies redaction policies to responses
+	apiKeys          *auth.Keys        // API keys clients must send; nil when authentication is disabled
 }
 
 // NewOCRHandler creates a new OCR handler instance
 func NewOCRHandler() *OCRHandler {
-	return &OCRHandler{
-		parserFactory:  parser.NewParserFactory(),
-		imageProcessor: imageprocessor.NewImageProcessor(),
+	workers := getPositiveIntFromEnv("OCR_WORKERS", runtime.NumCPU())
+	queueSize := getPositiveIntFromEnv("OCR_QUEUE_SIZE", 4*workers)
+	pool := ocr.NewPool(getOCREngineFromEnv(), workers, queueSize)
+	AppLogger.Info("OCR worker pool configured", "workers", workers, "queue_size", queueSize)
+	pipeline := getPipelineFromEnv()
+	redaction, redactor, err := getRedactionFromEnv()
+	var apiKeys *auth.Keys
+	if err == nil {
+		apiKeys, err = getAPIKeysFromEnv(redactor)
 	}
+	if err != nil {
+		AppLogger.Error("Refusing to start with an invalid security configuration", "error", err)
+		os.Exit(1)
+	}
+
+	h := &OCRHandler{
+		parserFactory:    parser.NewParserFactory(timedEngine{engine: pool}),
+		imageProcessor:   imageprocessor.NewImageProcessorWithPipeline(pipeline),
+		ocrPool:          pool,
+		batchConcurrency: getPositiveIntFromEnv("BATCH_CONCURRENCY", runtime.NumCPU()),
+		resultCache:      getResultCacheFromEnv(),
+		cacheConfig:      resultCacheConfig(pipeline.String(), os.Getenv("OCR_ENGINE")),
+		redaction:        redaction,
+		redactor:         redactor,
+		apiKeys:          apiKeys,
+	}
+	h.metrics = newHandlerMetrics(h)
+	return h
+}
+
+// getPipelineFromEnv reads the preprocessing pipeline from the PREPROCESS_PIPELINE
+// environment variable, falling back to the default pipeline
+func getPipelineFromEnv() *imageprocessor.Pipeline {
+	spec := os.Getenv("PREPROCESS_PIPELINE")
+	if spec == "" {
+		return imageprocessor.DefaultPipeline()
+	}
+
+	pipeline, err := imageprocessor.ParsePipeline(spec)
+	if err != nil {
+		AppLogger.Warn("Invalid PREPROCESS_PIPELINE, using default pipeline", "value", spec, "error", err)
+		return imageprocessor.DefaultPipeline()
+	}
+
+	AppLogger.Info("Using preprocessing pipeline", "pipeline", pipeline.String())
+	return pipeline
+}
+
+// getOCREngineFromEnv creates the OCR engine selected by OCR_ENGINE, falling
+// back to the tesseract command when it is unknown or cannot be loaded
+func getOCREngineFromEnv() ocr.Engine {
+	kind := os.Getenv("OCR_ENGINE")
+	engine, err := ocr.NewEngine(kind)
+	if err != nil {
+		AppLogger.Warn("Invalid OCR_ENGINE, using "+ocr.EngineExec+" engine", "value", kind, "error", err)
+		return ocr.NewOCREngine()
+	}
+
+	if kind != "" {
+		AppLogger.Info("Using OCR engine", "engine", kind)
+	}
+	return engine
+}
+
+// getPositiveIntFromEnv reads a positive integer from an environment
+// variable, falling back to def when it is unset or invalid
+func getPositiveIntFromEnv(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		AppLogger.Warn("Invalid "+name+", using default", "value", value, "default", def)
+		return def
+	}
+	return n
+}
+
+// getDurationFromEnv reads a positive duration such as "90s" or "5m" from an
+// environment variable, falling back to def when it is unset or invalid
+func getDurationFromEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		AppLogger.Warn("Invalid "+name+", using default", "value", value, "default", def.String())
+		return def
+	}
+	return d
 }
 
+// ocrBusyRetryAfter is the Retry-After value, in seconds, sent when the OCR worker pool is saturated
+const ocrBusyRetryAfter = "5"
+
+// cardNotDetectedMessage tells the client to retake a photo without a recognizable card
+const cardNotDetectedMessage = "card not detected: make sure the whole card is visible against a contrasting background"
+
 // HandleOCR processes OCR requests
 func (h *OCRHandler) HandleOCR(w http.ResponseWriter, r *http.Request) {
 	// Set CORS headers
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
 
 	// Handle preflight OPTIONS request
 	if r.Method == "OPTIONS" {
@@ -41,178 +152,422 @@ func (h *OCRHandler) HandleOCR(w http.ResponseWriter, r *http.Request) {
 
 	// Only accept POST requests
 	if r.Method != "POST" {
-		AppLogger.Warnf("Invalid method attempted: %s from %s", r.Method, r.RemoteAddr)
-		h.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Use POST.")
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
+		recordRequest(endpointOCR, "", http.StatusMethodNotAllowed)
+		h.sendErrorResponse(w, methodNotAllowedError("POST"))
 		return
 	}
 
+	defer trackInFlight(endpointOCR)()
+
 	// Create request context with 30-second timeout
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	// Track request start time for logging
-	startTime := time.Now()
-	defer func() {
-		duration := time.Since(startTime)
-		AppLogger.Infof("Request from %s completed in %v", r.RemoteAddr, duration)
-	}()
-
-	AppLogger.Infof("OCR request received from %s", r.RemoteAddr)
+	AppLogger.InfoContext(ctx, "OCR request received")
 
-	// Parse request body
-	var req OCRRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		AppLogger.Errorf("Failed to parse request JSON from %s: %v", r.RemoteAddr, err)
-		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+	// Parse request body, which is JSON, multipart/form-data or a raw image
+	req, apiErr := decodeOCRRequest(w, r)
+	if apiErr != nil {
+		AppLogger.WarnContext(ctx, "Failed to parse request body", "code", apiErr.Code, "error", apiErr.Message)
+		recordRequest(endpointOCR, "", apiErr.Status)
+		h.sendErrorResponse(w, apiErr)
 		return
 	}
 
-	AppLogger.Debugf("Request parsed: documentType=%s, imageSize=%d bytes", req.DocumentType, len(req.Image))
+	// Allow the response format and the fields to redact to be selected with query parameters as well
+	if req.Format == "" {
+		req.Format = r.URL.Query().Get("format")
+	}
+	if req.Redact == "" {
+		req.Redact = r.URL.Query().Get("redact")
+	}
+
+	imageSize := len(req.Image)
+	if req.imageData != nil {
+		imageSize = len(req.imageData)
+	}
+	AppLogger.DebugContext(ctx, "Request parsed", "document_type", req.DocumentType, "format", req.Format, "image_size", imageSize)
 
 	// Validate request using the comprehensive validation from types.go
 	if err := req.Validate(); err != nil {
-		AppLogger.Warnf("Request validation failed from %s: %v", r.RemoteAddr, err)
-		// Determine appropriate status code based on error type
-		statusCode := h.getErrorStatusCode(err)
-		h.sendErrorResponse(w, statusCode, err.Error())
+		apiErr := toAPIError(err)
+		AppLogger.WarnContext(ctx, "Request validation failed", "code", apiErr.Code, "error", err)
+		recordRequest(endpointOCR, req.DocumentType, apiErr.Status)
+		h.sendErrorResponse(w, apiErr)
 		return
 	}
 
 	// Process the OCR request with timeout context
-	response, err := h.processOCRRequestWithTimeout(ctx, &req)
+	response, err := h.processOCRRequestWithTimeout(ctx, req)
 	if err != nil {
-		// Check if the error is due to timeout
-		if ctx.Err() == context.DeadlineExceeded {
-			AppLogger.Errorf("Request timeout for %s from %s after 30 seconds", req.DocumentType, r.RemoteAddr)
-			h.sendErrorResponse(w, http.StatusRequestTimeout, "Request timeout: processing exceeded 30 seconds")
+		// The client went away; processing has been cancelled and nobody is left to answer
+		if errors.Is(ctx.Err(), context.Canceled) {
+			AppLogger.WarnContext(ctx, "Request cancelled by client", "document_type", req.DocumentType)
+			recordRequest(endpointOCR, req.DocumentType, statusClientClosed)
 			return
 		}
 
-		AppLogger.Errorf("OCR processing error for %s from %s: %v", req.DocumentType, r.RemoteAddr, err)
-		h.sendErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		// The full error stays in the log; the client only gets its sanitized form
+		apiErr := processingError(ctx, err, 30*time.Second)
+		if apiErr.Status >= http.StatusInternalServerError {
+			AppLogger.ErrorContext(ctx, "OCR processing error", "document_type", req.DocumentType, "code", apiErr.Code, "error", err)
+		} else {
+			AppLogger.WarnContext(ctx, "OCR processing failed", "document_type", req.DocumentType, "code", apiErr.Code, "error", err)
+		}
+		recordRequest(endpointOCR, req.DocumentType, apiErr.Status)
+		h.sendErrorResponse(w, apiErr)
 		return
 	}
 
-	AppLogger.Infof("OCR processing completed successfully for %s from %s", req.DocumentType, r.RemoteAddr)
+	AppLogger.InfoContext(ctx, "OCR processing completed", "document_type", req.DocumentType, "cached", response.Cached)
 
 	// Send successful response
+	recordRequest(endpointOCR, req.DocumentType, http.StatusOK)
+	if h.resultCache != nil {
+		w.Header().Set("X-Cache", cacheStatus(response.Cached))
+	}
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		AppLogger.Errorf("Failed to encode response for %s: %v", r.RemoteAddr, err)
+		AppLogger.ErrorContext(ctx, "Failed to encode response", "error", err)
 	}
 }
 
-// getErrorStatusCode determines the appropriate HTTP status code based on the error type
-func (h *OCRHandler) getErrorStatusCode(err error) int {
-	errMsg := err.Error()
+// processOCRRequest processes the OCR request and returns extracted data.
+// Every stage receives ctx, so OCR subprocesses are killed when it is done.
+func (h *OCRHandler) processOCRRequest(ctx context.Context, req *OCRRequest) (*OCRResponse, error) {
+	// Step 1: Process the image (decode Base64, rectify to the document size, preprocess)
+	image, err := h.decodeImage(ctx, req.Image, req.imageData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process image: %w", err)
+	}
+	documentType := req.DocumentType
+	rectified := true
+	processedMat, err := preprocess(ctx, h.processorFor(documentType), image)
+	if errors.Is(err, imageprocessor.ErrCardNotDetected) && documentType == DocumentTypeAuto {
+		// Paper documents have no card outline; classify the image as it is
+		processedMat, err = preprocess(ctx, h.imageProcessor.WithOptionalCard(), image)
+		rectified = false
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to process image: %w", err)
+	}
 
-	// 400 Bad Request - for missing required fields and invalid base64
-	if strings.Contains(errMsg, "field is required") ||
-		strings.Contains(errMsg, "invalid base64 encoding") {
-		return http.StatusBadRequest
+	// Step 2: Determine the document type when the caller left it to us
+	var candidates []parser.Classification
+	if documentType == DocumentTypeAuto {
+		candidates, err = h.classify(ctx, processedMat)
+		if err != nil {
+			return nil, err
+		}
+		documentType = candidates[0].DocumentType
+		AppLogger.InfoContext(ctx, "Document classified", "document_type", documentType, "score", candidates[0].Score)
+
+		widthMM, heightMM := h.parserFactory.DocumentSize(documentType)
+		switch {
+		case widthMM != imageprocessor.ID1WidthMM || heightMM != imageprocessor.ID1HeightMM:
+			// The image was processed as an ID-1 card; redo it for documents of another size
+			processedMat, err = preprocess(ctx, h.processorFor(documentType), image)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process image: %w", err)
+			}
+		case !rectified && !h.parserFactory.HasPaperVariant(documentType):
+			return nil, fmt.Errorf("failed to process image: %w", imageprocessor.ErrCardNotDetected)
+		}
 	}
 
-	// 422 Unprocessable Entity - for unsupported document types, image format issues, size limits
-	if strings.Contains(errMsg, "unsupported document type") ||
-		strings.Contains(errMsg, "unsupported image format") ||
-		strings.Contains(errMsg, "image size exceeds maximum limit") {
-		return http.StatusUnprocessableEntity
+	// Step 3: Get the appropriate parser for the document type
+	docParser, err := h.parserFactory.GetParser(documentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parser: %w", err)
 	}
 
-	// Default to 400 Bad Request for other validation errors
-	return http.StatusBadRequest
+	// Step 4: Parse the processed image using the selected parser, together
+	// with the back of the document when one was sent. The parse stage does
+	// not include the OCR and back image processing it waits for.
+	var result *parser.Result
+	start, waited := time.Now(), stageTime(ctx, stageDecode, stagePreprocess, stageOCR)
+	if req.BackImage != "" || req.backImageData != nil {
+		result, err = h.parseWithBack(ctx, docParser, documentType, processedMat, req)
+	} else {
+		result, err = docParser.Parse(ctx, processedMat)
+	}
+	addStageTime(ctx, stageParse, time.Since(start)-(stageTime(ctx, stageDecode, stagePreprocess, stageOCR)-waited))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+	recordFields(result)
+
+	// Step 5: Create and return response in the requested format
+	response := NewOCRResponse(result, req.Format)
+	response.Classification = candidates
+	return response, nil
 }
 
-// processOCRRequest processes the OCR request and returns extracted data
-func (h *OCRHandler) processOCRRequest(req *OCRRequest) (*OCRResponse, error) {
-	// Step 1: Process the image (decode Base64, preprocess)
-	processedMat, err := h.imageProcessor.ProcessImage(req.Image)
+// parseWithBack preprocesses the back image like the front and parses both
+// sides with a parser that supports them
+func (h *OCRHandler) parseWithBack(ctx context.Context, docParser parser.DocumentParser, documentType string, front imageprocessor.Mat, req *OCRRequest) (*parser.Result, error) {
+	doubleSided, ok := docParser.(parser.DoubleSidedParser)
+	if !ok {
+		return nil, newAPIError(http.StatusUnprocessableEntity, ErrCodeBackImageUnsupported,
+			"backImage is not supported for document type "+documentType,
+			ErrorDetail{Field: "backImage", Reason: ReasonUnsupported})
+	}
+
+	image, err := h.decodeImage(ctx, req.BackImage, req.backImageData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process image: %w", err)
+		return nil, fmt.Errorf("failed to process back image: %w", err)
+	}
+	back, err := preprocess(ctx, h.processorFor(documentType), image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process back image: %w", err)
 	}
+	return doubleSided.ParseWithBack(ctx, front, back)
+}
 
-	// Step 2: Get the appropriate parser for the document type
-	parser, err := h.parserFactory.GetParser(req.DocumentType)
+// decodeImage returns the image data of a request, decoding it from base64
+// unless it was uploaded as binary
+func (h *OCRHandler) decodeImage(ctx context.Context, base64Image string, data []byte) ([]byte, error) {
+	if data != nil {
+		return data, nil
+	}
+	start := time.Now()
+	image, err := h.imageProcessor.DecodeBase64(base64Image)
+	addStageTime(ctx, stageDecode, time.Since(start))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get parser: %w", err)
+		return nil, fmt.Errorf("failed to decode base64 image: %w", err)
+	}
+	return image, nil
+}
+
+// preprocess runs an image processor on image data, adding the time it takes
+// to the preprocess stage of the request
+func preprocess(ctx context.Context, processor *imageprocessor.ImageProcessor, image []byte) (imageprocessor.Mat, error) {
+	start := time.Now()
+	defer func() { addStageTime(ctx, stagePreprocess, time.Since(start)) }()
+	return processor.ProcessImageData(ctx, image)
+}
+
+// processorFor returns the image processor that rectifies documents of the
+// given type, keeping images without a card for types with a paper variant
+func (h *OCRHandler) processorFor(documentType string) *imageprocessor.ImageProcessor {
+	widthMM, heightMM := h.parserFactory.DocumentSize(documentType)
+	processor := h.imageProcessor.ForDocumentSize(widthMM, heightMM)
+	if h.parserFactory.HasPaperVariant(documentType) {
+		processor = processor.WithOptionalCard()
+	}
+	return processor
+}
+
+// classify ranks the registered document types for a processed image and
+// fails when even the best candidate is too unlikely to be parsed
+func (h *OCRHandler) classify(ctx context.Context, mat imageprocessor.Mat) ([]parser.Classification, error) {
+	candidates, err := h.parserFactory.Classify(ctx, mat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to classify document: %w", err)
 	}
+	if len(candidates) == 0 || candidates[0].Score < parser.MinClassificationScore {
+		return nil, errDocumentTypeUndetermined
+	}
+	return candidates, nil
+}
 
-	// Step 3: Parse the processed image using the selected parser
-	// Pass the processed image data to the parser
-	extractedData, err := parser.Parse(processedMat)
+// errDocumentTypeUndetermined is returned when no registered document type matches the image
+var errDocumentTypeUndetermined = errors.New("document type could not be determined")
+
+// processOCRRequestWithTimeout processes the OCR request with context
+// timeout. Responses to requests with the same images, document type and
+// format are served from the result cache while they are cached. Responses
+// are redacted after they are cached, so that one cached result serves
+// requests with any redaction policy and API key.
+func (h *OCRHandler) processOCRRequestWithTimeout(ctx context.Context, req *OCRRequest) (*OCRResponse, error) {
+	if err := authorizeDocumentType(ctx, req.DocumentType); err != nil {
+		return nil, err
+	}
+	policy, err := h.redactionPolicy(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse document: %w", err)
+		return nil, err
 	}
 
-	// Step 4: Create and return response
-	response := &OCRResponse{
-		DocumentType: req.DocumentType,
-		Data:         extractedData,
+	ctx, timer := withStageTimer(ctx)
+	defer timer.observe()
+
+	var key string
+	cacheable := false
+	if h.resultCache != nil {
+		key, cacheable = h.resultCacheKey(ctx, req)
+	}
+	if cacheable {
+		if response := h.cachedResponse(ctx, key); response != nil {
+			AppLogger.DebugContext(ctx, "Result cache hit", "document_type", req.DocumentType)
+			return h.finishResponse(ctx, policy, response)
+		}
+	}
+
+	response, err := runWithContext(ctx, func() (*OCRResponse, error) {
+		return h.processOCRRequest(ctx, req)
+	})
+	if err != nil {
+		return nil, err
 	}
+	if cacheable {
+		h.storeResponse(ctx, key, response)
+	}
+	return h.finishResponse(ctx, policy, response)
+}
 
+// finishResponse checks that the API key of the request may receive the
+// document type of a response, which automatic detection only determines
+// during processing, and redacts the response
+func (h *OCRHandler) finishResponse(ctx context.Context, policy redact.Policy, response *OCRResponse) (*OCRResponse, error) {
+	if err := authorizeDocumentType(ctx, response.DocumentType); err != nil {
+		return nil, err
+	}
+	h.redactResponse(policy, response)
 	return response, nil
 }
 
-// processOCRRequestWithTimeout processes the OCR request with context timeout
-func (h *OCRHandler) processOCRRequestWithTimeout(ctx context.Context, req *OCRRequest) (*OCRResponse, error) {
-	// Use a channel to handle the result from the processing
-	resultChan := make(chan *OCRResponse, 1)
-	errorChan := make(chan error, 1)
+// runWithContext runs fn in a goroutine and returns its result, or ctx.Err()
+// once ctx is done. fn must share ctx, so that its OCR processes are torn
+// down and the goroutine returns promptly after the caller has given up.
+func runWithContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	resultChan := make(chan result, 1)
 
-	// Run the OCR processing in a goroutine
 	go func() {
-		response, err := h.processOCRRequest(req)
-		if err != nil {
-			errorChan <- err
-		} else {
-			resultChan <- response
-		}
+		value, err := fn()
+		resultChan <- result{value: value, err: err}
 	}()
 
 	// Wait for either completion or timeout
 	select {
-	case response := <-resultChan:
-		return response, nil
-	case err := <-errorChan:
-		return nil, err
+	case r := <-resultChan:
+		return r.value, r.err
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		var zero T
+		return zero, ctx.Err()
 	}
 }
 
-// sendErrorResponse sends an error response in JSON format
-func (h *OCRHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	w.WriteHeader(statusCode)
-	errorResponse := ErrorResponse{
-		Error: APIError{
-			Code:    statusCode,
-			Message: message,
-		},
+// HandleClassify ranks the supported document types for an image
+func (h *OCRHandler) HandleClassify(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
 	}
 
-	AppLogger.Debugf("Sending error response: %d - %s", statusCode, message)
+	if r.Method != "POST" {
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
+		recordRequest(endpointClassify, "", http.StatusMethodNotAllowed)
+		h.sendErrorResponse(w, methodNotAllowedError("POST"))
+		return
+	}
+
+	defer trackInFlight(endpointClassify)()
+
+	// Create request context with 30-second timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var req ClassifyRequest
+	if apiErr := decodeJSONBody(w, r, maxJSONSize, &req); apiErr != nil {
+		AppLogger.WarnContext(ctx, "Failed to parse classify request JSON", "error", apiErr)
+		recordRequest(endpointClassify, "", apiErr.Status)
+		h.sendErrorResponse(w, apiErr)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		apiErr := toAPIError(err)
+		AppLogger.WarnContext(ctx, "Classify request validation failed", "code", apiErr.Code, "error", err)
+		recordRequest(endpointClassify, "", apiErr.Status)
+		h.sendErrorResponse(w, apiErr)
+		return
+	}
+
+	candidates, err := runWithContext(ctx, func() ([]parser.Classification, error) {
+		processedMat, err := h.imageProcessor.ProcessImage(ctx, req.Image)
+		if errors.Is(err, imageprocessor.ErrCardNotDetected) {
+			// Paper documents have no card outline; classify the image as it is
+			processedMat, err = h.imageProcessor.WithOptionalCard().ProcessImage(ctx, req.Image)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to process image: %w", err)
+		}
+		return h.parserFactory.Classify(ctx, processedMat)
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			AppLogger.WarnContext(ctx, "Classify request cancelled by client")
+			recordRequest(endpointClassify, "", statusClientClosed)
+			return
+		}
+
+		apiErr := processingError(ctx, err, 30*time.Second)
+		AppLogger.ErrorContext(ctx, "Classification error", "code", apiErr.Code, "error", err)
+		recordRequest(endpointClassify, "", apiErr.Status)
+		h.sendErrorResponse(w, apiErr)
+		return
+	}
+
+	recordRequest(endpointClassify, "", http.StatusOK)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(ClassifyResponse{Candidates: candidates}); err != nil {
+		AppLogger.ErrorContext(ctx, "Failed to encode classify response", "error", err)
+	}
+}
+
+// sendErrorResponse sends an error response in JSON format with the status of the error
+func (h *OCRHandler) sendErrorResponse(w http.ResponseWriter, apiErr *APIError) {
+	if apiErr.Status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", ocrBusyRetryAfter)
+	}
+	w.WriteHeader(apiErr.Status)
+	errorResponse := NewErrorResponse(apiErr)
+
+	AppLogger.Debug("Sending error response", "status", apiErr.Status, "code", apiErr.Code, "message", apiErr.Message)
 
 	if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
-		AppLogger.Errorf("Failed to encode error response: %v", err)
+		AppLogger.Error("Failed to encode error response", "error", err)
 	}
 }
 
-// HealthHandler handles health check requests
-func HealthHandler(w http.ResponseWriter, r *http.Request) {
+// HealthHandler handles health check requests. The status is "saturated"
+// while the OCR worker pool rejects new work.
+func (h *OCRHandler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != "GET" {
-		AppLogger.Warnf("Invalid method attempted on health endpoint: %s from %s", r.Method, r.RemoteAddr)
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	AppLogger.Debugf("Health check requested from %s", r.RemoteAddr)
+	AppLogger.DebugContext(r.Context(), "Health check requested")
+
+	stats := h.ocrPool.Stats()
+	status := "healthy"
+	if stats.Saturated {
+		status = "saturated"
+	}
 
 	healthResponse := map[string]interface{}{
-		"status":  "healthy",
+		"status":  status,
 		"service": "OCR Web API",
 		"version": "1.0.0",
+		"ocr":     stats,
+	}
+	if h.resultCache != nil {
+		healthResponse["cache"] = h.resultCache.Stats()
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -222,15 +577,14 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 // DocumentTypesHandler returns supported document types
 func (h *OCRHandler) DocumentTypesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if r.Method != "GET" {
-		AppLogger.Warnf("Invalid method attempted on document-types endpoint: %s from %s", r.Method, r.RemoteAddr)
-		h.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET.")
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
+		h.sendErrorResponse(w, methodNotAllowedError("GET"))
 		return
 	}
 
-	AppLogger.Debugf("Document types requested from %s", r.RemoteAddr)
+	AppLogger.DebugContext(r.Context(), "Document types requested")
 
 	supportedTypes := h.parserFactory.GetSupportedDocumentTypes()
 
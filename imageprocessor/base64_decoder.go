@@ -2,10 +2,14 @@ package imageprocessor
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 )
 
+// ErrInvalidBase64 is wrapped by errors for image strings that are not valid base64
+var ErrInvalidBase64 = errors.New("invalid base64 encoding")
+
 // Base64Decoder handles base64 image decoding
 type Base64Decoder struct{}
 
@@ -17,7 +21,7 @@ func NewBase64Decoder() *Base64Decoder {
 // DecodeBase64 decodes a Base64 encoded image string to byte slice with validation
 func (d *Base64Decoder) DecodeBase64(base64Image string) ([]byte, error) {
 	if base64Image == "" {
-		return nil, fmt.Errorf("base64 image string is empty")
+		return nil, fmt.Errorf("%w: base64 image string is empty", ErrInvalidBase64)
 	}
 
 	// Remove data URL prefix if present (e.g., "data:image/jpeg;base64,")
@@ -31,11 +35,11 @@ func (d *Base64Decoder) DecodeBase64(base64Image string) ([]byte, error) {
 	// Decode base64 string
 	imageData, err := base64.StdEncoding.DecodeString(base64Image)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode base64 string: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBase64, err)
 	}
 
 	if len(imageData) == 0 {
-		return nil, fmt.Errorf("decoded image data is empty")
+		return nil, fmt.Errorf("%w: decoded image data is empty", ErrInvalidBase64)
 	}
 
 	return imageData, nil
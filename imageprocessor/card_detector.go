@@ -0,0 +1,617 @@
+package imageprocessor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// ID-1 card dimensions (ISO/IEC 7810) in millimetres, shared by driver's
+// licenses, Individual Number Cards and most other Japanese ID cards
+const (
+	ID1WidthMM  = 85.6
+	ID1HeightMM = 54.0
+
+	// ID1AspectRatio is the width/height ratio of an ID-1 card
+	ID1AspectRatio = ID1WidthMM / ID1HeightMM
+
+	// TD3 (passport data page, ICAO 9303) dimensions in millimetres
+	TD3WidthMM  = 125.0
+	TD3HeightMM = 88.0
+
+	// TD3AspectRatio is the width/height ratio of a passport data page
+	TD3AspectRatio = TD3WidthMM / TD3HeightMM
+)
+
+// ErrCardNotDetected is returned when no card-shaped quadrilateral is found in the image
+var ErrCardNotDetected = errors.New("card not detected")
+
+// Point is a sub-pixel image coordinate
+type Point struct {
+	X, Y float64
+}
+
+// Quad is a card outline with corners ordered top-left, top-right,
+// bottom-right, bottom-left, where the top edge is a long side of the card
+type Quad [4]Point
+
+// CardDetector finds a card in a photo and warps it to a canonical,
+// fronto-parallel image of fixed resolution
+type CardDetector struct {
+	AspectRatio      float64 // Expected width/height ratio of the card
+	AspectTolerance  float64 // Allowed relative deviation of the detected aspect ratio
+	MinAreaRatio     float64 // Minimum fraction of the photo the card must cover
+	OutputWidth      int     // Width of the rectified card image; the height follows from AspectRatio
+	workingSize      int     // Longest side of the downscaled image used for detection
+	croppedTolerance float64 // Aspect tolerance for accepting an already cropped card image
+}
+
+// NewCardDetector creates a detector for ID-1 cards producing 1012×638
+// images, which corresponds to a 300 DPI scan
+func NewCardDetector() *CardDetector {
+	return NewCardDetectorForAspect(ID1AspectRatio, 1012)
+}
+
+// NewCardDetectorForAspect creates a detector for documents with the given
+// width/height ratio, producing images outputWidth pixels wide
+func NewCardDetectorForAspect(aspectRatio float64, outputWidth int) *CardDetector {
+	return &CardDetector{
+		AspectRatio:      aspectRatio,
+		AspectTolerance:  0.2,
+		MinAreaRatio:     0.1,
+		OutputWidth:      outputWidth,
+		workingSize:      480,
+		croppedTolerance: 0.04,
+	}
+}
+
+// outputSize returns the size of the rectified image
+func (d *CardDetector) outputSize() (int, int) {
+	return d.OutputWidth, int(math.Round(float64(d.OutputWidth) / d.AspectRatio))
+}
+
+// Rectify detects the card in img and returns it warped to the canonical
+// resolution. Images that already contain only the card are resized.
+// It returns ErrCardNotDetected when no card can be found.
+func (d *CardDetector) Rectify(img image.Image) (image.Image, error) {
+	width, height := d.outputSize()
+
+	quad, err := d.Detect(img)
+	if err == nil {
+		return warpPerspective(img, quad, width, height), nil
+	}
+
+	// Scans and cropped photos show the card edge to edge, leaving no outline to detect
+	bounds := img.Bounds()
+	if d.aspectMatches(float64(bounds.Dx())/float64(bounds.Dy()), d.croppedTolerance) {
+		return ResizeBicubic(img, width, height), nil
+	}
+	if d.aspectMatches(float64(bounds.Dy())/float64(bounds.Dx()), d.croppedTolerance) {
+		return ResizeBicubic(rotate90(img), width, height), nil
+	}
+
+	return nil, err
+}
+
+// Detect finds the card outline in img, in the coordinates of img
+func (d *CardDetector) Detect(img image.Image) (Quad, error) {
+	bounds := img.Bounds()
+	factor := max(1, int(math.Ceil(float64(max(bounds.Dx(), bounds.Dy()))/float64(d.workingSize))))
+	work := GaussianBlur(downscaleGray(ToGray(img), factor), 5, 0)
+
+	best, bestScore := Quad{}, 0.0
+	for _, mask := range candidateMasks(work) {
+		for _, component := range connectedComponents(mask, work.Rect.Dx(), work.Rect.Dy()) {
+			quad, score, ok := d.evaluateComponent(component, work.Rect.Dx(), work.Rect.Dy())
+			if ok && score > bestScore {
+				best, bestScore = quad, score
+			}
+		}
+	}
+
+	if bestScore == 0 {
+		return Quad{}, ErrCardNotDetected
+	}
+
+	// Map back to the full-resolution image
+	for i := range best {
+		best[i].X = best[i].X*float64(factor) + float64(bounds.Min.X)
+		best[i].Y = best[i].Y*float64(factor) + float64(bounds.Min.Y)
+	}
+	return best, nil
+}
+
+// evaluateComponent fits a quadrilateral to a connected component and scores
+// how card-like it is. Components touching the image border are rejected,
+// since a card cut off by the frame cannot be rectified.
+func (d *CardDetector) evaluateComponent(c component, w, h int) (Quad, float64, bool) {
+	if c.touchesBorder || float64(c.area) < d.MinAreaRatio*float64(w*h) {
+		return Quad{}, 0, false
+	}
+
+	hull := convexHull(c.outline)
+	if len(hull) < 4 {
+		return Quad{}, 0, false
+	}
+
+	quad := orderCorners(maxAreaQuad(simplifyHull(hull)))
+	quadArea := polygonArea(quad[:])
+	if quadArea <= 0 {
+		return Quad{}, 0, false
+	}
+
+	// The blob must fill its outline, which rules out ring-shaped or ragged regions
+	rectangularity := float64(c.area) / quadArea
+	if rectangularity < 0.85 {
+		return Quad{}, 0, false
+	}
+
+	top := distance(quad[0], quad[1])
+	bottom := distance(quad[3], quad[2])
+	left := distance(quad[0], quad[3])
+	right := distance(quad[1], quad[2])
+	if !d.aspectMatches((top+bottom)/(left+right), d.AspectTolerance) {
+		return Quad{}, 0, false
+	}
+
+	return quad, quadArea * math.Min(rectangularity, 1), true
+}
+
+// aspectMatches reports whether ratio is within tolerance of the expected aspect ratio
+func (d *CardDetector) aspectMatches(ratio, tolerance float64) bool {
+	return math.Abs(ratio-d.AspectRatio)/d.AspectRatio <= tolerance
+}
+
+// downscaleGray shrinks an image by an integer factor, averaging each block of pixels
+func downscaleGray(src *image.Gray, factor int) *image.Gray {
+	if factor <= 1 {
+		return src
+	}
+
+	w, h := src.Rect.Dx()/factor, src.Rect.Dy()/factor
+	dst := image.NewGray(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			sum, count := 0, 0
+			for dy := 0; dy < factor && y*factor+dy < src.Rect.Dy(); dy++ {
+				row := src.Pix[(y*factor+dy)*src.Stride:]
+				for dx := 0; dx < factor && x*factor+dx < src.Rect.Dx(); dx++ {
+					sum += int(row[x*factor+dx])
+					count++
+				}
+			}
+			dst.Pix[y*dst.Stride+x] = uint8(sum / count)
+		}
+	}
+	return dst
+}
+
+// candidateMasks returns binary masks (true = foreground) that may separate
+// the card from the background: regions enclosed by strong edges, and the
+// bright and dark halves of an Otsu threshold
+func candidateMasks(img *image.Gray) [][]bool {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+
+	// Edge-enclosed regions: flood the background from the border over non-edge pixels
+	edges := sobelEdges(img)
+	enclosed := make([]bool, w*h)
+	background := make([]bool, w*h)
+	var queue []int
+	for x := 0; x < w; x++ {
+		queue = append(queue, x, (h-1)*w+x)
+	}
+	for y := 0; y < h; y++ {
+		queue = append(queue, y*w, y*w+w-1)
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if background[i] || edges[i] {
+			continue
+		}
+		background[i] = true
+		x, y := i%w, i/w
+		if x > 0 {
+			queue = append(queue, i-1)
+		}
+		if x < w-1 {
+			queue = append(queue, i+1)
+		}
+		if y > 0 {
+			queue = append(queue, i-w)
+		}
+		if y < h-1 {
+			queue = append(queue, i+w)
+		}
+	}
+	for i := range enclosed {
+		enclosed[i] = !background[i]
+	}
+
+	// Intensity halves
+	threshold := otsuThreshold(img.Pix, w, h, img.Stride)
+	bright := make([]bool, w*h)
+	dark := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			isBright := img.Pix[y*img.Stride+x] > threshold
+			bright[y*w+x] = isBright
+			dark[y*w+x] = !isBright
+		}
+	}
+
+	return [][]bool{enclosed, bright, dark}
+}
+
+// sobelEdges returns the pixels whose gradient magnitude exceeds an Otsu
+// threshold, dilated once so small gaps in the card outline are closed
+func sobelEdges(img *image.Gray) []bool {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	magnitude := image.NewGray(image.Rect(0, 0, w, h))
+	at := func(x, y int) int {
+		return int(img.Pix[clampInt(y, 0, h-1)*img.Stride+clampInt(x, 0, w-1)])
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			magnitude.Pix[y*magnitude.Stride+x] = clampUint8(math.Hypot(float64(gx), float64(gy)) / 4)
+		}
+	}
+
+	threshold := otsuThreshold(magnitude.Pix, w, h, magnitude.Stride)
+	dilated := Dilate(magnitude, 3)
+	edges := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			edges[y*w+x] = dilated.Pix[y*dilated.Stride+x] > threshold
+		}
+	}
+	return edges
+}
+
+// otsuThreshold returns the threshold that best separates the pixel
+// histogram into two classes
+func otsuThreshold(pix []uint8, w, h, stride int) uint8 {
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			hist[pix[y*stride+x]]++
+		}
+	}
+
+	total := w * h
+	var sumAll float64
+	for i, count := range hist {
+		sumAll += float64(i * count)
+	}
+
+	var sumBackground float64
+	weightBackground := 0
+	best, bestVariance := 0, -1.0
+	for i, count := range hist {
+		weightBackground += count
+		if weightBackground == 0 {
+			continue
+		}
+		weightForeground := total - weightBackground
+		if weightForeground == 0 {
+			break
+		}
+		sumBackground += float64(i * count)
+		meanBackground := sumBackground / float64(weightBackground)
+		meanForeground := (sumAll - sumBackground) / float64(weightForeground)
+		variance := float64(weightBackground) * float64(weightForeground) * (meanBackground - meanForeground) * (meanBackground - meanForeground)
+		if variance > bestVariance {
+			best, bestVariance = i, variance
+		}
+	}
+	return uint8(best)
+}
+
+// component is a 4-connected foreground region of a mask
+type component struct {
+	area          int
+	outline       []Point // Leftmost and rightmost pixel of every row
+	touchesBorder bool
+}
+
+// connectedComponents labels the 4-connected foreground regions of mask
+func connectedComponents(mask []bool, w, h int) []component {
+	visited := make([]bool, w*h)
+	var components []component
+	var stack []int
+
+	for start := range mask {
+		if !mask[start] || visited[start] {
+			continue
+		}
+
+		c := component{}
+		rowMin := map[int]int{}
+		rowMax := map[int]int{}
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%w, i/w
+			c.area++
+			if x == 0 || y == 0 || x == w-1 || y == h-1 {
+				c.touchesBorder = true
+			}
+			if v, ok := rowMin[y]; !ok || x < v {
+				rowMin[y] = x
+			}
+			if v, ok := rowMax[y]; !ok || x > v {
+				rowMax[y] = x
+			}
+
+			for _, n := range [4]int{i - 1, i + 1, i - w, i + w} {
+				if n < 0 || n >= w*h || (n == i-1 && x == 0) || (n == i+1 && x == w-1) {
+					continue
+				}
+				if mask[n] && !visited[n] {
+					visited[n] = true
+					stack = append(stack, n)
+				}
+			}
+		}
+
+		for y, x := range rowMin {
+			c.outline = append(c.outline, Point{float64(x), float64(y)}, Point{float64(rowMax[y] + 1), float64(y)})
+			c.outline = append(c.outline, Point{float64(x), float64(y + 1)}, Point{float64(rowMax[y] + 1), float64(y + 1)})
+		}
+		components = append(components, c)
+	}
+
+	return components
+}
+
+// convexHull returns the convex hull of points in counter-clockwise order
+// (Andrew's monotone chain)
+func convexHull(points []Point) []Point {
+	if len(points) < 3 {
+		return points
+	}
+
+	sorted := append([]Point(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].X != sorted[j].X {
+			return sorted[i].X < sorted[j].X
+		}
+		return sorted[i].Y < sorted[j].Y
+	})
+
+	cross := func(o, a, b Point) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+
+	hull := make([]Point, 0, 2*len(sorted))
+	for _, p := range sorted {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(sorted) - 2; i >= 0; i-- {
+		p := sorted[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
+
+// simplifyHull drops hull vertices that barely change the outline, so the
+// quadrilateral search only considers real corners
+func simplifyHull(hull []Point) []Point {
+	perimeter := 0.0
+	for i := range hull {
+		perimeter += distance(hull[i], hull[(i+1)%len(hull)])
+	}
+
+	simplified := hull
+	for epsilon := perimeter * 0.005; len(simplified) > 24; epsilon *= 1.5 {
+		var kept []Point
+		for i := range hull {
+			prev, next := hull[(i+len(hull)-1)%len(hull)], hull[(i+1)%len(hull)]
+			if pointLineDistance(hull[i], prev, next) > epsilon {
+				kept = append(kept, hull[i])
+			}
+		}
+		if len(kept) < 4 {
+			break
+		}
+		simplified = kept
+	}
+	return simplified
+}
+
+// maxAreaQuad returns the four hull vertices that enclose the largest area
+func maxAreaQuad(hull []Point) [4]Point {
+	n := len(hull)
+	var best [4]Point
+	bestArea := -1.0
+	for a := 0; a < n; a++ {
+		for b := a + 1; b < n; b++ {
+			for c := b + 1; c < n; c++ {
+				for d := c + 1; d < n; d++ {
+					quad := []Point{hull[a], hull[b], hull[c], hull[d]}
+					if area := polygonArea(quad); area > bestArea {
+						bestArea = area
+						best = [4]Point{hull[a], hull[b], hull[c], hull[d]}
+					}
+				}
+			}
+		}
+	}
+	return best
+}
+
+// orderCorners orders corners clockwise from the top-left so that the first
+// edge is a long side of the card
+func orderCorners(corners [4]Point) Quad {
+	var cx, cy float64
+	for _, p := range corners {
+		cx += p.X / 4
+		cy += p.Y / 4
+	}
+
+	// Clockwise in image coordinates, where y grows downwards
+	sorted := corners
+	sort.Slice(sorted[:], func(i, j int) bool {
+		return math.Atan2(sorted[i].Y-cy, sorted[i].X-cx) < math.Atan2(sorted[j].Y-cy, sorted[j].X-cx)
+	})
+
+	// Start from the corner closest to the top-left
+	start := 0
+	for i := range sorted {
+		if sorted[i].X+sorted[i].Y < sorted[start].X+sorted[start].Y {
+			start = i
+		}
+	}
+	var quad Quad
+	for i := range quad {
+		quad[i] = sorted[(start+i)%4]
+	}
+
+	// Portrait outline: rotate so the card is read in landscape
+	if distance(quad[0], quad[1])+distance(quad[3], quad[2]) < distance(quad[0], quad[3])+distance(quad[1], quad[2]) {
+		quad = Quad{quad[3], quad[0], quad[1], quad[2]}
+	}
+	return quad
+}
+
+// polygonArea returns the absolute area of a simple polygon (shoelace formula)
+func polygonArea(points []Point) float64 {
+	area := 0.0
+	for i := range points {
+		j := (i + 1) % len(points)
+		area += points[i].X*points[j].Y - points[j].X*points[i].Y
+	}
+	return math.Abs(area) / 2
+}
+
+// distance returns the Euclidean distance between two points
+func distance(a, b Point) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+// pointLineDistance returns the distance from p to the line through a and b
+func pointLineDistance(p, a, b Point) float64 {
+	length := distance(a, b)
+	if length == 0 {
+		return distance(p, a)
+	}
+	return math.Abs((b.X-a.X)*(a.Y-p.Y)-(a.X-p.X)*(b.Y-a.Y)) / length
+}
+
+// homography computes the projective transform mapping the corners of a
+// width × height rectangle onto quad
+func homography(quad Quad, width, height int) ([9]float64, error) {
+	rect := Quad{{0, 0}, {float64(width), 0}, {float64(width), float64(height)}, {0, float64(height)}}
+	return solveHomography(rect, quad)
+}
+
+// solveHomography computes the projective transform mapping the corners of
+// from onto the corners of to, solving the 8×8 linear system with Gaussian
+// elimination
+func solveHomography(from, to Quad) ([9]float64, error) {
+	var m [8][9]float64
+	for i := 0; i < 4; i++ {
+		u, v := from[i].X, from[i].Y
+		x, y := to[i].X, to[i].Y
+		m[2*i] = [9]float64{u, v, 1, 0, 0, 0, -u * x, -v * x, x}
+		m[2*i+1] = [9]float64{0, 0, 0, u, v, 1, -u * y, -v * y, y}
+	}
+
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return [9]float64{}, fmt.Errorf("degenerate card outline")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := 0; row < 8; row++ {
+			if row == col {
+				continue
+			}
+			factor := m[row][col] / m[col][col]
+			for k := col; k < 9; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+
+	var h [9]float64
+	for i := 0; i < 8; i++ {
+		h[i] = m[i][8] / m[i][i]
+	}
+	h[8] = 1
+	return h, nil
+}
+
+// warpPerspective samples the quad region of img into a width × height
+// image using bilinear interpolation
+func warpPerspective(img image.Image, quad Quad, width, height int) image.Image {
+	h, err := homography(quad, width, height)
+	if err != nil {
+		return ResizeBicubic(img, width, height)
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Rect, img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	for v := 0; v < height; v++ {
+		for u := 0; u < width; u++ {
+			fu, fv := float64(u)+0.5, float64(v)+0.5
+			w := h[6]*fu + h[7]*fv + h[8]
+			x := (h[0]*fu+h[1]*fv+h[2])/w - float64(bounds.Min.X) - 0.5
+			y := (h[3]*fu+h[4]*fv+h[5])/w - float64(bounds.Min.Y) - 0.5
+
+			x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+			wx, wy := x-float64(x0), y-float64(y0)
+			x1, y1 := clampInt(x0+1, 0, sw-1), clampInt(y0+1, 0, sh-1)
+			x0, y0 = clampInt(x0, 0, sw-1), clampInt(y0, 0, sh-1)
+
+			for c := 0; c < 4; c++ {
+				p00 := float64(src.Pix[y0*src.Stride+x0*4+c])
+				p10 := float64(src.Pix[y0*src.Stride+x1*4+c])
+				p01 := float64(src.Pix[y1*src.Stride+x0*4+c])
+				p11 := float64(src.Pix[y1*src.Stride+x1*4+c])
+				top := p00*(1-wx) + p10*wx
+				bottom := p01*(1-wx) + p11*wx
+				dst.Pix[v*dst.Stride+u*4+c] = clampUint8(top*(1-wy) + bottom*wy)
+			}
+		}
+	}
+
+	return dst
+}
+
+// rotate90 rotates an image 90 degrees clockwise
+func rotate90(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dy(), bounds.Dx()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			dst.Set(bounds.Dy()-1-y, x, img.At(x+bounds.Min.X, y+bounds.Min.Y))
+		}
+	}
+	return dst
+}
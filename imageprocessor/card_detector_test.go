@@ -0,0 +1,132 @@
+package imageprocessor
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+// newCardPhoto renders a light card with a dark text bar, seen in perspective
+// at corners, on a darker textured background
+func newCardPhoto(w, h int, corners Quad) *image.RGBA {
+	card := Quad{{0, 0}, {856, 0}, {856, 540}, {0, 540}}
+	toCard, err := solveHomography(corners, card)
+	if err != nil {
+		panic(err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 90, G: 80, B: 70, A: 255}
+			if (x/7+y/5)%3 == 0 {
+				c = color.RGBA{R: 70, G: 65, B: 60, A: 255}
+			}
+
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			d := toCard[6]*fx + toCard[7]*fy + toCard[8]
+			u := (toCard[0]*fx + toCard[1]*fy + toCard[2]) / d
+			v := (toCard[3]*fx + toCard[4]*fy + toCard[5]) / d
+			if u >= 0 && u < 856 && v >= 0 && v < 540 {
+				c = color.RGBA{R: 235, G: 240, B: 235, A: 255}
+				if u >= 300 && u < 700 && v >= 200 && v < 260 {
+					c = color.RGBA{R: 30, G: 30, B: 40, A: 255}
+				}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// TestCardDetection tests that a card photographed at an angle is found and rectified
+func TestCardDetection(t *testing.T) {
+	corners := Quad{{130, 95}, {530, 70}, {545, 330}, {105, 325}}
+	photo := newCardPhoto(640, 480, corners)
+
+	detector := NewCardDetector()
+	quad, err := detector.Detect(photo)
+	if err != nil {
+		t.Fatalf("Expected card to be detected, got error: %v", err)
+	}
+	for i := range quad {
+		if distance(quad[i], corners[i]) > 8 {
+			t.Errorf("Corner %d: expected near %v, got %v", i, corners[i], quad[i])
+		}
+	}
+
+	rectified, err := detector.Rectify(photo)
+	if err != nil {
+		t.Fatalf("Expected card to be rectified, got error: %v", err)
+	}
+	if rectified.Bounds().Dx() != 1012 || rectified.Bounds().Dy() != 638 {
+		t.Fatalf("Unexpected rectified size: %v", rectified.Bounds())
+	}
+
+	gray := ToGray(rectified)
+	// The text bar spans 300-700 × 200-260 of the 856 × 540 card
+	if v := gray.GrayAt(590, 272).Y; v > 80 {
+		t.Errorf("Expected text bar in the rectified card, got value %d", v)
+	}
+	if v := gray.GrayAt(200, 500).Y; v < 200 {
+		t.Errorf("Expected blank card area in the rectified card, got value %d", v)
+	}
+}
+
+// TestCardDetectionPortrait tests that a card rotated by 90 degrees is returned in landscape
+func TestCardDetectionPortrait(t *testing.T) {
+	corners := Quad{{330, 80}, {340, 500}, {75, 510}, {70, 85}}
+	quad, err := NewCardDetector().Detect(newCardPhoto(420, 600, corners))
+	if err != nil {
+		t.Fatalf("Expected rotated card to be detected, got error: %v", err)
+	}
+
+	top := distance(quad[0], quad[1])
+	left := distance(quad[0], quad[3])
+	if top < left {
+		t.Errorf("Expected the first edge to be the long side, got %.0f < %.0f", top, left)
+	}
+}
+
+// TestCardNotDetected tests that images without a card are rejected
+func TestCardNotDetected(t *testing.T) {
+	blank := image.NewGray(image.Rect(0, 0, 640, 480))
+	for i := range blank.Pix {
+		blank.Pix[i] = uint8(100 + i%7)
+	}
+
+	if _, err := NewCardDetector().Rectify(blank); !errors.Is(err, ErrCardNotDetected) {
+		t.Errorf("Expected ErrCardNotDetected, got %v", err)
+	}
+
+	_, err := DefaultPipeline().Run(context.Background(), blank)
+	if !errors.Is(err, ErrCardNotDetected) {
+		t.Errorf("Expected pipeline to report ErrCardNotDetected, got %v", err)
+	}
+
+	// Documents with a paper variant keep the image when no card is found
+	optional := DefaultPipeline().WithOptionalCard()
+	if !strings.HasPrefix(optional.String(), "card_optional:1012:85.6:54,") {
+		t.Errorf("Unexpected optional card pipeline %s", optional)
+	}
+	kept, err := optional.Run(context.Background(), blank)
+	if err != nil {
+		t.Fatalf("Expected optional card step to keep the image, got error: %v", err)
+	}
+	if kept.Bounds().Dx() < blank.Bounds().Dx() {
+		t.Errorf("Expected the uncropped image to be kept, got %v", kept.Bounds())
+	}
+
+	// An image that already shows only the card is kept
+	cropped, err := NewCardDetector().Rectify(image.NewGray(image.Rect(0, 0, 428, 270)))
+	if err != nil {
+		t.Fatalf("Expected cropped card to be accepted, got error: %v", err)
+	}
+	if math.Abs(float64(cropped.Bounds().Dx())/float64(cropped.Bounds().Dy())-ID1AspectRatio) > 0.01 {
+		t.Errorf("Unexpected cropped card size: %v", cropped.Bounds())
+	}
+}
@@ -0,0 +1,507 @@
+package imageprocessor
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// The filters in this file operate on *image.Gray values with a zero origin,
+// as produced by ToGray, and always return a new image.
+
+// ToGray converts an image to 8-bit grayscale using the ITU-R BT.601 luma
+// weights (0.299R + 0.587G + 0.114B). The result always has a zero origin.
+func ToGray(src image.Image) *image.Gray {
+	bounds := src.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	switch img := src.(type) {
+	case *image.Gray:
+		for y := 0; y < bounds.Dy(); y++ {
+			srcRow := img.Pix[(y+bounds.Min.Y-img.Rect.Min.Y)*img.Stride+(bounds.Min.X-img.Rect.Min.X):]
+			copy(dst.Pix[y*dst.Stride:y*dst.Stride+bounds.Dx()], srcRow[:bounds.Dx()])
+		}
+	case *image.YCbCr:
+		// JPEG luma already uses the BT.601 weights
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				dst.Pix[y*dst.Stride+x] = img.Y[img.YOffset(x+bounds.Min.X, y+bounds.Min.Y)]
+			}
+		}
+	default:
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				r, g, b, _ := src.At(x+bounds.Min.X, y+bounds.Min.Y).RGBA()
+				lum := (19595*r + 38470*g + 7471*b + 1<<15) >> 24
+				dst.Pix[y*dst.Stride+x] = uint8(lum)
+			}
+		}
+	}
+
+	return dst
+}
+
+// clampInt limits v to the range [lo, hi]
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// clampUint8 rounds and limits v to the range of a byte
+func clampUint8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// CLAHE applies Contrast Limited Adaptive Histogram Equalization. The image
+// is split into tilesX × tilesY tiles, each tile histogram is clipped at
+// clipLimit times the mean bin height, and the per-tile mappings are
+// bilinearly interpolated to avoid visible tile borders.
+func CLAHE(src *image.Gray, clipLimit float64, tilesX, tilesY int) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	if w == 0 || h == 0 {
+		return dst
+	}
+
+	tilesX = clampInt(tilesX, 1, w)
+	tilesY = clampInt(tilesY, 1, h)
+	tileW := (w + tilesX - 1) / tilesX
+	tileH := (h + tilesY - 1) / tilesY
+
+	// Build the equalization lookup table of every tile
+	luts := make([][256]uint8, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx*tileW, ty*tileH
+			x1, y1 := min(x0+tileW, w), min(y0+tileH, h)
+			area := (x1 - x0) * (y1 - y0)
+			if area <= 0 {
+				continue
+			}
+
+			var hist [256]int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					hist[row[x]]++
+				}
+			}
+
+			// Clip the histogram and redistribute the excess evenly
+			if clipLimit > 0 {
+				limit := max(int(clipLimit*float64(area)/256), 1)
+				excess := 0
+				for i := range hist {
+					if hist[i] > limit {
+						excess += hist[i] - limit
+						hist[i] = limit
+					}
+				}
+				bonus, residual := excess/256, excess%256
+				for i := range hist {
+					hist[i] += bonus
+					if i < residual {
+						hist[i]++
+					}
+				}
+			}
+
+			lut := &luts[ty*tilesX+tx]
+			scale := 255.0 / float64(area)
+			sum := 0
+			for i := range hist {
+				sum += hist[i]
+				lut[i] = clampUint8(float64(sum) * scale)
+			}
+		}
+	}
+
+	// Interpolate between the four tiles surrounding each pixel
+	for y := 0; y < h; y++ {
+		fy := (float64(y)+0.5)/float64(tileH) - 0.5
+		ty0 := int(math.Floor(fy))
+		wy := fy - float64(ty0)
+		ty1 := clampInt(ty0+1, 0, tilesY-1)
+		ty0 = clampInt(ty0, 0, tilesY-1)
+
+		for x := 0; x < w; x++ {
+			fx := (float64(x)+0.5)/float64(tileW) - 0.5
+			tx0 := int(math.Floor(fx))
+			wx := fx - float64(tx0)
+			tx1 := clampInt(tx0+1, 0, tilesX-1)
+			tx0 = clampInt(tx0, 0, tilesX-1)
+
+			v := src.Pix[y*src.Stride+x]
+			top := (1-wx)*float64(luts[ty0*tilesX+tx0][v]) + wx*float64(luts[ty0*tilesX+tx1][v])
+			bottom := (1-wx)*float64(luts[ty1*tilesX+tx0][v]) + wx*float64(luts[ty1*tilesX+tx1][v])
+			dst.Pix[y*dst.Stride+x] = clampUint8((1-wy)*top + wy*bottom)
+		}
+	}
+
+	return dst
+}
+
+// BilateralFilter smooths noise while preserving edges. Each pixel becomes a
+// weighted mean of its neighbours within diameter, weighted by both spatial
+// distance (sigmaSpace) and intensity difference (sigmaColor).
+func BilateralFilter(src *image.Gray, diameter int, sigmaColor, sigmaSpace float64) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	radius := max(diameter/2, 1)
+
+	// Precompute the intensity and spatial weights
+	var colorWeights [256]float64
+	for i := range colorWeights {
+		colorWeights[i] = math.Exp(-float64(i*i) / (2 * sigmaColor * sigmaColor))
+	}
+
+	type offset struct {
+		dx, dy int
+		weight float64
+	}
+	var offsets []offset
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			dist := float64(dx*dx + dy*dy)
+			if dist > float64(radius*radius) {
+				continue // Circular neighbourhood
+			}
+			offsets = append(offsets, offset{dx, dy, math.Exp(-dist / (2 * sigmaSpace * sigmaSpace))})
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			center := int(src.Pix[y*src.Stride+x])
+			var sum, norm float64
+			for _, o := range offsets {
+				nx := clampInt(x+o.dx, 0, w-1)
+				ny := clampInt(y+o.dy, 0, h-1)
+				v := int(src.Pix[ny*src.Stride+nx])
+				diff := v - center
+				if diff < 0 {
+					diff = -diff
+				}
+				weight := o.weight * colorWeights[diff]
+				sum += weight * float64(v)
+				norm += weight
+			}
+			dst.Pix[y*dst.Stride+x] = clampUint8(sum / norm)
+		}
+	}
+
+	return dst
+}
+
+// MedianBlur replaces each pixel with the median of its size × size
+// neighbourhood. size must be odd.
+func MedianBlur(src *image.Gray, size int) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	if size%2 == 0 {
+		size++
+	}
+	radius := size / 2
+	window := make([]uint8, 0, size*size)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			window = window[:0]
+			for dy := -radius; dy <= radius; dy++ {
+				ny := clampInt(y+dy, 0, h-1)
+				for dx := -radius; dx <= radius; dx++ {
+					nx := clampInt(x+dx, 0, w-1)
+					window = append(window, src.Pix[ny*src.Stride+nx])
+				}
+			}
+			// Insertion sort is fastest for the small windows used here
+			for i := 1; i < len(window); i++ {
+				for j := i; j > 0 && window[j] < window[j-1]; j-- {
+					window[j], window[j-1] = window[j-1], window[j]
+				}
+			}
+			dst.Pix[y*dst.Stride+x] = window[len(window)/2]
+		}
+	}
+
+	return dst
+}
+
+// GaussianBlur blurs the image with a separable Gaussian kernel of the given
+// odd size. A non-positive sigma is derived from the size the same way as
+// OpenCV: 0.3*((size-1)*0.5 - 1) + 0.8.
+func GaussianBlur(src *image.Gray, size int, sigma float64) *image.Gray {
+	blurred := gaussianBlurFloat(src, size, sigma)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Pix[y*dst.Stride+x] = clampUint8(blurred[y*w+x])
+		}
+	}
+	return dst
+}
+
+// gaussianBlurFloat returns the Gaussian-blurred pixel values without rounding
+func gaussianBlurFloat(src *image.Gray, size int, sigma float64) []float64 {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if size%2 == 0 {
+		size++
+	}
+	if sigma <= 0 {
+		sigma = 0.3*((float64(size)-1)*0.5-1) + 0.8
+	}
+
+	radius := size / 2
+	kernel := make([]float64, size)
+	var total float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		total += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= total
+	}
+
+	// Horizontal pass followed by a vertical pass, replicating border pixels
+	horizontal := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x := 0; x < w; x++ {
+			var sum float64
+			for k, weight := range kernel {
+				sum += weight * float64(row[clampInt(x+k-radius, 0, w-1)])
+			}
+			horizontal[y*w+x] = sum
+		}
+	}
+
+	result := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum float64
+			for k, weight := range kernel {
+				sum += weight * horizontal[clampInt(y+k-radius, 0, h-1)*w+x]
+			}
+			result[y*w+x] = sum
+		}
+	}
+
+	return result
+}
+
+// AdaptiveThresholdGaussian binarizes the image against a local threshold:
+// a pixel becomes white when it is brighter than the Gaussian-weighted mean
+// of its blockSize × blockSize neighbourhood minus c, and black otherwise.
+func AdaptiveThresholdGaussian(src *image.Gray, blockSize int, c float64) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	mean := gaussianBlurFloat(src, blockSize, 0)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if float64(src.Pix[y*src.Stride+x]) > mean[y*w+x]-c {
+				dst.Pix[y*dst.Stride+x] = 255
+			}
+		}
+	}
+
+	return dst
+}
+
+// Erode replaces each pixel with the minimum of its size × size rectangle
+func Erode(src *image.Gray, size int) *image.Gray {
+	return morphology(src, size, func(a, b uint8) bool { return a < b })
+}
+
+// Dilate replaces each pixel with the maximum of its size × size rectangle
+func Dilate(src *image.Gray, size int) *image.Gray {
+	return morphology(src, size, func(a, b uint8) bool { return a > b })
+}
+
+// MorphOpen erodes then dilates, removing specks smaller than the kernel
+func MorphOpen(src *image.Gray, size int) *image.Gray {
+	return Dilate(Erode(src, size), size)
+}
+
+// MorphClose dilates then erodes, filling gaps smaller than the kernel
+func MorphClose(src *image.Gray, size int) *image.Gray {
+	return Erode(Dilate(src, size), size)
+}
+
+// morphology applies a separable rectangular min or max filter. The anchor
+// is the kernel centre, which for even sizes is size/2 like OpenCV.
+func morphology(src *image.Gray, size int, better func(a, b uint8) bool) *image.Gray {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if size <= 1 {
+		dst := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			copy(dst.Pix[y*dst.Stride:y*dst.Stride+w], src.Pix[y*src.Stride:])
+		}
+		return dst
+	}
+	anchor := size / 2
+
+	horizontal := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			best := src.Pix[y*src.Stride+clampInt(x-anchor, 0, w-1)]
+			for k := 1; k < size; k++ {
+				v := src.Pix[y*src.Stride+clampInt(x-anchor+k, 0, w-1)]
+				if better(v, best) {
+					best = v
+				}
+			}
+			horizontal.Pix[y*horizontal.Stride+x] = best
+		}
+	}
+
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			best := horizontal.Pix[clampInt(y-anchor, 0, h-1)*horizontal.Stride+x]
+			for k := 1; k < size; k++ {
+				v := horizontal.Pix[clampInt(y-anchor+k, 0, h-1)*horizontal.Stride+x]
+				if better(v, best) {
+					best = v
+				}
+			}
+			dst.Pix[y*dst.Stride+x] = best
+		}
+	}
+
+	return dst
+}
+
+// ResizeBicubic resizes any image to width × height with bicubic
+// interpolation (a = -0.75, matching OpenCV's INTER_CUBIC). Color images
+// are resized per channel and returned as RGBA; grayscale images stay gray.
+func ResizeBicubic(src image.Image, width, height int) image.Image {
+	if gray, ok := src.(*image.Gray); ok {
+		return resizeGrayBicubic(gray, width, height)
+	}
+
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			rgba.Set(x, y, src.At(x+bounds.Min.X, y+bounds.Min.Y))
+		}
+	}
+
+	// Resize each channel as a grayscale plane and recombine
+	channels := make([]*image.Gray, 4)
+	for c := range channels {
+		plane := image.NewGray(rgba.Rect)
+		for i := 0; i < len(plane.Pix); i++ {
+			plane.Pix[i] = rgba.Pix[i*4+c]
+		}
+		channels[c] = resizeGrayBicubic(plane, width, height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		for c := range channels {
+			dst.Pix[i*4+c] = channels[c].Pix[i]
+		}
+	}
+	return dst
+}
+
+// resizeGrayBicubic resizes a grayscale image with separable bicubic interpolation
+func resizeGrayBicubic(src *image.Gray, width, height int) *image.Gray {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	if sw == 0 || sh == 0 || width <= 0 || height <= 0 {
+		return dst
+	}
+
+	xIndex, xWeights := bicubicTaps(sw, width)
+	yIndex, yWeights := bicubicTaps(sh, height)
+
+	horizontal := make([]float64, sh*width)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x := 0; x < width; x++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += xWeights[x*4+k] * float64(row[xIndex[x*4+k]])
+			}
+			horizontal[y*width+x] = sum
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += yWeights[y*4+k] * horizontal[yIndex[y*4+k]*width+x]
+			}
+			dst.Pix[y*dst.Stride+x] = clampUint8(sum)
+		}
+	}
+
+	return dst
+}
+
+// bicubicTaps returns the four source indices and weights for each destination coordinate
+func bicubicTaps(srcSize, dstSize int) ([]int, []float64) {
+	const a = -0.75
+	cubic := func(t float64) float64 {
+		t = math.Abs(t)
+		switch {
+		case t <= 1:
+			return (a+2)*t*t*t - (a+3)*t*t + 1
+		case t < 2:
+			return a*t*t*t - 5*a*t*t + 8*a*t - 4*a
+		}
+		return 0
+	}
+
+	scale := float64(srcSize) / float64(dstSize)
+	indices := make([]int, dstSize*4)
+	weights := make([]float64, dstSize*4)
+	for i := 0; i < dstSize; i++ {
+		center := (float64(i)+0.5)*scale - 0.5
+		base := int(math.Floor(center))
+		frac := center - float64(base)
+		for k := 0; k < 4; k++ {
+			indices[i*4+k] = clampInt(base-1+k, 0, srcSize-1)
+			weights[i*4+k] = cubic(frac - float64(k-1))
+		}
+	}
+	return indices, weights
+}
+
+// CropNormalized returns a copy of the part of img inside the rectangle
+// (x, y, w, h), given as fractions of the image width and height. The
+// rectangle is clipped to the image.
+func CropNormalized(img image.Image, x, y, w, h float64) image.Image {
+	bounds := img.Bounds()
+	rect := image.Rect(
+		bounds.Min.X+int(math.Round(x*float64(bounds.Dx()))),
+		bounds.Min.Y+int(math.Round(y*float64(bounds.Dy()))),
+		bounds.Min.X+int(math.Round((x+w)*float64(bounds.Dx()))),
+		bounds.Min.Y+int(math.Round((y+h)*float64(bounds.Dy()))),
+	).Intersect(bounds)
+
+	// Keep binarized pipeline output in grayscale
+	var dst draw.Image = image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	}
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
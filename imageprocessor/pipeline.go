@@ -0,0 +1,287 @@
+package imageprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultPipelineSpec is the preprocessing applied before OCR. It crops the
+// card and corrects its perspective, upscales small images, boosts local
+// contrast, removes noise while keeping character edges and binarizes the
+// result for Tesseract.
+const DefaultPipelineSpec = "card:1012:85.6:54,upscale:800:600,grayscale,clahe:3:8,bilateral:9:75:75,adaptive_threshold:15:4,open:2,median:3"
+
+// Step is a named image preprocessing operation
+type Step interface {
+	// Name returns the step name and its arguments, e.g. "clahe:3:8"
+	Name() string
+	// Apply runs the step and returns a new image
+	Apply(img image.Image) (image.Image, error)
+}
+
+// Pipeline runs a sequence of preprocessing steps
+type Pipeline struct {
+	steps []Step
+}
+
+// NewPipeline creates a pipeline from the given steps
+func NewPipeline(steps ...Step) *Pipeline {
+	return &Pipeline{steps: steps}
+}
+
+// DefaultPipeline returns the pipeline described by DefaultPipelineSpec
+func DefaultPipeline() *Pipeline {
+	pipeline, err := ParsePipeline(DefaultPipelineSpec)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default pipeline: %v", err))
+	}
+	return pipeline
+}
+
+// ParsePipeline builds a pipeline from a comma-separated list of step names.
+// Each step may be followed by colon-separated numeric arguments that
+// override its defaults, e.g. "grayscale,median:5,adaptive_threshold:21:8".
+//
+// Available steps and their arguments (defaults in parentheses):
+//
+//	card:outputWidth:widthMM:heightMM (1012, 85.6, 54)
+//	card_optional:outputWidth:widthMM:heightMM (1012, 85.6, 54)
+//	grayscale
+//	upscale:minWidth:minHeight (800, 600)
+//	clahe:clipLimit:tiles (3, 8)
+//	bilateral:diameter:sigmaColor:sigmaSpace (9, 75, 75)
+//	median:size (3)
+//	adaptive_threshold:blockSize:c (15, 4)
+//	open:size (2)
+//	close:size (2)
+func ParsePipeline(spec string) (*Pipeline, error) {
+	var steps []Step
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		tokens := strings.Split(part, ":")
+		name := tokens[0]
+		builder, exists := stepBuilders[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown preprocessing step: %s", name)
+		}
+
+		if len(tokens)-1 > len(builder.defaults) {
+			return nil, fmt.Errorf("too many arguments for step %s: expected at most %d", name, len(builder.defaults))
+		}
+		args := append([]float64(nil), builder.defaults...)
+		for i, token := range tokens[1:] {
+			value, err := strconv.ParseFloat(token, 64)
+			if err != nil || value <= 0 {
+				return nil, fmt.Errorf("invalid argument %q for step %s", token, name)
+			}
+			args[i] = value
+		}
+
+		apply := builder.buildChecked
+		if apply == nil {
+			apply = func(args []float64) func(image.Image) (image.Image, error) {
+				filter := builder.build(args)
+				return func(img image.Image) (image.Image, error) { return filter(img), nil }
+			}
+		}
+		steps = append(steps, &funcStep{name: name, args: args, apply: apply(args)})
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("preprocessing pipeline is empty")
+	}
+	return NewPipeline(steps...), nil
+}
+
+// Run applies every step in order, stopping with ctx.Err() when ctx is done
+func (p *Pipeline) Run(ctx context.Context, img image.Image) (image.Image, error) {
+	for _, step := range p.steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var err error
+		img, err = step.Apply(img)
+		if err != nil {
+			return nil, fmt.Errorf("preprocessing step %s failed: %w", step.Name(), err)
+		}
+	}
+	return img, nil
+}
+
+// WithCardSize returns a copy of the pipeline whose card step rectifies
+// documents of the given size in millimetres, at the same resolution per
+// millimetre. Pipelines without a card step are returned unchanged.
+func (p *Pipeline) WithCardSize(widthMM, heightMM float64) *Pipeline {
+	return p.replaceCardSteps(func(name string, args []float64) (string, []float64) {
+		outputWidth := math.Round(args[0] * widthMM / args[1])
+		return name, []float64{outputWidth, widthMM, heightMM}
+	})
+}
+
+// WithOptionalCard returns a copy of the pipeline whose card step keeps the
+// image as it is when no card is found, for documents that are also issued
+// on paper of no fixed size
+func (p *Pipeline) WithOptionalCard() *Pipeline {
+	return p.replaceCardSteps(func(name string, args []float64) (string, []float64) {
+		return "card_optional", args
+	})
+}
+
+// replaceCardSteps returns a copy of the pipeline with every card step
+// rebuilt from the step name and arguments returned by replace
+func (p *Pipeline) replaceCardSteps(replace func(name string, args []float64) (string, []float64)) *Pipeline {
+	steps := make([]Step, len(p.steps))
+	copy(steps, p.steps)
+
+	for i, step := range steps {
+		card, ok := step.(*funcStep)
+		if !ok || (card.name != "card" && card.name != "card_optional") {
+			continue
+		}
+		name, args := replace(card.name, append([]float64(nil), card.args...))
+		steps[i] = &funcStep{name: name, args: args, apply: stepBuilders[name].buildChecked(args)}
+	}
+	return NewPipeline(steps...)
+}
+
+// String returns the pipeline specification, usable as a configuration version
+func (p *Pipeline) String() string {
+	names := make([]string, len(p.steps))
+	for i, step := range p.steps {
+		names[i] = step.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// funcStep is a Step backed by one of the filter functions
+type funcStep struct {
+	name  string
+	args  []float64
+	apply func(img image.Image) (image.Image, error)
+}
+
+// Name returns the step name followed by its arguments
+func (s *funcStep) Name() string {
+	parts := []string{s.name}
+	for _, arg := range s.args {
+		parts = append(parts, strconv.FormatFloat(arg, 'g', -1, 64))
+	}
+	return strings.Join(parts, ":")
+}
+
+// Apply runs the step
+func (s *funcStep) Apply(img image.Image) (image.Image, error) {
+	if img.Bounds().Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+	return s.apply(img)
+}
+
+// stepBuilder creates a step implementation from its arguments
+type stepBuilder struct {
+	defaults []float64
+	build    func(args []float64) func(img image.Image) image.Image
+	// buildChecked is used instead of build by steps that can fail
+	buildChecked func(args []float64) func(img image.Image) (image.Image, error)
+}
+
+// stepBuilders lists the preprocessing steps available to pipelines
+var stepBuilders = map[string]stepBuilder{
+	"card": {
+		defaults: []float64{1012, ID1WidthMM, ID1HeightMM},
+		buildChecked: func(args []float64) func(image.Image) (image.Image, error) {
+			detector := NewCardDetectorForAspect(args[1]/args[2], int(args[0]))
+			return detector.Rectify
+		},
+	},
+	"card_optional": {
+		defaults: []float64{1012, ID1WidthMM, ID1HeightMM},
+		buildChecked: func(args []float64) func(image.Image) (image.Image, error) {
+			detector := NewCardDetectorForAspect(args[1]/args[2], int(args[0]))
+			return func(img image.Image) (image.Image, error) {
+				rectified, err := detector.Rectify(img)
+				if errors.Is(err, ErrCardNotDetected) {
+					return img, nil
+				}
+				return rectified, err
+			}
+		},
+	},
+	"grayscale": {
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image { return ToGray(img) }
+		},
+	},
+	"upscale": {
+		defaults: []float64{800, 600},
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image {
+				return upscaleToMinimum(img, int(args[0]), int(args[1]))
+			}
+		},
+	},
+	"clahe": {
+		defaults: []float64{3, 8},
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image {
+				return CLAHE(ToGray(img), args[0], int(args[1]), int(args[1]))
+			}
+		},
+	},
+	"bilateral": {
+		defaults: []float64{9, 75, 75},
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image {
+				return BilateralFilter(ToGray(img), int(args[0]), args[1], args[2])
+			}
+		},
+	},
+	"median": {
+		defaults: []float64{3},
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image { return MedianBlur(ToGray(img), int(args[0])) }
+		},
+	},
+	"adaptive_threshold": {
+		defaults: []float64{15, 4},
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image {
+				return AdaptiveThresholdGaussian(ToGray(img), int(args[0]), args[1])
+			}
+		},
+	},
+	"open": {
+		defaults: []float64{2},
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image { return MorphOpen(ToGray(img), int(args[0])) }
+		},
+	},
+	"close": {
+		defaults: []float64{2},
+		build: func(args []float64) func(image.Image) image.Image {
+			return func(img image.Image) image.Image { return MorphClose(ToGray(img), int(args[0])) }
+		},
+	},
+}
+
+// upscaleToMinimum enlarges img so that it is at least minWidth × minHeight,
+// keeping the aspect ratio. Images that are already large enough are returned as is.
+func upscaleToMinimum(img image.Image, minWidth, minHeight int) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w >= minWidth && h >= minHeight {
+		return img
+	}
+
+	scale := math.Max(float64(minWidth)/float64(w), float64(minHeight)/float64(h))
+	return ResizeBicubic(img, int(math.Round(float64(w)*scale)), int(math.Round(float64(h)*scale)))
+}
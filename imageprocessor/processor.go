@@ -2,10 +2,18 @@ package imageprocessor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
+	_ "image/jpeg" // Register the JPEG decoder
+	"image/png"
+	"math"
 )
 
+// ErrInvalidImage is wrapped by errors for image data that cannot be decoded as PNG or JPEG
+var ErrInvalidImage = errors.New("failed to decode image")
+
 // Mat represents an image matrix - simplified type for basic image handling
 type Mat []byte
 
@@ -17,31 +25,89 @@ func (m Mat) ToBytes() ([]byte, error) {
 	return []byte(m), nil
 }
 
-// ImageProcessor handles image preprocessing operations without OpenCV
+// ImageProcessor handles image preprocessing operations in pure Go
 type ImageProcessor struct {
-	decoder *Base64Decoder
+	decoder  *Base64Decoder
+	pipeline *Pipeline
 }
 
-// NewImageProcessor creates a new ImageProcessor instance
+// NewImageProcessor creates a new ImageProcessor instance using the default pipeline
 func NewImageProcessor() *ImageProcessor {
+	return NewImageProcessorWithPipeline(DefaultPipeline())
+}
+
+// NewImageProcessorWithPipeline creates a new ImageProcessor that runs the given pipeline
+func NewImageProcessorWithPipeline(pipeline *Pipeline) *ImageProcessor {
+	return &ImageProcessor{
+		decoder:  NewBase64Decoder(),
+		pipeline: pipeline,
+	}
+}
+
+// ForDocumentSize returns a processor that rectifies documents of the given
+// size in millimetres instead of ID-1 cards
+func (ip *ImageProcessor) ForDocumentSize(widthMM, heightMM float64) *ImageProcessor {
+	if widthMM == ID1WidthMM && heightMM == ID1HeightMM {
+		return ip
+	}
 	return &ImageProcessor{
-		decoder: NewBase64Decoder(),
+		decoder:  ip.decoder,
+		pipeline: ip.pipeline.WithCardSize(widthMM, heightMM),
 	}
 }
 
-// ProcessImage performs basic image preprocessing pipeline
+// WithOptionalCard returns a processor that keeps images in which no card is
+// found instead of failing with ErrCardNotDetected
+func (ip *ImageProcessor) WithOptionalCard() *ImageProcessor {
+	return &ImageProcessor{
+		decoder:  ip.decoder,
+		pipeline: ip.pipeline.WithOptionalCard(),
+	}
+}
+
+// Pipeline returns the preprocessing pipeline run by ProcessImage
+func (ip *ImageProcessor) Pipeline() *Pipeline {
+	return ip.pipeline
+}
+
+// ProcessImage performs the image preprocessing pipeline
 // Input: Base64 encoded image string
-// Output: Processed image data as bytes
-func (ip *ImageProcessor) ProcessImage(base64Image string) (Mat, error) {
+// Output: Processed image data as PNG bytes
+// Processing stops early with ctx.Err() when ctx is done.
+func (ip *ImageProcessor) ProcessImage(ctx context.Context, base64Image string) (Mat, error) {
+	if err := ctx.Err(); err != nil {
+		return Mat{}, err
+	}
+
 	// Step 1: Decode Base64 image
 	imageData, err := ip.DecodeBase64(base64Image)
 	if err != nil {
 		return Mat{}, fmt.Errorf("failed to decode base64 image: %w", err)
 	}
 
-	// For now, just return the decoded image data
-	// In a full implementation, you would add image processing here
-	return Mat(imageData), nil
+	return ip.ProcessImageData(ctx, imageData)
+}
+
+// ProcessImageData performs the image preprocessing pipeline on PNG or JPEG
+// data, such as an image uploaded as binary
+func (ip *ImageProcessor) ProcessImageData(ctx context.Context, imageData []byte) (Mat, error) {
+	if err := ctx.Err(); err != nil {
+		return Mat{}, err
+	}
+
+	// Step 2: Decode PNG/JPEG data
+	img, err := decodeImage(imageData)
+	if err != nil {
+		return Mat{}, err
+	}
+
+	// Step 3: Run the preprocessing pipeline, which crops and rectifies the card first
+	processed, err := ip.pipeline.Run(ctx, img)
+	if err != nil {
+		return Mat{}, err
+	}
+
+	return EncodeMat(processed)
 }
 
 // DecodeBase64 decodes a Base64 encoded image string to byte slice with validation
@@ -49,57 +115,79 @@ func (ip *ImageProcessor) DecodeBase64(base64Image string) ([]byte, error) {
 	return ip.decoder.DecodeBase64(base64Image)
 }
 
-// ConvertToGrayscale converts a color image to grayscale (placeholder)
+// ConvertToGrayscale converts a color image to grayscale
 func (ip *ImageProcessor) ConvertToGrayscale(src Mat) (Mat, error) {
-	if len(src) == 0 {
-		return Mat{}, fmt.Errorf("source image is empty")
-	}
+	return applyToMat(src, func(img image.Image) image.Image {
+		return ToGray(img)
+	})
+}
 
-	// Decode image to verify format
-	_, format, err := image.DecodeConfig(bytes.NewReader(src))
-	if err != nil {
-		return Mat{}, fmt.Errorf("failed to decode image config: %w", err)
-	}
+// ApplyBinarization applies an adaptive Gaussian threshold to the image
+func (ip *ImageProcessor) ApplyBinarization(src Mat) (Mat, error) {
+	return applyToMat(src, func(img image.Image) image.Image {
+		return AdaptiveThresholdGaussian(ToGray(img), 15, 4)
+	})
+}
 
-	// For now, return original data
-	// In a full implementation, you would convert to grayscale
-	_ = format
-	return src, nil
+// ApplyNoiseReduction applies an edge-preserving bilateral filter to improve OCR accuracy
+func (ip *ImageProcessor) ApplyNoiseReduction(src Mat) (Mat, error) {
+	return applyToMat(src, func(img image.Image) image.Image {
+		return BilateralFilter(ToGray(img), 9, 75, 75)
+	})
 }
 
-// ApplyBinarization applies binary threshold to a grayscale image (placeholder)
-func (ip *ImageProcessor) ApplyBinarization(src Mat) (Mat, error) {
-	if len(src) == 0 {
-		return Mat{}, fmt.Errorf("source image is empty")
+// ResizeForOCR resizes the image to the target height, keeping the aspect ratio
+func (ip *ImageProcessor) ResizeForOCR(src Mat, targetHeight int) (Mat, error) {
+	if targetHeight <= 0 {
+		targetHeight = 600 // Default target height for OCR
 	}
 
-	// For now, return original data
-	// In a full implementation, you would apply binarization
-	return src, nil
+	return applyToMat(src, func(img image.Image) image.Image {
+		bounds := img.Bounds()
+		targetWidth := int(math.Round(float64(bounds.Dx()) * float64(targetHeight) / float64(bounds.Dy())))
+		return ResizeBicubic(img, max(targetWidth, 1), targetHeight)
+	})
 }
 
-// ApplyNoiseReduction applies noise reduction to improve OCR accuracy (placeholder)
-func (ip *ImageProcessor) ApplyNoiseReduction(src Mat) (Mat, error) {
+// applyToMat decodes src, applies fn and encodes the result as PNG
+func applyToMat(src Mat, fn func(img image.Image) image.Image) (Mat, error) {
 	if len(src) == 0 {
 		return Mat{}, fmt.Errorf("source image is empty")
 	}
 
-	// For now, return original data
-	// In a full implementation, you would reduce noise
-	return src, nil
+	img, err := decodeImage(src)
+	if err != nil {
+		return Mat{}, err
+	}
+
+	return EncodeMat(fn(img))
 }
 
-// ResizeForOCR resizes the image to optimal dimensions for OCR processing (placeholder)
-func (ip *ImageProcessor) ResizeForOCR(src Mat, targetHeight int) (Mat, error) {
-	if len(src) == 0 {
-		return Mat{}, fmt.Errorf("source image is empty")
+// decodeImage decodes PNG or JPEG data
+func decodeImage(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+	if img.Bounds().Empty() {
+		return nil, fmt.Errorf("%w: decoded image is empty", ErrInvalidImage)
 	}
+	return img, nil
+}
 
-	if targetHeight <= 0 {
-		targetHeight = 600 // Default target height for OCR
+// DecodeMat decodes a processed image
+func DecodeMat(m Mat) (image.Image, error) {
+	if len(m) == 0 {
+		return nil, fmt.Errorf("empty Mat data")
 	}
+	return decodeImage(m)
+}
 
-	// For now, return original data
-	// In a full implementation, you would resize the image
-	return src, nil
+// EncodeMat encodes an image as PNG, the lossless format handed to the OCR engine
+func EncodeMat(img image.Image) (Mat, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Mat{}, fmt.Errorf("failed to encode processed image: %w", err)
+	}
+	return Mat(buf.Bytes()), nil
 }
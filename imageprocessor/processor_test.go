@@ -0,0 +1,138 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// newTestImage returns a white image with a black rectangle, like text on a card
+func newTestImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 240, G: 235, B: 230, A: 255}
+			if x >= w/4 && x < w/2 && y >= h/4 && y < h/2 {
+				c = color.RGBA{R: 20, G: 20, B: 30, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// TestParsePipeline tests pipeline specification parsing
+func TestParsePipeline(t *testing.T) {
+	pipeline, err := ParsePipeline("grayscale, median:5 ,adaptive_threshold:21")
+	if err != nil {
+		t.Fatalf("Expected pipeline to parse, got error: %v", err)
+	}
+	if got := pipeline.String(); got != "grayscale,median:5,adaptive_threshold:21:4" {
+		t.Errorf("Unexpected pipeline specification: %s", got)
+	}
+
+	invalid := []string{"", "sharpen", "median:abc", "median:0", "median:3:3"}
+	for _, spec := range invalid {
+		if _, err := ParsePipeline(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+
+	if got := DefaultPipeline().String(); got != DefaultPipelineSpec {
+		t.Errorf("Default pipeline %s does not match its specification %s", got, DefaultPipelineSpec)
+	}
+
+	resized := DefaultPipeline().WithCardSize(TD3WidthMM, TD3HeightMM).String()
+	if !strings.HasPrefix(resized, "card:1478:125:88,upscale:") {
+		t.Errorf("Expected card step for a TD3 page at the same resolution, got %s", resized)
+	}
+}
+
+// TestFilters tests the basic behaviour of the preprocessing filters
+func TestFilters(t *testing.T) {
+	gray := ToGray(newTestImage(40, 20))
+	if gray.GrayAt(0, 0).Y < 200 || gray.GrayAt(15, 7).Y > 40 {
+		t.Fatalf("Unexpected grayscale values: %d, %d", gray.GrayAt(0, 0).Y, gray.GrayAt(15, 7).Y)
+	}
+
+	binary := AdaptiveThresholdGaussian(gray, 15, 4)
+	for _, v := range binary.Pix {
+		if v != 0 && v != 255 {
+			t.Fatalf("Expected binary output, got value %d", v)
+		}
+	}
+	if binary.GrayAt(12, 6).Y != 0 {
+		t.Errorf("Expected dark rectangle edge to be black after thresholding")
+	}
+
+	// A single dark speck on a white background is removed by closing and by median blur
+	speck := image.NewGray(image.Rect(0, 0, 10, 10))
+	for i := range speck.Pix {
+		speck.Pix[i] = 255
+	}
+	speck.SetGray(5, 5, color.Gray{Y: 0})
+	if MorphClose(speck, 2).GrayAt(5, 5).Y != 255 {
+		t.Errorf("Expected closing to fill a one-pixel speck")
+	}
+	if MedianBlur(speck, 3).GrayAt(5, 5).Y != 255 {
+		t.Errorf("Expected median blur to remove a one-pixel speck")
+	}
+
+	resized := ResizeBicubic(gray, 80, 40)
+	if resized.Bounds().Dx() != 80 || resized.Bounds().Dy() != 40 {
+		t.Errorf("Unexpected resized bounds: %v", resized.Bounds())
+	}
+
+	uniform := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range uniform.Pix {
+		uniform.Pix[i] = 128
+	}
+	if v := BilateralFilter(uniform, 9, 75, 75).GrayAt(8, 8).Y; v != 128 {
+		t.Errorf("Expected bilateral filter to keep a uniform image, got %d", v)
+	}
+	if CLAHE(gray, 3, 8, 8).Bounds() != gray.Bounds() {
+		t.Errorf("Expected CLAHE to keep image bounds")
+	}
+}
+
+// TestProcessImage tests the full preprocessing pipeline on a base64 PNG
+func TestProcessImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newTestImage(200, 126)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	processor := NewImageProcessor()
+	mat, err := processor.ProcessImage(context.Background(), base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected image to be processed, got error: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(mat))
+	if err != nil {
+		t.Fatalf("Expected processed image to be a PNG: %v", err)
+	}
+	if img.Bounds().Dx() < 800 || img.Bounds().Dy() < 600 {
+		t.Errorf("Expected small image to be upscaled, got %v", img.Bounds())
+	}
+	if _, ok := img.(*image.Gray); !ok {
+		t.Errorf("Expected grayscale output, got %T", img)
+	}
+
+	// Binary uploads skip the base64 step but run the same pipeline
+	raw, err := processor.ProcessImageData(context.Background(), buf.Bytes())
+	if err != nil || !bytes.Equal(raw, mat) {
+		t.Errorf("Expected binary image to be processed like its base64 encoding, got error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := processor.ProcessImage(ctx, base64.StdEncoding.EncodeToString(buf.Bytes())); err == nil {
+		t.Errorf("Expected cancelled context to stop processing")
+	}
+}
@@ -0,0 +1,244 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"ocr-web-api/seal"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File name extensions of the files a FileStore keeps per job
+const (
+	jobFileExt     = ".json"
+	requestFileExt = ".request"
+
+	// tmpFileInfix marks the temporary files that are renamed over job files
+	tmpFileInfix = ".tmp"
+)
+
+// FileStore keeps each job as a JSON file in a directory, next to a file
+// holding its request, so that jobs survive restarts. Files are replaced
+// atomically, so a crash never leaves a partially written job behind.
+//
+// Requests carry the document images and jobs their results, so every file
+// is encrypted. Files that cannot be decrypted, such as those written with
+// another key, are treated as unreadable and removed by Prune.
+type FileStore struct {
+	dir string
+	box *seal.Box
+}
+
+// Ensure FileStore satisfies the Store interface
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore opens a file store in dir, creating the directory if needed.
+// Files are encrypted with a key derived from secret, which must not be empty.
+func NewFileStore(dir, secret string) (*FileStore, error) {
+	box, err := seal.New(secret)
+	if err != nil {
+		return nil, fmt.Errorf("job store: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %w", err)
+	}
+	return &FileStore{dir: dir, box: box}, nil
+}
+
+// Create stores a new job together with its request. The request is written
+// first, so that a listed job always has one.
+func (s *FileStore) Create(_ context.Context, job *Job, request []byte) error {
+	if !validID(job.ID) {
+		return fmt.Errorf("invalid job id %q", job.ID)
+	}
+	if err := s.writeFile(job.ID+requestFileExt, request); err != nil {
+		return err
+	}
+	return s.writeJob(job)
+}
+
+// Get returns the job with the given ID
+func (s *FileStore) Get(_ context.Context, id string) (*Job, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	return s.readJob(id + jobFileExt)
+}
+
+// Request returns the request of a job that is not done yet
+func (s *FileStore) Request(_ context.Context, id string) ([]byte, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	return s.readFile(id + requestFileExt)
+}
+
+// Update replaces a stored job
+func (s *FileStore) Update(_ context.Context, job *Job) error {
+	if !validID(job.ID) {
+		return ErrNotFound
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, job.ID+jobFileExt)); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err := s.writeJob(job); err != nil {
+		return err
+	}
+	if job.Status.Done() {
+		return s.remove(job.ID + requestFileExt)
+	}
+	return nil
+}
+
+// List returns all stored jobs. Files that cannot be read are skipped.
+func (s *FileStore) List(_ context.Context) ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job store directory: %w", err)
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), jobFileExt)
+		if !ok || !validID(id) {
+			continue
+		}
+		if job, err := s.readJob(entry.Name()); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// Delete removes a job and its request
+func (s *FileStore) Delete(_ context.Context, id string) error {
+	if !validID(id) {
+		return nil
+	}
+	if err := s.remove(id + requestFileExt); err != nil {
+		return err
+	}
+	return s.remove(id + jobFileExt)
+}
+
+// Prune removes the request files of jobs that are done, missing or
+// unreadable, and the temporary files of writes interrupted by a crash.
+// Unreadable jobs, e.g. encrypted with another key, are removed as well,
+// since they can never be resumed nor expire.
+func (s *FileStore) Prune(ctx context.Context) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list job store directory: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.Contains(name, tmpFileInfix) {
+			errs = append(errs, s.remove(name))
+			continue
+		}
+
+		if id, ok := strings.CutSuffix(name, jobFileExt); ok && validID(id) {
+			if _, err := s.readJob(name); err != nil && !errors.Is(err, ErrNotFound) {
+				errs = append(errs, s.Delete(ctx, id))
+			}
+			continue
+		}
+
+		id, ok := strings.CutSuffix(name, requestFileExt)
+		if !ok || !validID(id) {
+			continue
+		}
+		job, err := s.readJob(id + jobFileExt)
+		switch {
+		case errors.Is(err, ErrNotFound), err == nil && job.Status.Done():
+			errs = append(errs, s.remove(name))
+		case err != nil:
+			errs = append(errs, s.Delete(ctx, id))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readJob decodes a job file
+func (s *FileStore) readJob(name string) (*Job, error) {
+	data, err := s.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job file %s: %w", name, err)
+	}
+	return &job, nil
+}
+
+// writeJob encodes a job file
+func (s *FileStore) writeJob(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	return s.writeFile(job.ID+jobFileExt, data)
+}
+
+// readFile reads and decrypts a file of the store
+func (s *FileStore) readFile(name string) ([]byte, error) {
+	sealed, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.box.Open(name, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job file %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// writeFile encrypts data and replaces a file by renaming a fully written
+// temporary file over it
+func (s *FileStore) writeFile(name string, data []byte) error {
+	data, err := s.box.Seal(name, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt job file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, name+tmpFileInfix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create job file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	return nil
+}
+
+// remove deletes a file of the store, ignoring files that do not exist
+func (s *FileStore) remove(name string) error {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Status is the processing state of a job
+type Status string
+
+// Job statuses. Queued and running jobs are requeued when the server restarts.
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Done reports whether the job has completed, successfully or not
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+// Job is an asynchronously processed request. Result and Error hold the JSON
+// response the synchronous endpoint would have returned; exactly one of them
+// is set once the job is done. Owner is the ID of the API key the job was
+// submitted with, empty without authentication.
+type Job struct {
+	ID          string          `json:"id"`
+	Owner       string          `json:"owner,omitempty"`
+	Status      Status          `json:"status"`
+	CallbackURL string          `json:"callbackUrl,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       json.RawMessage `json:"error,omitempty"`
+	Webhook     *WebhookStatus  `json:"webhook,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	StartedAt   *time.Time      `json:"startedAt,omitempty"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+}
+
+// WebhookStatus records the delivery of the completion callback of a job
+type WebhookStatus struct {
+	Delivered bool      `json:"delivered"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	LastTry   time.Time `json:"lastAttemptAt"`
+}
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("job not found")
+
+// idLength is the number of hex digits of a job ID
+const idLength = 32
+
+// newID returns a random job ID
+func newID() (string, error) {
+	var id [idLength / 2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// validID reports whether id has the form of a job ID. Stores reject other
+// IDs, so that client input never reaches a file path.
+func validID(id string) bool {
+	if len(id) != idLength {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// clone returns a copy of the job that can be modified independently
+func (j *Job) clone() *Job {
+	c := *j
+	if j.Webhook != nil {
+		webhook := *j.Webhook
+		c.Webhook = &webhook
+	}
+	return &c
+}
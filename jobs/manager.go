@@ -0,0 +1,350 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"ocr-web-api/logging"
+	"sync"
+	"time"
+)
+
+// Manager defaults
+const (
+	DefaultTimeout   = 5 * time.Minute
+	DefaultQueueSize = 100
+	DefaultRetention = 24 * time.Hour
+)
+
+// ErrQueueFull is returned by Submit when too many jobs are waiting
+var ErrQueueFull = errors.New("job queue is full")
+
+// errRequestUnavailable is the error of a job whose request cannot be loaded,
+// in the shape of the errors of the API
+var errRequestUnavailable = json.RawMessage(`{"code":"INTERNAL_ERROR","status":500,"message":"request of the job is no longer available"}`)
+
+// Runner processes the request of a job. It returns the JSON result on
+// success, or the JSON error response otherwise.
+type Runner func(ctx context.Context, request []byte) (result, failure json.RawMessage)
+
+// Config configures a Manager
+type Config struct {
+	Workers   int           // Number of jobs processed at once
+	QueueSize int           // Number of jobs that may wait for a worker
+	Timeout   time.Duration // Processing time limit of a job
+	Retention time.Duration // How long completed jobs are kept
+
+	// Notifier delivers completion callbacks; jobs with a callback URL
+	// are refused when it is nil
+	Notifier *Notifier
+
+	// Logger receives errors of background work; defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Manager runs jobs on a fixed number of workers. Jobs that were queued or
+// running when the server stopped are requeued by Start, and callbacks that
+// were not attempted yet are sent again, so delivery is at least once.
+type Manager struct {
+	store  Store
+	run    Runner
+	config Config
+	queue  chan string
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stop     chan struct{} // Closed by Shutdown to stop taking jobs from the queue
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewManager creates a manager that processes jobs of store with run
+func NewManager(store Store, run Runner, config Config) *Manager {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		store:  store,
+		run:    run,
+		config: config,
+		queue:  make(chan string, config.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start resumes the jobs left unfinished by a previous run and starts the
+// workers. Requests left behind by jobs that finished are deleted first.
+func (m *Manager) Start() error {
+	if err := m.store.Prune(m.ctx); err != nil {
+		return fmt.Errorf("failed to prune job requests: %w", err)
+	}
+
+	jobs, err := m.store.List(m.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	var pending []string
+	for _, job := range jobs {
+		switch {
+		case !job.Status.Done():
+			job.Status = StatusQueued
+			job.StartedAt = nil
+			if err := m.store.Update(m.ctx, job); err != nil {
+				return fmt.Errorf("failed to requeue job %s: %w", job.ID, err)
+			}
+			pending = append(pending, job.ID)
+		case job.CallbackURL != "" && job.Webhook == nil && m.config.Notifier != nil:
+			job := job
+			m.goBackground(func() { m.notify(job) })
+		}
+	}
+
+	for i := 0; i < m.config.Workers; i++ {
+		m.goBackground(m.work)
+	}
+	m.goBackground(m.expire)
+
+	// More jobs may be pending than fit into the queue
+	m.goBackground(func() {
+		for _, id := range pending {
+			select {
+			case m.queue <- id:
+			case <-m.stop:
+				return
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Close stops the workers and waits for them. Jobs that are interrupted stay
+// in the store and are resumed by the next Start.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Shutdown stops taking jobs from the queue and waits for the running jobs
+// and their callbacks to finish. When ctx is done first, the remaining work is
+// interrupted as by Close. Queued jobs stay in the store and are resumed by
+// the next Start.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		m.cancel()
+		return nil
+	case <-ctx.Done():
+		m.Close()
+		return ctx.Err()
+	}
+}
+
+// Submit stores a new job for request and queues it. The owner is recorded
+// on the job so that only its submitter can read it.
+func (m *Manager) Submit(ctx context.Context, owner string, request []byte, callbackURL string) (*Job, error) {
+	if callbackURL != "" && m.config.Notifier == nil {
+		return nil, errors.New("callbacks are not configured")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job id: %w", err)
+	}
+
+	job := &Job{
+		ID:          id,
+		Owner:       owner,
+		Status:      StatusQueued,
+		CallbackURL: callbackURL,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := m.store.Create(ctx, job, request); err != nil {
+		return nil, fmt.Errorf("failed to store job: %w", err)
+	}
+
+	select {
+	case m.queue <- id:
+		return job, nil
+	default:
+		if err := m.store.Delete(ctx, id); err != nil {
+			m.config.Logger.ErrorContext(ctx, "Failed to delete rejected job", "job_id", id, "error", err)
+		}
+		return nil, ErrQueueFull
+	}
+}
+
+// Get returns the job with the given ID, or ErrNotFound
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	return m.store.Get(ctx, id)
+}
+
+// goBackground runs fn in a goroutine that Close waits for
+func (m *Manager) goBackground(fn func()) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		fn()
+	}()
+}
+
+// work processes queued jobs until the manager is shut down or closed
+func (m *Manager) work() {
+	for {
+		// Stop before taking another job, even when more are queued
+		select {
+		case <-m.stop:
+			return
+		default:
+		}
+
+		select {
+		case id := <-m.queue:
+			m.process(id)
+		case <-m.stop:
+			return
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// process runs a single job and stores its outcome
+func (m *Manager) process(id string) {
+	job, err := m.store.Get(m.ctx, id)
+	if err != nil {
+		m.config.Logger.Error("Failed to load job", "job_id", id, "error", err)
+		return
+	}
+	request, err := m.store.Request(m.ctx, id)
+	if err != nil {
+		// The job can never run; fail it rather than leave it queued for good
+		m.config.Logger.Error("Failed to load request of job", "job_id", id, "error", err)
+		m.complete(job, nil, errRequestUnavailable)
+		return
+	}
+
+	startedAt := time.Now().UTC()
+	job.Status = StatusRunning
+	job.StartedAt = &startedAt
+	if err := m.store.Update(m.ctx, job); err != nil {
+		m.config.Logger.Error("Failed to update job", "job_id", id, "error", err)
+		return
+	}
+
+	// Records logged while the job runs carry its ID
+	ctx, cancel := context.WithTimeout(logging.With(m.ctx, slog.String("job_id", id)), m.config.Timeout)
+	result, failure := m.run(ctx, request)
+	cancel()
+
+	// The job was interrupted by Close; leave it to be resumed
+	if m.ctx.Err() != nil {
+		return
+	}
+
+	m.complete(job, result, failure)
+}
+
+// complete stores the outcome of a job, which drops its request, and sends
+// its callback
+func (m *Manager) complete(job *Job, result, failure json.RawMessage) {
+	completedAt := time.Now().UTC()
+	job.CompletedAt = &completedAt
+	if failure != nil {
+		job.Status = StatusFailed
+		job.Error = failure
+	} else {
+		job.Status = StatusSucceeded
+		job.Result = result
+	}
+	if err := m.store.Update(m.ctx, job); err != nil {
+		m.config.Logger.Error("Failed to store outcome of job", "job_id", job.ID, "error", err)
+		return
+	}
+
+	if job.CallbackURL != "" {
+		m.notify(job)
+	}
+}
+
+// notify delivers the callback of a completed job and records the delivery
+func (m *Manager) notify(job *Job) {
+	status := m.config.Notifier.Deliver(m.ctx, job)
+	if !status.Delivered && m.ctx.Err() != nil {
+		// Interrupted by Close; the next Start sends the callback again
+		return
+	}
+
+	job.Webhook = status
+	if !job.Webhook.Delivered {
+		m.config.Logger.Error("Failed to deliver callback of job", "job_id", job.ID, "attempts", job.Webhook.Attempts, "error", job.Webhook.Error)
+	}
+
+	// Use a fresh context so that a delivery is recorded even during Close
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.store.Update(ctx, job); err != nil {
+		m.config.Logger.Error("Failed to record callback of job", "job_id", job.ID, "error", err)
+	}
+}
+
+// expire periodically deletes jobs completed longer than the retention ago
+func (m *Manager) expire() {
+	ticker := time.NewTicker(min(m.config.Retention, time.Hour))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.deleteExpired(time.Now().Add(-m.config.Retention))
+		case <-m.stop:
+			return
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// deleteExpired deletes jobs that completed before cutoff
+func (m *Manager) deleteExpired(cutoff time.Time) {
+	jobs, err := m.store.List(m.ctx)
+	if err != nil {
+		m.config.Logger.Error("Failed to list expired jobs", "error", err)
+		return
+	}
+	for _, job := range jobs {
+		if job.CompletedAt != nil && job.CompletedAt.Before(cutoff) {
+			if err := m.store.Delete(m.ctx, job.ID); err != nil {
+				m.config.Logger.Error("Failed to delete expired job", "job_id", job.ID, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForJob polls the store until the job is done
+func waitForJob(t *testing.T, store Store, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := store.Get(context.Background(), id)
+		if err == nil && job.Status.Done() && (job.CallbackURL == "" || job.Webhook != nil) {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not complete", id)
+	return nil
+}
+
+// echoRunner succeeds with the request as result, or fails for "fail"
+func echoRunner(_ context.Context, request []byte) (json.RawMessage, json.RawMessage) {
+	if string(request) == `"fail"` {
+		return nil, json.RawMessage(`{"code":422,"message":"failed"}`)
+	}
+	return json.RawMessage(request), nil
+}
+
+// TestManagerProcessesJobs tests that submitted jobs run to completion
+func TestManagerProcessesJobs(t *testing.T) {
+	store := NewMemoryStore()
+	manager := NewManager(store, echoRunner, Config{Workers: 2})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Close()
+
+	succeeded, err := manager.Submit(context.Background(), "partner", []byte(`{"ok":true}`), "")
+	if err != nil || succeeded.Status != StatusQueued {
+		t.Fatalf("Expected queued job, got %+v (%v)", succeeded, err)
+	}
+	failed, _ := manager.Submit(context.Background(), "", []byte(`"fail"`), "")
+
+	job := waitForJob(t, store, succeeded.ID)
+	if job.Status != StatusSucceeded || string(job.Result) != `{"ok":true}` || job.StartedAt == nil || job.CompletedAt == nil || job.Owner != "partner" {
+		t.Errorf("Expected succeeded job of its owner with result, got %+v", job)
+	}
+	job = waitForJob(t, store, failed.ID)
+	if job.Status != StatusFailed || string(job.Error) != `{"code":422,"message":"failed"}` || job.Result != nil {
+		t.Errorf("Expected failed job with error, got %+v", job)
+	}
+
+	if _, err := manager.Submit(context.Background(), "", nil, "http://example.com/callback"); err == nil {
+		t.Errorf("Expected callback to be refused without a notifier")
+	}
+}
+
+// TestManagerQueueFull tests that jobs beyond the queue size are rejected
+func TestManagerQueueFull(t *testing.T) {
+	store := NewMemoryStore()
+	manager := NewManager(store, echoRunner, Config{QueueSize: 1})
+
+	// Without Start nothing takes jobs off the queue
+	if _, err := manager.Submit(context.Background(), "", []byte("1"), ""); err != nil {
+		t.Fatalf("Expected first job to be queued, got %v", err)
+	}
+	if _, err := manager.Submit(context.Background(), "", []byte("2"), ""); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if jobs, _ := store.List(context.Background()); len(jobs) != 1 {
+		t.Errorf("Expected rejected job to be removed, got %d jobs", len(jobs))
+	}
+}
+
+// TestManagerResumesJobs tests that unfinished jobs and callbacks of a
+// previous run are resumed on Start
+func TestManagerResumesJobs(t *testing.T) {
+	callbacks := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var job Job
+		json.Unmarshal(body, &job)
+		callbacks <- job.ID
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir(), "secret")
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+
+	running, _ := newID()
+	store.Create(ctx, &Job{ID: running, Status: StatusRunning, CallbackURL: server.URL}, []byte(`{"n":1}`))
+	completed, _ := newID()
+	store.Create(ctx, &Job{ID: completed, Status: StatusQueued, CallbackURL: server.URL}, nil)
+	store.Update(ctx, &Job{ID: completed, Status: StatusSucceeded, CallbackURL: server.URL, Result: json.RawMessage(`{}`)})
+
+	manager := NewManager(store, echoRunner, Config{Notifier: NewNotifier("secret").WithAllowedHosts("127.0.0.1")})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Close()
+
+	job := waitForJob(t, store, running)
+	if job.Status != StatusSucceeded || string(job.Result) != `{"n":1}` || job.Webhook == nil || !job.Webhook.Delivered {
+		t.Errorf("Expected interrupted job to be run and reported, got %+v", job)
+	}
+	job = waitForJob(t, store, completed)
+	if job.Webhook == nil || !job.Webhook.Delivered {
+		t.Errorf("Expected pending callback to be delivered, got %+v", job)
+	}
+
+	delivered := map[string]bool{<-callbacks: true, <-callbacks: true}
+	if !delivered[running] || !delivered[completed] {
+		t.Errorf("Expected callbacks for both jobs, got %v", delivered)
+	}
+}
+
+// TestManagerDeletesExpiredJobs tests the retention of completed jobs
+func TestManagerDeletesExpiredJobs(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now()
+
+	store.Create(ctx, &Job{ID: "old", Status: StatusSucceeded, CompletedAt: &old}, nil)
+	store.Create(ctx, &Job{ID: "recent", Status: StatusSucceeded, CompletedAt: &recent}, nil)
+	store.Create(ctx, &Job{ID: "queued", Status: StatusQueued}, nil)
+
+	manager := NewManager(store, echoRunner, Config{Retention: time.Hour})
+	manager.deleteExpired(time.Now().Add(-time.Hour))
+
+	if _, err := store.Get(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected expired job to be deleted")
+	}
+	for _, id := range []string{"recent", "queued"} {
+		if _, err := store.Get(ctx, id); err != nil {
+			t.Errorf("Expected %s job to be kept, got %v", id, err)
+		}
+	}
+}
+
+// TestManagerFailsJobWithoutRequest tests that a job whose request was lost
+// is failed instead of staying queued
+func TestManagerFailsJobWithoutRequest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir, "secret")
+
+	id, _ := newID()
+	store.Create(ctx, &Job{ID: id, Status: StatusQueued}, []byte(`{"n":1}`))
+	os.Remove(filepath.Join(dir, id+requestFileExt))
+
+	manager := NewManager(store, echoRunner, Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Close()
+
+	job := waitForJob(t, store, id)
+	if job.Status != StatusFailed || string(job.Error) != string(errRequestUnavailable) {
+		t.Errorf("Expected job to fail without its request, got %+v", job)
+	}
+}
+
+// TestManagerShutdown tests that Shutdown lets the running job finish and
+// leaves queued jobs to the next Start
+func TestManagerShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	blockingRunner := func(ctx context.Context, request []byte) (json.RawMessage, json.RawMessage) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return json.RawMessage(request), nil
+		case <-ctx.Done():
+			return nil, json.RawMessage(`{"code":500,"message":"interrupted"}`)
+		}
+	}
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	manager := NewManager(store, blockingRunner, Config{Workers: 1})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+
+	running, _ := manager.Submit(ctx, "", []byte(`{"n":1}`), "")
+	<-started
+	queued, _ := manager.Submit(ctx, "", []byte(`{"n":2}`), "")
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- manager.Shutdown(ctx) }()
+	<-manager.stop
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Expected shutdown to finish the running job, got %v", err)
+	}
+
+	if job, _ := store.Get(ctx, running.ID); job.Status != StatusSucceeded {
+		t.Errorf("Expected running job to finish, got %+v", job)
+	}
+	if job, _ := store.Get(ctx, queued.ID); job.Status != StatusQueued {
+		t.Errorf("Expected queued job to stay queued, got %+v", job)
+	}
+
+	// Jobs still running at the deadline are interrupted and resumed later
+	release = make(chan struct{})
+	manager = NewManager(store, blockingRunner, Config{Workers: 1})
+	manager.Start()
+	<-started
+	deadline, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := manager.Shutdown(deadline); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected shutdown to time out, got %v", err)
+	}
+	if job, _ := store.Get(ctx, queued.ID); job.Status != StatusRunning {
+		t.Errorf("Expected interrupted job to be left for the next Start, got %+v", job)
+	}
+}
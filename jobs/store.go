@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// Store persists jobs and the requests they process. The request of a job
+// is only kept until the job is done; Prune removes those that outlived it.
+type Store interface {
+	// Create stores a new job together with its request
+	Create(ctx context.Context, job *Job, request []byte) error
+
+	// Get returns the job with the given ID, or ErrNotFound
+	Get(ctx context.Context, id string) (*Job, error)
+
+	// Request returns the request of a job that is not done yet, or ErrNotFound
+	Request(ctx context.Context, id string) ([]byte, error)
+
+	// Update replaces a stored job and drops its request once it is done
+	Update(ctx context.Context, job *Job) error
+
+	// List returns all stored jobs
+	List(ctx context.Context) ([]*Job, error)
+
+	// Delete removes a job and its request
+	Delete(ctx context.Context, id string) error
+
+	// Prune drops the requests of jobs that are done or no longer stored
+	Prune(ctx context.Context) error
+}
+
+// MemoryStore keeps jobs in memory. Jobs are lost when the server stops.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	jobs     map[string]*Job
+	requests map[string][]byte
+}
+
+// Ensure MemoryStore satisfies the Store interface
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory job store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:     make(map[string]*Job),
+		requests: make(map[string][]byte),
+	}
+}
+
+// Create stores a new job together with its request
+func (s *MemoryStore) Create(_ context.Context, job *Job, request []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job.clone()
+	s.requests[job.ID] = request
+	return nil
+}
+
+// Get returns the job with the given ID
+func (s *MemoryStore) Get(_ context.Context, id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return job.clone(), nil
+}
+
+// Request returns the request of a job that is not done yet
+func (s *MemoryStore) Request(_ context.Context, id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	request, ok := s.requests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return request, nil
+}
+
+// Update replaces a stored job
+func (s *MemoryStore) Update(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; !ok {
+		return ErrNotFound
+	}
+	s.jobs[job.ID] = job.clone()
+	if job.Status.Done() {
+		delete(s.requests, job.ID)
+	}
+	return nil
+}
+
+// List returns all stored jobs
+func (s *MemoryStore) List(_ context.Context) ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	return jobs, nil
+}
+
+// Delete removes a job and its request
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, id)
+	delete(s.requests, id)
+	return nil
+}
+
+// Prune drops the requests of jobs that are done or no longer stored
+func (s *MemoryStore) Prune(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.requests {
+		if job, ok := s.jobs[id]; !ok || job.Status.Done() {
+			delete(s.requests, id)
+		}
+	}
+	return nil
+}
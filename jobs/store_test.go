@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStores runs the same checks against every store backend
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+		"file": func(t *testing.T) Store {
+			store, err := NewFileStore(t.TempDir(), "secret")
+			if err != nil {
+				t.Fatalf("Failed to open file store: %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, newStore(t))
+		})
+	}
+}
+
+// testStore tests the lifecycle of a job in a store
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	id, _ := newID()
+	job := &Job{ID: id, Status: StatusQueued, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := store.Create(ctx, job, []byte(`{"image":"abc"}`)); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// Stored jobs are copies
+	job.Status = StatusRunning
+	stored, err := store.Get(ctx, id)
+	if err != nil || stored.Status != StatusQueued || !stored.CreatedAt.Equal(job.CreatedAt) {
+		t.Fatalf("Expected queued job, got %+v (%v)", stored, err)
+	}
+
+	request, err := store.Request(ctx, id)
+	if err != nil || string(request) != `{"image":"abc"}` {
+		t.Errorf("Expected stored request, got %q (%v)", request, err)
+	}
+
+	// Completing a job drops its request
+	stored.Status = StatusSucceeded
+	stored.Result = json.RawMessage(`{"documentType":"passport"}`)
+	if err := store.Update(ctx, stored); err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+	if _, err := store.Request(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected request of completed job to be dropped, got %v", err)
+	}
+
+	jobs, err := store.List(ctx)
+	if err != nil || len(jobs) != 1 || jobs[0].Status != StatusSucceeded || string(jobs[0].Result) != `{"documentType":"passport"}` {
+		t.Errorf("Expected one succeeded job, got %+v (%v)", jobs, err)
+	}
+
+	if err := store.Delete(ctx, id); err != nil {
+		t.Fatalf("Failed to delete job: %v", err)
+	}
+	if _, err := store.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted job to be gone, got %v", err)
+	}
+	if err := store.Update(ctx, stored); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected update of deleted job to fail, got %v", err)
+	}
+
+	// IDs that were never issued are not found rather than looked up
+	for _, id := range []string{"", "../jobs", "0123456789abcdef"} {
+		if _, err := store.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected %q to be not found, got %v", id, err)
+		}
+	}
+}
+
+// TestFileStoreSurvivesRestart tests that a reopened file store still has its jobs
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, _ := NewFileStore(dir, "secret")
+	id, _ := newID()
+	if err := store.Create(ctx, &Job{ID: id, Status: StatusRunning}, []byte("request")); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// Leftovers of an interrupted write are ignored
+	os.WriteFile(filepath.Join(dir, id+".json.tmp123"), []byte("{"), 0o600)
+
+	reopened, err := NewFileStore(dir, "secret")
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	jobs, err := reopened.List(ctx)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != id || jobs[0].Status != StatusRunning {
+		t.Errorf("Expected running job after restart, got %+v (%v)", jobs, err)
+	}
+	if request, err := reopened.Request(ctx, id); err != nil || string(request) != "request" {
+		t.Errorf("Expected request after restart, got %q (%v)", request, err)
+	}
+}
+
+// TestFileStorePrune tests that only the requests of unfinished jobs are kept
+func TestFileStorePrune(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir, "secret")
+
+	running, _ := newID()
+	store.Create(ctx, &Job{ID: running, Status: StatusRunning}, []byte("running"))
+	done, _ := newID()
+	store.Create(ctx, &Job{ID: done, Status: StatusSucceeded}, []byte("done"))
+	orphan, _ := newID()
+	os.WriteFile(filepath.Join(dir, orphan+requestFileExt), []byte("orphan"), 0o600)
+	corrupt, _ := newID()
+	os.WriteFile(filepath.Join(dir, corrupt+jobFileExt), []byte("{"), 0o600)
+	os.WriteFile(filepath.Join(dir, corrupt+requestFileExt), []byte("corrupt"), 0o600)
+	os.WriteFile(filepath.Join(dir, running+requestFileExt+".tmp123"), []byte("partial"), 0o600)
+
+	if err := store.Prune(ctx); err != nil {
+		t.Fatalf("Failed to prune store: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{done + jobFileExt, running + jobFileExt, running + requestFileExt}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected files %v after pruning, got %v", expected, names)
+	}
+}
+
+// TestFileStoreEncryption tests that job files do not hold the request or
+// result in plaintext, and that jobs written with another key are dropped
+func TestFileStoreEncryption(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	if _, err := NewFileStore(dir, ""); err == nil {
+		t.Error("Expected file store without a key to be refused")
+	}
+
+	store, _ := NewFileStore(dir, "secret")
+	id, _ := newID()
+	store.Create(ctx, &Job{ID: id, Status: StatusQueued}, []byte(`{"image":"iVBORw0KGgo"}`))
+	store.Update(ctx, &Job{ID: id, Status: StatusRunning, Result: json.RawMessage(`{"name":"山田太郎"}`)})
+	for _, name := range []string{id + jobFileExt, id + requestFileExt} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || strings.Contains(string(data), "iVBORw0KGgo") || strings.Contains(string(data), "山田太郎") || strings.Contains(string(data), id) {
+			t.Errorf("Expected %s to be encrypted, got %q (%v)", name, data, err)
+		}
+	}
+
+	rotated, _ := NewFileStore(dir, "other")
+	if _, err := rotated.Get(ctx, id); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected job of another key to be unreadable, got %v", err)
+	}
+	if err := rotated.Prune(ctx); err != nil {
+		t.Fatalf("Failed to prune store: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected unreadable job files to be removed, got %v", entries)
+	}
+}
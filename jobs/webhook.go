@@ -0,0 +1,268 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers of a webhook request
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	JobIDHeader     = "X-Webhook-Job-Id"
+)
+
+// Webhook delivery defaults
+const (
+	DefaultWebhookAttempts = 5
+	DefaultWebhookBackoff  = time.Second
+	maxWebhookBackoff      = time.Minute
+	webhookTimeout         = 10 * time.Second
+)
+
+// ErrCallbackNotAllowed is returned for callback URLs the server does not send to
+var ErrCallbackNotAllowed = errors.New("callback URL is not allowed")
+
+// blockedPrefixes are address ranges that are not reachable on the internet
+// and are not covered by the checks of netip.Addr
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64, which may map to private IPv4 addresses
+}
+
+// Notifier delivers HMAC-SHA256 signed completion callbacks. Failed
+// deliveries are retried with exponential backoff.
+//
+// Callbacks are only sent over HTTPS to public addresses, so that clients
+// cannot make the server send requests into its own network. Hosts on the
+// allow-list are trusted: they may use HTTP and resolve to any address, and
+// once the list is set, no other host is allowed.
+type Notifier struct {
+	secret       []byte
+	client       *http.Client
+	maxAttempts  int
+	backoff      time.Duration // Delay before the first retry, doubled for every further one
+	allowedHosts map[string]bool
+}
+
+// NewNotifier creates a notifier that signs callbacks with secret
+func NewNotifier(secret string) *Notifier {
+	n := &Notifier{
+		secret:      []byte(secret),
+		maxAttempts: DefaultWebhookAttempts,
+		backoff:     DefaultWebhookBackoff,
+	}
+	n.client = n.newClient()
+	return n
+}
+
+// WithRetries returns a copy of the notifier that makes at most maxAttempts
+// attempts, waiting backoff before the first retry
+func (n *Notifier) WithRetries(maxAttempts int, backoff time.Duration) *Notifier {
+	c := *n
+	c.maxAttempts = max(maxAttempts, 1)
+	c.backoff = backoff
+	return &c
+}
+
+// WithAllowedHosts returns a copy of the notifier that only sends callbacks to
+// the given host names, which may be internal
+func (n *Notifier) WithAllowedHosts(hosts ...string) *Notifier {
+	c := *n
+	c.allowedHosts = make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		c.allowedHosts[strings.ToLower(host)] = true
+	}
+	c.client = c.newClient()
+	return &c
+}
+
+// CheckCallbackURL returns ErrCallbackNotAllowed for a URL the notifier does
+// not send callbacks to. Host names are resolved when the callback is sent,
+// and addresses that are not public are refused then.
+func (n *Notifier) CheckCallbackURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case n.allowedHosts[host]:
+		return nil
+	case len(n.allowedHosts) > 0:
+		return fmt.Errorf("%w: host %s is not on the allow-list", ErrCallbackNotAllowed, host)
+	case u.Scheme != "https":
+		return fmt.Errorf("%w: https is required", ErrCallbackNotAllowed)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return fmt.Errorf("%w: %s is not a public address", ErrCallbackNotAllowed, host)
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s is not a public address", ErrCallbackNotAllowed, host)
+	}
+	return nil
+}
+
+// newClient creates the HTTP client of the notifier. Connections to hosts
+// that are not on the allow-list fail unless they go to a public address; the
+// address is checked after resolution, so DNS cannot point a callback
+// elsewhere. Redirects are not followed and proxies are not used, since both
+// would bypass the check.
+func (n *Notifier) newClient() *http.Client {
+	trusted := &net.Dialer{Timeout: webhookTimeout}
+	guarded := &net.Dialer{Timeout: webhookTimeout, Control: refuseNonPublic}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && n.allowedHosts[strings.ToLower(host)] {
+			return trusted.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refuseNonPublic is a dialer control function that fails connections to
+// addresses that are not public
+func refuseNonPublic(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s is not a public address", ErrCallbackNotAllowed, addrPort.Addr())
+	}
+	return nil
+}
+
+// publicAddr reports whether addr is reachable on the internet: not loopback,
+// private, link-local (which includes the metadata endpoints of cloud
+// providers), multicast or unspecified
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the signature of a webhook body sent at the given Unix
+// timestamp, in the form "sha256=<hex>". Receivers recompute it over
+// "<timestamp>.<body>" to verify a callback and reject stale timestamps to
+// prevent replays.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver posts the completed job to its callback URL until the receiver
+// answers with a 2xx status, the receiver rejects it with a client error,
+// the attempts are used up or ctx is done
+func (n *Notifier) Deliver(ctx context.Context, job *Job) *WebhookStatus {
+	// Jobs stored before the allow-list changed are checked again
+	if err := n.CheckCallbackURL(job.CallbackURL); err != nil {
+		return &WebhookStatus{Error: err.Error(), LastTry: time.Now()}
+	}
+
+	// The payload is the job as returned by GET /jobs/{id}, without the delivery status
+	payload := job.clone()
+	payload.Webhook = nil
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return &WebhookStatus{Error: err.Error(), LastTry: time.Now()}
+	}
+
+	status := &WebhookStatus{}
+	backoff := n.backoff
+	for status.Attempts < n.maxAttempts {
+		if status.Attempts > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return status
+			}
+			backoff = min(backoff*2, maxWebhookBackoff)
+		}
+
+		status.Attempts++
+		status.LastTry = time.Now()
+		retry, err := n.post(ctx, job, body)
+		if err == nil {
+			status.Delivered = true
+			status.Error = ""
+			return status
+		}
+		status.Error = err.Error()
+		if !retry {
+			return status
+		}
+	}
+	return status
+}
+
+// post sends one webhook request and reports whether a failure is worth retrying
+func (n *Notifier) post(ctx context.Context, job *Job, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(n.secret, timestamp, body))
+	req.Header.Set(JobIDHeader, job.ID)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, ErrCallbackNotAllowed), err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+}
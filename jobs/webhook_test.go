@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSign tests the webhook signature against a known HMAC-SHA256 value
+func TestSign(t *testing.T) {
+	signature := Sign([]byte("secret"), "1700000000", []byte(`{"id":"1"}`))
+	expected := "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"
+	if signature != expected {
+		t.Fatalf("Expected %s, got %s", expected, signature)
+	}
+	if signature == Sign([]byte("secret"), "1700000001", []byte(`{"id":"1"}`)) {
+		t.Errorf("Expected signature to cover the timestamp")
+	}
+	if signature == Sign([]byte("other"), "1700000000", []byte(`{"id":"1"}`)) {
+		t.Errorf("Expected signature to depend on the secret")
+	}
+}
+
+// TestDeliverRetries tests that server errors are retried and client errors are not
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name              string
+		statuses          []int
+		expectedAttempts  int
+		expectedDelivered bool
+	}{
+		{"delivered at once", []int{http.StatusOK}, 1, true},
+		{"retried after server errors", []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusNoContent}, 3, true},
+		{"client error is final", []int{http.StatusNotFound, http.StatusOK}, 1, false},
+		{"attempts used up", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := int(calls.Add(1)) - 1
+				w.WriteHeader(tt.statuses[min(call, len(tt.statuses)-1)])
+			}))
+			defer server.Close()
+
+			notifier := NewNotifier("secret").WithRetries(3, time.Millisecond).WithAllowedHosts("127.0.0.1")
+			status := notifier.Deliver(context.Background(), &Job{ID: "1", Status: StatusSucceeded, CallbackURL: server.URL})
+			if status.Attempts != tt.expectedAttempts || status.Delivered != tt.expectedDelivered {
+				t.Errorf("Expected %d attempts and delivered=%v, got %+v", tt.expectedAttempts, tt.expectedDelivered, status)
+			}
+			if !status.Delivered && status.Error == "" {
+				t.Errorf("Expected failed delivery to record an error")
+			}
+		})
+	}
+}
+
+// TestDeliverSignsPayload tests that receivers can verify a callback
+func TestDeliverSignsPayload(t *testing.T) {
+	verified := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(TimestampHeader)
+		verified <- r.Header.Get(SignatureHeader) == Sign([]byte("secret"), timestamp, body) && r.Header.Get(JobIDHeader) == "1"
+	}))
+	defer server.Close()
+
+	status := NewNotifier("secret").WithAllowedHosts("127.0.0.1").Deliver(context.Background(), &Job{ID: "1", Status: StatusSucceeded, CallbackURL: server.URL})
+	if !status.Delivered {
+		t.Fatalf("Expected callback to be delivered, got %+v", status)
+	}
+	if !<-verified {
+		t.Errorf("Expected callback signature to verify")
+	}
+}
+
+// TestCheckCallbackURL tests that callbacks go to public HTTPS URLs or to allowed hosts only
+func TestCheckCallbackURL(t *testing.T) {
+	notifier := NewNotifier("secret")
+	allowed := []string{"https://example.com/hook", "https://93.184.216.34/hook"}
+	refused := []string{
+		"http://example.com/hook",
+		"https://127.0.0.1/hook",
+		"https://[::1]/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://10.0.0.5/hook",
+		"https://[::ffff:192.168.0.1]/hook",
+		"https://100.64.0.1/hook",
+		"https://localhost:8443/hook",
+	}
+	for _, callbackURL := range allowed {
+		if err := notifier.CheckCallbackURL(callbackURL); err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", callbackURL, err)
+		}
+	}
+	for _, callbackURL := range refused {
+		if err := notifier.CheckCallbackURL(callbackURL); !errors.Is(err, ErrCallbackNotAllowed) {
+			t.Errorf("Expected %s to be refused, got %v", callbackURL, err)
+		}
+	}
+
+	internal := notifier.WithAllowedHosts("hooks.internal")
+	if err := internal.CheckCallbackURL("http://HOOKS.internal:8080/ocr"); err != nil {
+		t.Errorf("Expected allowed host to be accepted over http, got %v", err)
+	}
+	if err := internal.CheckCallbackURL("https://example.com/hook"); !errors.Is(err, ErrCallbackNotAllowed) {
+		t.Errorf("Expected host off the allow-list to be refused, got %v", err)
+	}
+}
+
+// TestDeliverRefusesPrivateAddress tests that callbacks are not sent to
+// addresses that are not public, and are not retried
+func TestDeliverRefusesPrivateAddress(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	if err := refuseNonPublic("tcp", server.Listener.Addr().String(), nil); !errors.Is(err, ErrCallbackNotAllowed) {
+		t.Errorf("Expected dialing %s to be refused, got %v", server.Listener.Addr(), err)
+	}
+	if err := refuseNonPublic("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("Expected dialing a public address to be allowed, got %v", err)
+	}
+
+	notifier := NewNotifier("secret").WithRetries(3, time.Millisecond)
+	status := notifier.Deliver(context.Background(), &Job{ID: "1", Status: StatusSucceeded, CallbackURL: server.URL})
+
+	// Host names are checked once they are resolved
+	if _, err := notifier.client.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1)); !errors.Is(err, ErrCallbackNotAllowed) {
+		t.Errorf("Expected connection to a host resolving to loopback to be refused, got %v", err)
+	}
+	if status.Delivered || status.Attempts != 0 || calls.Load() != 0 {
+		t.Errorf("Expected callback to a private address to be refused, got %+v", status)
+	}
+}
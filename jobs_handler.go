@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"ocr-web-api/auth"
+	"ocr-web-api/jobs"
+	"ocr-web-api/logging"
+	"ocr-web-api/ocr"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Job store backends selected with the JOB_STORE environment variable
+const (
+	JobStoreMemory = "memory"
+	JobStoreFile   = "file"
+)
+
+// JobHandler handles the asynchronous job API. Jobs run the same processing
+// as /ocr, but with a longer time limit.
+type JobHandler struct {
+	ocrHandler *OCRHandler
+	manager    *jobs.Manager
+	timeout    time.Duration
+	notifier   *jobs.Notifier // Set when WEBHOOK_SECRET is set, so callbacks can be signed
+}
+
+// NewJobHandler creates a job handler configured from the environment and
+// resumes the jobs left unfinished by a previous run
+func NewJobHandler(ocrHandler *OCRHandler) (*JobHandler, error) {
+	store, err := getJobStoreFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	config := jobs.Config{
+		Workers:   getPositiveIntFromEnv("JOB_WORKERS", runtime.NumCPU()),
+		QueueSize: getPositiveIntFromEnv("JOB_QUEUE_SIZE", jobs.DefaultQueueSize),
+		Timeout:   getDurationFromEnv("JOB_TIMEOUT", jobs.DefaultTimeout),
+		Retention: getDurationFromEnv("JOB_RETENTION", jobs.DefaultRetention),
+		Logger:    AppLogger,
+	}
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" {
+		config.Notifier = jobs.NewNotifier(secret)
+		if hosts := strings.FieldsFunc(os.Getenv("WEBHOOK_ALLOWED_HOSTS"), isListSeparator); len(hosts) > 0 {
+			AppLogger.Info("Callbacks limited to allowed hosts", "hosts", hosts)
+			config.Notifier = config.Notifier.WithAllowedHosts(hosts...)
+		}
+	}
+
+	h := newJobHandler(ocrHandler, store, config)
+	if err := h.manager.Start(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// newJobHandler creates a job handler whose manager is not started yet
+func newJobHandler(ocrHandler *OCRHandler, store jobs.Store, config jobs.Config) *JobHandler {
+	h := &JobHandler{
+		ocrHandler: ocrHandler,
+		timeout:    config.Timeout,
+		notifier:   config.Notifier,
+	}
+	if h.timeout <= 0 {
+		h.timeout = jobs.DefaultTimeout
+	}
+	h.manager = jobs.NewManager(store, h.run, config)
+	return h
+}
+
+// isListSeparator reports whether r separates the entries of a list in an
+// environment variable
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' '
+}
+
+// getJobStoreFromEnv opens the job store selected by JOB_STORE. The file
+// store keeps its files in JOB_STORE_DIR, encrypted with JOB_STORE_KEY; it
+// is an error to select it without a key, as jobs hold the document images.
+func getJobStoreFromEnv() (jobs.Store, error) {
+	switch backend := os.Getenv("JOB_STORE"); backend {
+	case "", JobStoreMemory:
+		return jobs.NewMemoryStore(), nil
+	case JobStoreFile:
+		dir := os.Getenv("JOB_STORE_DIR")
+		if dir == "" {
+			dir = "data/jobs"
+		}
+		AppLogger.Info("Using file job store", "dir", dir)
+		return jobs.NewFileStore(dir, os.Getenv("JOB_STORE_KEY"))
+	default:
+		return nil, fmt.Errorf("unsupported JOB_STORE %q, use %s or %s", backend, JobStoreMemory, JobStoreFile)
+	}
+}
+
+// Close stops processing jobs; unfinished jobs are resumed on the next start
+func (h *JobHandler) Close() {
+	h.manager.Close()
+}
+
+// Shutdown lets the running jobs and their callbacks finish until ctx is
+// done. Queued and interrupted jobs are resumed on the next start.
+func (h *JobHandler) Shutdown(ctx context.Context) error {
+	return h.manager.Shutdown(ctx)
+}
+
+// HandleJobs submits an OCR request as a job and returns the queued job
+func (h *JobHandler) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	// Set CORS headers
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
+		h.ocrHandler.sendErrorResponse(w, methodNotAllowedError("POST"))
+		return
+	}
+
+	var req JobRequest
+	if apiErr := decodeJSONBody(w, r, maxJSONSize, &req); apiErr != nil {
+		AppLogger.WarnContext(r.Context(), "Failed to parse job request JSON", "error", apiErr)
+		h.ocrHandler.sendErrorResponse(w, apiErr)
+		return
+	}
+
+	// Allow the response format and the fields to redact to be selected with query parameters as well
+	if req.Format == "" {
+		req.Format = r.URL.Query().Get("format")
+	}
+	if req.Redact == "" {
+		req.Redact = r.URL.Query().Get("redact")
+	}
+
+	if err := req.Validate(); err != nil {
+		AppLogger.WarnContext(r.Context(), "Job request validation failed", "error", err)
+		h.ocrHandler.sendErrorResponse(w, toAPIError(err))
+		return
+	}
+
+	if req.CallbackURL != "" && h.notifier == nil {
+		h.ocrHandler.sendErrorResponse(w, newAPIError(http.StatusUnprocessableEntity, ErrCodeCallbacksDisabled,
+			"callbackUrl requires WEBHOOK_SECRET to be configured", ErrorDetail{Field: "callbackUrl", Reason: ReasonUnsupported}))
+		return
+	}
+	if req.CallbackURL != "" {
+		if err := h.notifier.CheckCallbackURL(req.CallbackURL); err != nil {
+			AppLogger.WarnContext(r.Context(), "Callback URL refused", "error", err)
+			h.ocrHandler.sendErrorResponse(w, newAPIError(http.StatusBadRequest, ErrCodeInvalidField, "invalid callbackUrl: "+err.Error(),
+				ErrorDetail{Field: "callbackUrl", Reason: ReasonForbidden}))
+			return
+		}
+	}
+
+	// Reject what the API key or the server does not allow now rather than fail the job later
+	err := authorizeDocumentType(r.Context(), req.DocumentType)
+	if err == nil {
+		_, err = h.ocrHandler.redactionPolicy(r.Context(), &req.OCRRequest)
+	}
+	if err != nil {
+		h.ocrHandler.sendErrorResponse(w, toAPIError(err))
+		return
+	}
+
+	stored := storedJobRequest{OCRRequest: req.OCRRequest, APIKey: jobOwner(r.Context())}
+	request, err := json.Marshal(stored)
+	if err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to encode job request", "error", err)
+		h.ocrHandler.sendErrorResponse(w, newAPIError(http.StatusInternalServerError, ErrCodeInternal, "failed to create job"))
+		return
+	}
+
+	job, err := h.manager.Submit(r.Context(), stored.APIKey, request, req.CallbackURL)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		AppLogger.WarnContext(r.Context(), "Job queue full, rejecting job")
+		w.Header().Set("Retry-After", "30")
+		h.ocrHandler.sendErrorResponse(w, newAPIError(http.StatusServiceUnavailable, ErrCodeQueueFull, err.Error()))
+		return
+	}
+	if err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to create job", "error", err)
+		h.ocrHandler.sendErrorResponse(w, newAPIError(http.StatusInternalServerError, ErrCodeInternal, "failed to create job"))
+		return
+	}
+
+	AppLogger.InfoContext(r.Context(), "Job queued", "job_id", job.ID, "document_type", req.DocumentType)
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to encode job response", "error", err)
+	}
+}
+
+// HandleJob reports the status of a job, and its result once it is done.
+// Jobs of other API keys are reported as not found, so their IDs cannot be probed.
+func (h *JobHandler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
+		h.ocrHandler.sendErrorResponse(w, methodNotAllowedError("GET"))
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	job, err := h.manager.Get(r.Context(), id)
+	if err == nil && job.Owner != jobOwner(r.Context()) {
+		err = jobs.ErrNotFound
+	}
+	if errors.Is(err, jobs.ErrNotFound) {
+		h.ocrHandler.sendErrorResponse(w, newAPIError(http.StatusNotFound, ErrCodeJobNotFound, err.Error()))
+		return
+	}
+	if err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to load job", "job_id", id, "error", err)
+		h.ocrHandler.sendErrorResponse(w, newAPIError(http.StatusInternalServerError, ErrCodeInternal, "failed to load job"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to encode job response", "error", err)
+	}
+}
+
+// jobOwner returns the ID of the API key of a request, which owns the jobs it submits
+func jobOwner(ctx context.Context) string {
+	if key, ok := auth.FromContext(ctx); ok {
+		return key.ID
+	}
+	return ""
+}
+
+// storedJobRequest is the request of a job as it is stored
+type storedJobRequest struct {
+	OCRRequest
+	APIKey string `json:"apiKey,omitempty"` // ID of the API key the job was submitted with
+}
+
+// run processes the OCR request of a job. Failures are reported in the
+// shape of the error of an ErrorResponse. Job workers are already bounded by
+// JOB_WORKERS, so jobs wait for OCR workers rather than fail when the pool is saturated.
+func (h *JobHandler) run(ctx context.Context, request []byte) (json.RawMessage, json.RawMessage) {
+	ctx = ocr.WithoutQueueLimit(ctx)
+
+	var stored storedJobRequest
+	if err := json.Unmarshal(request, &stored); err != nil {
+		return nil, encodeJobError(newAPIError(http.StatusInternalServerError, ErrCodeInternal, "failed to decode job request"))
+	}
+	req := stored.OCRRequest
+
+	// The job runs with the current settings of the key it was submitted with
+	if stored.APIKey != "" && h.ocrHandler.apiKeys != nil {
+		key, ok := h.ocrHandler.apiKeys.Get(stored.APIKey)
+		if !ok {
+			AppLogger.WarnContext(ctx, "API key of job no longer configured", "api_key", stored.APIKey)
+			return nil, encodeJobError(newAPIError(http.StatusUnauthorized, ErrCodeUnauthorized, "API key of the job is no longer valid"))
+		}
+		ctx = logging.With(auth.WithKey(ctx, key), slog.String("api_key", key.ID))
+	}
+
+	defer trackInFlight(endpointJob)()
+
+	response, err := h.ocrHandler.processOCRRequestWithTimeout(ctx, &req)
+	if err != nil {
+		apiErr := processingError(ctx, err, h.timeout)
+		AppLogger.ErrorContext(ctx, "OCR processing error for job", "document_type", req.DocumentType, "code", apiErr.Code, "error", err)
+		recordRequest(endpointJob, req.DocumentType, apiErr.Status)
+		return nil, encodeJobError(apiErr)
+	}
+	recordRequest(endpointJob, req.DocumentType, http.StatusOK)
+
+	result, err := json.Marshal(response)
+	if err != nil {
+		return nil, encodeJobError(newAPIError(http.StatusInternalServerError, ErrCodeInternal, "failed to encode job result"))
+	}
+	return result, nil
+}
+
+// encodeJobError encodes the error of a failed job
+func encodeJobError(apiErr *APIError) json.RawMessage {
+	data, _ := json.Marshal(apiErr)
+	return data
+}
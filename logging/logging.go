@@ -0,0 +1,151 @@
+// Package logging provides the structured log handler of the service. It
+// writes JSON records, adds the attributes carried by the context of a call,
+// such as the request ID, and keeps personal data out of records above DEBUG.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// RequestIDHeader is the header a request ID is read from and echoed in
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs supplied by clients
+const maxRequestIDLength = 128
+
+// Redacted replaces personal data in records above DEBUG
+const Redacted = "[REDACTED]"
+
+// attrsKey is the context key of the attributes added to records logged with a context
+type attrsKey struct{}
+
+// With returns a context whose log records carry attrs in addition to those
+// of ctx. Code that logs with the *Context functions of log/slog picks them
+// up without having to pass them along.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	previous, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	combined := make([]slog.Attr, 0, len(previous)+len(attrs))
+	combined = append(append(combined, previous...), attrs...)
+	return context.WithValue(ctx, attrsKey{}, combined)
+}
+
+// WithRequestID returns a context whose log records carry the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return With(ctx, slog.String("request_id", id))
+}
+
+// RequestID returns a request ID for a request that sent the given
+// X-Request-ID value. Usable client IDs are kept so that logs can be
+// correlated across services; anything else is replaced by a new random ID.
+func RequestID(header string) string {
+	if header != "" && len(header) <= maxRequestIDLength && strings.IndexFunc(header, invalidIDRune) < 0 {
+		return header
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// invalidIDRune reports runes that may not appear in a request ID, so that
+// IDs cannot forge log lines or headers
+func invalidIDRune(r rune) bool {
+	return r < '!' || r > '~'
+}
+
+// pii marks a value as personal data
+type pii struct {
+	value any
+}
+
+// LogValue returns the value itself; it is only reached in DEBUG records
+func (p pii) LogValue() slog.Value {
+	return slog.AnyValue(p.value)
+}
+
+// PII returns an attribute for personal data such as extracted names,
+// numbers or OCR text. Its value only appears in DEBUG records; records of
+// higher levels get Redacted instead.
+func PII(key string, value any) slog.Attr {
+	return slog.Any(key, pii{value: value})
+}
+
+// Handler is a slog.Handler that adds the attributes of the context to each
+// record and redacts personal data in records above DEBUG
+type Handler struct {
+	next slog.Handler
+}
+
+// Ensure Handler satisfies the slog.Handler interface
+var _ slog.Handler = (*Handler)(nil)
+
+// NewHandler creates a handler that writes JSON records of at least the given level to w
+func NewHandler(w io.Writer, level slog.Leveler) *Handler {
+	return &Handler{next: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})}
+}
+
+// Enabled reports whether records of the given level are written
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle writes a record with the attributes of ctx
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	debug := r.Level <= slog.LevelDebug
+	record := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		record.AddAttrs(redact(a, debug))
+		return true
+	})
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a handler whose records carry attrs. Their level is not
+// known yet, so personal data among them is always redacted.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redact(a, false)
+	}
+	return &Handler{next: h.next.WithAttrs(redacted)}
+}
+
+// WithGroup returns a handler that puts the attributes of records in a group
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name)}
+}
+
+// redact replaces personal data in an attribute, including inside groups,
+// unless it is logged at DEBUG
+func redact(a slog.Attr, debug bool) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindLogValuer:
+		if _, ok := a.Value.Any().(pii); ok && !debug {
+			return slog.String(a.Key, Redacted)
+		}
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redact(member, debug)
+		}
+		return slog.Group(a.Key, redacted...)
+	}
+	return a
+}
+
+// ParseLevel parses a LOG_LEVEL value such as "DEBUG" or "warn"
+func ParseLevel(s string) (slog.Level, bool) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo, false
+	}
+	return level, true
+}
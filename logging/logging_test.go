@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestHandlerRedactsPII tests that personal data only appears in DEBUG records
+func TestHandlerRedactsPII(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewHandler(&out, slog.LevelDebug))
+	ctx := WithRequestID(context.Background(), "req-1")
+
+	logger.DebugContext(ctx, "zone recognized", PII("text", "山田 太郎"))
+	logger.InfoContext(ctx, "zone recognized", PII("text", "山田 太郎"), slog.Group("zone", PII("text", "山田 太郎"), "field", "name"))
+	logger.With(PII("name", "山田 太郎")).DebugContext(ctx, "logger with personal data")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 records, got %q", out.String())
+	}
+
+	var debug, info, with map[string]any
+	for i, record := range []*map[string]any{&debug, &info, &with} {
+		if err := json.Unmarshal([]byte(lines[i]), record); err != nil {
+			t.Fatalf("Expected JSON records, got %q: %v", lines[i], err)
+		}
+		if (*record)["request_id"] != "req-1" {
+			t.Errorf("Expected request ID from the context, got %v", *record)
+		}
+	}
+
+	if debug["text"] != "山田 太郎" {
+		t.Errorf("Expected personal data in DEBUG record, got %v", debug)
+	}
+	zone, _ := info["zone"].(map[string]any)
+	if info["text"] != Redacted || zone["text"] != Redacted || zone["field"] != "name" {
+		t.Errorf("Expected personal data to be redacted above DEBUG, got %v", info)
+	}
+	if with["name"] != Redacted {
+		t.Errorf("Expected personal data of logger attributes to be redacted, got %v", with)
+	}
+}
+
+// TestRequestID tests that usable client request IDs are kept and others replaced
+func TestRequestID(t *testing.T) {
+	if id := RequestID("abc-123"); id != "abc-123" {
+		t.Errorf("Expected client request ID to be kept, got %q", id)
+	}
+	for _, header := range []string{"", "line\nbreak", "with space", strings.Repeat("a", maxRequestIDLength+1)} {
+		id := RequestID(header)
+		if id == header || len(id) != 32 {
+			t.Errorf("Expected a new request ID for %q, got %q", header, id)
+		}
+	}
+}
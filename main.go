@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// defaultShutdownTimeout bounds how long a stopping server waits for requests,
+// jobs and callbacks in flight
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
 	// Initialize logger
 	AppLogger.Info("Starting OCR Web API server...")
@@ -13,12 +22,27 @@ func main() {
 	ocrHandler := NewOCRHandler()
 	AppLogger.Info("OCR handler initialized successfully")
 
-	// Set up HTTP routes
-	http.HandleFunc("/ocr", ocrHandler.HandleOCR)
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		HealthHandler(w, r)
-	})
-	http.HandleFunc("/document-types", ocrHandler.DocumentTypesHandler)
+	// Initialize the job handler, resuming jobs left unfinished by a previous run
+	jobHandler, err := NewJobHandler(ocrHandler)
+	if err != nil {
+		AppLogger.Error("Failed to initialize job handler", "error", err)
+		os.Exit(1)
+	}
+
+	// Reload the API keys when the keys file has been edited
+	if ocrHandler.apiKeys != nil {
+		reloadAPIKeysOnSIGHUP(ocrHandler.apiKeys)
+	}
+
+	// Set up HTTP routes; processing endpoints require an API key when keys are configured
+	http.HandleFunc("/ocr", ocrHandler.requireAPIKey(ocrHandler.HandleOCR))
+	http.HandleFunc("/ocr/batch", ocrHandler.requireAPIKey(ocrHandler.HandleBatch))
+	http.HandleFunc("/jobs", ocrHandler.requireAPIKey(jobHandler.HandleJobs))
+	http.HandleFunc("/jobs/", ocrHandler.requireAPIKey(jobHandler.HandleJob))
+	http.HandleFunc("/classify", ocrHandler.requireAPIKey(ocrHandler.HandleClassify))
+	http.HandleFunc("/health", ocrHandler.HealthHandler)
+	http.HandleFunc("/metrics", ocrHandler.MetricsHandler)
+	http.HandleFunc("/document-types", ocrHandler.allowCORS(ocrHandler.DocumentTypesHandler))
 	AppLogger.Info("HTTP routes configured")
 
 	// Get port from environment variable or use default
@@ -28,17 +52,45 @@ func main() {
 	}
 
 	// Start server
-	AppLogger.Infof("OCR Web API server starting on port %s...", port)
+	AppLogger.Info("OCR Web API server starting", "port", port)
 	AppLogger.Info("Available endpoints:")
 	AppLogger.Info("  POST /ocr - Process OCR requests")
+	AppLogger.Info("  POST /ocr/batch - Process a batch of OCR requests")
+	AppLogger.Info("  POST /jobs - Submit an asynchronous OCR job")
+	AppLogger.Info("  GET  /jobs/{id} - Get the status and result of a job")
+	AppLogger.Info("  POST /classify - Classify document type")
 	AppLogger.Info("  GET  /health - Health check")
+	AppLogger.Info("  GET  /metrics - Prometheus metrics")
 	AppLogger.Info("  GET  /document-types - Get supported document types")
 
-	AppLogger.Infof("Server ready to accept connections on :%s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		AppLogger.Errorf("Server failed to start: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: withRequestID(http.DefaultServeMux)}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	AppLogger.Info("Server ready to accept connections", "port", port)
+
+	// Stop on SIGTERM or SIGINT, letting the work in flight finish
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-serveErr:
+		AppLogger.Error("Server failed to start", "error", err)
+		jobHandler.Close()
 		os.Exit(1)
+	case sig := <-signals:
+		AppLogger.Info("Shutting down server", "signal", sig.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), getDurationFromEnv("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		AppLogger.Error("Requests still in flight were cut off", "error", err)
+	}
+	if err := jobHandler.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+		AppLogger.Warn("Jobs still running were interrupted and are resumed on the next start")
 	}
+	AppLogger.Info("Server stopped")
 }
 
 // handleOCR is now replaced by the handler in handler.go
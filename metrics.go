@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"ocr-web-api/metrics"
+	"ocr-web-api/ocr"
+	"ocr-web-api/parser"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Endpoints of the endpoint label of request metrics
+const (
+	endpointOCR      = "ocr"
+	endpointBatch    = "batch"
+	endpointJob      = "job"
+	endpointClassify = "classify"
+)
+
+// Processing stages of the stage label of ocr_stage_duration_seconds
+const (
+	stageDecode     = "decode"
+	stagePreprocess = "preprocess"
+	stageOCR        = "ocr"
+	stageParse      = "parse"
+)
+
+// Outcomes of the result label of ocr_fields_total
+const (
+	fieldExtracted = "extracted"
+	fieldInvalid   = "invalid"
+	fieldMissing   = "missing"
+)
+
+// statusClientClosed is recorded as the code of requests whose client went
+// away before the response, following the nginx convention
+const statusClientClosed = 499
+
+// metricsRegistry holds the metrics of all handlers of the process
+var metricsRegistry = metrics.NewRegistry()
+
+var (
+	requestsTotal = metricsRegistry.NewCounter("ocr_requests_total",
+		"OCR requests by endpoint, requested document type and HTTP status code.",
+		"endpoint", "document_type", "code")
+	requestsInFlight = metricsRegistry.NewGauge("ocr_requests_in_flight",
+		"OCR requests being processed.", "endpoint")
+	stageDuration = metricsRegistry.NewHistogram("ocr_stage_duration_seconds",
+		"Time a request spent in each processing stage.", metrics.DefaultBuckets, "stage")
+	engineFailuresTotal = metricsRegistry.NewCounter("ocr_engine_failures_total",
+		"OCR engine calls that failed, such as Tesseract processes that could not run or crashed.")
+	timeoutsTotal = metricsRegistry.NewCounter("ocr_timeouts_total",
+		"OCR requests that exceeded their time limit.", "endpoint")
+	fieldsTotal = metricsRegistry.NewCounter("ocr_fields_total",
+		"Fields of parsed documents by whether they were extracted, failed validation or were missing.",
+		"document_type", "field", "result")
+)
+
+// newHandlerMetrics creates the metrics that read the state of a handler,
+// namely its OCR worker pool and result cache, when they are written
+func newHandlerMetrics(h *OCRHandler) *metrics.Registry {
+	r := metrics.NewRegistry()
+	r.NewGaugeFunc("ocr_pool_workers", "Maximum number of concurrent OCR runs.",
+		func() float64 { return float64(h.ocrPool.Stats().Size) })
+	r.NewGaugeFunc("ocr_pool_active", "OCR runs in progress.",
+		func() float64 { return float64(h.ocrPool.Stats().Active) })
+	r.NewGaugeFunc("ocr_pool_queued", "OCR calls waiting for a free worker.",
+		func() float64 { return float64(h.ocrPool.Stats().Queued) })
+	r.NewCounterFunc("ocr_pool_processed_total", "OCR runs started by the worker pool.",
+		func() float64 { return float64(h.ocrPool.Stats().Processed) })
+	r.NewCounterFunc("ocr_pool_rejected_total", "OCR calls rejected because the worker pool queue was full.",
+		func() float64 { return float64(h.ocrPool.Stats().Rejected) })
+
+	if h.resultCache != nil {
+		r.NewCounterFunc("ocr_cache_hits_total", "Requests answered from the result cache.",
+			func() float64 { return float64(h.resultCache.Stats().Hits) })
+		r.NewCounterFunc("ocr_cache_misses_total", "Requests not found in the result cache.",
+			func() float64 { return float64(h.resultCache.Stats().Misses) })
+		r.NewCounterFunc("ocr_cache_evictions_total", "Results removed from the result cache to respect its size limit.",
+			func() float64 { return float64(h.resultCache.Stats().Evictions) })
+		r.NewGaugeFunc("ocr_cache_entries", "Results stored in the result cache.",
+			func() float64 { return float64(h.resultCache.Stats().Entries) })
+		r.NewGaugeFunc("ocr_cache_bytes", "Size of the results stored in the result cache.",
+			func() float64 { return float64(h.resultCache.Stats().Bytes) })
+	}
+	return r
+}
+
+// MetricsHandler serves the metrics in the Prometheus text exposition format
+func (h *OCRHandler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		AppLogger.WarnContext(r.Context(), "Invalid method attempted", "method", r.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := metricsRegistry.WriteTo(w); err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to write metrics", "error", err)
+		return
+	}
+	if _, err := h.metrics.WriteTo(w); err != nil {
+		AppLogger.ErrorContext(r.Context(), "Failed to write metrics", "error", err)
+	}
+}
+
+// trackInFlight counts a request of endpoint as in flight until the returned function is called
+func trackInFlight(endpoint string) func() {
+	gauge := requestsInFlight.With(endpoint)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// recordRequest counts a finished request of endpoint with its status code
+func recordRequest(endpoint, documentType string, status int) {
+	requestsTotal.With(endpoint, documentTypeLabel(documentType), strconv.Itoa(status)).Inc()
+	if status == http.StatusRequestTimeout {
+		timeoutsTotal.With(endpoint).Inc()
+	}
+}
+
+// documentTypeLabel returns the document type label of a request. Unknown
+// types share one label, so clients cannot create arbitrary series.
+func documentTypeLabel(documentType string) string {
+	if documentType == "" || isValidDocumentType(documentType) {
+		return documentType
+	}
+	return "unsupported"
+}
+
+// recordFields counts the outcome of every field of a parse result
+func recordFields(result *parser.Result) {
+	if result == nil || result.Fields == nil {
+		return
+	}
+	for name, field := range result.Fields.FieldMap() {
+		outcome := fieldExtracted
+		switch {
+		case field == nil || field.Value == "":
+			outcome = fieldMissing
+		case field.Valid != nil && !*field.Valid:
+			outcome = fieldInvalid
+		}
+		fieldsTotal.With(result.DocumentType, name, outcome).Inc()
+	}
+}
+
+// stageTimerKey is the context key of the stageTimer of a request
+type stageTimerKey struct{}
+
+// stageTimer adds up the time a request spends in each processing stage
+type stageTimer struct {
+	mu     sync.Mutex
+	stages map[string]time.Duration
+}
+
+// withStageTimer returns a context whose processing stages are timed by the returned timer
+func withStageTimer(ctx context.Context) (context.Context, *stageTimer) {
+	timer := &stageTimer{stages: make(map[string]time.Duration)}
+	return context.WithValue(ctx, stageTimerKey{}, timer), timer
+}
+
+// addStageTime adds d to a stage of the request of ctx, if it is timed
+func addStageTime(ctx context.Context, stage string, d time.Duration) {
+	if timer, ok := ctx.Value(stageTimerKey{}).(*stageTimer); ok {
+		timer.mu.Lock()
+		timer.stages[stage] += d
+		timer.mu.Unlock()
+	}
+}
+
+// stageTime returns the time the request of ctx has spent in the given stages so far
+func stageTime(ctx context.Context, stages ...string) time.Duration {
+	timer, ok := ctx.Value(stageTimerKey{}).(*stageTimer)
+	if !ok {
+		return 0
+	}
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+	var total time.Duration
+	for _, stage := range stages {
+		total += timer.stages[stage]
+	}
+	return total
+}
+
+// observe records the time of every stage the request went through
+func (t *stageTimer) observe() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for stage, d := range t.stages {
+		stageDuration.With(stage).Observe(d.Seconds())
+	}
+}
+
+// timedEngine is an Engine that adds the time of its calls to the ocr stage
+// of the request and counts engine failures
+type timedEngine struct {
+	engine ocr.Engine
+}
+
+// Ensure timedEngine satisfies the Engine interface
+var _ ocr.Engine = timedEngine{}
+
+// done records a finished call that started at start
+func (e timedEngine) done(ctx context.Context, start time.Time, err error) {
+	addStageTime(ctx, stageOCR, time.Since(start))
+	if errors.Is(err, ocr.ErrEngineFailure) {
+		engineFailuresTotal.With().Inc()
+	}
+}
+
+func (e timedEngine) ExtractText(ctx context.Context, imageData []byte) (string, error) {
+	start := time.Now()
+	text, err := e.engine.ExtractText(ctx, imageData)
+	e.done(ctx, start, err)
+	return text, err
+}
+
+func (e timedEngine) ExtractRegions(ctx context.Context, imageData []byte) ([]ocr.RegionInfo, error) {
+	start := time.Now()
+	regions, err := e.engine.ExtractRegions(ctx, imageData)
+	e.done(ctx, start, err)
+	return regions, err
+}
+
+func (e timedEngine) ExtractTextWithOptions(ctx context.Context, imageData []byte, opts ocr.Options) (string, error) {
+	start := time.Now()
+	text, err := e.engine.ExtractTextWithOptions(ctx, imageData, opts)
+	e.done(ctx, start, err)
+	return text, err
+}
+
+func (e timedEngine) ExtractRegionsWithOptions(ctx context.Context, imageData []byte, opts ocr.Options) ([]ocr.RegionInfo, error) {
+	start := time.Now()
+	regions, err := e.engine.ExtractRegionsWithOptions(ctx, imageData, opts)
+	e.done(ctx, start, err)
+	return regions, err
+}
+
+func (e timedEngine) Close() error {
+	return e.engine.Close()
+}
@@ -0,0 +1,357 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format, without depending on a client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram bucket upper bounds, in seconds, suited to
+// request stages that take from milliseconds to tens of seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types of the exposition format
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Registry holds metrics in the order they were registered
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	names    map[string]bool
+}
+
+// family is a registered metric with all its series
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register adds a metric; names must be unique within a registry
+func (r *Registry) register(name string, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.families = append(r.families, f)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	bw := bufio.NewWriter(counter)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return counter.n, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// desc describes a metric and keeps its series by label values
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is a metric with one set of label values
+type series struct {
+	values []string
+
+	mu      sync.Mutex
+	value   float64
+	buckets []uint64 // Histograms only: counts per bucket, not cumulative
+	sum     float64
+	count   uint64
+}
+
+func newDesc(name, help, kind string, labels []string) *desc {
+	return &desc{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+// with returns the series of the given label values, creating it on first use
+func (d *desc) with(values []string, buckets int) *series {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", d.name, len(d.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if buckets > 0 {
+			s.buckets = make([]uint64, buckets)
+		}
+		d.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by their label values
+func (d *desc) sorted() []*series {
+	d.mu.Lock()
+	list := make([]*series, 0, len(d.series))
+	for _, s := range d.series {
+		list = append(list, s)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].values, "\xff") < strings.Join(list[j].values, "\xff")
+	})
+	return list
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// writeSample writes a sample line with the labels of s and any extra label
+func (d *desc) writeSample(w *bufio.Writer, suffix string, s *series, extraName, extraValue string, value float64) {
+	w.WriteString(d.name + suffix)
+	names, values := d.labels, s.values
+	if extraName != "" {
+		names = append(append([]string(nil), names...), extraName)
+		values = append(append([]string(nil), values...), extraValue)
+	}
+	if len(names) > 0 {
+		w.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, name, escapeLabel(values[i]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func (d *desc) write(w *bufio.Writer) {
+	d.writeHeader(w)
+	for _, s := range d.sorted() {
+		s.mu.Lock()
+		value := s.value
+		s.mu.Unlock()
+		d.writeSample(w, "", s, "", "", value)
+	}
+}
+
+// Counter is a value that only goes up
+type Counter struct{ s *series }
+
+// Inc adds 1 to the counter
+func (c Counter) Inc() { c.Add(1) }
+
+// Add adds v, which must not be negative, to the counter
+func (c Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.s.mu.Lock()
+	c.s.value += v
+	c.s.mu.Unlock()
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct{ d *desc }
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	d := newDesc(name, help, typeCounter, labels)
+	r.register(name, d)
+	return &CounterVec{d: d}
+}
+
+// With returns the counter of the given label values
+func (v *CounterVec) With(values ...string) Counter {
+	return Counter{s: v.d.with(values, 0)}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct{ s *series }
+
+// Set sets the gauge to v
+func (g Gauge) Set(v float64) {
+	g.s.mu.Lock()
+	g.s.value = v
+	g.s.mu.Unlock()
+}
+
+// Add adds v, which may be negative, to the gauge
+func (g Gauge) Add(v float64) {
+	g.s.mu.Lock()
+	g.s.value += v
+	g.s.mu.Unlock()
+}
+
+// Inc adds 1 to the gauge
+func (g Gauge) Inc() { g.Add(1) }
+
+// Dec subtracts 1 from the gauge
+func (g Gauge) Dec() { g.Add(-1) }
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct{ d *desc }
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	d := newDesc(name, help, typeGauge, labels)
+	r.register(name, d)
+	return &GaugeVec{d: d}
+}
+
+// With returns the gauge of the given label values
+func (v *GaugeVec) With(values ...string) Gauge {
+	return Gauge{s: v.d.with(values, 0)}
+}
+
+// funcMetric is a metric without labels whose value is read when it is written
+type funcMetric struct {
+	*desc
+	fn func() float64
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	f.writeSample(w, "", &series{}, "", "", f.fn())
+}
+
+// NewCounterFunc registers a counter whose value is returned by fn, for
+// counts that are kept elsewhere
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: newDesc(name, help, typeCounter, nil), fn: fn})
+}
+
+// NewGaugeFunc registers a gauge whose value is returned by fn
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: newDesc(name, help, typeGauge, nil), fn: fn})
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	s      *series
+	bounds []float64
+}
+
+// Observe records a value
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.s.mu.Lock()
+	if i < len(h.bounds) {
+		h.s.buckets[i]++
+	}
+	h.s.sum += v
+	h.s.count++
+	h.s.mu.Unlock()
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	d      *desc
+	bounds []float64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds,
+// in increasing order, and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: histogram buckets of " + name + " are not sorted")
+	}
+	h := &HistogramVec{d: newDesc(name, help, typeHistogram, labels), bounds: buckets}
+	r.register(name, h)
+	return h
+}
+
+// With returns the histogram of the given label values
+func (v *HistogramVec) With(values ...string) Histogram {
+	return Histogram{s: v.d.with(values, len(v.bounds)), bounds: v.bounds}
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.d.writeHeader(w)
+	for _, s := range v.d.sorted() {
+		s.mu.Lock()
+		buckets := append([]uint64(nil), s.buckets...)
+		sum, count := s.sum, s.count
+		s.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range v.bounds {
+			cumulative += buckets[i]
+			v.d.writeSample(w, "_bucket", s, "le", formatFloat(bound), float64(cumulative))
+		}
+		v.d.writeSample(w, "_bucket", s, "le", "+Inf", float64(count))
+		v.d.writeSample(w, "_sum", s, "", "", sum)
+		v.d.writeSample(w, "_count", s, "", "", float64(count))
+	}
+}
+
+// formatFloat formats a sample value as the exposition format expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes backslashes and line breaks in help text
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+// escapeLabel escapes backslashes, line breaks and quotes in label values
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRegistryWriteTo tests the exposition format of every metric type
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests by code.", "code")
+	inFlight := r.NewGauge("in_flight", "Requests in progress.")
+	duration := r.NewHistogram("duration_seconds", "Duration\nof requests.", []float64{0.1, 1}, "stage")
+	r.NewGaugeFunc("queued", "Queued calls.", func() float64 { return 3 })
+
+	requests.With("500").Inc()
+	requests.With("200").Add(2)
+	requests.With(`say "hi"`).Inc()
+	inFlight.With().Inc()
+	inFlight.With().Inc()
+	inFlight.With().Dec()
+	duration.With("ocr").Observe(0.05)
+	duration.With("ocr").Observe(0.5)
+	duration.With("ocr").Observe(3)
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	expected := `# HELP requests_total Requests by code.
+# TYPE requests_total counter
+requests_total{code="200"} 2
+requests_total{code="500"} 1
+requests_total{code="say \"hi\""} 1
+# HELP in_flight Requests in progress.
+# TYPE in_flight gauge
+in_flight 1
+# HELP duration_seconds Duration\nof requests.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{stage="ocr",le="0.1"} 1
+duration_seconds_bucket{stage="ocr",le="1"} 2
+duration_seconds_bucket{stage="ocr",le="+Inf"} 3
+duration_seconds_sum{stage="ocr"} 3.55
+duration_seconds_count{stage="ocr"} 3
+# HELP queued Queued calls.
+# TYPE queued gauge
+queued 3
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+// TestRegistryRejectsDuplicates tests that a metric name can only be registered once
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("requests_total", "Requests.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a duplicate metric to panic")
+		}
+	}()
+	r.NewGauge("requests_total", "Requests.")
+}
@@ -0,0 +1,239 @@
+//go:build tesseract_cgo
+
+package ocr
+
+/*
+#cgo pkg-config: tesseract lept
+#include <stdint.h>
+#include <stdlib.h>
+#include <leptonica/allheaders.h>
+#include <tesseract/capi.h>
+
+extern int ocrCancelled(void* cancel_this, int words);
+
+// setCancelFunc makes recognition poll ocrCancelled with cancel_this
+static void setCancelFunc(ETEXT_DESC* monitor, void* cancel_this) {
+	TessMonitorSetCancelFunc(monitor, (TessCancelFunc)ocrCancelled);
+	TessMonitorSetCancelThis(monitor, cancel_this);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/cgo"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// tsvHeader is the header line the tesseract command writes to TSV files;
+// the C API returns the rows only
+const tsvHeader = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n"
+
+// CAPIEngine recognizes text in process through the Tesseract C API. Each
+// recognizer loads the language data once and is reused by later calls, so
+// calls do not pay for starting a process, loading models or temporary files.
+// A recognizer serves one call at a time; the engine creates one per
+// concurrent call and language, so it should be used behind a Pool.
+type CAPIEngine struct {
+	dataPath string
+
+	mu     sync.Mutex
+	idle   map[string][]*C.TessBaseAPI // Loaded recognizers not in use, by language
+	closed bool
+}
+
+// Ensure CAPIEngine satisfies the Engine interface
+var _ Engine = (*CAPIEngine)(nil)
+
+// NewCAPIEngine creates an engine that loads language data from dataPath.
+// The default language is loaded right away, so a missing installation is
+// reported here rather than by the first request.
+func NewCAPIEngine(dataPath string) (Engine, error) {
+	e := &CAPIEngine{
+		dataPath: dataPath,
+		idle:     make(map[string][]*C.TessBaseAPI),
+	}
+
+	language := DefaultOptions().Language
+	api, err := e.get(language)
+	if err != nil {
+		return nil, err
+	}
+	e.put(language, api)
+	return e, nil
+}
+
+// get returns an idle recognizer for language, loading a new one when none is idle
+func (e *CAPIEngine) get(language string) (*C.TessBaseAPI, error) {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("%w: engine is closed", ErrEngineFailure)
+	}
+	if idle := e.idle[language]; len(idle) > 0 {
+		api := idle[len(idle)-1]
+		e.idle[language] = idle[:len(idle)-1]
+		e.mu.Unlock()
+		return api, nil
+	}
+	e.mu.Unlock()
+
+	dataPath := C.CString(e.dataPath)
+	defer C.free(unsafe.Pointer(dataPath))
+	lang := C.CString(language)
+	defer C.free(unsafe.Pointer(lang))
+
+	api := C.TessBaseAPICreate()
+	if C.TessBaseAPIInit2(api, dataPath, lang, C.OEM_LSTM_ONLY) != 0 {
+		C.TessBaseAPIDelete(api)
+		return nil, fmt.Errorf("%w: failed to load language %s from %s", ErrEngineFailure, language, e.dataPath)
+	}
+	return api, nil
+}
+
+// put returns a recognizer to the idle list, or frees it once the engine is closed
+func (e *CAPIEngine) put(language string, api *C.TessBaseAPI) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		freeAPI(api)
+		return
+	}
+	e.idle[language] = append(e.idle[language], api)
+}
+
+// freeAPI releases a recognizer and its language data
+func freeAPI(api *C.TessBaseAPI) {
+	C.TessBaseAPIEnd(api)
+	C.TessBaseAPIDelete(api)
+}
+
+// ExtractText extracts text from image data with DefaultOptions
+func (e *CAPIEngine) ExtractText(ctx context.Context, imageData []byte) (string, error) {
+	return e.ExtractTextWithOptions(ctx, imageData, DefaultOptions())
+}
+
+// ExtractTextWithOptions extracts text from image data with the given recognition options
+func (e *CAPIEngine) ExtractTextWithOptions(ctx context.Context, imageData []byte, opts Options) (string, error) {
+	text, err := e.recognize(ctx, imageData, opts, false)
+	if err != nil {
+		return "", err
+	}
+	return cleanText(text)
+}
+
+// ExtractRegions extracts text regions with positional information with DefaultOptions
+func (e *CAPIEngine) ExtractRegions(ctx context.Context, imageData []byte) ([]RegionInfo, error) {
+	return e.ExtractRegionsWithOptions(ctx, imageData, DefaultOptions())
+}
+
+// ExtractRegionsWithOptions extracts text regions with positional
+// information with the given recognition options
+func (e *CAPIEngine) ExtractRegionsWithOptions(ctx context.Context, imageData []byte, opts Options) ([]RegionInfo, error) {
+	tsv, err := e.recognize(ctx, imageData, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return parseTSV(tsvHeader + tsv), nil
+}
+
+// recognize runs recognition on a PNG or JPEG image and returns the result
+// as plain text, or as TSV rows when tsv is set. Recognition is abandoned
+// as soon as ctx is done.
+func (e *CAPIEngine) recognize(ctx context.Context, imageData []byte, opts Options, tsv bool) (string, error) {
+	if len(imageData) == 0 {
+		return "", fmt.Errorf("cannot process empty image")
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	opts = opts.withDefaults()
+	api, err := e.get(opts.Language)
+	if err != nil {
+		return "", err
+	}
+	defer e.put(opts.Language, api)
+
+	pix := C.pixReadMem((*C.l_uint8)(unsafe.Pointer(&imageData[0])), C.size_t(len(imageData)))
+	if pix == nil {
+		return "", fmt.Errorf("%w: failed to read image", ErrEngineFailure)
+	}
+	defer C.pixDestroy(&pix)
+
+	// Recognizers are reused, so every option is set on every call and the
+	// image and results are cleared before the recognizer is put back
+	defer C.TessBaseAPIClear(api)
+	C.TessBaseAPISetPageSegMode(api, C.TessPageSegMode(opts.PSM))
+	if err := setVariable(api, "tessedit_char_whitelist", opts.Whitelist); err != nil {
+		return "", err
+	}
+	C.TessBaseAPISetImage2(api, pix)
+	C.TessBaseAPISetSourceResolution(api, sourceDPI)
+
+	monitor := C.TessMonitorCreate()
+	defer C.TessMonitorDelete(monitor)
+	if deadline, ok := ctx.Deadline(); ok {
+		msecs := min(max(time.Until(deadline).Milliseconds(), 1), math.MaxInt32)
+		C.TessMonitorSetDeadlineMSecs(monitor, C.int(msecs))
+	}
+
+	// The cancel function finds ctx through a handle kept in C memory
+	handle := cgo.NewHandle(ctx)
+	defer handle.Delete()
+	cancelThis := C.malloc(C.size_t(unsafe.Sizeof(C.uintptr_t(0))))
+	defer C.free(cancelThis)
+	*(*C.uintptr_t)(cancelThis) = C.uintptr_t(handle)
+	C.setCancelFunc(monitor, cancelThis)
+
+	status := C.TessBaseAPIRecognize(api, monitor)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if status != 0 {
+		return "", fmt.Errorf("%w: tesseract recognition failed", ErrEngineFailure)
+	}
+
+	var text *C.char
+	if tsv {
+		text = C.TessBaseAPIGetTsvText(api, 0)
+	} else {
+		text = C.TessBaseAPIGetUTF8Text(api)
+	}
+	if text == nil {
+		return "", fmt.Errorf("%w: tesseract returned no result", ErrEngineFailure)
+	}
+	defer C.TessDeleteText(text)
+	return C.GoString(text), nil
+}
+
+// setVariable sets a Tesseract variable; an empty value restores the default
+func setVariable(api *C.TessBaseAPI, name, value string) error {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cValue := C.CString(value)
+	defer C.free(unsafe.Pointer(cValue))
+
+	if C.TessBaseAPISetVariable(api, cName, cValue) == 0 {
+		return fmt.Errorf("%w: failed to set %s", ErrEngineFailure, name)
+	}
+	return nil
+}
+
+// Close frees the idle recognizers; recognizers still in use are freed when their call returns
+func (e *CAPIEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for language, idle := range e.idle {
+		for _, api := range idle {
+			freeAPI(api)
+		}
+		delete(e.idle, language)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build tesseract_cgo
+
+package ocr
+
+// A file with exported functions may only declare C symbols, so the cancel
+// function lives apart from the rest of the C API engine.
+
+// #include <stdint.h>
+import "C"
+
+import (
+	"context"
+	"runtime/cgo"
+	"unsafe"
+)
+
+// ocrCancelled is polled by Tesseract during recognition. cancelThis points
+// to the handle of the context of the call; a non-zero result stops recognition.
+//
+//export ocrCancelled
+func ocrCancelled(cancelThis unsafe.Pointer, words C.int) C.int {
+	ctx := cgo.Handle(*(*C.uintptr_t)(cancelThis)).Value().(context.Context)
+	if ctx.Err() != nil {
+		return 1
+	}
+	return 0
+}
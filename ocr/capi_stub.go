@@ -0,0 +1,10 @@
+//go:build !tesseract_cgo
+
+package ocr
+
+import "errors"
+
+// NewCAPIEngine is not available without the tesseract_cgo build tag
+func NewCAPIEngine(dataPath string) (Engine, error) {
+	return nil, errors.New("the capi OCR engine requires a build with -tags tesseract_cgo")
+}
@@ -0,0 +1,36 @@
+//go:build tesseract_cgo
+
+package ocr
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// newTestCAPIEngine creates a C API engine, skipping when the language data is missing
+func newTestCAPIEngine(tb testing.TB) Engine {
+	tb.Helper()
+	engine, err := NewCAPIEngine(TessdataDir)
+	if err != nil {
+		tb.Skipf("Tesseract language data is not available: %v", err)
+	}
+	tb.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+// TestCAPIEngineCancelled tests that a call with a done context does not recognize anything
+func TestCAPIEngineCancelled(t *testing.T) {
+	engine := newTestCAPIEngine(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := engine.ExtractText(ctx, []byte{0x89, 'P', 'N', 'G'}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// BenchmarkCAPIEngine benchmarks the engine that keeps recognizers loaded in process
+func BenchmarkCAPIEngine(b *testing.B) {
+	benchmarkEngine(b, newTestCAPIEngine(b))
+}
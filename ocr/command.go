@@ -0,0 +1,21 @@
+package ocr
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// commandWaitDelay bounds how long a cancelled command may keep its output
+// pipes open after it has been killed
+const commandWaitDelay = 2 * time.Second
+
+// newCommand creates a command bound to ctx. When ctx is done the command's
+// whole process group is killed, so helpers spawned by the command do not
+// outlive the request that started it.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = commandWaitDelay
+	configureProcessGroup(cmd)
+	return cmd
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package ocr
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestNewCommandCancellation tests that cancelling the context kills the command
+// together with the children it spawned, instead of waiting for them to exit
+func TestNewCommandCancellation(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The background sleep inherits stdout, so without killing the process
+	// group Run would block until it exits
+	cmd := newCommand(ctx, "sh", "-c", "sleep 30 & sleep 30")
+	cmd.Stdout = &discardWriter{}
+
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatalf("Expected cancelled command to fail")
+	}
+	if elapsed > commandWaitDelay/2 {
+		t.Errorf("Expected command to be torn down promptly, took %v", elapsed)
+	}
+}
+
+// discardWriter forces exec to copy output through a pipe
+type discardWriter struct{}
+
+func (discardWriter) Write(p []byte) (int, error) { return len(p), nil }
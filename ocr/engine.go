@@ -0,0 +1,25 @@
+package ocr
+
+import "fmt"
+
+// Engine implementations selectable with NewEngine
+const (
+	// EngineExec runs the tesseract command for every call
+	EngineExec = "exec"
+
+	// EngineCAPI keeps recognizers loaded in process through the Tesseract C
+	// API. It is only available in builds with the tesseract_cgo tag.
+	EngineCAPI = "capi"
+)
+
+// NewEngine creates the OCR engine of the given kind, EngineExec when kind is empty
+func NewEngine(kind string) (Engine, error) {
+	switch kind {
+	case "", EngineExec:
+		return NewOCREngine(), nil
+	case EngineCAPI:
+		return NewCAPIEngine(TessdataDir)
+	default:
+		return nil, fmt.Errorf("unknown OCR engine %q, use %s or %s", kind, EngineExec, EngineCAPI)
+	}
+}
@@ -0,0 +1,63 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os/exec"
+	"testing"
+)
+
+// benchmarkImage returns a PNG the size of a rectified card with a few
+// dark bars where text lines would be
+func benchmarkImage(b *testing.B) []byte {
+	b.Helper()
+	img := image.NewGray(image.Rect(0, 0, 1012, 638))
+	for y := 0; y < 638; y++ {
+		for x := 0; x < 1012; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+			if y%80 > 40 && y%80 < 60 && x > 60 && x < 900 && (x/24)%3 != 0 {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		b.Fatalf("Failed to encode benchmark image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// benchmarkEngine measures whole-image text and region extraction, the two
+// kinds of calls the parsers make
+func benchmarkEngine(b *testing.B, engine Engine) {
+	imageData := benchmarkImage(b)
+	ctx := context.Background()
+
+	b.Run("ExtractText", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := engine.ExtractText(ctx, imageData); err != nil && !errors.Is(err, ErrNoText) {
+				b.Fatalf("ExtractText failed: %v", err)
+			}
+		}
+	})
+	b.Run("ExtractRegions", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := engine.ExtractRegionsWithOptions(ctx, imageData, Options{PSM: PSMSingleLine, Whitelist: WhitelistDigits}); err != nil {
+				b.Fatalf("ExtractRegions failed: %v", err)
+			}
+		}
+	})
+}
+
+// BenchmarkExecEngine benchmarks the engine that runs the tesseract command per call
+func BenchmarkExecEngine(b *testing.B) {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		b.Skip("tesseract is not installed")
+	}
+	benchmarkEngine(b, NewOCREngine())
+}
@@ -0,0 +1,18 @@
+package ocr
+
+import "testing"
+
+// TestNewEngine tests the selection of engine implementations
+func TestNewEngine(t *testing.T) {
+	for _, kind := range []string{"", EngineExec} {
+		if engine, err := NewEngine(kind); err != nil {
+			t.Errorf("Expected %q to select the exec engine, got %v", kind, err)
+		} else if _, ok := engine.(*OCREngine); !ok {
+			t.Errorf("Expected %q to select the exec engine, got %T", kind, engine)
+		}
+	}
+
+	if _, err := NewEngine("gpu"); err == nil {
+		t.Errorf("Expected unknown engine to be rejected")
+	}
+}
@@ -0,0 +1,15 @@
+package ocr
+
+import "errors"
+
+var (
+	// ErrEngineFailure is wrapped by errors of the OCR engine itself, such as
+	// a missing or crashing Tesseract binary, as opposed to images without text
+	ErrEngineFailure = errors.New("OCR engine failure")
+
+	// ErrNoText is returned when no text could be extracted from an image
+	ErrNoText = errors.New("no text could be extracted from the image")
+
+	// ErrPoolSaturated is returned by a Pool whose workers are busy and whose queue is full
+	ErrPoolSaturated = errors.New("OCR worker pool is saturated")
+)
@@ -1,7 +1,14 @@
 package ocr
 
-// Engine defines the interface for OCR operations
+import "context"
+
+// Engine defines the interface for OCR operations.
+// Implementations must stop work and release any external resources,
+// such as child processes and temporary files, when ctx is done.
 type Engine interface {
-	ExtractText(imageData []byte) (string, error)
+	ExtractText(ctx context.Context, imageData []byte) (string, error)
+	ExtractRegions(ctx context.Context, imageData []byte) ([]RegionInfo, error)
+	ExtractTextWithOptions(ctx context.Context, imageData []byte, opts Options) (string, error)
+	ExtractRegionsWithOptions(ctx context.Context, imageData []byte, opts Options) ([]RegionInfo, error)
 	Close() error
 }
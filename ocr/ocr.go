@@ -1,26 +1,49 @@
 package ocr
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// Region levels reported by Tesseract TSV output
+const (
+	LevelLine = 4
+	LevelWord = 5
 )
 
 // RegionInfo represents a detected text region with OCR confidence
 type RegionInfo struct {
 	Text       string
-	Confidence float64
-	X, Y, W, H int
-	Category   string // "name", "address", "date", "number", etc.
+	Confidence float64      // Recognition confidence in the range 0.0-1.0
+	X, Y, W, H int          // Bounding box in pixels of the OCR input image
+	Level      int          // LevelWord or LevelLine
+	Block      int          // Tesseract block number
+	Paragraph  int          // Tesseract paragraph number within the block
+	Line       int          // Tesseract line number within the paragraph
+	Words      []RegionInfo // Words making up a line region
 }
 
-// OCREngine handles text extraction from images using Tesseract with OpenCV preprocessing
+// TessdataDir is the directory of the Tesseract language data
+const TessdataDir = "/usr/share/tesseract-ocr/5/tessdata/"
+
+// OCREngine handles text extraction from images using the Tesseract command.
+// Every call runs a new Tesseract process, which loads the language data
+// again; CAPIEngine keeps it loaded instead.
+// Images are expected to be preprocessed by the imageprocessor pipeline.
 type OCREngine struct {
 	tempDir string
 }
 
+// Ensure OCREngine satisfies the Engine interface
+var _ Engine = (*OCREngine)(nil)
+
 // NewOCREngine creates a new OCR engine instance
 func NewOCREngine() *OCREngine {
 	return &OCREngine{
@@ -28,251 +51,106 @@ func NewOCREngine() *OCREngine {
 	}
 }
 
-// ExtractText extracts text from image data using Tesseract OCR with OpenCV preprocessing
-func (e *OCREngine) ExtractText(imageData []byte) (string, error) {
-	if len(imageData) == 0 {
-		return "", fmt.Errorf("cannot process empty image")
-	}
-
-	// Preprocess image with OpenCV for better OCR results
-	preprocessedImage, err := e.preprocessImageWithOpenCV(imageData)
-	if err != nil {
-		// If OpenCV preprocessing fails, use original image
-		fmt.Printf("Warning: OpenCV preprocessing failed, using original image: %v\n", err)
-		preprocessedImage = imageData
-	}
+// ExtractText extracts text from image data using Tesseract OCR with DefaultOptions.
+// The Tesseract process is killed when ctx is done.
+func (e *OCREngine) ExtractText(ctx context.Context, imageData []byte) (string, error) {
+	return e.ExtractTextWithOptions(ctx, imageData, DefaultOptions())
+}
 
-	// Create temporary file for the preprocessed image
-	tempImageFile, err := os.CreateTemp(e.tempDir, "ocr_preprocessed_*.png")
+// ExtractTextWithOptions extracts text from image data using Tesseract OCR
+// with the given recognition options
+func (e *OCREngine) ExtractTextWithOptions(ctx context.Context, imageData []byte, opts Options) (string, error) {
+	outputData, err := e.runTesseract(ctx, imageData, opts, "txt")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary image file: %w", err)
+		return "", err
 	}
-	defer os.Remove(tempImageFile.Name())
-	defer tempImageFile.Close()
+	return cleanText(string(outputData))
+}
 
-	// Write preprocessed image data to temporary file
-	if _, err := tempImageFile.Write(preprocessedImage); err != nil {
-		return "", fmt.Errorf("failed to write preprocessed image data to temporary file: %w", err)
+// cleanText trims recognized text and fails with ErrNoText when nothing is left
+func cleanText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrNoText
 	}
-	tempImageFile.Close()
-
-	// Create temporary output file path (without extension)
-	outputBase := filepath.Join(e.tempDir, "ocr_output_"+filepath.Base(tempImageFile.Name()))
-	outputFile := outputBase + ".txt"
-	defer os.Remove(outputFile)
-
-	// Run Tesseract OCR with optimized configuration for Japanese documents
-	cmd := exec.Command("tesseract", tempImageFile.Name(), outputBase,
-		"-l", "jpn+eng",
-		"--oem", "1", // Use LSTM OCR Engine Mode only
-		"--psm", "3", // Fully automatic page segmentation, but no OSD
-		"-c", "tessedit_char_whitelist=0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyzあいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわをんアイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワヲン一二三四五六七八九十百千万億兆京",
-		"--dpi", "300",
-	)
-
-	// Set environment to ensure proper operation
-	cmd.Env = append(os.Environ(),
-		"TESSDATA_PREFIX=/usr/share/tesseract-ocr/5/tessdata/",
-	)
+	return text, nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("tesseract OCR command failed: %w", err)
-	}
+// ExtractRegions extracts text regions with positional information using
+// Tesseract with DefaultOptions. The Tesseract process is killed when ctx is done.
+func (e *OCREngine) ExtractRegions(ctx context.Context, imageData []byte) ([]RegionInfo, error) {
+	return e.ExtractRegionsWithOptions(ctx, imageData, DefaultOptions())
+}
 
-	// Read the OCR output
-	outputData, err := os.ReadFile(outputFile)
+// ExtractRegionsWithOptions extracts text regions with positional information
+// using Tesseract with the given recognition options
+func (e *OCREngine) ExtractRegionsWithOptions(ctx context.Context, imageData []byte, opts Options) ([]RegionInfo, error) {
+	outputData, err := e.runTesseract(ctx, imageData, opts, "tsv")
 	if err != nil {
-		return "", fmt.Errorf("failed to read OCR output file: %w", err)
+		return nil, err
 	}
 
-	// Clean up the extracted text
-	text := strings.TrimSpace(string(outputData))
-	if text == "" {
-		return "", fmt.Errorf("no text could be extracted from the image")
-	}
-
-	return text, nil
+	return parseTSV(string(outputData)), nil
 }
 
-// ExtractRegions extracts text regions with positional information using OpenCV and Tesseract
-func (e *OCREngine) ExtractRegions(imageData []byte) ([]RegionInfo, error) {
+// runTesseract runs Tesseract on imageData and returns the content of the
+// output file with the given extension ("txt" or "tsv")
+func (e *OCREngine) runTesseract(ctx context.Context, imageData []byte, opts Options, format string) ([]byte, error) {
 	if len(imageData) == 0 {
 		return nil, fmt.Errorf("cannot process empty image")
 	}
 
-	// Preprocess image with OpenCV
-	preprocessedImage, err := e.preprocessImageWithOpenCV(imageData)
-	if err != nil {
-		// If OpenCV preprocessing fails, use original image
-		fmt.Printf("Warning: OpenCV preprocessing failed, using original image: %v\n", err)
-		preprocessedImage = imageData
-	}
-
 	// Create temporary file for the preprocessed image
-	tempImageFile, err := os.CreateTemp(e.tempDir, "ocr_regions_*.png")
+	tempImageFile, err := os.CreateTemp(e.tempDir, "ocr_preprocessed_*.png")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary image file: %w", err)
+		return nil, fmt.Errorf("%w: failed to create temporary image file: %w", ErrEngineFailure, err)
 	}
 	defer os.Remove(tempImageFile.Name())
 	defer tempImageFile.Close()
 
 	// Write preprocessed image data to temporary file
-	if _, err := tempImageFile.Write(preprocessedImage); err != nil {
-		return nil, fmt.Errorf("failed to write preprocessed image data to temporary file: %w", err)
+	if _, err := tempImageFile.Write(imageData); err != nil {
+		return nil, fmt.Errorf("%w: failed to write preprocessed image data to temporary file: %w", ErrEngineFailure, err)
 	}
 	tempImageFile.Close()
 
-	// Use Tesseract to extract text with bounding box information
-	outputBase := filepath.Join(e.tempDir, "ocr_regions_"+filepath.Base(tempImageFile.Name()))
-	tsvFile := outputBase + ".tsv"
-	defer os.Remove(tsvFile)
-
-	// Run Tesseract with TSV output for bounding boxes - optimized for Japanese
-	cmd := exec.Command("tesseract", tempImageFile.Name(), outputBase,
-		"-l", "jpn+eng",
-		"--oem", "1", // Use LSTM OCR Engine Mode only
-		"--psm", "3", // Fully automatic page segmentation, but no OSD
-		"-c", "tessedit_char_whitelist=0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyzあいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわをんアイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワヲン一二三四五六七八九十百千万億兆京",
-		"--dpi", "300",
-		"tsv",
-	)
-
-	cmd.Env = append(os.Environ(),
-		"TESSDATA_PREFIX=/usr/share/tesseract-ocr/5/tessdata/",
-	)
-
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("tesseract TSV command failed: %w", err)
-	}
-
-	// Parse TSV output to extract regions
-	regions, err := e.parseTesseractTSV(tsvFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse Tesseract TSV output: %w", err)
-	}
-
-	return regions, nil
-}
-
-// preprocessImageWithOpenCV applies OpenCV preprocessing to improve OCR accuracy
-func (e *OCREngine) preprocessImageWithOpenCV(imageData []byte) ([]byte, error) {
-	// Create temporary files for OpenCV processing
-	inputFile, err := os.CreateTemp(e.tempDir, "opencv_input_*.png")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create input file: %w", err)
-	}
-	defer os.Remove(inputFile.Name())
-	defer inputFile.Close()
-
-	outputFile, err := os.CreateTemp(e.tempDir, "opencv_output_*.png")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer os.Remove(outputFile.Name())
-	defer outputFile.Close()
+	// Tesseract appends the extension to the output base
+	outputBase := filepath.Join(e.tempDir, "ocr_output_"+filepath.Base(tempImageFile.Name()))
+	outputFile := outputBase + "." + format
+	defer os.Remove(outputFile)
 
-	// Write input image
-	if _, err := inputFile.Write(imageData); err != nil {
-		return nil, fmt.Errorf("failed to write input image: %w", err)
+	args := append([]string{tempImageFile.Name(), outputBase}, opts.args()...)
+	if format == "tsv" {
+		args = append(args, "tsv")
 	}
-	inputFile.Close()
-	outputFile.Close()
-
-	// Create Python script for enhanced OpenCV preprocessing optimized for Japanese text
-	pythonScript := fmt.Sprintf(`
-import cv2
-import numpy as np
-import sys
-
-try:
-    # Read the image
-    img = cv2.imread('%s')
-    if img is None:
-        print("Error: Could not load image", file=sys.stderr)
-        sys.exit(1)
-
-    # Resize image to improve OCR accuracy (minimum 300 DPI equivalent)
-    height, width = img.shape[:2]
-    if height < 600 or width < 800:
-        scale_factor = max(600/height, 800/width)
-        new_width = int(width * scale_factor)
-        new_height = int(height * scale_factor)
-        img = cv2.resize(img, (new_width, new_height), interpolation=cv2.INTER_CUBIC)
-
-    # Convert to grayscale
-    gray = cv2.cvtColor(img, cv2.COLOR_BGR2GRAY)
-
-    # Apply CLAHE (Contrast Limited Adaptive Histogram Equalization) for better contrast
-    clahe = cv2.createCLAHE(clipLimit=3.0, tileGridSize=(8,8))
-    enhanced = clahe.apply(gray)
-
-    # Apply bilateral filter to reduce noise while preserving edges
-    filtered = cv2.bilateralFilter(enhanced, 9, 75, 75)
-
-    # Apply adaptive threshold optimized for Japanese characters
-    thresh = cv2.adaptiveThreshold(filtered, 255, cv2.ADAPTIVE_THRESH_GAUSSIAN_C, cv2.THRESH_BINARY, 15, 4)
-
-    # Morphological operations to connect broken characters (common in Japanese text)
-    kernel = cv2.getStructuringElement(cv2.MORPH_RECT, (1, 1))
-    cleaned = cv2.morphologyEx(thresh, cv2.MORPH_CLOSE, kernel)
-    
-    # Remove small noise
-    kernel2 = cv2.getStructuringElement(cv2.MORPH_RECT, (2, 2))
-    cleaned = cv2.morphologyEx(cleaned, cv2.MORPH_OPEN, kernel2)
-
-    # Final enhancement for better character recognition
-    final = cv2.medianBlur(cleaned, 3)
-
-    # Save the processed image
-    success = cv2.imwrite('%s', final)
-    if not success:
-        print("Error: Could not save processed image", file=sys.stderr)
-        sys.exit(1)
-        
-    print("Enhanced image preprocessing completed successfully")
-
-except Exception as e:
-    print(f"Error during image processing: {e}", file=sys.stderr)
-    sys.exit(1)
-`, inputFile.Name(), outputFile.Name())
-
-	// Write Python script to temporary file
-	scriptFile, err := os.CreateTemp(e.tempDir, "opencv_script_*.py")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create script file: %w", err)
-	}
-	defer os.Remove(scriptFile.Name())
-	defer scriptFile.Close()
+	cmd := newCommand(ctx, "tesseract", args...)
 
-	if _, err := scriptFile.WriteString(pythonScript); err != nil {
-		return nil, fmt.Errorf("failed to write script: %w", err)
-	}
-	scriptFile.Close()
+	// Set environment to ensure proper operation
+	cmd.Env = append(os.Environ(),
+		"TESSDATA_PREFIX="+TessdataDir,
+	)
 
-	// Execute Python script
-	cmd := exec.Command("python3", scriptFile.Name())
-	output, err := cmd.CombinedOutput()
+	start := time.Now()
+	err = cmd.Run()
+	slog.DebugContext(ctx, "Tesseract finished", "format", format, "duration_ms", time.Since(start).Milliseconds(), "error", err)
 	if err != nil {
-		return nil, fmt.Errorf("OpenCV preprocessing failed: %w, output: %s", err, string(output))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: tesseract OCR command failed: %w", ErrEngineFailure, err)
 	}
 
-	// Read the processed image
-	processedData, err := os.ReadFile(outputFile.Name())
+	outputData, err := os.ReadFile(outputFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read processed image: %w", err)
+		return nil, fmt.Errorf("%w: failed to read OCR output file: %w", ErrEngineFailure, err)
 	}
-
-	return processedData, nil
+	return outputData, nil
 }
 
-// parseTesseractTSV parses Tesseract TSV output to extract text regions
-func (e *OCREngine) parseTesseractTSV(tsvFile string) ([]RegionInfo, error) {
-	data, err := os.ReadFile(tsvFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read TSV file: %w", err)
-	}
-
-	lines := strings.Split(string(data), "\n")
+// parseTSV parses Tesseract TSV content into word regions.
+// Columns: level page_num block_num par_num line_num word_num left top width height conf text
+func parseTSV(data string) []RegionInfo {
+	lines := strings.Split(data, "\n")
 	var regions []RegionInfo
 
 	for i, line := range lines {
@@ -280,46 +158,116 @@ func (e *OCREngine) parseTesseractTSV(tsvFile string) ([]RegionInfo, error) {
 			continue // Skip header and empty lines
 		}
 
-		fields := strings.Split(line, "\t")
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
 		if len(fields) < 12 {
 			continue // Skip malformed lines
 		}
 
+		// Only word rows carry text; page, block, paragraph and line rows are derived
+		level, err := strconv.Atoi(fields[0])
+		if err != nil || level != LevelWord {
+			continue
+		}
+
 		// Extract relevant fields from TSV
 		text := strings.TrimSpace(fields[11])
 		if text == "" {
 			continue
 		}
 
-		// Parse coordinates and confidence (simplified)
+		// Tesseract reports confidence as 0-100, and -1 for rows without a recognition result
+		conf, err := strconv.ParseFloat(fields[10], 64)
+		if err != nil || conf < 0 {
+			conf = 0
+		}
+
 		region := RegionInfo{
 			Text:       text,
-			Confidence: 0.8, // Default confidence, could be parsed from TSV
-			Category:   e.categorizeText(text),
+			Confidence: conf / 100,
+			X:          atoiOrZero(fields[6]),
+			Y:          atoiOrZero(fields[7]),
+			W:          atoiOrZero(fields[8]),
+			H:          atoiOrZero(fields[9]),
+			Level:      LevelWord,
+			Block:      atoiOrZero(fields[2]),
+			Paragraph:  atoiOrZero(fields[3]),
+			Line:       atoiOrZero(fields[4]),
 		}
 
 		regions = append(regions, region)
 	}
 
-	return regions, nil
+	return regions
 }
 
-// categorizeText attempts to categorize extracted text
-func (e *OCREngine) categorizeText(text string) string {
-	// Simple heuristics for categorizing text
-	if strings.Contains(text, "年") && strings.Contains(text, "月") {
-		return "date"
-	}
-	if strings.Contains(text, "都") || strings.Contains(text, "県") || strings.Contains(text, "市") || strings.Contains(text, "区") {
-		return "address"
+// GroupLines groups word regions into line regions. The line text joins
+// the word texts with spaces, the bounding box is the union of the word
+// boxes and the confidence is the mean word confidence weighted by text length.
+func GroupLines(words []RegionInfo) []RegionInfo {
+	type lineKey struct{ block, paragraph, line int }
+
+	index := make(map[lineKey]int)
+	var lines []RegionInfo
+
+	for _, word := range words {
+		key := lineKey{word.Block, word.Paragraph, word.Line}
+		i, exists := index[key]
+		if !exists {
+			index[key] = len(lines)
+			lines = append(lines, RegionInfo{
+				Level:     LevelLine,
+				Block:     word.Block,
+				Paragraph: word.Paragraph,
+				Line:      word.Line,
+				X:         word.X,
+				Y:         word.Y,
+			})
+			i = len(lines) - 1
+		}
+		lines[i].Words = append(lines[i].Words, word)
 	}
-	if len(text) >= 2 && len(text) <= 10 && !strings.ContainsAny(text, "0123456789") {
-		return "name"
+
+	for i := range lines {
+		line := &lines[i]
+		texts := make([]string, 0, len(line.Words))
+		var weighted, weight float64
+		right, bottom := line.X, line.Y
+
+		// Keep words in reading order
+		sort.SliceStable(line.Words, func(a, b int) bool {
+			return line.Words[a].X < line.Words[b].X
+		})
+
+		for _, word := range line.Words {
+			texts = append(texts, word.Text)
+			n := float64(len([]rune(word.Text)))
+			weighted += word.Confidence * n
+			weight += n
+
+			line.X = min(line.X, word.X)
+			line.Y = min(line.Y, word.Y)
+			right = max(right, word.X+word.W)
+			bottom = max(bottom, word.Y+word.H)
+		}
+
+		line.Text = strings.Join(texts, " ")
+		line.W = right - line.X
+		line.H = bottom - line.Y
+		if weight > 0 {
+			line.Confidence = weighted / weight
+		}
 	}
-	if strings.ContainsAny(text, "0123456789") && len(text) >= 4 {
-		return "number"
+
+	return lines
+}
+
+// atoiOrZero converts a TSV column to an integer, returning 0 for malformed values
+func atoiOrZero(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0
 	}
-	return "other"
+	return n
 }
 
 // Close cleans up resources (no-op for this implementation)
@@ -0,0 +1,73 @@
+package ocr
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const sampleTSV = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+	"1\t1\t0\t0\t0\t0\t0\t0\t800\t500\t-1\t\n" +
+	"4\t1\t1\t1\t1\t0\t20\t30\t300\t40\t-1\t\n" +
+	"5\t1\t1\t1\t1\t1\t20\t30\t80\t40\t96.5\t氏名\n" +
+	"5\t1\t1\t1\t1\t2\t120\t32\t200\t38\t80.0\t佐藤花子\n" +
+	"4\t1\t1\t1\t2\t0\t20\t90\t400\t40\t-1\t\n" +
+	"5\t1\t1\t1\t2\t1\t20\t90\t400\t40\t60\t大阪府大阪市\n" +
+	"5\t1\t1\t1\t2\t2\t430\t90\t10\t40\t-1\t \n"
+
+// TestParseTSV tests that word confidence and bounding boxes are read from Tesseract TSV
+func TestParseTSV(t *testing.T) {
+	words := parseTSV(sampleTSV)
+
+	if len(words) != 3 {
+		t.Fatalf("Expected 3 word regions, got %d", len(words))
+	}
+
+	first := words[0]
+	if first.Text != "氏名" || first.Level != LevelWord {
+		t.Errorf("Unexpected first word: %+v", first)
+	}
+	if math.Abs(first.Confidence-0.965) > 1e-9 {
+		t.Errorf("Expected confidence 0.965, got %f", first.Confidence)
+	}
+	if first.X != 20 || first.Y != 30 || first.W != 80 || first.H != 40 {
+		t.Errorf("Unexpected bounding box: %d,%d %dx%d", first.X, first.Y, first.W, first.H)
+	}
+}
+
+// TestGroupLines tests that words are aggregated into lines with weighted confidence
+func TestGroupLines(t *testing.T) {
+	lines := GroupLines(parseTSV(sampleTSV))
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	line := lines[0]
+	if line.Text != "氏名 佐藤花子" {
+		t.Errorf("Expected line text '氏名 佐藤花子', got '%s'", line.Text)
+	}
+	if line.X != 20 || line.Y != 30 || line.W != 300 || line.H != 40 {
+		t.Errorf("Unexpected line bounding box: %d,%d %dx%d", line.X, line.Y, line.W, line.H)
+	}
+
+	// (0.965*2 + 0.80*4) / 6
+	expected := (0.965*2 + 0.80*4) / 6
+	if math.Abs(line.Confidence-expected) > 1e-9 {
+		t.Errorf("Expected line confidence %f, got %f", expected, line.Confidence)
+	}
+}
+
+// TestOptionsArgs tests that recognition options are passed to Tesseract
+func TestOptionsArgs(t *testing.T) {
+	args := strings.Join(Options{Language: "eng", PSM: PSMSingleLine, Whitelist: WhitelistDigits}.args(), " ")
+	if args != "-l eng --oem 1 --psm 7 -c tessedit_char_whitelist=0123456789 --dpi 300" {
+		t.Errorf("Unexpected arguments: %s", args)
+	}
+
+	// Zero values fall back to the defaults and an empty whitelist allows every character
+	args = strings.Join(Options{}.args(), " ")
+	if args != "-l jpn+eng --oem 1 --psm 3 --dpi 300" {
+		t.Errorf("Unexpected default arguments: %s", args)
+	}
+}
@@ -0,0 +1,65 @@
+package ocr
+
+import "strconv"
+
+// Page segmentation modes passed to Tesseract with --psm
+const (
+	PSMAuto        = 3 // Fully automatic page segmentation, but no OSD
+	PSMSingleBlock = 6 // A single uniform block of text
+	PSMSingleLine  = 7 // A single text line
+	PSMSparseText  = 11
+)
+
+// Character sets for Options.Whitelist
+const (
+	// WhitelistDigits allows digits only, for document numbers
+	WhitelistDigits = "0123456789"
+
+	// DefaultWhitelist is the character set used for full-page recognition
+	DefaultWhitelist = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyzあいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわをんアイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワヲン一二三四五六七八九十百千万億兆京"
+)
+
+// Options controls how Tesseract recognizes an image
+type Options struct {
+	Language  string // Tesseract language, e.g. "jpn+eng"
+	PSM       int    // Page segmentation mode, one of the PSM constants
+	Whitelist string // Allowed characters; empty allows every character
+}
+
+// DefaultOptions returns the options used for full-page recognition of Japanese documents
+func DefaultOptions() Options {
+	return Options{
+		Language:  "jpn+eng",
+		PSM:       PSMAuto,
+		Whitelist: DefaultWhitelist,
+	}
+}
+
+// sourceDPI is the resolution Tesseract assumes for preprocessed images
+const sourceDPI = 300
+
+// withDefaults returns the options with the default language and page
+// segmentation mode filled in
+func (o Options) withDefaults() Options {
+	if o.Language == "" {
+		o.Language = "jpn+eng"
+	}
+	if o.PSM == 0 {
+		o.PSM = PSMAuto
+	}
+	return o
+}
+
+// args returns the Tesseract command-line arguments for the options
+func (o Options) args() []string {
+	o = o.withDefaults()
+	args := []string{
+		"-l", o.Language,
+		"--oem", "1", // Use LSTM OCR Engine Mode only
+		"--psm", strconv.Itoa(o.PSM),
+	}
+	if o.Whitelist != "" {
+		args = append(args, "-c", "tessedit_char_whitelist="+o.Whitelist)
+	}
+	return append(args, "--dpi", strconv.Itoa(sourceDPI))
+}
@@ -0,0 +1,172 @@
+package ocr
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pool limits the number of concurrent OCR runs of an engine. Calls beyond
+// the pool size wait in a bounded queue; once the queue is full, further
+// calls fail with ErrPoolSaturated instead of piling up Tesseract processes.
+type Pool struct {
+	engine    Engine
+	slots     chan struct{}
+	queueSize int
+
+	mu        sync.Mutex
+	queued    int
+	processed uint64
+	rejected  uint64
+	totalWait time.Duration
+	lastWait  time.Duration
+}
+
+// Ensure Pool satisfies the Engine interface
+var _ Engine = (*Pool)(nil)
+
+// PoolStats is a snapshot of the state of a Pool
+type PoolStats struct {
+	Size          int     `json:"size"`          // Maximum number of concurrent OCR runs
+	Active        int     `json:"active"`        // OCR runs in progress
+	Queued        int     `json:"queued"`        // Calls waiting for a free worker
+	QueueSize     int     `json:"queueSize"`     // Maximum number of waiting calls
+	Processed     uint64  `json:"processed"`     // OCR runs started since the pool was created
+	Rejected      uint64  `json:"rejected"`      // Calls rejected because the queue was full
+	AverageWaitMS float64 `json:"averageWaitMs"` // Mean time a run waited for a worker
+	LastWaitMS    float64 `json:"lastWaitMs"`    // Time the most recent run waited for a worker
+	Saturated     bool    `json:"saturated"`     // Whether new calls are currently rejected
+}
+
+// NewPool creates a pool that runs at most size OCR calls of engine at a
+// time and lets at most queueSize further calls wait for a worker
+func NewPool(engine Engine, size, queueSize int) *Pool {
+	return &Pool{
+		engine:    engine,
+		slots:     make(chan struct{}, max(size, 1)),
+		queueSize: max(queueSize, 0),
+	}
+}
+
+// queueLimitKey marks a context whose calls wait for a worker however long the queue is
+type queueLimitKey struct{}
+
+// WithoutQueueLimit returns a context whose OCR calls wait for a worker
+// instead of failing with ErrPoolSaturated. It is meant for callers that
+// bound their own concurrency, such as background job workers.
+func WithoutQueueLimit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queueLimitKey{}, true)
+}
+
+// acquire takes a worker slot, waiting in the queue when all are busy. It
+// fails with ErrPoolSaturated when the queue is full, or with ctx.Err()
+// when ctx is done first.
+func (p *Pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		p.recordWait(0)
+		return nil
+	default:
+	}
+
+	unlimited, _ := ctx.Value(queueLimitKey{}).(bool)
+	p.mu.Lock()
+	if !unlimited && p.queued >= p.queueSize {
+		p.rejected++
+		p.mu.Unlock()
+		return ErrPoolSaturated
+	}
+	p.queued++
+	p.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case p.slots <- struct{}{}:
+		p.mu.Lock()
+		p.queued--
+		p.mu.Unlock()
+		p.recordWait(time.Since(start))
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.queued--
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// release frees a worker slot taken by acquire
+func (p *Pool) release() {
+	<-p.slots
+}
+
+// recordWait records the time a run waited for its worker
+func (p *Pool) recordWait(wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.processed++
+	p.totalWait += wait
+	p.lastWait = wait
+}
+
+// Stats returns the current state of the pool
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{
+		Size:       cap(p.slots),
+		Active:     len(p.slots),
+		Queued:     p.queued,
+		QueueSize:  p.queueSize,
+		Processed:  p.processed,
+		Rejected:   p.rejected,
+		LastWaitMS: float64(p.lastWait) / float64(time.Millisecond),
+		Saturated:  len(p.slots) == cap(p.slots) && p.queued >= p.queueSize,
+	}
+	if p.processed > 0 {
+		stats.AverageWaitMS = float64(p.totalWait) / float64(p.processed) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+// ExtractText runs ExtractText of the engine on a pool worker
+func (p *Pool) ExtractText(ctx context.Context, imageData []byte) (string, error) {
+	if err := p.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer p.release()
+	return p.engine.ExtractText(ctx, imageData)
+}
+
+// ExtractRegions runs ExtractRegions of the engine on a pool worker
+func (p *Pool) ExtractRegions(ctx context.Context, imageData []byte) ([]RegionInfo, error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.release()
+	return p.engine.ExtractRegions(ctx, imageData)
+}
+
+// ExtractTextWithOptions runs ExtractTextWithOptions of the engine on a pool worker
+func (p *Pool) ExtractTextWithOptions(ctx context.Context, imageData []byte, opts Options) (string, error) {
+	if err := p.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer p.release()
+	return p.engine.ExtractTextWithOptions(ctx, imageData, opts)
+}
+
+// ExtractRegionsWithOptions runs ExtractRegionsWithOptions of the engine on a pool worker
+func (p *Pool) ExtractRegionsWithOptions(ctx context.Context, imageData []byte, opts Options) ([]RegionInfo, error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.release()
+	return p.engine.ExtractRegionsWithOptions(ctx, imageData, opts)
+}
+
+// Close closes the underlying engine
+func (p *Pool) Close() error {
+	return p.engine.Close()
+}
@@ -0,0 +1,98 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingEngine is an Engine whose calls block until release is closed
+type blockingEngine struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingEngine() *blockingEngine {
+	return &blockingEngine{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (e *blockingEngine) ExtractText(ctx context.Context, imageData []byte) (string, error) {
+	return e.ExtractTextWithOptions(ctx, imageData, DefaultOptions())
+}
+
+func (e *blockingEngine) ExtractRegions(ctx context.Context, imageData []byte) ([]RegionInfo, error) {
+	return e.ExtractRegionsWithOptions(ctx, imageData, DefaultOptions())
+}
+
+func (e *blockingEngine) ExtractTextWithOptions(ctx context.Context, imageData []byte, opts Options) (string, error) {
+	e.started <- struct{}{}
+	<-e.release
+	return "text", nil
+}
+
+func (e *blockingEngine) ExtractRegionsWithOptions(ctx context.Context, imageData []byte, opts Options) ([]RegionInfo, error) {
+	_, err := e.ExtractTextWithOptions(ctx, imageData, opts)
+	return nil, err
+}
+
+func (e *blockingEngine) Close() error {
+	return nil
+}
+
+// TestPoolLimitsConcurrency tests that calls beyond the pool size queue up
+// and calls beyond the queue are rejected
+func TestPoolLimitsConcurrency(t *testing.T) {
+	engine := newBlockingEngine()
+	pool := NewPool(engine, 1, 1)
+	ctx := context.Background()
+
+	results := make(chan error, 2)
+	go func() {
+		_, err := pool.ExtractText(ctx, nil)
+		results <- err
+	}()
+	<-engine.started
+
+	// The second call waits for the worker
+	go func() {
+		_, err := pool.ExtractText(ctx, nil)
+		results <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Stats().Queued != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats := pool.Stats()
+	if stats.Active != 1 || stats.Queued != 1 || !stats.Saturated {
+		t.Fatalf("Expected one active and one queued call, got %+v", stats)
+	}
+
+	// The third call finds the queue full
+	if _, err := pool.ExtractText(ctx, nil); !errors.Is(err, ErrPoolSaturated) {
+		t.Errorf("Expected ErrPoolSaturated, got %v", err)
+	}
+
+	// Unless it bounds its own concurrency and may wait regardless
+	waitCtx, cancel := context.WithTimeout(WithoutQueueLimit(ctx), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.ExtractText(waitCtx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected unlimited call to wait until its deadline, got %v", err)
+	}
+
+	close(engine.release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Expected queued calls to succeed, got %v", err)
+		}
+	}
+
+	stats = pool.Stats()
+	if stats.Active != 0 || stats.Queued != 0 || stats.Saturated || stats.Processed != 2 || stats.Rejected != 1 {
+		t.Errorf("Expected an idle pool with 2 processed and 1 rejected calls, got %+v", stats)
+	}
+	if stats.AverageWaitMS <= 0 || stats.LastWaitMS <= 0 {
+		t.Errorf("Expected the queued call to record its wait, got %+v", stats)
+	}
+}
@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+	"sort"
+	"strings"
+)
+
+// DetectionSignals describes how a document type can be recognized in an image
+type DetectionSignals struct {
+	Keywords []string        // Printed words typical for the document, e.g. 運転免許証
+	Layout   *LayoutTemplate // Fixed layout whose zones should contain text, nil if none
+}
+
+// Detector is implemented by parsers that can recognize their own document type
+type Detector interface {
+	DetectionSignals() DetectionSignals
+}
+
+// Classification is the score of one document type for an image
+type Classification struct {
+	DocumentType string  `json:"documentType"`
+	Score        float64 `json:"score"` // 0.0-1.0, higher is more likely
+}
+
+// Weights of the detection signals in the classification score. The aspect
+// ratio is not a signal: the image is rectified to the ID-1 card size before
+// it is classified, so it is the same for every card.
+const (
+	keywordWeight = 0.7
+	layoutWeight  = 0.3
+
+	// keywordsForFullScore is the number of keywords that must be found for the
+	// full keyword score, since a photo rarely shows every printed word clearly
+	keywordsForFullScore = 3
+)
+
+// MinClassificationScore is the score below which an image is not considered
+// to be of any registered document type
+const MinClassificationScore = 0.25
+
+// classificationOptions recognizes the whole image without a whitelist so
+// that kanji keywords are not lost
+var classificationOptions = ocr.Options{Language: "jpn+eng", PSM: ocr.PSMSparseText}
+
+// Classify recognizes the processed image once and scores every registered
+// parser that implements Detector. The result is sorted by descending score.
+func (pf *ParserFactory) Classify(ctx context.Context, mat imageprocessor.Mat) ([]Classification, error) {
+	img, err := imageprocessor.DecodeMat(mat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image for classification: %w", err)
+	}
+
+	words, err := pf.engine.ExtractRegionsWithOptions(ctx, mat, classificationOptions)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to recognize image for classification: %w", err)
+	}
+
+	return pf.classifyRegions(words, img.Bounds().Dx(), img.Bounds().Dy()), nil
+}
+
+// classifyRegions scores every registered detector against the recognized words
+// of a width × height image
+func (pf *ParserFactory) classifyRegions(words []ocr.RegionInfo, width, height int) []Classification {
+	var text strings.Builder
+	for _, line := range ocr.GroupLines(words) {
+		text.WriteString(normalizeForMatch(line.Text))
+	}
+
+	var classifications []Classification
+	for docType, parser := range pf.parsers {
+		detector, ok := parser.(Detector)
+		if !ok {
+			continue
+		}
+		signals := detector.DetectionSignals()
+
+		score := keywordWeight * keywordScore(text.String(), signals.Keywords)
+		if signals.Layout != nil {
+			score += layoutWeight * layoutScore(words, width, height, signals.Layout)
+		}
+
+		classifications = append(classifications, Classification{
+			DocumentType: docType,
+			Score:        math.Round(score*1000) / 1000,
+		})
+	}
+
+	sort.Slice(classifications, func(i, j int) bool {
+		if classifications[i].Score != classifications[j].Score {
+			return classifications[i].Score > classifications[j].Score
+		}
+		return classifications[i].DocumentType < classifications[j].DocumentType
+	})
+	return classifications
+}
+
+// keywordScore returns the share of keywords found in text, saturating at keywordsForFullScore
+func keywordScore(text string, keywords []string) float64 {
+	if len(keywords) == 0 {
+		return 0
+	}
+
+	found := 0
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			found++
+		}
+	}
+	return math.Min(1, float64(found)/float64(min(len(keywords), keywordsForFullScore)))
+}
+
+// layoutScore returns the share of template zones that contain the center of a recognized word
+func layoutScore(words []ocr.RegionInfo, width, height int, layout *LayoutTemplate) float64 {
+	if len(layout.Zones) == 0 || width == 0 || height == 0 {
+		return 0
+	}
+
+	filled := 0
+	for _, zone := range layout.Zones {
+		for _, word := range words {
+			cx := (float64(word.X) + float64(word.W)/2) / float64(width)
+			cy := (float64(word.Y) + float64(word.H)/2) / float64(height)
+			if cx >= zone.X && cx <= zone.X+zone.W && cy >= zone.Y && cy <= zone.Y+zone.H {
+				filled++
+				break
+			}
+		}
+	}
+	return float64(filled) / float64(len(layout.Zones))
+}
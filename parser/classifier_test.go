@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"ocr-web-api/ocr"
+	"testing"
+)
+
+// TestClassifyRegions tests that registered parsers are ranked by their detection signals
+func TestClassifyRegions(t *testing.T) {
+	factory := NewParserFactory(ocr.NewOCREngine())
+	width, height := 1012, 638
+
+	// Words of a license front: keywords plus text inside the name and address zones
+	license := []ocr.RegionInfo{
+		{Text: "氏名", Block: 1, Paragraph: 1, Line: 1, X: 30, Y: 30, W: 60, H: 40},
+		{Text: "日本 花子", Block: 1, Paragraph: 1, Line: 1, X: 150, Y: 30, W: 200, H: 40},
+		{Text: "東京都千代田区霞が関2-1-2", Block: 2, Paragraph: 1, Line: 1, X: 150, Y: 90, W: 500, H: 40},
+		{Text: "運転 免許証", Block: 3, Paragraph: 1, Line: 1, X: 400, Y: 560, W: 200, H: 40},
+		{Text: "東京都公安委員会", Block: 4, Paragraph: 1, Line: 1, X: 350, Y: 590, W: 250, H: 30},
+	}
+
+	candidates := factory.classifyRegions(license, width, height)
+	if expected := len(factory.GetSupportedDocumentTypes()); len(candidates) != expected {
+		t.Fatalf("Expected %d candidates, got %d", expected, len(candidates))
+	}
+	if candidates[0].DocumentType != DocumentTypeDriversLicenseJP {
+		t.Errorf("Expected driver's license to rank first, got %+v", candidates)
+	}
+	if candidates[0].Score < MinClassificationScore || candidates[0].Score <= candidates[1].Score {
+		t.Errorf("Unexpected scores: %+v", candidates)
+	}
+
+	card := []ocr.RegionInfo{
+		{Text: "個人番号カード", Block: 1, Paragraph: 1, Line: 1, X: 30, Y: 5, W: 300, H: 20},
+		{Text: "性別 女", Block: 2, Paragraph: 1, Line: 1, X: 480, Y: 390, W: 160, H: 40},
+		{Text: "臓器提供意思", Block: 3, Paragraph: 1, Line: 1, X: 30, Y: 560, W: 200, H: 30},
+	}
+	candidates = factory.classifyRegions(card, width, height)
+	if candidates[0].DocumentType != DocumentTypeIndividualNumberCard {
+		t.Errorf("Expected Individual Number Card to rank first, got %+v", candidates)
+	}
+
+	// Nothing recognized
+	candidates = factory.classifyRegions(nil, width, height)
+	if candidates[0].Score >= MinClassificationScore {
+		t.Errorf("Expected an empty image to score below the threshold, got %+v", candidates)
+	}
+}
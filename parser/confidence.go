@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"ocr-web-api/ocr"
+	"strings"
+)
+
+// applyFieldConfidence sets the aggregated OCR confidence of every extracted
+// field by locating its value in the recognized lines
+func applyFieldConfidence(doc Document, words []ocr.RegionInfo) {
+	if len(words) == 0 {
+		return
+	}
+
+	lines := ocr.GroupLines(words)
+	for _, field := range doc.FieldMap() {
+		if field != nil {
+			field.Confidence = fieldConfidence(field.Value, lines)
+		}
+	}
+}
+
+// fieldConfidence returns the length-weighted mean confidence of the words
+// that make up value. Values found inside a single line are scored by the
+// words overlapping the match; values spanning several lines (such as
+// addresses) are scored by the lines they contain. It returns 0 when the
+// value cannot be located in the OCR output.
+func fieldConfidence(value string, lines []ocr.RegionInfo) float64 {
+	target := normalizeForMatch(value)
+	if target == "" {
+		return 0
+	}
+
+	// Look for the value inside a single line first
+	for _, line := range lines {
+		if conf, found := confidenceWithinLine(target, line); found {
+			return conf
+		}
+	}
+
+	// Fall back to lines that are contained in a multi-line value
+	var weighted, weight float64
+	for _, line := range lines {
+		lineText := normalizeForMatch(line.Text)
+		if lineText == "" || !strings.Contains(target, lineText) {
+			continue
+		}
+		n := float64(len([]rune(lineText)))
+		weighted += line.Confidence * n
+		weight += n
+	}
+	if weight == 0 {
+		return 0
+	}
+	return weighted / weight
+}
+
+// confidenceWithinLine scores the words of line overlapping the first match of target
+func confidenceWithinLine(target string, line ocr.RegionInfo) (float64, bool) {
+	type span struct {
+		start, end int
+		conf       float64
+	}
+
+	var lineText []rune
+	spans := make([]span, 0, len(line.Words))
+	for _, word := range line.Words {
+		text := []rune(normalizeForMatch(word.Text))
+		spans = append(spans, span{start: len(lineText), end: len(lineText) + len(text), conf: word.Confidence})
+		lineText = append(lineText, text...)
+	}
+
+	byteIndex := strings.Index(string(lineText), target)
+	if byteIndex < 0 {
+		return 0, false
+	}
+	start := len([]rune(string(lineText)[:byteIndex]))
+	end := start + len([]rune(target))
+
+	var weighted, weight float64
+	for _, s := range spans {
+		overlap := min(s.end, end) - max(s.start, start)
+		if overlap <= 0 {
+			continue
+		}
+		weighted += s.conf * float64(overlap)
+		weight += float64(overlap)
+	}
+	if weight == 0 {
+		return 0, false
+	}
+	return weighted / weight, true
+}
+
+// normalizeForMatch removes separators that post-processing may add or drop
+func normalizeForMatch(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r', '　', '-':
+			return -1
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"math"
+	"ocr-web-api/ocr"
+	"testing"
+)
+
+// TestFieldConfidence tests that field values are scored by the words they were read from
+func TestFieldConfidence(t *testing.T) {
+	words := []ocr.RegionInfo{
+		{Text: "氏名", Confidence: 0.9, Block: 1, Paragraph: 1, Line: 1, X: 0},
+		{Text: "佐藤", Confidence: 0.8, Block: 1, Paragraph: 1, Line: 1, X: 100},
+		{Text: "花子", Confidence: 0.6, Block: 1, Paragraph: 1, Line: 1, X: 200},
+		{Text: "大阪府大阪市", Confidence: 0.5, Block: 1, Paragraph: 1, Line: 2, X: 0},
+		{Text: "中央区大手前1-1-1", Confidence: 0.7, Block: 1, Paragraph: 1, Line: 3, X: 0},
+	}
+
+	doc := &IndividualNumberCardResult{
+		Name:    &Field{Value: "佐藤 花子", Type: FieldTypeString},
+		Address: &Field{Value: "大阪府大阪市中央区大手前1-1-1", Type: FieldTypeString},
+		Gender:  &Field{Value: "女", Type: FieldTypeEnum},
+	}
+	applyFieldConfidence(doc, words)
+
+	if math.Abs(doc.Name.Confidence-0.7) > 1e-9 {
+		t.Errorf("Expected name confidence 0.7, got %f", doc.Name.Confidence)
+	}
+
+	// 6 characters at 0.5 and 9 characters (hyphens removed) at 0.7
+	expected := (0.5*6 + 0.7*9) / 15
+	if math.Abs(doc.Address.Confidence-expected) > 1e-9 {
+		t.Errorf("Expected address confidence %f, got %f", expected, doc.Address.Confidence)
+	}
+
+	if doc.Gender.Confidence != 0 {
+		t.Errorf("Expected unlocated field to have confidence 0, got %f", doc.Gender.Confidence)
+	}
+}
@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ISODateLayout is the layout of normalized date values (ISO 8601 calendar date)
+const ISODateLayout = "2006-01-02"
+
+// era describes a Japanese era (元号) and the Gregorian dates it covers
+type era struct {
+	name  string
+	start time.Time // First day of the era
+	end   time.Time // Last day of the era, zero for the current era
+}
+
+// eras lists the supported eras. Dates before 1873 used the lunisolar
+// calendar; they are treated as Gregorian here.
+var eras = []era{
+	{name: "明治", start: civilDate(1868, 1, 25), end: civilDate(1912, 7, 29)},
+	{name: "大正", start: civilDate(1912, 7, 30), end: civilDate(1926, 12, 24)},
+	{name: "昭和", start: civilDate(1926, 12, 25), end: civilDate(1989, 1, 7)},
+	{name: "平成", start: civilDate(1989, 1, 8), end: civilDate(2019, 4, 30)},
+	{name: "令和", start: civilDate(2019, 5, 1)},
+}
+
+// eraAliases maps abbreviated era notations to the full era name
+var eraAliases = map[string]string{
+	"明": "明治", "M": "明治",
+	"大": "大正", "T": "大正",
+	"昭": "昭和", "S": "昭和",
+	"平": "平成", "H": "平成",
+	"令": "令和", "R": "令和",
+}
+
+var (
+	// eraDatePattern matches dates such as 昭和60年3月10日, 令和元年5月1日 and H5.12.25
+	eraDatePattern = regexp.MustCompile(`(明治|大正|昭和|平成|令和|[明大昭平令]|[MTSHR])\s*(\d{1,2}|元)\s*[年.\-/]\s*(\d{1,2})\s*[月.\-/]\s*(\d{1,2})`)
+
+	// gregorianDatePattern matches dates such as 1985年3月10日, 1985/03/10 and 1985-03-10
+	gregorianDatePattern = regexp.MustCompile(`(\d{4})\s*[年.\-/]\s*(\d{1,2})\s*[月.\-/]\s*(\d{1,2})`)
+
+	// kanjiNumeralPattern matches runs of kanji numerals
+	kanjiNumeralPattern = regexp.MustCompile(`[〇零一二三四五六七八九十百千]+`)
+)
+
+// ParseJapaneseDate parses a date written with a Japanese era or in Gregorian
+// form. Full-width digits, kanji numerals and 元年 are accepted. The date must
+// exist in the calendar and, for era dates, fall within the era.
+func ParseJapaneseDate(text string) (time.Time, error) {
+	normalized := normalizeDateText(text)
+
+	if matches := eraDatePattern.FindStringSubmatch(normalized); matches != nil {
+		return parseEraDate(matches[1], matches[2], matches[3], matches[4])
+	}
+
+	if matches := gregorianDatePattern.FindStringSubmatch(normalized); matches != nil {
+		year, _ := strconv.Atoi(matches[1])
+		month, _ := strconv.Atoi(matches[2])
+		day, _ := strconv.Atoi(matches[3])
+		return validCivilDate(year, month, day)
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date format: %q", text)
+}
+
+// parseEraDate converts an era year, month and day to a Gregorian date
+func parseEraDate(eraName, eraYear, monthText, dayText string) (time.Time, error) {
+	if alias, exists := eraAliases[eraName]; exists {
+		eraName = alias
+	}
+
+	var current *era
+	for i := range eras {
+		if eras[i].name == eraName {
+			current = &eras[i]
+			break
+		}
+	}
+	if current == nil {
+		return time.Time{}, fmt.Errorf("unsupported era: %s", eraName)
+	}
+
+	year := 1
+	if eraYear != "元" {
+		year, _ = strconv.Atoi(eraYear)
+	}
+	if year < 1 {
+		return time.Time{}, fmt.Errorf("invalid era year: %s%d年", eraName, year)
+	}
+	month, _ := strconv.Atoi(monthText)
+	day, _ := strconv.Atoi(dayText)
+
+	date, err := validCivilDate(current.start.Year()+year-1, month, day)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if date.Before(current.start) || (!current.end.IsZero() && date.After(current.end)) {
+		return time.Time{}, fmt.Errorf("date %s is outside the %s era", date.Format(ISODateLayout), eraName)
+	}
+
+	return date, nil
+}
+
+// validCivilDate returns the date for year, month and day, rejecting dates
+// that do not exist such as February 30th
+func validCivilDate(year, month, day int) (time.Time, error) {
+	date := civilDate(year, month, day)
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid calendar date: %04d-%02d-%02d", year, month, day)
+	}
+	return date, nil
+}
+
+// civilDate returns midnight UTC of the given date
+func civilDate(year, month, day int) time.Time {
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// normalizeDateText converts full-width characters and kanji numerals to ASCII digits
+func normalizeDateText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return '0' + (r - '０')
+		case r >= 'Ａ' && r <= 'Ｚ':
+			return 'A' + (r - 'Ａ')
+		case r == '．':
+			return '.'
+		case r == '／':
+			return '/'
+		case r == '－' || r == 'ー' || r == '−':
+			return '-'
+		case r == '　':
+			return ' '
+		}
+		return r
+	}, text)
+
+	return kanjiNumeralPattern.ReplaceAllStringFunc(text, func(numeral string) string {
+		return strconv.Itoa(kanjiToInt(numeral))
+	})
+}
+
+// kanjiToInt converts kanji numerals such as 六十, 三十一 or 二〇一九 to an integer
+func kanjiToInt(numeral string) int {
+	digits := map[rune]int{
+		'〇': 0, '零': 0, '一': 1, '二': 2, '三': 3, '四': 4,
+		'五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+	}
+	units := map[rune]int{'十': 10, '百': 100, '千': 1000}
+
+	// Digit-by-digit form such as 二〇一九
+	if !strings.ContainsAny(numeral, "十百千") {
+		value := 0
+		for _, r := range numeral {
+			value = value*10 + digits[r]
+		}
+		return value
+	}
+
+	// Positional form such as 六十 or 千九百八十五
+	total, current := 0, 0
+	for _, r := range numeral {
+		if unit, isUnit := units[r]; isUnit {
+			if current == 0 {
+				current = 1
+			}
+			total += current * unit
+			current = 0
+			continue
+		}
+		current = digits[r]
+	}
+	return total + current
+}
+
+// normalizeDateFields fills the ISO value of every date field and flags
+// dates that cannot be parsed or do not exist in the calendar
+func normalizeDateFields(doc Document) {
+	for _, field := range doc.FieldMap() {
+		if field == nil || field.Type != FieldTypeDate {
+			continue
+		}
+
+		date, err := ParseJapaneseDate(field.Value)
+		if err != nil {
+			field.setInvalid(err.Error())
+			continue
+		}
+		field.Normalized = date.Format(ISODateLayout)
+		field.setValid()
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import "testing"
+
+// TestParseJapaneseDate tests era, Gregorian, full-width and kanji date forms
+func TestParseJapaneseDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "showa", input: "昭和60年3月10日", expected: "1985-03-10"},
+		{name: "showa with suffix", input: "昭和60年3月10日生", expected: "1985-03-10"},
+		{name: "heisei", input: "平成5年12月25日", expected: "1993-12-25"},
+		{name: "reiwa gannen", input: "令和元年5月1日", expected: "2019-05-01"},
+		{name: "reiwa expiry", input: "令和10年12月25日まで有効", expected: "2028-12-25"},
+		{name: "taisho", input: "大正15年12月24日", expected: "1926-12-24"},
+		{name: "meiji", input: "明治45年7月29日", expected: "1912-07-29"},
+		{name: "full-width digits", input: "平成３１年４月３０日", expected: "2019-04-30"},
+		{name: "kanji numerals", input: "昭和六十年三月十日", expected: "1985-03-10"},
+		{name: "kanji thirty-first", input: "平成二年十二月三十一日", expected: "1990-12-31"},
+		{name: "abbreviated era", input: "S60.3.10", expected: "1985-03-10"},
+		{name: "gregorian kanji", input: "1985年3月10日", expected: "1985-03-10"},
+		{name: "gregorian slash", input: "1985/03/10", expected: "1985-03-10"},
+		{name: "gregorian kanji digits", input: "二〇一九年五月一日", expected: "2019-05-01"},
+		{name: "spaced", input: "昭和 60 年 3 月 10 日", expected: "1985-03-10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, err := ParseJapaneseDate(tt.input)
+			if err != nil {
+				t.Fatalf("Expected %q to parse, got error: %v", tt.input, err)
+			}
+			if got := date.Format(ISODateLayout); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestParseJapaneseDateInvalid tests that impossible dates and era overruns are rejected
+func TestParseJapaneseDateInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "february 30th", input: "令和4年2月30日"},
+		{name: "non leap year", input: "平成31年2月29日"},
+		{name: "heisei after reiwa start", input: "平成31年5月1日"},
+		{name: "reiwa before start", input: "令和元年4月30日"},
+		{name: "showa before start", input: "昭和元年12月24日"},
+		{name: "showa 65", input: "昭和65年1月1日"},
+		{name: "era year zero", input: "令和0年5月1日"},
+		{name: "month 13", input: "1985年13月1日"},
+		{name: "not a date", input: "東京都千代田区"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if date, err := ParseJapaneseDate(tt.input); err == nil {
+				t.Errorf("Expected %q to be rejected, got %s", tt.input, date.Format(ISODateLayout))
+			}
+		})
+	}
+}
+
+// TestNormalizeDateFields tests that date fields carry both the original text and the ISO value
+func TestNormalizeDateFields(t *testing.T) {
+	doc := &DriversLicenseResult{
+		Name:       &Field{Value: "山田 太郎", Type: FieldTypeString},
+		BirthDate:  &Field{Value: "昭和60年3月10日", Type: FieldTypeDate},
+		ExpiryDate: &Field{Value: "令和4年2月30日", Type: FieldTypeDate},
+	}
+	normalizeDateFields(doc)
+
+	if doc.BirthDate.Value != "昭和60年3月10日" || doc.BirthDate.Normalized != "1985-03-10" {
+		t.Errorf("Unexpected birth date field: %+v", doc.BirthDate)
+	}
+	if doc.BirthDate.Valid == nil || !*doc.BirthDate.Valid {
+		t.Errorf("Expected birth date to be valid")
+	}
+	if doc.ExpiryDate.Valid == nil || *doc.ExpiryDate.Valid || doc.ExpiryDate.Error == "" {
+		t.Errorf("Expected expiry date to be flagged invalid, got %+v", doc.ExpiryDate)
+	}
+	if doc.Name.Normalized != "" || doc.Name.Valid != nil {
+		t.Errorf("Expected non-date field to be untouched, got %+v", doc.Name)
+	}
+}
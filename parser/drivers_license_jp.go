@@ -1,116 +1,110 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"ocr-web-api/imageprocessor"
 	"ocr-web-api/ocr"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // JPDriverLicenseParser handles parsing of Japanese driver's license documents
 type JPDriverLicenseParser struct {
 	patterns map[string]*regexp.Regexp
+	engine   ocr.Engine
 }
 
-// NewJPDriverLicenseParser creates a new Japanese driver's license parser instance
-func NewJPDriverLicenseParser() *JPDriverLicenseParser {
+// NewJPDriverLicenseParser creates a new Japanese driver's license parser instance that recognizes text with engine
+func NewJPDriverLicenseParser(engine ocr.Engine) *JPDriverLicenseParser {
 	return &JPDriverLicenseParser{
+		engine:   engine,
 		patterns: initJPDriverLicensePatterns(),
 	}
 }
 
-// Parse extracts structured data from a Japanese driver's license image
-func (p *JPDriverLicenseParser) Parse(mat imageprocessor.Mat) (map[string]string, error) {
-	// Step 1: Try region-based extraction with OpenCV for better accuracy
-	extractedData, err := p.parseWithRegionDetection(mat)
-	if err == nil && len(extractedData) > 0 {
-		// Step 1.5: Validate the extracted data from region detection
-		if validationErr := p.validateExtractedData(extractedData); validationErr == nil {
-			return extractedData, nil
-		} else {
-			fmt.Printf("Region-based extraction validation failed, falling back to full OCR: %v\n", validationErr)
-		}
+// DetectionSignals returns the signals that identify a Japanese driver's license
+func (p *JPDriverLicenseParser) DetectionSignals() DetectionSignals {
+	return DetectionSignals{
+		Keywords: []string{"運転免許証", "公安委員会", "免許の条件", "種類", "優良", "大型", "普通"},
+		Layout:   jpDriverLicenseFrontLayout,
+	}
+}
+
+// Parse extracts structured data from a Japanese driver's license image.
+// The image is expected to be the rectified card produced by the preprocessing pipeline.
+func (p *JPDriverLicenseParser) Parse(ctx context.Context, mat imageprocessor.Mat) (*Result, error) {
+	// Step 1: Read every field from its zone of the card layout
+	extractedData, regions, err := p.parseWithTemplate(ctx, mat)
+	zonesValid := err == nil && p.validateExtractedData(extractedData) == nil
+	if zonesValid && jpDriverLicenseFrontLayout.Complete(extractedData) {
+		// Every zone was read; no need for a full-page OCR pass
+		return p.buildResult(extractedData, regions), nil
+	}
+	if err != nil {
+		slog.InfoContext(ctx, "Layout-based extraction failed, falling back to full OCR", "document_type", DocumentTypeDriversLicenseJP, "error", err)
+	}
+
+	// Do not fall back to a second OCR run once the request has been cancelled,
+	// or when the OCR pool has no room for it
+	if errors.Is(err, ocr.ErrPoolSaturated) {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	// Step 2: Fallback to traditional OCR text extraction
-	ocrText, err := p.extractTextUsingOCR(mat)
+	ocrText, pageRegions, err := p.extractTextUsingOCR(ctx, mat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract text via OCR: %w", err)
 	}
 
 	// Step 3: Parse the text using regex patterns
-	extractedData, err = p.parseTextWithRegex(ocrText)
+	fallbackData, err := p.parseTextWithRegex(ocrText)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse text with regex: %w", err)
 	}
 
+	// Zone values are kept when they are usable; the full-page pass only fills the gaps
+	if zonesValid {
+		mergeMissingFields(extractedData, fallbackData)
+		regions = mergeRegions(regions, pageRegions)
+	} else {
+		extractedData = fallbackData
+		regions = pageRegions
+	}
+
 	// Step 4: Validate the extracted data
 	if err := p.validateExtractedData(extractedData); err != nil {
 		return nil, fmt.Errorf("validation failed for driver's license data: %w", err)
 	}
 
-	return extractedData, nil
+	return p.buildResult(extractedData, regions), nil
 }
 
-// parseWithRegionDetection uses OpenCV region detection for more accurate field extraction
-func (p *JPDriverLicenseParser) parseWithRegionDetection(mat imageprocessor.Mat) (map[string]string, error) {
-	// Convert Mat to image data
-	imageData, err := mat.ToBytes()
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert Mat to bytes: %w", err)
-	}
-
-	// Create OCR engine
-	engine := ocr.NewOCREngine()
-	defer engine.Close()
+// buildResult assembles the typed result and scores each field against the OCR regions
+func (p *JPDriverLicenseParser) buildResult(data map[string]string, regions []ocr.RegionInfo) *Result {
+	doc := newDriversLicenseResult(data)
+	applyFieldConfidence(doc, regions)
+	normalizeDateFields(doc)
+	validateLicenseNumber(doc, time.Now())
+	return NewResult(DocumentTypeDriversLicenseJP, doc)
+}
 
-	// Extract text regions with positional information
-	regions, err := engine.ExtractRegions(imageData)
+// parseWithTemplate recognizes each field in its own zone of the card layout.
+// The recognized words are returned as well so field confidence can be scored against them.
+func (p *JPDriverLicenseParser) parseWithTemplate(ctx context.Context, mat imageprocessor.Mat) (map[string]string, []ocr.RegionInfo, error) {
+	extractedData, regions, err := jpDriverLicenseFrontLayout.Extract(ctx, p.engine, mat)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract regions: %w", err)
+		return nil, nil, err
 	}
 
-	extractedData := make(map[string]string)
-
-	// Process regions based on category and content for driver's license
-	for _, region := range regions {
-		switch region.Category {
-		case "name":
-			if isValidName(region.Text) {
-				extractedData["name"] = region.Text
-			}
-		case "address":
-			if isValidAddress(region.Text) {
-				extractedData["address"] = region.Text
-			}
-		case "date":
-			if isValidDate(region.Text) {
-				if strings.Contains(region.Text, "生") {
-					extractedData["birth_date"] = region.Text
-				} else if strings.Contains(region.Text, "交付") {
-					extractedData["issue_date"] = region.Text
-				} else if strings.Contains(region.Text, "有効") {
-					extractedData["expiry_date"] = region.Text
-				}
-			}
-		case "number":
-			if isValidLicenseNumber(region.Text) {
-				extractedData["license_number"] = region.Text
-			}
-		}
-	}
-
-	// Enhanced extraction for driver's license specific fields
-	if municipality := extractMunicipalityFromRegions(regions); municipality != "" {
-		extractedData["municipality"] = municipality
-	}
-
-	if name := extractNameFromRegions(regions); name != "" {
-		extractedData["name"] = name
-	}
-
-	return extractedData, nil
+	p.postProcessExtractedData(extractedData)
+	return extractedData, regions, nil
 }
 
 // parseTextWithRegex extracts structured data from OCR text using regex patterns
@@ -174,6 +168,11 @@ func (p *JPDriverLicenseParser) postProcessExtractedData(data map[string]string)
 			cleaned = strings.ReplaceAll(cleaned, "  ", " ")
 		}
 		data["address"] = strings.TrimSpace(cleaned)
+
+		// The municipality is the leading part of the address
+		if municipality := municipalityFromAddress(data["address"]); municipality != "" {
+			data["municipality"] = municipality
+		}
 	}
 
 	// Normalize name field
@@ -225,20 +224,15 @@ func initJPDriverLicensePatterns() map[string]*regexp.Regexp {
 	patterns["name_alt"] = regexp.MustCompile(`([ァ-ヴー一-龯ひ-ゖ]+\s+[ァ-ヴー一-龯ひ-ゖ]+)`)
 
 	// Date patterns with specific Japanese date formats
-	patterns["birth_date_alt"] = regexp.MustCompile(`([平成|昭和|令和]\d{1,2}年\d{1,2}月\d{1,2}日|\d{4}年\d{1,2}月\d{1,2}日)`)
+	patterns["birth_date_alt"] = regexp.MustCompile(`((?:明治|大正|昭和|平成|令和)\s*(?:\d{1,2}|元)年\d{1,2}月\d{1,2}日|\d{4}年\d{1,2}月\d{1,2}日)`)
 
 	return patterns
 }
 
 // validateExtractedData validates the extracted data for required fields
 func (p *JPDriverLicenseParser) validateExtractedData(data map[string]string) error {
-	requiredFields := []string{"name"}
-
-	for _, field := range requiredFields {
-		value, exists := data[field]
-		if !exists || strings.TrimSpace(value) == "" {
-			return fmt.Errorf("required field '%s' is missing or empty", field)
-		}
+	if err := checkRequiredFields(data, "name"); err != nil {
+		return err
 	}
 
 	// Additional validation for specific fields
@@ -246,10 +240,9 @@ func (p *JPDriverLicenseParser) validateExtractedData(data map[string]string) er
 		// Remove spaces and validate length
 		cleanNumber := strings.ReplaceAll(licenseNumber, " ", "")
 		if len(cleanNumber) != 12 {
-			return fmt.Errorf("invalid license number format: expected 12 digits, got %d", len(cleanNumber))
+			return invalidFieldError("license_number", fmt.Sprintf("expected 12 digits, got %d", len(cleanNumber)))
 		}
 	}
 
 	return nil
 }
-
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+	"regexp"
+	"strings"
+)
+
+// jpDriverLicenseBackLayout is the back of a Japanese driver's license. The
+// remarks (備考) area holds one change record per line, each starting with
+// its date and ending with the seal of the police.
+var jpDriverLicenseBackLayout = &LayoutTemplate{
+	Name: DocumentTypeDriversLicenseJP + "/back",
+	Zones: []Zone{
+		{Field: "remarks", X: 0.03, Y: 0.05, W: 0.94, H: 0.60, Options: zoneTextBlock, Multiline: true},
+	},
+}
+
+var (
+	// changeDatePattern finds the date a change record starts with, such as
+	// 令和5年4月1日 or R5.4.1. Unlike eraDatePattern it does not rely on
+	// kanji numerals being converted, so it can run on the raw record.
+	changeDatePattern = regexp.MustCompile(`(?:明治|大正|昭和|平成|令和|[明大昭平令]|[MTSHR])\s*(?:[0-9０-９]{1,2}|元)\s*[年.．\-/]\s*[0-9０-９]{1,2}\s*[月.．\-/]\s*[0-9０-９]{1,2}\s*日?|[0-9０-９]{4}\s*[年.．\-/]\s*[0-9０-９]{1,2}\s*[月.．\-/]\s*[0-9０-９]{1,2}\s*日?`)
+
+	// changeStampPattern finds the seal of the authority that made the change
+	changeStampPattern = regexp.MustCompile(`\S*?(?:公安委員会|警視庁|警察本部長?|警察署長?)`)
+
+	// licenseCategories lists the license classes that may be added on the back
+	licenseCategories = []string{"大型", "中型", "準中型", "普通", "大特", "大自二", "普自二", "小特", "原付", "けん引", "牽引", "二種"}
+)
+
+// ParseWithBack parses both sides of a driver's license and merges the change
+// records of the back into the result of the front
+func (p *JPDriverLicenseParser) ParseWithBack(ctx context.Context, front, back imageprocessor.Mat) (*Result, error) {
+	result, err := p.Parse(ctx, front)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := p.ParseBack(ctx, back)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse back side: %w", err)
+	}
+
+	mergeLicenseBack(result.Fields.(*DriversLicenseResult), changes)
+	return result, nil
+}
+
+// ParseBack reads the change records from the remarks area of the back of a
+// driver's license. A back without records yields an empty list.
+func (p *JPDriverLicenseParser) ParseBack(ctx context.Context, mat imageprocessor.Mat) ([]LicenseChangeRecord, error) {
+	data, regions, err := jpDriverLicenseBackLayout.Extract(ctx, p.engine, mat)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := parseLicenseChanges(data["remarks"])
+	lines := ocr.GroupLines(regions)
+	for i := range changes {
+		changes[i].Date.Confidence = fieldConfidence(changes[i].Date.Value, lines)
+		changes[i].Value.Confidence = fieldConfidence(changes[i].Value.Value, lines)
+	}
+	return changes, nil
+}
+
+// parseLicenseChanges splits the remarks text into change records. A line
+// without a date continues the record above it, e.g. a wrapped address,
+// unless that record is already closed by its seal.
+func parseLicenseChanges(text string) []LicenseChangeRecord {
+	var records []string
+	for _, line := range strings.Split(text, "\n") {
+		line = collapseSpaces(line)
+		if line == "" {
+			continue
+		}
+		if len(records) == 0 || changeDatePattern.MatchString(line) || changeStampPattern.MatchString(records[len(records)-1]) {
+			records = append(records, line)
+			continue
+		}
+		records[len(records)-1] += " " + line
+	}
+
+	changes := make([]LicenseChangeRecord, 0, len(records))
+	for _, record := range records {
+		if change, ok := parseLicenseChange(record); ok {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// parseLicenseChange decodes a single change record. Records without a
+// date are OCR noise and are skipped.
+func parseLicenseChange(record string) (LicenseChangeRecord, bool) {
+	location := changeDatePattern.FindStringIndex(record)
+	if location == nil {
+		return LicenseChangeRecord{}, false
+	}
+
+	change := LicenseChangeRecord{
+		Date: &Field{Value: strings.Join(strings.Fields(record[location[0]:location[1]]), ""), Type: FieldTypeDate},
+		Kind: LicenseChangeOther,
+		Text: record,
+	}
+	if date, err := ParseJapaneseDate(change.Date.Value); err == nil {
+		change.Date.Normalized = date.Format(ISODateLayout)
+		change.Date.setValid()
+	} else {
+		change.Date.setInvalid(err.Error())
+	}
+
+	// The seal closes the record
+	content := record[location[1]:]
+	if stamps := changeStampPattern.FindAllStringIndex(content, -1); stamps != nil {
+		last := stamps[len(stamps)-1]
+		change.Stamp = content[last[0]:last[1]]
+		content = content[:last[0]] + content[last[1]:]
+	}
+	content = collapseSpaces(content)
+
+	var value string
+	switch {
+	case strings.HasPrefix(content, "住所") || strings.HasPrefix(content, "住居") || municipalityFromAddress(content) != "":
+		change.Kind = LicenseChangeAddress
+		content = strings.TrimPrefix(strings.TrimPrefix(content, "住所"), "住居")
+		value = cleanAddress(strings.TrimLeft(content, " :：変更"))
+	case strings.HasPrefix(content, "氏名"):
+		change.Kind = LicenseChangeName
+		value = collapseSpaces(strings.TrimLeft(strings.TrimPrefix(content, "氏名"), " :：変更"))
+	case containsAny(content, licenseCategories):
+		change.Kind = LicenseChangeLicenseClass
+		value = content
+	default:
+		value = content
+	}
+	change.Value = &Field{Value: value, Type: FieldTypeString}
+	return change, true
+}
+
+// containsAny reports whether text contains any of the given substrings
+func containsAny(text string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(text, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeLicenseBack adds the change records of the back to a front result.
+// The latest address change becomes the current address, and every field
+// is tagged with the side it was read from.
+func mergeLicenseBack(doc *DriversLicenseResult, changes []LicenseChangeRecord) {
+	for _, field := range doc.FieldMap() {
+		if field != nil {
+			field.Source = SourceFront
+		}
+	}
+	for _, change := range changes {
+		change.Date.Source = SourceBack
+		change.Value.Source = SourceBack
+	}
+	doc.Changes = changes
+
+	// Records are written in order; a later dated record wins over an undated one
+	var latest *LicenseChangeRecord
+	for i := range changes {
+		change := &changes[i]
+		if change.Kind != LicenseChangeAddress || change.Value.Value == "" {
+			continue
+		}
+		if latest == nil || change.Date.Normalized >= latest.Date.Normalized {
+			latest = change
+		}
+	}
+	if latest == nil {
+		return
+	}
+
+	address := *latest.Value
+	address.Source = SourceBack
+	doc.CurrentAddress = &address
+	if municipality := municipalityFromAddress(address.Value); municipality != "" {
+		doc.Municipality = &Field{Value: municipality, Type: FieldTypeString, Confidence: address.Confidence, Source: SourceBack}
+	}
+}
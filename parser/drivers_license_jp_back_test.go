@@ -0,0 +1,62 @@
+package parser
+
+import "testing"
+
+// TestParseLicenseChanges tests splitting the remarks area into change records
+func TestParseLicenseChanges(t *testing.T) {
+	text := "令和3年5月10日 住所 東京都新宿区西新宿2-8-1 東京都公安委員会\n" +
+		"R5.4.1 住所 神奈川県横浜市中区\n" +
+		"日本大通1 神奈川県公安委員会\n" +
+		"令和6年1月20日 大型二輪 追加 神奈川県公安委員会\n" +
+		"ノイズ\n"
+
+	changes := parseLicenseChanges(text)
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 change records, got %d: %+v", len(changes), changes)
+	}
+
+	expected := []struct {
+		date, kind, value, stamp string
+	}{
+		{"2021-05-10", LicenseChangeAddress, "東京都新宿区西新宿2-8-1", "東京都公安委員会"},
+		{"2023-04-01", LicenseChangeAddress, "神奈川県横浜市中区日本大通1", "神奈川県公安委員会"},
+		{"2024-01-20", LicenseChangeLicenseClass, "大型二輪 追加", "神奈川県公安委員会"},
+	}
+	for i, want := range expected {
+		got := changes[i]
+		if got.Date.Normalized != want.date || got.Kind != want.kind || got.Value.Value != want.value || got.Stamp != want.stamp {
+			t.Errorf("Record %d: expected %+v, got date=%s kind=%s value=%s stamp=%s",
+				i, want, got.Date.Normalized, got.Kind, got.Value.Value, got.Stamp)
+		}
+	}
+}
+
+// TestMergeLicenseBack tests that the latest address change becomes the current address
+func TestMergeLicenseBack(t *testing.T) {
+	data := map[string]string{"name": "山田 太郎", "address": "東京都新宿区西新宿2-8-1", "municipality": "東京都新宿区"}
+	doc := newDriversLicenseResult(data)
+
+	changes := parseLicenseChanges("R5.4.1 住所 神奈川県横浜市中区日本大通1 神奈川県公安委員会\n" +
+		"令和3年5月10日 住所 東京都渋谷区道玄坂1 東京都公安委員会")
+	mergeLicenseBack(doc, changes)
+
+	if doc.CurrentAddress.Value != "神奈川県横浜市中区日本大通1" || doc.CurrentAddress.Source != SourceBack {
+		t.Errorf("Expected the latest address change as current address, got %+v", doc.CurrentAddress)
+	}
+	if doc.Address.Value != data["address"] || doc.Address.Source != SourceFront {
+		t.Errorf("Expected the printed address to be kept from the front, got %+v", doc.Address)
+	}
+	if doc.Municipality.Value != "神奈川県横浜市" || doc.Municipality.Source != SourceBack {
+		t.Errorf("Expected municipality of the current address, got %+v", doc.Municipality)
+	}
+	if doc.Name.Source != SourceFront || len(doc.Changes) != 2 {
+		t.Errorf("Expected front fields to be tagged and changes to be kept, got %+v, %d changes", doc.Name, len(doc.Changes))
+	}
+
+	// Without address changes the printed address stays current
+	doc = newDriversLicenseResult(data)
+	mergeLicenseBack(doc, nil)
+	if doc.CurrentAddress.Value != data["address"] || doc.CurrentAddress.Source != SourceFront {
+		t.Errorf("Expected the printed address as current address, got %+v", doc.CurrentAddress)
+	}
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrRequiredFieldMissing is wrapped by a FieldError for required fields
+	// that could not be read from the document
+	ErrRequiredFieldMissing = errors.New("required field is missing")
+
+	// ErrInvalidField is wrapped by a FieldError for fields whose value is not valid
+	ErrInvalidField = errors.New("invalid field value")
+
+	// ErrMRZNotFound is returned when no machine readable zone is found on a passport
+	ErrMRZNotFound = errors.New("machine readable zone not found")
+)
+
+// FieldError reports document fields that are missing or invalid. The
+// message names the fields but never repeats their values.
+type FieldError struct {
+	Err    error    // ErrRequiredFieldMissing or ErrInvalidField
+	Fields []string // Names of the failing fields
+	Reason string   // Why the fields are invalid; empty for missing fields
+}
+
+func (e *FieldError) Error() string {
+	if e.Err == ErrRequiredFieldMissing {
+		if len(e.Fields) == 1 {
+			return fmt.Sprintf("required field '%s' is missing or empty", e.Fields[0])
+		}
+		return fmt.Sprintf("required fields '%s' are missing or empty", strings.Join(e.Fields, "', '"))
+	}
+	return fmt.Sprintf("invalid %s: %s", strings.Join(e.Fields, ", "), e.Reason)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// checkRequiredFields returns a FieldError naming every required field that
+// is missing from data or empty, or nil when all are present
+func checkRequiredFields(data map[string]string, fields ...string) error {
+	var missing []string
+	for _, field := range fields {
+		if strings.TrimSpace(data[field]) == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &FieldError{Err: ErrRequiredFieldMissing, Fields: missing}
+}
+
+// invalidFieldError returns a FieldError for a field with an invalid value
+func invalidFieldError(field, reason string) error {
+	return &FieldError{Err: ErrInvalidField, Fields: []string{field}, Reason: reason}
+}
@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCheckRequiredFields tests that every missing field is named but no value is repeated
+func TestCheckRequiredFields(t *testing.T) {
+	data := map[string]string{"name": "山田 太郎", "birthDate": " ", "address": "東京都千代田区"}
+
+	if err := checkRequiredFields(data, "name", "address"); err != nil {
+		t.Fatalf("Expected present fields to pass, got %v", err)
+	}
+
+	err := checkRequiredFields(data, "name", "birthDate", "licenseNumber")
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || !errors.Is(err, ErrRequiredFieldMissing) {
+		t.Fatalf("Expected missing field error, got %v", err)
+	}
+	if expected := []string{"birthDate", "licenseNumber"}; !reflect.DeepEqual(fieldErr.Fields, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, fieldErr.Fields)
+	}
+
+	err = invalidFieldError("expiryDate", "must be after issue date")
+	if !errors.Is(err, ErrInvalidField) || strings.Contains(err.Error(), "山田") {
+		t.Errorf("Expected invalid field error without values, got %v", err)
+	}
+}
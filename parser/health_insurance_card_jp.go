@@ -0,0 +1,288 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+	"regexp"
+	"strings"
+)
+
+// HealthInsuranceCardParser handles parsing of Japanese health insurance
+// certificates (健康保険被保険者証). Employee insurance certificates are
+// issued as ID-1 cards; National Health Insurance certificates are often
+// paper of no fixed size, which is read from the full page only.
+type HealthInsuranceCardParser struct {
+	patterns map[string]*regexp.Regexp
+	engine   ocr.Engine
+}
+
+// NewHealthInsuranceCardParser creates a new health insurance card parser instance that recognizes text with engine
+func NewHealthInsuranceCardParser(engine ocr.Engine) *HealthInsuranceCardParser {
+	return &HealthInsuranceCardParser{
+		engine:   engine,
+		patterns: initHealthInsuranceCardPatterns(),
+	}
+}
+
+// healthInsuranceCardFrontLayout is the front of a health insurance card.
+// Zones start right of the printed labels (記号, 番号, 氏名, 保険者番号…).
+var healthInsuranceCardFrontLayout = &LayoutTemplate{
+	Name: DocumentTypeHealthInsuranceCard + "/front",
+	Zones: []Zone{
+		{Field: "symbol", X: 0.10, Y: 0.15, W: 0.30, H: 0.09, Options: zoneTextLine, Clean: collapseSpaces},
+		{Field: "number", X: 0.50, Y: 0.15, W: 0.24, H: 0.09, Options: zoneDigits, Clean: cleanDigits},
+		{Field: "branch_number", X: 0.86, Y: 0.15, W: 0.11, H: 0.09, Options: zoneDigits, Clean: cleanDigits, Optional: true},
+		{Field: "name", X: 0.14, Y: 0.28, W: 0.60, H: 0.10, Options: zoneTextLine, Clean: cleanName},
+		{Field: "birth_date", X: 0.20, Y: 0.40, W: 0.45, H: 0.08, Options: zoneDateLine, Clean: cleanDate},
+		{Field: "gender", X: 0.80, Y: 0.40, W: 0.12, H: 0.08, Options: zoneGender},
+		{Field: "issue_date", X: 0.25, Y: 0.58, W: 0.45, H: 0.08, Options: zoneDateLine, Clean: cleanDate},
+		{Field: "insurer_number", X: 0.28, Y: 0.71, W: 0.40, H: 0.08, Options: zoneDigits, Clean: cleanDigits},
+		{Field: "insurer_name", X: 0.28, Y: 0.80, W: 0.68, H: 0.09, Options: zoneTextLine, Clean: collapseSpaces},
+	},
+}
+
+// DetectionSignals returns the signals that identify a health insurance certificate
+func (p *HealthInsuranceCardParser) DetectionSignals() DetectionSignals {
+	return DetectionSignals{
+		Keywords: []string{"被保険者証", "健康保険", "保険者番号", "保険者名称", "被保険者", "資格取得", "国民健康保険"},
+		Layout:   healthInsuranceCardFrontLayout,
+	}
+}
+
+// HasPaperVariant reports that health insurance certificates are also issued on paper
+func (p *HealthInsuranceCardParser) HasPaperVariant() bool {
+	return true
+}
+
+// Parse extracts structured data from a health insurance certificate image.
+// A card is expected to be rectified by the preprocessing pipeline; any
+// other image is treated as a paper certificate.
+func (p *HealthInsuranceCardParser) Parse(ctx context.Context, mat imageprocessor.Mat) (*Result, error) {
+	variant, err := healthInsuranceVariant(mat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Read every field from its zone of the card layout. Paper
+	// certificates have no common layout and go straight to the full page.
+	var extractedData map[string]string
+	var regions []ocr.RegionInfo
+	zonesValid := false
+	if variant == HealthInsuranceVariantCard {
+		extractedData, regions, err = p.parseWithTemplate(ctx, mat)
+		zonesValid = err == nil && p.validateExtractedData(extractedData) == nil
+		if zonesValid && healthInsuranceCardFrontLayout.Complete(extractedData) {
+			// Every zone was read; no need for a full-page OCR pass
+			return p.buildResult(extractedData, regions, variant), nil
+		}
+		if err != nil {
+			slog.InfoContext(ctx, "Layout-based extraction failed, falling back to full OCR", "document_type", DocumentTypeHealthInsuranceCard, "error", err)
+		}
+	}
+
+	// Do not fall back to a second OCR run once the request has been cancelled,
+	// or when the OCR pool has no room for it
+	if errors.Is(err, ocr.ErrPoolSaturated) {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Step 2: Fallback to traditional OCR text extraction
+	ocrText, pageRegions, err := p.extractTextUsingOCR(ctx, mat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract text via OCR: %w", err)
+	}
+
+	// Step 3: Parse the text using regex patterns
+	fallbackData, err := p.parseTextWithRegex(ocrText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text with regex: %w", err)
+	}
+
+	// Zone values are kept when they are usable; the full-page pass only fills the gaps
+	if zonesValid {
+		mergeMissingFields(extractedData, fallbackData)
+		regions = mergeRegions(regions, pageRegions)
+	} else {
+		extractedData = fallbackData
+		regions = pageRegions
+	}
+
+	// Step 4: Validate the extracted data
+	if err := p.validateExtractedData(extractedData); err != nil {
+		return nil, fmt.Errorf("validation failed for health insurance card data: %w", err)
+	}
+
+	return p.buildResult(extractedData, regions, variant), nil
+}
+
+// healthInsuranceVariant tells a rectified card from a paper certificate by
+// the aspect ratio of the processed image
+func healthInsuranceVariant(mat imageprocessor.Mat) (string, error) {
+	img, err := imageprocessor.DecodeMat(mat)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode processed image: %w", err)
+	}
+
+	ratio := float64(img.Bounds().Dx()) / float64(img.Bounds().Dy())
+	if math.Abs(ratio-imageprocessor.ID1AspectRatio)/imageprocessor.ID1AspectRatio < 0.02 {
+		return HealthInsuranceVariantCard, nil
+	}
+	return HealthInsuranceVariantPaper, nil
+}
+
+// buildResult assembles the typed result and scores each field against the OCR regions
+func (p *HealthInsuranceCardParser) buildResult(data map[string]string, regions []ocr.RegionInfo, variant string) *Result {
+	data["variant"] = variant
+	doc := newHealthInsuranceCardResult(data)
+	applyFieldConfidence(doc, regions)
+	normalizeDateFields(doc)
+	validateInsurerNumberField(doc.InsurerNumber)
+	return NewResult(DocumentTypeHealthInsuranceCard, doc)
+}
+
+// parseWithTemplate recognizes each field in its own zone of the card layout.
+// The recognized words are returned as well so field confidence can be scored against them.
+func (p *HealthInsuranceCardParser) parseWithTemplate(ctx context.Context, mat imageprocessor.Mat) (map[string]string, []ocr.RegionInfo, error) {
+	extractedData, regions, err := healthInsuranceCardFrontLayout.Extract(ctx, p.engine, mat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.postProcessExtractedData(extractedData)
+	return extractedData, regions, nil
+}
+
+// parseTextWithRegex extracts structured data from OCR text using regex patterns.
+// Patterns may have alternative groups; the first non-empty one is used.
+func (p *HealthInsuranceCardParser) parseTextWithRegex(ocrText string) (map[string]string, error) {
+	extractedData := make(map[string]string)
+
+	// Apply each regex pattern to extract relevant fields
+	for fieldName, pattern := range p.patterns {
+		matches := pattern.FindStringSubmatch(ocrText)
+		for _, match := range matches[min(1, len(matches)):] {
+			// Clean up the extracted text
+			if value := strings.TrimSpace(match); value != "" {
+				extractedData[fieldName] = value
+				break
+			}
+		}
+	}
+
+	// Post-process extracted data
+	p.postProcessExtractedData(extractedData)
+
+	return extractedData, nil
+}
+
+// symbolNumberPattern splits a combined 記号・番号 value such as 12345・67
+var symbolNumberPattern = regexp.MustCompile(`^(\S+?)\s*[・･/]\s*(\d+)`)
+
+// postProcessExtractedData cleans and normalizes extracted data
+func (p *HealthInsuranceCardParser) postProcessExtractedData(data map[string]string) {
+	// Some certificates print 記号・番号 as a single item
+	if combined, exists := data["symbol_number"]; exists {
+		if matches := symbolNumberPattern.FindStringSubmatch(combined); matches != nil {
+			data["symbol"] = matches[1]
+			data["number"] = matches[2]
+		}
+		delete(data, "symbol_number")
+	}
+
+	for _, key := range []string{"insurer_number", "branch_number"} {
+		if number, exists := data[key]; exists {
+			data[key] = cleanDigits(number)
+		}
+	}
+
+	// The name line often continues with the sex or birth date on paper certificates
+	if name, exists := data["name"]; exists {
+		for _, label := range []string{"性別", "生年月日"} {
+			name, _, _ = strings.Cut(name, label)
+		}
+		data["name"] = cleanName(name)
+	}
+
+	for _, key := range []string{"birth_date", "issue_date"} {
+		if date, exists := data[key]; exists {
+			data[key] = cleanDate(date)
+		}
+	}
+
+	if insurer, exists := data["insurer_name"]; exists {
+		data["insurer_name"] = collapseSpaces(insurer)
+	}
+
+	// Normalize gender field
+	if gender, exists := data["gender"]; exists {
+		cleaned := strings.TrimSpace(gender)
+		if cleaned == "男性" || cleaned == "男" {
+			data["gender"] = "男"
+		} else if cleaned == "女性" || cleaned == "女" {
+			data["gender"] = "女"
+		}
+	}
+}
+
+// initHealthInsuranceCardPatterns initializes regex patterns for health insurance certificate fields
+func initHealthInsuranceCardPatterns() map[string]*regexp.Regexp {
+	patterns := make(map[string]*regexp.Regexp)
+
+	const date = `((?:明治|大正|昭和|平成|令和)\s*(?:\d{1,2}|元)\s*年\s*\d{1,2}\s*月\s*\d{1,2}\s*日|\d{4}\s*年\s*\d{1,2}\s*月\s*\d{1,2}\s*日)`
+
+	// Name pattern (氏名)
+	patterns["name"] = regexp.MustCompile(`氏\s*名\s*[:：]?\s*([^\r\n]+)`)
+
+	// Birth date pattern (生年月日)
+	patterns["birth_date"] = regexp.MustCompile(`生\s*年\s*月\s*日\s*[:：]?\s*` + date)
+
+	// Gender pattern (性別)
+	patterns["gender"] = regexp.MustCompile(`性\s*別\s*[:：]?\s*([男女])`)
+
+	// Symbol (記号), unless printed together with the number
+	patterns["symbol"] = regexp.MustCompile(`記\s*号\s*[:：]?\s*([^\s・･:：番]+)`)
+
+	// Number (番号), excluding the insurer number (保険者番号)
+	patterns["number"] = regexp.MustCompile(`(?:^|[^者・･])番\s*号\s*[:：]?\s*(\d+)`)
+
+	// Combined symbol and number (記号・番号), e.g. 12345・67
+	patterns["symbol_number"] = regexp.MustCompile(`記\s*号\s*[・･]\s*番\s*号\s*[:：]?\s*(\S+\s*[・･/]\s*\d+)`)
+
+	// Branch number (枝番), two digits
+	patterns["branch_number"] = regexp.MustCompile(`枝\s*番\s*[)）]?\s*[:：]?\s*(\d{1,2})`)
+
+	// Issue date (交付年月日), printed either after its label or before 交付
+	patterns["issue_date"] = regexp.MustCompile(`(?:交\s*付|発\s*行)\s*(?:年\s*月\s*日)?\s*[:：]?\s*` + date + `|` + date + `[ \t]*交\s*付`)
+
+	// Insurer number (保険者番号) - 6 or 8 digits
+	patterns["insurer_number"] = regexp.MustCompile(`保\s*険\s*者\s*番\s*号\s*[:：]?\s*(\d[\d ]{4,8}\d)`)
+
+	// Insurer name (保険者名称)
+	patterns["insurer_name"] = regexp.MustCompile(`保\s*険\s*者\s*名\s*称\s*[:：]?\s*([^\r\n]+)`)
+
+	return patterns
+}
+
+// validateExtractedData validates the extracted data for required fields
+func (p *HealthInsuranceCardParser) validateExtractedData(data map[string]string) error {
+	if err := checkRequiredFields(data, "name"); err != nil {
+		return err
+	}
+
+	// Gender validation
+	if gender, exists := data["gender"]; exists {
+		if gender != "男" && gender != "女" {
+			return invalidFieldError("gender", "expected '男' or '女'")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+package parser
+
+import (
+	"context"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+)
+
+// extractTextUsingOCR performs OCR text extraction from the image. The
+// recognized words are returned as well so the fallback fields can be scored.
+func (p *HealthInsuranceCardParser) extractTextUsingOCR(ctx context.Context, mat imageprocessor.Mat) (string, []ocr.RegionInfo, error) {
+	return recognizePage(ctx, p.engine, mat)
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"image"
+	"ocr-web-api/imageprocessor"
+	"testing"
+)
+
+// TestValidateInsurerNumber tests the insurer number check digit
+func TestValidateInsurerNumber(t *testing.T) {
+	valid := []string{"01130012", "131045", "138016", "0113 0012"}
+	for _, number := range valid {
+		if err := validateInsurerNumber(number); err != nil {
+			t.Errorf("Expected %q to be valid, got error: %v", number, err)
+		}
+	}
+
+	invalid := []string{"", "01130013", "1310", "0113001A", "131046"}
+	for _, number := range invalid {
+		if err := validateInsurerNumber(number); err == nil {
+			t.Errorf("Expected %q to be invalid", number)
+		}
+	}
+}
+
+// TestInsurerNumberField tests that an unambiguous single-digit misread is repaired
+func TestInsurerNumberField(t *testing.T) {
+	field := &Field{Value: "131845", Type: FieldTypeNumber}
+	validateInsurerNumberField(field)
+	if field.Valid == nil || !*field.Valid || !field.Corrected || field.Value != "131045" {
+		t.Errorf("Expected 131845 to be corrected to 131045, got %+v", field)
+	}
+
+	field = &Field{Value: "1234", Type: FieldTypeNumber}
+	validateInsurerNumberField(field)
+	if field.Valid == nil || *field.Valid || field.Error == "" {
+		t.Errorf("Expected short number to be invalid, got %+v", field)
+	}
+}
+
+// TestHealthInsuranceRegex tests field extraction from the full-page OCR text of a paper certificate
+func TestHealthInsuranceRegex(t *testing.T) {
+	text := "国民健康保険被保険者証\n" +
+		"記号・番号 新宿12・3456 (枝番) 01\n" +
+		"氏名 山田 太郎 性別 男\n" +
+		"生年月日 昭和60年3月10日\n" +
+		"交付年月日 令和5年4月1日\n" +
+		"保険者番号 131045\n" +
+		"保険者名称 新宿区\n"
+
+	data, err := NewHealthInsuranceCardParser(nil).parseTextWithRegex(text)
+	if err != nil {
+		t.Fatalf("Expected text to be parsed, got error: %v", err)
+	}
+
+	expected := map[string]string{
+		"symbol":         "新宿12",
+		"number":         "3456",
+		"branch_number":  "01",
+		"name":           "山田 太郎",
+		"gender":         "男",
+		"birth_date":     "昭和60年3月10日",
+		"issue_date":     "令和5年4月1日",
+		"insurer_number": "131045",
+		"insurer_name":   "新宿区",
+	}
+	for key, value := range expected {
+		if data[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, data[key])
+		}
+	}
+
+	result := NewHealthInsuranceCardParser(nil).buildResult(data, nil, HealthInsuranceVariantPaper)
+	doc := result.Fields.(*HealthInsuranceCardResult)
+	if doc.BirthDate.Normalized != "1985-03-10" {
+		t.Errorf("Expected normalized birth date 1985-03-10, got %q", doc.BirthDate.Normalized)
+	}
+	if doc.InsurerNumber.Valid == nil || !*doc.InsurerNumber.Valid {
+		t.Errorf("Expected insurer number to be valid, got %+v", doc.InsurerNumber)
+	}
+	if doc.Variant.Value != HealthInsuranceVariantPaper {
+		t.Errorf("Expected paper variant, got %q", doc.Variant.Value)
+	}
+}
+
+// TestHealthInsuranceCardRegex tests the separate labels and trailing issue date of a card
+func TestHealthInsuranceCardRegex(t *testing.T) {
+	text := "健康保険 被保険者証 本人(被保険者) 令和3年4月1日交付\n" +
+		"記号 1234567 番号 89 (枝番) 00\n" +
+		"氏名 鈴木 花子\n" +
+		"保険者番号 01130012\n"
+
+	data, _ := NewHealthInsuranceCardParser(nil).parseTextWithRegex(text)
+	expected := map[string]string{
+		"symbol":         "1234567",
+		"number":         "89",
+		"branch_number":  "00",
+		"issue_date":     "令和3年4月1日",
+		"insurer_number": "01130012",
+	}
+	for key, value := range expected {
+		if data[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, data[key])
+		}
+	}
+}
+
+// TestHealthInsuranceVariant tests that rectified cards are told apart from paper
+func TestHealthInsuranceVariant(t *testing.T) {
+	tests := []struct {
+		width, height int
+		expected      string
+	}{
+		{1012, 638, HealthInsuranceVariantCard},
+		{800, 1100, HealthInsuranceVariantPaper},
+		{1200, 800, HealthInsuranceVariantPaper},
+	}
+
+	for _, tt := range tests {
+		mat, err := imageprocessor.EncodeMat(image.NewGray(image.Rect(0, 0, tt.width, tt.height)))
+		if err != nil {
+			t.Fatalf("Failed to encode test image: %v", err)
+		}
+		variant, err := healthInsuranceVariant(mat)
+		if err != nil || variant != tt.expected {
+			t.Errorf("%dx%d: expected %s, got %s (%v)", tt.width, tt.height, tt.expected, variant, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ocrDigitConfusions lists digits that OCR commonly misreads as one another
+var ocrDigitConfusions = map[byte]string{
+	'0': "869",
+	'1': "74",
+	'2': "7",
+	'3': "8",
+	'4': "1",
+	'5': "6",
+	'6': "850",
+	'7': "12",
+	'8': "3690",
+	'9': "80",
+}
+
+// individualNumberCheckDigit computes the check digit of an Individual Number
+// (個人番号) from its first 11 digits, as defined by the ordinance of the
+// Ministry of Internal Affairs and Communications:
+//
+//	Pn: n-th digit counted from the right, excluding the check digit
+//	Qn: n+1 for 1 <= n <= 6, n-5 for 7 <= n <= 11
+//	check digit = 0 if Σ(Pn×Qn) mod 11 <= 1, else 11 - Σ(Pn×Qn) mod 11
+func individualNumberCheckDigit(digits string) int {
+	sum := 0
+	for n := 1; n <= 11; n++ {
+		p := int(digits[11-n] - '0')
+		q := n + 1
+		if n >= 7 {
+			q = n - 5
+		}
+		sum += p * q
+	}
+
+	remainder := sum % 11
+	if remainder <= 1 {
+		return 0
+	}
+	return 11 - remainder
+}
+
+// validateIndividualNumber checks the length, characters and check digit of
+// an Individual Number. Spaces and hyphens are ignored.
+func validateIndividualNumber(number string) error {
+	digits := stripNumberSeparators(number)
+
+	if len(digits) != 12 {
+		return fmt.Errorf("expected 12 digits, got %d", len(digits))
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("contains non-digit character %q", r)
+		}
+	}
+
+	expected := individualNumberCheckDigit(digits)
+	if actual := int(digits[11] - '0'); actual != expected {
+		return fmt.Errorf("check digit mismatch: expected %d, got %d", expected, actual)
+	}
+
+	return nil
+}
+
+// correctIndividualNumber tries to repair an Individual Number whose check
+// digit does not match by substituting a single commonly confused digit.
+// The correction is only returned when exactly one substitution yields a
+// valid number, so that ambiguous reads are never silently changed.
+func correctIndividualNumber(number string) (string, bool) {
+	digits := stripNumberSeparators(number)
+	if len(digits) != 12 {
+		return "", false
+	}
+
+	var candidates []string
+	for i := 0; i < len(digits); i++ {
+		for _, alternative := range []byte(ocrDigitConfusions[digits[i]]) {
+			candidate := digits[:i] + string(alternative) + digits[i+1:]
+			if validateIndividualNumber(candidate) == nil {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	if len(candidates) != 1 {
+		return "", false
+	}
+	return candidates[0], true
+}
+
+// validateIndividualNumberField validates the Individual Number field in place.
+// When a single-digit OCR correction produces a valid number, the corrected
+// value replaces the original and the field is marked as corrected.
+func validateIndividualNumberField(field *Field) {
+	if field == nil {
+		return
+	}
+
+	err := validateIndividualNumber(field.Value)
+	if err == nil {
+		field.setValid()
+		return
+	}
+
+	if corrected, ok := correctIndividualNumber(field.Value); ok {
+		field.Original = field.Value
+		field.Value = formatIndividualNumber(corrected)
+		field.Corrected = true
+		field.setValid()
+		return
+	}
+
+	field.setInvalid("invalid individual number: " + err.Error())
+}
+
+// formatIndividualNumber formats 12 digits as XXXX-XXXX-XXXX
+func formatIndividualNumber(digits string) string {
+	if len(digits) != 12 {
+		return digits
+	}
+	return digits[:4] + "-" + digits[4:8] + "-" + digits[8:12]
+}
+
+// stripNumberSeparators removes spaces and hyphens from a number
+func stripNumberSeparators(number string) string {
+	number = strings.ReplaceAll(number, " ", "")
+	return strings.ReplaceAll(number, "-", "")
+}
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"ocr-web-api/imageprocessor"
 	"ocr-web-api/ocr"
 	"regexp"
@@ -11,104 +14,94 @@ import (
 // IndividualNumberCardParser handles parsing of Japanese Individual Number Card documents
 type IndividualNumberCardParser struct {
 	patterns map[string]*regexp.Regexp
+	engine   ocr.Engine
 }
 
-// NewIndividualNumberCardParser creates a new Individual Number Card parser instance
-func NewIndividualNumberCardParser() *IndividualNumberCardParser {
+// NewIndividualNumberCardParser creates a new Individual Number Card parser instance that recognizes text with engine
+func NewIndividualNumberCardParser(engine ocr.Engine) *IndividualNumberCardParser {
 	return &IndividualNumberCardParser{
+		engine:   engine,
 		patterns: initIndividualNumberCardPatterns(),
 	}
 }
 
-// Parse extracts structured data from an Individual Number Card image
-func (p *IndividualNumberCardParser) Parse(mat imageprocessor.Mat) (map[string]string, error) {
-	// Step 1: Try region-based extraction with OpenCV for better accuracy
-	extractedData, err := p.parseWithRegionDetection(mat)
-	if err == nil && len(extractedData) > 0 {
-		// Step 1.5: Validate the extracted data from region detection
-		if validationErr := p.validateExtractedData(extractedData); validationErr == nil {
-			return extractedData, nil
-		} else {
-			fmt.Printf("Region-based extraction validation failed, falling back to full OCR: %v\n", validationErr)
-		}
+// DetectionSignals returns the signals that identify an Individual Number Card
+func (p *IndividualNumberCardParser) DetectionSignals() DetectionSignals {
+	return DetectionSignals{
+		Keywords: []string{"個人番号カード", "個人番号", "性別", "電子証明書", "臓器提供", "マイナンバー"},
+		Layout:   individualNumberCardFrontLayout,
+	}
+}
+
+// Parse extracts structured data from an Individual Number Card image.
+// The image is expected to be the rectified card produced by the preprocessing pipeline.
+func (p *IndividualNumberCardParser) Parse(ctx context.Context, mat imageprocessor.Mat) (*Result, error) {
+	// Step 1: Read every field from its zone of the card layout. The Individual
+	// Number is printed on the back and is not part of the front layout, so the
+	// full-page pass below always runs to look for it.
+	extractedData, regions, err := p.parseWithTemplate(ctx, mat)
+	zonesValid := err == nil && p.validateExtractedData(extractedData) == nil
+	if err != nil {
+		slog.InfoContext(ctx, "Layout-based extraction failed, falling back to full OCR", "document_type", DocumentTypeIndividualNumberCard, "error", err)
+	}
+
+	// Do not fall back to a second OCR run once the request has been cancelled,
+	// or when the OCR pool has no room for it
+	if errors.Is(err, ocr.ErrPoolSaturated) {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	// Step 2: Fallback to traditional OCR text extraction
-	ocrText, err := p.extractTextUsingOCR(mat)
+	ocrText, pageRegions, err := p.extractTextUsingOCR(ctx, mat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract text via OCR: %w", err)
 	}
 
 	// Step 3: Parse the text using regex patterns
-	extractedData, err = p.parseTextWithRegex(ocrText)
+	fallbackData, err := p.parseTextWithRegex(ocrText)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse text with regex: %w", err)
 	}
 
+	// Zone values are kept when they are usable; the full-page pass only fills the gaps
+	if zonesValid {
+		mergeMissingFields(extractedData, fallbackData)
+		regions = mergeRegions(regions, pageRegions)
+	} else {
+		extractedData = fallbackData
+		regions = pageRegions
+	}
+
 	// Step 4: Validate the extracted data
 	if err := p.validateExtractedData(extractedData); err != nil {
 		return nil, fmt.Errorf("validation failed for individual number card data: %w", err)
 	}
 
-	return extractedData, nil
+	return p.buildResult(extractedData, regions), nil
 }
 
-// parseWithRegionDetection uses OpenCV region detection for more accurate field extraction
-func (p *IndividualNumberCardParser) parseWithRegionDetection(mat imageprocessor.Mat) (map[string]string, error) {
-	// Convert Mat to image data
-	imageData, err := mat.ToBytes()
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert Mat to bytes: %w", err)
-	}
-
-	// Create OCR engine
-	engine := ocr.NewOCREngine()
-	defer engine.Close()
+// buildResult assembles the typed result and scores each field against the OCR regions
+func (p *IndividualNumberCardParser) buildResult(data map[string]string, regions []ocr.RegionInfo) *Result {
+	doc := newIndividualNumberCardResult(data)
+	applyFieldConfidence(doc, regions)
+	normalizeDateFields(doc)
+	validateIndividualNumberField(doc.IndividualNumber)
+	return NewResult(DocumentTypeIndividualNumberCard, doc)
+}
 
-	// Extract text regions with positional information
-	regions, err := engine.ExtractRegions(imageData)
+// parseWithTemplate recognizes each field in its own zone of the card layout.
+// The recognized words are returned as well so field confidence can be scored against them.
+func (p *IndividualNumberCardParser) parseWithTemplate(ctx context.Context, mat imageprocessor.Mat) (map[string]string, []ocr.RegionInfo, error) {
+	extractedData, regions, err := individualNumberCardFrontLayout.Extract(ctx, p.engine, mat)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract regions: %w", err)
+		return nil, nil, err
 	}
 
-	extractedData := make(map[string]string)
-
-	// Process regions based on category and content
-	for _, region := range regions {
-		switch region.Category {
-		case "name":
-			if isValidName(region.Text) {
-				extractedData["name"] = region.Text
-			}
-		case "address":
-			if isValidAddress(region.Text) {
-				extractedData["address"] = region.Text
-			}
-		case "date":
-			if isValidDate(region.Text) {
-				if strings.Contains(region.Text, "生") {
-					extractedData["birth_date"] = region.Text
-				} else {
-					extractedData["expiry_date"] = region.Text
-				}
-			}
-		case "number":
-			if isValidIndividualNumber(region.Text) {
-				extractedData["individual_number"] = region.Text
-			}
-		}
-	}
-
-	// Also try to extract municipality and name using enhanced patterns
-	if municipality := extractMunicipalityFromRegions(regions); municipality != "" {
-		extractedData["municipality"] = municipality
-	}
-
-	if name := extractNameFromRegions(regions); name != "" {
-		extractedData["name"] = name
-	}
-
-	return extractedData, nil
+	p.postProcessExtractedData(extractedData)
+	return extractedData, regions, nil
 }
 
 // parseTextWithRegex extracts structured data from OCR text using regex patterns
@@ -166,12 +159,9 @@ func (p *IndividualNumberCardParser) postProcessExtractedData(data map[string]st
 	// Normalize individual number format
 	if individualNumber, exists := data["individual_number"]; exists {
 		// Ensure proper format XXXX-XXXX-XXXX
-		cleaned := strings.ReplaceAll(individualNumber, " ", "")
-		cleaned = strings.ReplaceAll(cleaned, "-", "")
+		cleaned := stripNumberSeparators(individualNumber)
 		if len(cleaned) == 12 {
-			// Format as XXXX-XXXX-XXXX
-			formatted := cleaned[:4] + "-" + cleaned[4:8] + "-" + cleaned[8:12]
-			data["individual_number"] = formatted
+			data["individual_number"] = formatIndividualNumber(cleaned)
 		}
 	}
 
@@ -185,6 +175,11 @@ func (p *IndividualNumberCardParser) postProcessExtractedData(data map[string]st
 			cleaned = strings.ReplaceAll(cleaned, "  ", " ")
 		}
 		data["address"] = strings.TrimSpace(cleaned)
+
+		// The municipality is the leading part of the address
+		if municipality := municipalityFromAddress(data["address"]); municipality != "" {
+			data["municipality"] = municipality
+		}
 	}
 
 	// Normalize name field
@@ -246,26 +241,18 @@ func initIndividualNumberCardPatterns() map[string]*regexp.Regexp {
 	patterns["name_alt"] = regexp.MustCompile(`([ァ-ヴー一-龯ひ-ゖ]+\s+[ァ-ヴー一-龯ひ-ゖ]+)`)
 
 	// Date patterns with specific Japanese date formats
-	patterns["birth_date_alt"] = regexp.MustCompile(`([平成|昭和|令和]\d{1,2}年\d{1,2}月\d{1,2}日|\d{4}年\d{1,2}月\d{1,2}日)`)
+	patterns["birth_date_alt"] = regexp.MustCompile(`((?:明治|大正|昭和|平成|令和)\s*(?:\d{1,2}|元)年\d{1,2}月\d{1,2}日|\d{4}年\d{1,2}月\d{1,2}日)`)
 
 	// Individual number with specific format (XXXX-XXXX-XXXX)
 	patterns["individual_number_alt"] = regexp.MustCompile(`(\d{4}-\d{4}-\d{4})`)
 
-	// Municipality pattern (市区町村)
-	patterns["municipality"] = regexp.MustCompile(`([^都道府県]+[都道府県][^市区町村]+[市区町村])`)
-
 	return patterns
 }
 
 // validateExtractedData validates the extracted data for required fields
 func (p *IndividualNumberCardParser) validateExtractedData(data map[string]string) error {
-	requiredFields := []string{"name"}
-	fmt.Println("sss")
-	for _, field := range requiredFields {
-		value, exists := data[field]
-		if !exists || strings.TrimSpace(value) == "" {
-			return fmt.Errorf("required field '%s' is missing or empty", field)
-		}
+	if err := checkRequiredFields(data, "name"); err != nil {
+		return err
 	}
 
 	// Additional validation for specific fields
@@ -274,14 +261,14 @@ func (p *IndividualNumberCardParser) validateExtractedData(data map[string]strin
 		cleanNumber := strings.ReplaceAll(individualNumber, " ", "")
 		cleanNumber = strings.ReplaceAll(cleanNumber, "-", "")
 		if len(cleanNumber) != 12 {
-			return fmt.Errorf("invalid individual number format: expected 12 digits, got %d", len(cleanNumber))
+			return invalidFieldError("individual_number", fmt.Sprintf("expected 12 digits, got %d", len(cleanNumber)))
 		}
 	}
 
 	// Gender validation
 	if gender, exists := data["gender"]; exists {
 		if gender != "男" && gender != "女" {
-			return fmt.Errorf("invalid gender value: expected '男' or '女', got '%s'", gender)
+			return invalidFieldError("gender", "expected '男' or '女'")
 		}
 	}
 
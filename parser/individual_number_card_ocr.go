@@ -1,27 +1,13 @@
 package parser
 
 import (
-	"fmt"
+	"context"
 	"ocr-web-api/imageprocessor"
 	"ocr-web-api/ocr"
 )
 
-// extractTextUsingOCR performs OCR text extraction from the image
-func (p *IndividualNumberCardParser) extractTextUsingOCR(mat imageprocessor.Mat) (string, error) {
-
-	if len(mat) == 0 {
-		return "", fmt.Errorf("cannot process empty image")
-	}
-
-	// Initialize the OCR engine
-	engine := ocr.NewOCREngine()
-	defer engine.Close()
-
-	// Extract text using the engine
-	text, err := engine.ExtractText([]byte(mat))
-	if err != nil {
-		return "", fmt.Errorf("OCR engine failed to extract text: %w", err)
-	}
-
-	return text, nil
+// extractTextUsingOCR performs OCR text extraction from the image. The
+// recognized words are returned as well so the fallback fields can be scored.
+func (p *IndividualNumberCardParser) extractTextUsingOCR(ctx context.Context, mat imageprocessor.Mat) (string, []ocr.RegionInfo, error) {
+	return recognizePage(ctx, p.engine, mat)
 }
@@ -0,0 +1,76 @@
+package parser
+
+import "testing"
+
+// TestValidateIndividualNumber tests the Individual Number check digit verification
+func TestValidateIndividualNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+		valid  bool
+	}{
+		{name: "valid number", number: "123456789018", valid: true},
+		{name: "valid formatted number", number: "9876-5432-1093", valid: true},
+		{name: "valid number with remainder zero or one", number: "111111111118", valid: true},
+		{name: "wrong check digit", number: "123456789012", valid: false},
+		{name: "too short", number: "12345678901", valid: false},
+		{name: "non-digit", number: "12345678901A", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateIndividualNumber(tt.number)
+			if tt.valid && err != nil {
+				t.Errorf("Expected %s to be valid, got error: %v", tt.number, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected %s to be invalid", tt.number)
+			}
+		})
+	}
+}
+
+// TestValidateIndividualNumberField tests validity flags and OCR-confusion correction
+func TestValidateIndividualNumberField(t *testing.T) {
+	t.Run("valid number", func(t *testing.T) {
+		field := &Field{Value: "1234-5678-9018", Type: FieldTypeNumber}
+		validateIndividualNumberField(field)
+
+		if field.Valid == nil || !*field.Valid || field.Corrected {
+			t.Errorf("Expected valid uncorrected field, got %+v", field)
+		}
+	})
+
+	t.Run("8 misread as 6", func(t *testing.T) {
+		field := &Field{Value: "1234-5676-9018", Type: FieldTypeNumber}
+		validateIndividualNumberField(field)
+
+		if !field.Corrected || field.Value != "1234-5678-9018" || field.Original != "1234-5676-9018" {
+			t.Errorf("Expected correction to 1234-5678-9018, got %+v", field)
+		}
+		if field.Valid == nil || !*field.Valid {
+			t.Errorf("Expected corrected field to be valid")
+		}
+	})
+
+	t.Run("1 misread as 7", func(t *testing.T) {
+		field := &Field{Value: "1234-5678-9078", Type: FieldTypeNumber}
+		validateIndividualNumberField(field)
+
+		if !field.Corrected || field.Value != "1234-5678-9018" {
+			t.Errorf("Expected correction to 1234-5678-9018, got %+v", field)
+		}
+	})
+
+	t.Run("ambiguous correction", func(t *testing.T) {
+		field := &Field{Value: "1234-5678-9014", Type: FieldTypeNumber}
+		validateIndividualNumberField(field)
+
+		if field.Valid == nil || *field.Valid || field.Error == "" {
+			t.Errorf("Expected invalid field with error reason, got %+v", field)
+		}
+		if field.Corrected || field.Value != "1234-5678-9014" {
+			t.Errorf("Expected value to be left unchanged, got %+v", field)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package parser
+
+import "fmt"
+
+// insurerNumberCheckDigit computes the check digit (検証番号) of an insurer
+// number (保険者番号) from its leading digits, as defined for health
+// insurance claims:
+//
+//	multiply the digits by 2, 1, 2, 1, ... counted from the right,
+//	add up the digits of the products,
+//	check digit = 10 - sum mod 10, or 0 when sum mod 10 is 0
+func insurerNumberCheckDigit(digits string) int {
+	sum := 0
+	for n := 0; n < len(digits); n++ {
+		product := int(digits[len(digits)-1-n] - '0')
+		if n%2 == 0 {
+			product *= 2
+		}
+		sum += product/10 + product%10
+	}
+	return (10 - sum%10) % 10
+}
+
+// validateInsurerNumber checks the length, characters and check digit of an
+// insurer number. Employee insurance numbers have 8 digits; the municipal
+// National Health Insurance numbers have 6. Spaces and hyphens are ignored.
+func validateInsurerNumber(number string) error {
+	digits := stripNumberSeparators(number)
+
+	if len(digits) != 6 && len(digits) != 8 {
+		return fmt.Errorf("expected 6 or 8 digits, got %d", len(digits))
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("contains non-digit character %q", r)
+		}
+	}
+
+	last := len(digits) - 1
+	expected := insurerNumberCheckDigit(digits[:last])
+	if actual := int(digits[last] - '0'); actual != expected {
+		return fmt.Errorf("check digit mismatch: expected %d, got %d", expected, actual)
+	}
+
+	return nil
+}
+
+// correctInsurerNumber tries to repair an insurer number whose check digit
+// does not match by substituting a single commonly confused digit. The
+// correction is only returned when exactly one substitution yields a valid
+// number.
+func correctInsurerNumber(number string) (string, bool) {
+	digits := stripNumberSeparators(number)
+	if len(digits) != 6 && len(digits) != 8 {
+		return "", false
+	}
+
+	var candidates []string
+	for i := 0; i < len(digits); i++ {
+		for _, alternative := range []byte(ocrDigitConfusions[digits[i]]) {
+			candidate := digits[:i] + string(alternative) + digits[i+1:]
+			if validateInsurerNumber(candidate) == nil {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	if len(candidates) != 1 {
+		return "", false
+	}
+	return candidates[0], true
+}
+
+// validateInsurerNumberField validates the insurer number field in place,
+// applying a single-digit OCR correction when it is unambiguous
+func validateInsurerNumberField(field *Field) {
+	if field == nil {
+		return
+	}
+
+	err := validateInsurerNumber(field.Value)
+	if err == nil {
+		field.Value = stripNumberSeparators(field.Value)
+		field.setValid()
+		return
+	}
+
+	if corrected, ok := correctInsurerNumber(field.Value); ok {
+		field.Original = field.Value
+		field.Value = corrected
+		field.Corrected = true
+		field.setValid()
+		return
+	}
+
+	field.setInvalid("invalid insurer number: " + err.Error())
+}
@@ -0,0 +1,241 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/logging"
+	"ocr-web-api/ocr"
+	"regexp"
+	"strings"
+)
+
+// Zone is the area of a document field. Coordinates are fractions of the
+// width and height of the card after perspective correction, so a template
+// applies to any output resolution.
+type Zone struct {
+	Field   string              // Key the recognized text is stored under
+	X, Y    float64             // Top-left corner
+	W, H    float64             // Size
+	Options ocr.Options         // Recognition options for the zone
+	Clean   func(string) string // Optional cleanup of the recognized text
+
+	// Multiline keeps the recognized lines separated by newlines instead of spaces
+	Multiline bool
+
+	// Optional zones may be blank on a valid document and do not trigger the full-page fallback
+	Optional bool
+}
+
+// LayoutTemplate describes the fixed layout of one side of a document
+type LayoutTemplate struct {
+	Name  string
+	Zones []Zone
+}
+
+// Extract recognizes every zone of the template separately and returns the
+// text per field. The returned word regions are in the coordinates of the
+// whole image, with block numbers made unique across zones.
+func (t *LayoutTemplate) Extract(ctx context.Context, engine ocr.Engine, mat imageprocessor.Mat) (map[string]string, []ocr.RegionInfo, error) {
+	img, err := imageprocessor.DecodeMat(mat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image for layout %s: %w", t.Name, err)
+	}
+	bounds := img.Bounds()
+
+	data := make(map[string]string)
+	var regions []ocr.RegionInfo
+	blockOffset := 0
+
+	for _, zone := range t.Zones {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		zoneMat, err := imageprocessor.EncodeMat(imageprocessor.CropNormalized(img, zone.X, zone.Y, zone.W, zone.H))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		words, err := engine.ExtractRegionsWithOptions(ctx, zoneMat, zone.Options)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			return nil, nil, fmt.Errorf("failed to recognize zone %s: %w", zone.Field, err)
+		}
+
+		// Move the words into image coordinates
+		offsetX := int(math.Round(zone.X * float64(bounds.Dx())))
+		offsetY := int(math.Round(zone.Y * float64(bounds.Dy())))
+		maxBlock := 0
+		for i := range words {
+			words[i].X += offsetX
+			words[i].Y += offsetY
+			maxBlock = max(maxBlock, words[i].Block)
+			words[i].Block += blockOffset
+		}
+		blockOffset += maxBlock + 1
+		regions = append(regions, words...)
+
+		lines := ocr.GroupLines(words)
+		texts := make([]string, 0, len(lines))
+		for _, line := range lines {
+			texts = append(texts, line.Text)
+		}
+		separator := " "
+		if zone.Multiline {
+			separator = "\n"
+		}
+		text := strings.TrimSpace(strings.Join(texts, separator))
+		if zone.Clean != nil {
+			text = zone.Clean(text)
+		}
+		slog.DebugContext(ctx, "Zone recognized", "layout", t.Name, "field", zone.Field, "words", len(words), logging.PII("text", text))
+		if text != "" {
+			data[zone.Field] = text
+		}
+	}
+
+	return data, regions, nil
+}
+
+// Complete reports whether data has a value for every required zone of the template
+func (t *LayoutTemplate) Complete(data map[string]string) bool {
+	for _, zone := range t.Zones {
+		if !zone.Optional && strings.TrimSpace(data[zone.Field]) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeMissingFields copies the fields of fallback that are missing from data
+func mergeMissingFields(data, fallback map[string]string) {
+	for key, value := range fallback {
+		if strings.TrimSpace(data[key]) == "" {
+			data[key] = value
+		}
+	}
+}
+
+// recognizePage runs the full-page OCR pass of the fallback. The text is
+// returned one recognized line per row, along with the words it was built
+// from so the fields parsed out of it can be scored as well.
+func recognizePage(ctx context.Context, engine ocr.Engine, mat imageprocessor.Mat) (string, []ocr.RegionInfo, error) {
+	if len(mat) == 0 {
+		return "", nil, fmt.Errorf("cannot process empty image")
+	}
+
+	words, err := engine.ExtractRegions(ctx, []byte(mat))
+	if err != nil {
+		return "", nil, fmt.Errorf("OCR engine failed to extract text: %w", err)
+	}
+
+	lines := ocr.GroupLines(words)
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	text := strings.TrimSpace(strings.Join(texts, "\n"))
+	if text == "" {
+		return "", nil, ocr.ErrNoText
+	}
+	return text, words, nil
+}
+
+// mergeRegions appends the words of the full-page pass to the words of the
+// zones. Their block numbers are moved past those of the zones so that lines
+// of the two passes are not grouped together.
+func mergeRegions(zones, page []ocr.RegionInfo) []ocr.RegionInfo {
+	blockOffset := 0
+	for _, word := range zones {
+		blockOffset = max(blockOffset, word.Block+1)
+	}
+
+	merged := make([]ocr.RegionInfo, 0, len(zones)+len(page))
+	merged = append(merged, zones...)
+	for _, word := range page {
+		word.Block += blockOffset
+		merged = append(merged, word)
+	}
+	return merged
+}
+
+// Zone recognition options. Names and addresses use the full character set,
+// since the default whitelist does not cover the kanji they are written in.
+var (
+	zoneTextLine  = ocr.Options{Language: "jpn", PSM: ocr.PSMSingleLine}
+	zoneTextBlock = ocr.Options{Language: "jpn", PSM: ocr.PSMSingleBlock}
+	zoneDateLine  = ocr.Options{Language: "jpn", PSM: ocr.PSMSingleLine, Whitelist: ocr.WhitelistDigits + "明治大正昭和平成令和元年月日生まで有効"}
+	zoneDigits    = ocr.Options{Language: "eng", PSM: ocr.PSMSingleLine, Whitelist: ocr.WhitelistDigits}
+	zoneGender    = ocr.Options{Language: "jpn", PSM: ocr.PSMSingleLine, Whitelist: "男女"}
+)
+
+// jpDriverLicenseFrontLayout is the front of a Japanese driver's license.
+// Zones start right of the printed labels (氏名, 住所, 交付, 第…号).
+var jpDriverLicenseFrontLayout = &LayoutTemplate{
+	Name: DocumentTypeDriversLicenseJP + "/front",
+	Zones: []Zone{
+		{Field: "name", X: 0.11, Y: 0.035, W: 0.49, H: 0.085, Options: zoneTextLine, Clean: cleanName},
+		{Field: "birth_date", X: 0.60, Y: 0.035, W: 0.38, H: 0.085, Options: zoneDateLine, Clean: cleanDate},
+		{Field: "address", X: 0.11, Y: 0.125, W: 0.86, H: 0.085, Options: zoneTextLine, Clean: cleanAddress},
+		{Field: "issue_date", X: 0.11, Y: 0.215, W: 0.36, H: 0.075, Options: zoneDateLine, Clean: cleanDate},
+		{Field: "expiry_date", X: 0.03, Y: 0.295, W: 0.62, H: 0.10, Options: zoneDateLine, Clean: cleanDate},
+		{Field: "license_number", X: 0.14, Y: 0.555, W: 0.44, H: 0.085, Options: zoneDigits, Clean: cleanDigits},
+		{Field: "license_class", X: 0.03, Y: 0.66, W: 0.62, H: 0.27, Options: zoneTextBlock, Clean: collapseSpaces},
+	},
+}
+
+// individualNumberCardFrontLayout is the front of an Individual Number Card.
+// The Individual Number itself is printed on the back.
+var individualNumberCardFrontLayout = &LayoutTemplate{
+	Name: DocumentTypeIndividualNumberCard + "/front",
+	Zones: []Zone{
+		{Field: "name", X: 0.10, Y: 0.04, W: 0.55, H: 0.11, Options: zoneTextLine, Clean: cleanName},
+		{Field: "address", X: 0.10, Y: 0.16, W: 0.57, H: 0.22, Options: zoneTextBlock, Clean: cleanAddress},
+		{Field: "birth_date", X: 0.03, Y: 0.60, W: 0.42, H: 0.08, Options: zoneDateLine, Clean: cleanDate},
+		{Field: "gender", X: 0.56, Y: 0.60, W: 0.09, H: 0.08, Options: zoneGender},
+		{Field: "expiry_date", X: 0.03, Y: 0.70, W: 0.45, H: 0.12, Options: zoneDateLine, Clean: cleanDate},
+	},
+}
+
+// zoneDatePattern finds a date inside zone text such as 昭和60年 3月10日生
+var zoneDatePattern = regexp.MustCompile(`(?:明治|大正|昭和|平成|令和)\s*(?:\d{1,2}|元)\s*年\s*\d{1,2}\s*月\s*\d{1,2}\s*日|\d{4}\s*年\s*\d{1,2}\s*月\s*\d{1,2}\s*日`)
+
+// cleanDate keeps the date of a zone, dropping suffixes such as 生 or まで有効
+func cleanDate(text string) string {
+	if match := zoneDatePattern.FindString(text); match != "" {
+		return strings.Join(strings.Fields(match), "")
+	}
+	return strings.TrimSpace(text)
+}
+
+// cleanName drops a 氏名 label that bled into the zone
+func cleanName(text string) string {
+	text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "氏名"))
+	return collapseSpaces(text)
+}
+
+// cleanAddress drops a 住所 label and the spaces OCR inserts between words
+func cleanAddress(text string) string {
+	text = strings.TrimPrefix(strings.TrimSpace(text), "住所")
+	return strings.Join(strings.Fields(text), "")
+}
+
+// cleanDigits keeps only the digits of a number zone
+func cleanDigits(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, text)
+}
+
+// collapseSpaces trims text and collapses runs of whitespace to a single space
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"image"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+	"testing"
+)
+
+// zoneEngine is an OCR engine returning one canned recognition result per call
+type zoneEngine struct {
+	results [][]ocr.RegionInfo
+	options []ocr.Options
+	sizes   []image.Point
+}
+
+func (e *zoneEngine) ExtractText(ctx context.Context, imageData []byte) (string, error) {
+	return "", nil
+}
+
+func (e *zoneEngine) ExtractRegions(ctx context.Context, imageData []byte) ([]ocr.RegionInfo, error) {
+	return e.ExtractRegionsWithOptions(ctx, imageData, ocr.DefaultOptions())
+}
+
+func (e *zoneEngine) ExtractTextWithOptions(ctx context.Context, imageData []byte, opts ocr.Options) (string, error) {
+	return "", nil
+}
+
+func (e *zoneEngine) ExtractRegionsWithOptions(ctx context.Context, imageData []byte, opts ocr.Options) ([]ocr.RegionInfo, error) {
+	img, err := imageprocessor.DecodeMat(imageData)
+	if err != nil {
+		return nil, err
+	}
+	e.sizes = append(e.sizes, img.Bounds().Size())
+	e.options = append(e.options, opts)
+
+	result := e.results[0]
+	e.results = e.results[1:]
+	return result, nil
+}
+
+func (e *zoneEngine) Close() error { return nil }
+
+// TestLayoutTemplateExtract tests that every zone is recognized on its own
+// with its own options and mapped back to card coordinates
+func TestLayoutTemplateExtract(t *testing.T) {
+	template := &LayoutTemplate{
+		Name: "test",
+		Zones: []Zone{
+			{Field: "name", X: 0.1, Y: 0.1, W: 0.5, H: 0.1, Options: zoneTextLine, Clean: cleanName},
+			{Field: "birth_date", X: 0.6, Y: 0.1, W: 0.4, H: 0.1, Options: zoneDateLine, Clean: cleanDate},
+			{Field: "license_number", X: 0.1, Y: 0.5, W: 0.5, H: 0.1, Options: zoneDigits, Clean: cleanDigits},
+		},
+	}
+	engine := &zoneEngine{results: [][]ocr.RegionInfo{
+		{
+			{Text: "佐藤", Confidence: 0.9, Block: 1, Paragraph: 1, Line: 1, X: 5, Y: 2},
+			{Text: "花子", Confidence: 0.8, Block: 1, Paragraph: 1, Line: 1, X: 60, Y: 2},
+		},
+		{{Text: "昭和60年3月10日生", Confidence: 0.7, Block: 1, Paragraph: 1, Line: 1, X: 0, Y: 0}},
+		{},
+	}}
+
+	mat, err := imageprocessor.EncodeMat(image.NewGray(image.Rect(0, 0, 1000, 600)))
+	if err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	data, regions, err := template.Extract(context.Background(), engine, mat)
+	if err != nil {
+		t.Fatalf("Expected zones to be extracted, got error: %v", err)
+	}
+
+	if data["name"] != "佐藤 花子" {
+		t.Errorf("Unexpected name: %q", data["name"])
+	}
+	if data["birth_date"] != "昭和60年3月10日" {
+		t.Errorf("Expected birth date without suffix, got %q", data["birth_date"])
+	}
+	if _, exists := data["license_number"]; exists {
+		t.Errorf("Expected empty zone to be left out, got %q", data["license_number"])
+	}
+	if template.Complete(data) {
+		t.Errorf("Expected template with an empty zone to be incomplete")
+	}
+
+	if engine.sizes[0] != image.Pt(500, 60) || engine.sizes[1] != image.Pt(400, 60) {
+		t.Errorf("Unexpected zone crop sizes: %v", engine.sizes)
+	}
+	if engine.options[2].Whitelist != ocr.WhitelistDigits {
+		t.Errorf("Expected number zone to use the digit whitelist, got %+v", engine.options[2])
+	}
+
+	// Words are moved into card coordinates and zones never share a line
+	if regions[0].X != 105 || regions[0].Y != 62 {
+		t.Errorf("Expected first word at (105, 62), got (%d, %d)", regions[0].X, regions[0].Y)
+	}
+	if lines := ocr.GroupLines(regions); len(lines) != 2 {
+		t.Errorf("Expected 2 separate lines, got %d", len(lines))
+	}
+}
+
+// TestFallbackConfidence tests that fields filled by the full-page pass are
+// scored against its own words, while zone fields keep their zone scores
+func TestFallbackConfidence(t *testing.T) {
+	zones := []ocr.RegionInfo{{Text: "佐藤花子", Confidence: 0.9, Block: 0, Paragraph: 1, Line: 1}}
+	engine := &zoneEngine{results: [][]ocr.RegionInfo{{
+		{Text: "氏名", Confidence: 0.5, Block: 0, Paragraph: 1, Line: 1, X: 0},
+		{Text: "佐藤花子", Confidence: 0.4, Block: 0, Paragraph: 1, Line: 1, X: 50},
+		{Text: "東京都千代田区", Confidence: 0.8, Block: 0, Paragraph: 1, Line: 2, Y: 40},
+	}}}
+
+	mat, err := imageprocessor.EncodeMat(image.NewGray(image.Rect(0, 0, 100, 60)))
+	if err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	text, page, err := recognizePage(context.Background(), engine, mat)
+	if err != nil {
+		t.Fatalf("Expected page to be recognized, got error: %v", err)
+	}
+	if text != "氏名 佐藤花子\n東京都千代田区" {
+		t.Errorf("Unexpected page text: %q", text)
+	}
+
+	doc := newResidenceCardResult(map[string]string{"name": "佐藤花子", "address": "東京都千代田区"})
+	applyFieldConfidence(doc, mergeRegions(zones, page))
+	if doc.Name.Confidence != 0.9 {
+		t.Errorf("Expected zone confidence for name, got %v", doc.Name.Confidence)
+	}
+	if doc.Address.Confidence != 0.8 {
+		t.Errorf("Expected full-page confidence for address, got %v", doc.Address.Confidence)
+	}
+
+	engine.results = [][]ocr.RegionInfo{{}}
+	if _, _, err := recognizePage(context.Background(), engine, mat); !errors.Is(err, ocr.ErrNoText) {
+		t.Errorf("Expected ErrNoText for a blank page, got %v", err)
+	}
+}
+
+// TestMunicipalityFromAddress tests that the municipality is taken from the start of the address
+func TestMunicipalityFromAddress(t *testing.T) {
+	tests := map[string]string{
+		"大阪府大阪市中央区大手前1-1-1": "大阪府大阪市",
+		"東京都 千代田区霞が関2-1-2":  "東京都千代田区",
+		"神奈川県横浜市中区日本大通1":    "神奈川県横浜市",
+		"北海道札幌市中央区北1条西2丁目":  "北海道札幌市",
+		"長野県北佐久郡軽井沢町長倉":     "長野県北佐久郡軽井沢町",
+		"個人番号カード":           "",
+	}
+
+	for address, expected := range tests {
+		if got := municipalityFromAddress(address); got != expected {
+			t.Errorf("municipalityFromAddress(%q) = %q, expected %q", address, got, expected)
+		}
+	}
+}
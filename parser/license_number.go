@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// licenseIssuers maps the first two digits of a driver's license number to
+// the prefecture of the issuing public safety commission (公安委員会).
+// Hokkaido is split into five area commissions (方面公安委員会).
+var licenseIssuers = map[string]string{
+	"10": "北海道", "11": "北海道", "12": "北海道", "13": "北海道", "14": "北海道",
+	"20": "青森県", "21": "岩手県", "22": "宮城県", "23": "秋田県", "24": "山形県", "25": "福島県",
+	"30": "東京都",
+	"40": "茨城県", "41": "栃木県", "42": "群馬県", "43": "埼玉県", "44": "千葉県",
+	"45": "神奈川県", "46": "新潟県", "47": "山梨県", "48": "長野県", "49": "静岡県",
+	"50": "富山県", "51": "石川県", "52": "福井県", "53": "岐阜県", "54": "愛知県", "55": "三重県",
+	"60": "滋賀県", "61": "京都府", "62": "大阪府", "63": "兵庫県", "64": "奈良県", "65": "和歌山県",
+	"70": "鳥取県", "71": "島根県", "72": "岡山県", "73": "広島県", "74": "山口県",
+	"80": "徳島県", "81": "香川県", "82": "愛媛県", "83": "高知県",
+	"90": "福岡県", "91": "佐賀県", "92": "長崎県", "93": "熊本県", "94": "大分県",
+	"95": "宮崎県", "96": "鹿児島県", "97": "沖縄県",
+}
+
+// licenseNumberWeights are the modulus 11 weights applied to the first ten digits
+var licenseNumberWeights = [10]int{5, 4, 3, 2, 7, 6, 5, 4, 3, 2}
+
+// licenseNumberInfo holds the values encoded in a driver's license number:
+//
+//	digits 1-2:  issuing public safety commission
+//	digits 3-4:  last two digits of the year of first acquisition
+//	digits 5-10: serial number
+//	digit 11:    check digit
+//	digit 12:    reissue count
+type licenseNumberInfo struct {
+	IssuingPrefecture string
+	FirstLicenseYear  int
+	Serial            string
+	ReissueCount      int
+}
+
+// licenseNumberCheckDigit computes the check digit of a driver's license
+// number from its first ten digits (modulus 11, weights 5-2, 7-2)
+func licenseNumberCheckDigit(digits string) int {
+	sum := 0
+	for i, weight := range licenseNumberWeights {
+		sum += int(digits[i]-'0') * weight
+	}
+
+	remainder := sum % 11
+	if remainder <= 1 {
+		return 0
+	}
+	return 11 - remainder
+}
+
+// decodeLicenseNumber validates the structure of a driver's license number
+// and decodes the values it carries. Spaces and hyphens are ignored. The
+// two-digit year is resolved to the most recent year not after now.
+func decodeLicenseNumber(number string, now time.Time) (*licenseNumberInfo, error) {
+	digits := stripNumberSeparators(number)
+
+	if len(digits) != 12 {
+		return nil, fmt.Errorf("expected 12 digits, got %d", len(digits))
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("contains non-digit character %q", r)
+		}
+	}
+
+	prefecture, exists := licenseIssuers[digits[:2]]
+	if !exists {
+		return nil, fmt.Errorf("unknown issuing public safety commission code %s", digits[:2])
+	}
+
+	expected := licenseNumberCheckDigit(digits)
+	if actual := int(digits[10] - '0'); actual != expected {
+		return nil, fmt.Errorf("check digit mismatch: expected %d, got %d", expected, actual)
+	}
+
+	yearSuffix, _ := strconv.Atoi(digits[2:4])
+	year := 2000 + yearSuffix
+	if year > now.Year() {
+		year -= 100
+	}
+
+	return &licenseNumberInfo{
+		IssuingPrefecture: prefecture,
+		FirstLicenseYear:  year,
+		Serial:            digits[4:10],
+		ReissueCount:      int(digits[11] - '0'),
+	}, nil
+}
+
+// validateLicenseNumber validates the license number field of a driver's
+// license result and fills in the fields decoded from it
+func validateLicenseNumber(doc *DriversLicenseResult, now time.Time) {
+	if doc.LicenseNumber == nil {
+		return
+	}
+
+	info, err := decodeLicenseNumber(doc.LicenseNumber.Value, now)
+	if err != nil {
+		doc.LicenseNumber.setInvalid("invalid license number: " + err.Error())
+		return
+	}
+
+	doc.LicenseNumber.Normalized = stripNumberSeparators(doc.LicenseNumber.Value)
+	doc.LicenseNumber.setValid()
+
+	// Decoded values share the confidence of the number they were read from
+	confidence := doc.LicenseNumber.Confidence
+	doc.IssuingPrefecture = &Field{Value: info.IssuingPrefecture, Type: FieldTypeString, Confidence: confidence}
+	doc.FirstLicenseYear = &Field{Value: strconv.Itoa(info.FirstLicenseYear), Type: FieldTypeNumber, Confidence: confidence}
+	doc.ReissueCount = &Field{Value: strconv.Itoa(info.ReissueCount), Type: FieldTypeNumber, Confidence: confidence}
+}
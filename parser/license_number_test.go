@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDecodeLicenseNumber tests structural validation and decoding of driver's license numbers
+func TestDecodeLicenseNumber(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		number     string
+		valid      bool
+		prefecture string
+		year       int
+		reissue    int
+	}{
+		{name: "tokyo 1998", number: "3098 1234 5680", valid: true, prefecture: "東京都", year: 1998, reissue: 0},
+		{name: "osaka 2005 reissued twice", number: "620500012322", valid: true, prefecture: "大阪府", year: 2005, reissue: 2},
+		{name: "hokkaido area commission", number: "101234567801", valid: true, prefecture: "北海道", year: 2012, reissue: 1},
+		{name: "wrong check digit", number: "309812345670", valid: false},
+		{name: "unknown commission", number: "999812345680", valid: false},
+		{name: "too short", number: "30981234568", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := decodeLicenseNumber(tt.number, now)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("Expected %s to be invalid", tt.number)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected %s to be valid, got error: %v", tt.number, err)
+			}
+
+			if info.IssuingPrefecture != tt.prefecture {
+				t.Errorf("Expected prefecture %s, got %s", tt.prefecture, info.IssuingPrefecture)
+			}
+			if info.FirstLicenseYear != tt.year {
+				t.Errorf("Expected first license year %d, got %d", tt.year, info.FirstLicenseYear)
+			}
+			if info.ReissueCount != tt.reissue {
+				t.Errorf("Expected reissue count %d, got %d", tt.reissue, info.ReissueCount)
+			}
+		})
+	}
+}
+
+// TestValidateLicenseNumber tests that decoded values are exposed as extra fields
+func TestValidateLicenseNumber(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	doc := &DriversLicenseResult{
+		LicenseNumber: &Field{Value: "3098 1234 5680", Type: FieldTypeNumber, Confidence: 0.9},
+	}
+	validateLicenseNumber(doc, now)
+
+	if doc.LicenseNumber.Valid == nil || !*doc.LicenseNumber.Valid {
+		t.Fatalf("Expected license number to be valid, got %+v", doc.LicenseNumber)
+	}
+	if doc.IssuingPrefecture == nil || doc.IssuingPrefecture.Value != "東京都" {
+		t.Errorf("Expected issuing prefecture 東京都, got %+v", doc.IssuingPrefecture)
+	}
+	if doc.FirstLicenseYear == nil || doc.FirstLicenseYear.Value != "1998" {
+		t.Errorf("Expected first license year 1998, got %+v", doc.FirstLicenseYear)
+	}
+	if doc.ReissueCount == nil || doc.ReissueCount.Value != "0" || doc.ReissueCount.Confidence != 0.9 {
+		t.Errorf("Expected reissue count 0 with confidence 0.9, got %+v", doc.ReissueCount)
+	}
+
+	invalid := &DriversLicenseResult{
+		LicenseNumber: &Field{Value: "309812345670", Type: FieldTypeNumber},
+	}
+	validateLicenseNumber(invalid, now)
+
+	if invalid.LicenseNumber.Valid == nil || *invalid.LicenseNumber.Valid || invalid.LicenseNumber.Error == "" {
+		t.Errorf("Expected invalid license number with reason, got %+v", invalid.LicenseNumber)
+	}
+	if invalid.IssuingPrefecture != nil {
+		t.Errorf("Expected no decoded fields for an invalid number")
+	}
+}
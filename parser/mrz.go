@@ -0,0 +1,321 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MRZ (machine readable zone) constants of ICAO Doc 9303
+const (
+	// mrzCharset lists the characters that may appear in a machine readable zone
+	mrzCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789<"
+
+	// td3LineLength is the length of each of the two TD3 (passport) MRZ lines
+	td3LineLength = 44
+)
+
+// mrzCharValue returns the value of an MRZ character for check digit
+// computation: digits are 0-9, letters A-Z are 10-35 and the filler < is 0
+func mrzCharValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 0
+}
+
+// mrzCheckDigit computes the ICAO 9303 check digit of data: the sum of the
+// character values weighted 7, 3, 1 repeatedly, modulo 10
+func mrzCheckDigit(data string) int {
+	weights := [3]int{7, 3, 1}
+	sum := 0
+	for i := 0; i < len(data); i++ {
+		sum += mrzCharValue(data[i]) * weights[i%3]
+	}
+	return sum % 10
+}
+
+// normalizeMRZLine removes spaces from an OCR line and maps characters that
+// Tesseract emits for the filler to <
+func normalizeMRZLine(line string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(line) {
+		switch r {
+		case ' ', '\t', '\r':
+			continue
+		case '«', '‹', '(', '{', '[':
+			b.WriteByte('<')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isMRZCandidate reports whether a normalized line looks like an MRZ line
+func isMRZCandidate(line string) bool {
+	if len(line) < td3LineLength-4 || len(line) > td3LineLength+4 {
+		return false
+	}
+	valid := 0
+	for i := 0; i < len(line); i++ {
+		if strings.IndexByte(mrzCharset, line[i]) >= 0 {
+			valid++
+		}
+	}
+	return float64(valid) >= 0.9*float64(len(line))
+}
+
+// findTD3Lines locates the two lines of a passport MRZ in OCR text. The
+// first line starts with P; it is padded or cut to 44 characters, since
+// its tail is filler only. The second line must have exactly 44 characters.
+func findTD3Lines(text string) (string, string, error) {
+	var candidates []string
+	for _, line := range strings.Split(text, "\n") {
+		if normalized := normalizeMRZLine(line); isMRZCandidate(normalized) {
+			candidates = append(candidates, normalized)
+		}
+	}
+
+	for i := 0; i+1 < len(candidates); i++ {
+		line1, line2 := candidates[i], candidates[i+1]
+		if line1[0] != 'P' {
+			continue
+		}
+		if len(line2) != td3LineLength {
+			return "", "", fmt.Errorf("second MRZ line has %d characters, expected %d", len(line2), td3LineLength)
+		}
+
+		if len(line1) < td3LineLength {
+			line1 += strings.Repeat("<", td3LineLength-len(line1))
+		}
+		return line1[:td3LineLength], line2, nil
+	}
+
+	return "", "", fmt.Errorf("no pair of %d-character MRZ lines found", td3LineLength)
+}
+
+// mrzField is the kind of characters an MRZ position may hold
+type mrzField int
+
+const (
+	mrzAlpha        mrzField = iota // Letters and filler
+	mrzNumeric                      // Digits
+	mrzAlphanumeric                 // Letters, digits and filler
+)
+
+// correctMRZ replaces characters that OCR commonly confuses with the
+// character allowed at their position: digits read in letter fields, letters
+// read in digit fields, and K read for the filler <
+func correctMRZ(line string, layout []mrzField) string {
+	b := []byte(line)
+	for i := range b {
+		switch layout[i] {
+		case mrzNumeric:
+			if digit, ok := letterToDigit[rune(b[i])]; ok {
+				b[i] = byte(digit)
+			}
+		case mrzAlpha:
+			if letter, ok := digitToLetter[rune(b[i])]; ok {
+				b[i] = byte(letter)
+			}
+		}
+	}
+
+	// A run of K between fillers or at the end of a letter field is filler
+	for start := 0; start < len(b); {
+		if b[start] != 'K' || layout[start] == mrzNumeric {
+			start++
+			continue
+		}
+		end := start
+		for end < len(b) && b[end] == 'K' && layout[end] != mrzNumeric {
+			end++
+		}
+		before := start == 0 || b[start-1] == '<'
+		after := end == len(b) || b[end] == '<' || layout[end] == mrzNumeric
+		if before && after && start > 0 {
+			for i := start; i < end; i++ {
+				b[i] = '<'
+			}
+		}
+		start = end
+	}
+	return string(b)
+}
+
+// td3Layout returns the character kind of every position of both TD3 lines
+func td3Layout() ([]mrzField, []mrzField) {
+	line1 := make([]mrzField, td3LineLength)
+	for i := range line1 {
+		line1[i] = mrzAlpha
+	}
+
+	line2 := make([]mrzField, td3LineLength)
+	set := func(from, to int, kind mrzField) {
+		for i := from; i < to; i++ {
+			line2[i] = kind
+		}
+	}
+	set(0, 9, mrzAlphanumeric)   // Document number
+	set(9, 10, mrzNumeric)       // Check digit
+	set(10, 13, mrzAlpha)        // Nationality
+	set(13, 20, mrzNumeric)      // Birth date and check digit
+	set(20, 21, mrzAlphanumeric) // Sex
+	set(21, 28, mrzNumeric)      // Expiry date and check digit
+	set(28, 43, mrzAlphanumeric) // Personal number and its check digit, which may be <
+	set(43, 44, mrzNumeric)      // Composite check digit
+	return line1, line2
+}
+
+// decodeTD3 corrects and decodes the two MRZ lines of a passport. Two-digit
+// birth years are placed in the most recent century not after now; expiry
+// years are always in the 21st century.
+func decodeTD3(line1, line2 string, now time.Time) *PassportResult {
+	layout1, layout2 := td3Layout()
+	line1 = correctMRZ(line1, layout1)
+	line2 = correctMRZ(line2, layout2)
+
+	doc := &PassportResult{
+		DocumentCode:   &Field{Value: strings.TrimRight(line1[0:2], "<"), Type: FieldTypeEnum},
+		IssuingCountry: &Field{Value: strings.Trim(line1[2:5], "<"), Type: FieldTypeString},
+		Nationality:    &Field{Value: strings.Trim(line2[10:13], "<"), Type: FieldTypeString},
+	}
+
+	// Names: primary identifier, <<, then secondary identifiers separated by <
+	names := strings.TrimRight(line1[5:], "<")
+	surname, givenNames, _ := strings.Cut(names, "<<")
+	doc.Surname = &Field{Value: strings.ReplaceAll(surname, "<", " "), Type: FieldTypeString}
+	doc.GivenNames = &Field{Value: strings.TrimSpace(strings.ReplaceAll(givenNames, "<", " ")), Type: FieldTypeString}
+
+	sex := line2[20:21]
+	if sex == "<" {
+		sex = "X"
+	}
+	doc.Sex = &Field{Value: sex, Type: FieldTypeEnum}
+	if sex != "M" && sex != "F" && sex != "X" {
+		doc.Sex.setInvalid("invalid sex: " + sex)
+	}
+
+	check := func(name, data string, digit byte) bool {
+		// An empty optional field may carry < instead of 0
+		if digit == '<' && strings.Trim(data, "<") == "" {
+			digit = '0'
+		}
+		expected := strconv.Itoa(mrzCheckDigit(data))
+		result := CheckDigitResult{Name: name, Expected: expected, Actual: string(digit), Valid: expected == string(digit)}
+		doc.CheckDigits = append(doc.CheckDigits, result)
+		return result.Valid
+	}
+
+	// Alphanumeric fields cannot be corrected by position; use their check digits instead
+	original := line2
+	line2 = repairWithCheckDigit(line2, 0, 9, 9)
+	line2 = repairWithCheckDigit(line2, 28, 42, 42)
+
+	documentNumber := line2[0:9]
+	doc.DocumentNumber = &Field{Value: strings.TrimRight(documentNumber, "<"), Type: FieldTypeString}
+	markCorrected(doc.DocumentNumber, strings.TrimRight(original[0:9], "<"))
+	if check("document_number", documentNumber, line2[9]) {
+		doc.DocumentNumber.setValid()
+	} else {
+		doc.DocumentNumber.setInvalid("document number check digit mismatch")
+	}
+
+	doc.BirthDate = mrzDateField(line2[13:19], now.Year()%100, check("birth_date", line2[13:19], line2[19]))
+	doc.ExpiryDate = mrzDateField(line2[21:27], 99, check("expiry_date", line2[21:27], line2[27]))
+
+	personalNumber := line2[28:42]
+	doc.PersonalNumber = &Field{Value: strings.TrimRight(personalNumber, "<"), Type: FieldTypeString}
+	markCorrected(doc.PersonalNumber, strings.TrimRight(original[28:42], "<"))
+	if check("personal_number", personalNumber, line2[42]) {
+		doc.PersonalNumber.setValid()
+	} else {
+		doc.PersonalNumber.setInvalid("personal number check digit mismatch")
+	}
+
+	// The composite digit covers the document number, birth date, expiry date
+	// and personal number lines including their own check digits
+	check("composite", line2[0:10]+line2[13:20]+line2[21:43], line2[43])
+
+	return doc
+}
+
+// mrzConfusions maps characters to those OCR-B is commonly misread as
+var mrzConfusions = map[byte]string{
+	'0': "OD", 'O': "0D", 'D': "0O", '1': "I", 'I': "1", '2': "Z", 'Z': "2",
+	'5': "S", 'S': "5", '6': "G", 'G': "6", '8': "B", 'B': "8",
+}
+
+// repairWithCheckDigit fixes a single OCR confusion in line[from:to] when
+// the field fails the check digit at position digit and exactly one
+// substitution makes it pass. The line is returned unchanged otherwise.
+func repairWithCheckDigit(line string, from, to, digit int) string {
+	actual := line[digit]
+	if actual == '<' {
+		actual = '0'
+	}
+	if actual < '0' || actual > '9' || mrzCheckDigit(line[from:to]) == int(actual-'0') {
+		return line
+	}
+
+	var candidate string
+	found := 0
+	for i := from; i < to; i++ {
+		for _, replacement := range []byte(mrzConfusions[line[i]]) {
+			repaired := line[:i] + string(replacement) + line[i+1:]
+			if mrzCheckDigit(repaired[from:to]) == int(actual-'0') {
+				candidate = repaired
+				found++
+			}
+		}
+	}
+	if found != 1 {
+		return line
+	}
+	return candidate
+}
+
+// markCorrected records the OCR result of a field that was repaired
+func markCorrected(field *Field, original string) {
+	if field.Value != original {
+		field.Corrected = true
+		field.Original = original
+	}
+}
+
+// mrzDateField converts a YYMMDD MRZ date to a date field. Years up to
+// pivotYear are placed in the 2000s, later years in the 1900s.
+func mrzDateField(value string, pivotYear int, checkValid bool) *Field {
+	field := &Field{Value: value, Type: FieldTypeDate}
+
+	year, errYear := strconv.Atoi(value[0:2])
+	month, errMonth := strconv.Atoi(value[2:4])
+	day, errDay := strconv.Atoi(value[4:6])
+	if errYear != nil || errMonth != nil || errDay != nil {
+		field.setInvalid("invalid MRZ date: " + value)
+		return field
+	}
+
+	century := 2000
+	if year > pivotYear {
+		century = 1900
+	}
+	date, err := validCivilDate(century+year, month, day)
+	if err != nil {
+		field.setInvalid(err.Error())
+		return field
+	}
+
+	field.Normalized = date.Format(ISODateLayout)
+	if !checkValid {
+		field.setInvalid("check digit mismatch")
+		return field
+	}
+	field.setValid()
+	return field
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Specimen MRZ from ICAO Doc 9303 Part 4
+const (
+	specimenMRZLine1 = "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<"
+	specimenMRZLine2 = "L898902C36UTO7408122F1204159ZE184226B<<<<<10"
+)
+
+var mrzTestNow = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestMRZCheckDigit tests the 7-3-1 weighted check digit
+func TestMRZCheckDigit(t *testing.T) {
+	tests := map[string]int{
+		"L898902C3": 6,
+		"740812":    2,
+		"120415":    9,
+		"ZE184226B": 1,
+		"<<<<<":     0,
+	}
+	for data, expected := range tests {
+		if got := mrzCheckDigit(data); got != expected {
+			t.Errorf("mrzCheckDigit(%q) = %d, expected %d", data, got, expected)
+		}
+	}
+}
+
+// TestDecodeTD3 tests decoding of the specimen passport MRZ
+func TestDecodeTD3(t *testing.T) {
+	doc := decodeTD3(specimenMRZLine1, specimenMRZLine2, mrzTestNow)
+
+	expected := map[string]string{
+		"document_code":   "P",
+		"issuing_country": "UTO",
+		"surname":         "ERIKSSON",
+		"given_names":     "ANNA MARIA",
+		"document_number": "L898902C3",
+		"nationality":     "UTO",
+		"birth_date":      "740812",
+		"sex":             "F",
+		"expiry_date":     "120415",
+		"personal_number": "ZE184226B",
+	}
+	flat := doc.Flatten()
+	for key, value := range expected {
+		if flat[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, flat[key])
+		}
+	}
+
+	if doc.BirthDate.Normalized != "1974-08-12" || doc.ExpiryDate.Normalized != "2012-04-15" {
+		t.Errorf("Unexpected normalized dates: %q, %q", doc.BirthDate.Normalized, doc.ExpiryDate.Normalized)
+	}
+	if len(doc.CheckDigits) != 5 {
+		t.Fatalf("Expected 5 check digits, got %d", len(doc.CheckDigits))
+	}
+	for _, check := range doc.CheckDigits {
+		if !check.Valid {
+			t.Errorf("Expected %s check digit to be valid, got %+v", check.Name, check)
+		}
+		if flat[check.Name+"_check"] != "valid" {
+			t.Errorf("Expected flattened %s_check to be valid", check.Name)
+		}
+	}
+}
+
+// TestDecodeTD3Corrections tests that positional OCR confusions are repaired
+// and that a wrong check digit is reported
+func TestDecodeTD3Corrections(t *testing.T) {
+	line1 := "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<KKK<<<<<<<<<"
+	line2 := "L898902C36UT07408I22F12O4159ZE184226B<<<<<10"
+	doc := decodeTD3(line1, line2, mrzTestNow)
+	if doc.GivenNames.Value != "ANNA MARIA" || doc.Nationality.Value != "UTO" {
+		t.Errorf("Expected filler and letters to be repaired, got %q, %q", doc.GivenNames.Value, doc.Nationality.Value)
+	}
+	for _, check := range doc.CheckDigits {
+		if !check.Valid {
+			t.Errorf("Expected %s check digit to be valid after correction, got %+v", check.Name, check)
+		}
+	}
+
+	line2 = strings.Replace(specimenMRZLine2, "L898902C3", "L8989O2C3", 1)
+	doc = decodeTD3(specimenMRZLine1, line2, mrzTestNow)
+	if doc.DocumentNumber.Value != "L898902C3" || !doc.DocumentNumber.Corrected || doc.DocumentNumber.Original != "L8989O2C3" {
+		t.Errorf("Expected document number to be repaired by its check digit, got %+v", doc.DocumentNumber)
+	}
+
+	line2 = strings.Replace(specimenMRZLine2, "7408122", "7408123", 1)
+	doc = decodeTD3(specimenMRZLine1, line2, mrzTestNow)
+	if doc.BirthDate.Valid == nil || *doc.BirthDate.Valid {
+		t.Errorf("Expected birth date with wrong check digit to be invalid, got %+v", doc.BirthDate)
+	}
+	invalid := map[string]bool{}
+	for _, check := range doc.CheckDigits {
+		if !check.Valid {
+			invalid[check.Name] = true
+		}
+	}
+	if len(invalid) != 2 || !invalid["birth_date"] || !invalid["composite"] {
+		t.Errorf("Expected birth_date and composite check digits to fail, got %v", invalid)
+	}
+}
+
+// TestFindTD3Lines tests locating the MRZ in noisy OCR text
+func TestFindTD3Lines(t *testing.T) {
+	text := "PASSPORT\nUTOPIA\n" +
+		"P<UTO ERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<\n" +
+		specimenMRZLine2 + "\n"
+
+	line1, line2, err := findTD3Lines(text)
+	if err != nil {
+		t.Fatalf("Expected MRZ to be found, got error: %v", err)
+	}
+	if line1 != specimenMRZLine1 || line2 != specimenMRZLine2 {
+		t.Errorf("Unexpected MRZ lines:\n%s\n%s", line1, line2)
+	}
+
+	if _, _, err := findTD3Lines("PASSPORT\nno machine readable zone"); err == nil {
+		t.Error("Expected an error for text without an MRZ")
+	}
+}
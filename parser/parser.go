@@ -1,28 +1,58 @@
 // Package parser provides interfaces and implementations for document parsing
 package parser
 
-import "ocr-web-api/imageprocessor"
+import (
+	"context"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+)
 
 // DocumentParser defines the interface for parsing different document types
-// Uses imageprocessor.Mat for processed image data as specified in the design document
+// Uses imageprocessor.Mat for processed image data as specified in the design document.
+// Parsers must pass ctx to the OCR engine so cancelled requests stop their OCR work.
 type DocumentParser interface {
-	Parse(mat imageprocessor.Mat) (map[string]string, error)
+	Parse(ctx context.Context, mat imageprocessor.Mat) (*Result, error)
+}
+
+// DoubleSidedParser is implemented by parsers that can read the back of their
+// document. ParseWithBack returns the front result with the back merged in.
+type DoubleSidedParser interface {
+	ParseWithBack(ctx context.Context, front, back imageprocessor.Mat) (*Result, error)
+}
+
+// SizedDocument is implemented by parsers whose documents are not ID-1 cards.
+// The preprocessing pipeline rectifies the image to the returned size.
+type SizedDocument interface {
+	DocumentSize() (widthMM, heightMM float64)
+}
+
+// PaperDocument is implemented by parsers whose documents are also issued on
+// paper of no fixed size. Images in which no card is found are parsed as
+// they are instead of being rejected.
+type PaperDocument interface {
+	HasPaperVariant() bool
 }
 
 // ParserFactory manages document parsers and provides parser selection
 type ParserFactory struct {
 	parsers map[string]DocumentParser
+	engine  ocr.Engine // Shared by the registered parsers and the classifier
 }
 
-// NewParserFactory creates a new parser factory instance
-func NewParserFactory() *ParserFactory {
+// NewParserFactory creates a new parser factory instance whose parsers
+// recognize text with engine
+func NewParserFactory(engine ocr.Engine) *ParserFactory {
 	factory := &ParserFactory{
 		parsers: make(map[string]DocumentParser),
+		engine:  engine,
 	}
 
 	// Register available parsers
-	factory.RegisterParser("drivers_license_jp", NewJPDriverLicenseParser())
-	factory.RegisterParser("individual_number_card_jp", NewIndividualNumberCardParser())
+	factory.RegisterParser(DocumentTypeDriversLicenseJP, NewJPDriverLicenseParser(engine))
+	factory.RegisterParser(DocumentTypeIndividualNumberCard, NewIndividualNumberCardParser(engine))
+	factory.RegisterParser(DocumentTypeResidenceCardJP, NewResidenceCardParser(engine))
+	factory.RegisterParser(DocumentTypePassport, NewPassportParser(engine))
+	factory.RegisterParser(DocumentTypeHealthInsuranceCard, NewHealthInsuranceCardParser(engine))
 
 	return factory
 }
@@ -41,6 +71,22 @@ func (pf *ParserFactory) GetParser(documentType string) (DocumentParser, error)
 	return parser, nil
 }
 
+// DocumentSize returns the physical size of the given document type in
+// millimetres, which is the ID-1 card size unless its parser is a SizedDocument
+func (pf *ParserFactory) DocumentSize(documentType string) (widthMM, heightMM float64) {
+	if sized, ok := pf.parsers[documentType].(SizedDocument); ok {
+		return sized.DocumentSize()
+	}
+	return imageprocessor.ID1WidthMM, imageprocessor.ID1HeightMM
+}
+
+// HasPaperVariant reports whether the given document type may be an image
+// without a card, i.e. whether its parser is a PaperDocument with a paper variant
+func (pf *ParserFactory) HasPaperVariant(documentType string) bool {
+	paper, ok := pf.parsers[documentType].(PaperDocument)
+	return ok && paper.HasPaperVariant()
+}
+
 // GetSupportedDocumentTypes returns a list of supported document types
 func (pf *ParserFactory) GetSupportedDocumentTypes() []string {
 	types := make([]string, 0, len(pf.parsers))
@@ -56,5 +102,5 @@ type UnsupportedDocumentTypeError struct {
 }
 
 func (e *UnsupportedDocumentTypeError) Error() string {
-	return "サポートされていない文書タイプです: " + e.DocumentType
+	return "unsupported document type: " + e.DocumentType
 }
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+	"strings"
+	"time"
+)
+
+// PassportParser handles parsing of passports through the TD3 machine
+// readable zone (MRZ) at the bottom of the data page
+type PassportParser struct {
+	engine ocr.Engine
+
+	// now returns the current time, used to pick the century of birth years
+	now func() time.Time
+}
+
+// NewPassportParser creates a new passport parser instance that recognizes text with engine
+func NewPassportParser(engine ocr.Engine) *PassportParser {
+	return &PassportParser{engine: engine, now: time.Now}
+}
+
+// mrzOptions recognizes MRZ text: OCR-B letters, digits and the filler only
+var mrzOptions = ocr.Options{Language: "eng", PSM: ocr.PSMSingleBlock, Whitelist: mrzCharset}
+
+// passportDataPageLayout is the data page of a TD3 passport. Only the MRZ is
+// read; the visual zone repeats the same data in the issuing state's script.
+var passportDataPageLayout = &LayoutTemplate{
+	Name: DocumentTypePassport + "/data_page",
+	Zones: []Zone{
+		{Field: "mrz", X: 0, Y: 0.72, W: 1, H: 0.28, Options: mrzOptions, Multiline: true},
+	},
+}
+
+// DetectionSignals returns the signals that identify a passport data page
+func (p *PassportParser) DetectionSignals() DetectionSignals {
+	return DetectionSignals{
+		Keywords: []string{"PASSPORT", "旅券", "P<", "PASSEPORT", "NATIONALITY"},
+		Layout:   passportDataPageLayout,
+	}
+}
+
+// DocumentSize returns the size of a passport data page in millimetres
+func (p *PassportParser) DocumentSize() (float64, float64) {
+	return imageprocessor.TD3WidthMM, imageprocessor.TD3HeightMM
+}
+
+// Parse extracts structured data from the MRZ of a passport data page.
+// The image is expected to be the rectified page produced by the preprocessing pipeline.
+func (p *PassportParser) Parse(ctx context.Context, mat imageprocessor.Mat) (*Result, error) {
+	if len(mat) == 0 {
+		return nil, fmt.Errorf("cannot process empty image")
+	}
+
+	// Step 1: Read the MRZ from the bottom of the page
+	data, regions, err := passportDataPageLayout.Extract(ctx, p.engine, mat)
+	if err == nil {
+		var line1, line2 string
+		if line1, line2, err = findTD3Lines(data["mrz"]); err == nil {
+			return p.buildResult(line1, line2, regions), nil
+		}
+	}
+	slog.InfoContext(ctx, "MRZ zone extraction failed, falling back to full page", "document_type", DocumentTypePassport, "error", err)
+
+	// Do not fall back to a second OCR run once the request has been cancelled,
+	// or when the OCR pool has no room for it
+	if errors.Is(err, ocr.ErrPoolSaturated) {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Step 2: The page may not have been rectified; look for the MRZ anywhere
+	regions, err = p.engine.ExtractRegionsWithOptions(ctx, mat, mrzOptions)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to extract text via OCR: %w", err)
+	}
+
+	lines := ocr.GroupLines(regions)
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	line1, line2, err := findTD3Lines(strings.Join(texts, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMRZNotFound, err)
+	}
+
+	return p.buildResult(line1, line2, regions), nil
+}
+
+// buildResult decodes the MRZ lines and scores each field against the OCR regions
+func (p *PassportParser) buildResult(line1, line2 string, regions []ocr.RegionInfo) *Result {
+	doc := decodeTD3(line1, line2, p.now())
+	applyFieldConfidence(doc, regions)
+	return NewResult(DocumentTypePassport, doc)
+}
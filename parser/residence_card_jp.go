@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/ocr"
+	"regexp"
+	"strings"
+)
+
+// ResidenceCardParser handles parsing of Japanese residence cards (在留カード)
+type ResidenceCardParser struct {
+	patterns map[string]*regexp.Regexp
+	engine   ocr.Engine
+}
+
+// NewResidenceCardParser creates a new residence card parser instance that recognizes text with engine
+func NewResidenceCardParser(engine ocr.Engine) *ResidenceCardParser {
+	return &ResidenceCardParser{
+		engine:   engine,
+		patterns: initResidenceCardPatterns(),
+	}
+}
+
+// residenceCardFrontLayout is the front of a residence card. Labels are
+// printed in Japanese and English, and the zones start right of them.
+var residenceCardFrontLayout = &LayoutTemplate{
+	Name: DocumentTypeResidenceCardJP + "/front",
+	Zones: []Zone{
+		{Field: "card_number", X: 0.62, Y: 0.03, W: 0.36, H: 0.08, Options: zoneCardNumber, Clean: cleanCardNumber},
+		{Field: "name", X: 0.12, Y: 0.11, W: 0.86, H: 0.09, Options: zoneLatinName, Clean: collapseSpaces},
+		{Field: "birth_date", X: 0.16, Y: 0.21, W: 0.32, H: 0.07, Options: zoneDateLine, Clean: cleanDate},
+		{Field: "gender", X: 0.52, Y: 0.21, W: 0.12, H: 0.07, Options: zoneGender},
+		{Field: "nationality", X: 0.12, Y: 0.28, W: 0.50, H: 0.07, Options: zoneTextLine, Clean: collapseSpaces},
+		{Field: "address", X: 0.12, Y: 0.35, W: 0.56, H: 0.09, Options: zoneTextLine, Clean: cleanAddress},
+		{Field: "status_of_residence", X: 0.12, Y: 0.45, W: 0.56, H: 0.08, Options: zoneTextLine, Clean: collapseSpaces},
+		{Field: "work_restriction", X: 0.03, Y: 0.54, W: 0.65, H: 0.09, Options: zoneTextLine, Clean: normalizeWorkRestriction},
+		{Field: "period_of_stay", X: 0.12, Y: 0.64, W: 0.56, H: 0.08, Options: zoneTextLine, Clean: collapseSpaces},
+	},
+}
+
+// Zone options specific to the residence card
+var (
+	zoneCardNumber = ocr.Options{Language: "eng", PSM: ocr.PSMSingleLine, Whitelist: ocr.WhitelistDigits + "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}
+	zoneLatinName  = ocr.Options{Language: "eng", PSM: ocr.PSMSingleLine, Whitelist: "ABCDEFGHIJKLMNOPQRSTUVWXYZ,-'."}
+)
+
+// workRestrictions lists the work permission statements printed on residence cards
+var workRestrictions = []string{
+	"就労制限なし",
+	"就労不可",
+	"在留資格に基づく就労活動のみ可",
+	"指定書記載機関での在留資格に基づく就労活動のみ可",
+	"指定書により指定された就労活動のみ可",
+}
+
+// DetectionSignals returns the signals that identify a residence card
+func (p *ResidenceCardParser) DetectionSignals() DetectionSignals {
+	return DetectionSignals{
+		Keywords: []string{"在留カード", "RESIDENCECARD", "在留資格", "在留期間", "就労制限", "住居地", "国籍・地域"},
+		Layout:   residenceCardFrontLayout,
+	}
+}
+
+// Parse extracts structured data from a residence card image.
+// The image is expected to be the rectified card produced by the preprocessing pipeline.
+func (p *ResidenceCardParser) Parse(ctx context.Context, mat imageprocessor.Mat) (*Result, error) {
+	// Step 1: Read every field from its zone of the card layout
+	extractedData, regions, err := p.parseWithTemplate(ctx, mat)
+	zonesValid := err == nil && p.validateExtractedData(extractedData) == nil
+	if zonesValid && residenceCardFrontLayout.Complete(extractedData) {
+		// Every zone was read; no need for a full-page OCR pass
+		return p.buildResult(extractedData, regions), nil
+	}
+	if err != nil {
+		slog.InfoContext(ctx, "Layout-based extraction failed, falling back to full OCR", "document_type", DocumentTypeResidenceCardJP, "error", err)
+	}
+
+	// Do not fall back to a second OCR run once the request has been cancelled,
+	// or when the OCR pool has no room for it
+	if errors.Is(err, ocr.ErrPoolSaturated) {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Step 2: Fallback to traditional OCR text extraction
+	ocrText, pageRegions, err := p.extractTextUsingOCR(ctx, mat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract text via OCR: %w", err)
+	}
+
+	// Step 3: Parse the text using regex patterns
+	fallbackData, err := p.parseTextWithRegex(ocrText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text with regex: %w", err)
+	}
+
+	// Zone values are kept when they are usable; the full-page pass only fills the gaps
+	if zonesValid {
+		mergeMissingFields(extractedData, fallbackData)
+		regions = mergeRegions(regions, pageRegions)
+	} else {
+		extractedData = fallbackData
+		regions = pageRegions
+	}
+
+	// Step 4: Validate the extracted data
+	if err := p.validateExtractedData(extractedData); err != nil {
+		return nil, fmt.Errorf("validation failed for residence card data: %w", err)
+	}
+
+	return p.buildResult(extractedData, regions), nil
+}
+
+// buildResult assembles the typed result and scores each field against the OCR regions
+func (p *ResidenceCardParser) buildResult(data map[string]string, regions []ocr.RegionInfo) *Result {
+	doc := newResidenceCardResult(data)
+	applyFieldConfidence(doc, regions)
+	normalizeDateFields(doc)
+	validateResidenceCardNumberField(doc.CardNumber)
+	return NewResult(DocumentTypeResidenceCardJP, doc)
+}
+
+// parseWithTemplate recognizes each field in its own zone of the card layout.
+// The recognized words are returned as well so field confidence can be scored against them.
+func (p *ResidenceCardParser) parseWithTemplate(ctx context.Context, mat imageprocessor.Mat) (map[string]string, []ocr.RegionInfo, error) {
+	extractedData, regions, err := residenceCardFrontLayout.Extract(ctx, p.engine, mat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.postProcessExtractedData(extractedData)
+	return extractedData, regions, nil
+}
+
+// parseTextWithRegex extracts structured data from OCR text using regex patterns
+func (p *ResidenceCardParser) parseTextWithRegex(ocrText string) (map[string]string, error) {
+	extractedData := make(map[string]string)
+
+	// Apply each regex pattern to extract relevant fields
+	for fieldName, pattern := range p.patterns {
+		matches := pattern.FindStringSubmatch(ocrText)
+		if len(matches) > 1 {
+			// Clean up the extracted text
+			value := strings.TrimSpace(matches[1])
+			if value != "" {
+				extractedData[fieldName] = value
+			}
+		}
+	}
+
+	// Post-process extracted data
+	p.postProcessExtractedData(extractedData)
+
+	return extractedData, nil
+}
+
+// postProcessExtractedData cleans and normalizes extracted data
+func (p *ResidenceCardParser) postProcessExtractedData(data map[string]string) {
+	// The period of stay is printed with its expiry, e.g. 3年3月(2025年06月01日)
+	if period, exists := data["period_of_stay"]; exists {
+		if expiry := zoneDatePattern.FindString(period); expiry != "" {
+			if _, found := data["period_of_stay_expiry"]; !found {
+				data["period_of_stay_expiry"] = strings.Join(strings.Fields(expiry), "")
+			}
+			period = strings.Replace(period, expiry, "", 1)
+		}
+		data["period_of_stay"] = strings.Trim(strings.Join(strings.Fields(period), ""), "()（）")
+	}
+
+	// Card numbers are compared without separators
+	if number, exists := data["card_number"]; exists {
+		data["card_number"] = cleanCardNumber(number)
+	}
+
+	if restriction, exists := data["work_restriction"]; exists {
+		data["work_restriction"] = normalizeWorkRestriction(restriction)
+	}
+
+	// The card prints both scripts, e.g. 男 M.
+	if gender, exists := data["gender"]; exists {
+		switch {
+		case strings.Contains(gender, "男") || strings.HasPrefix(strings.TrimSpace(gender), "M"):
+			data["gender"] = "男"
+		case strings.Contains(gender, "女") || strings.HasPrefix(strings.TrimSpace(gender), "F"):
+			data["gender"] = "女"
+		}
+	}
+
+	if name, exists := data["name"]; exists {
+		data["name"] = collapseSpaces(strings.ToUpper(name))
+	}
+}
+
+// cleanCardNumber keeps the letters and digits of a card number zone
+func cleanCardNumber(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'Z':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return -1
+	}, text)
+}
+
+// normalizeWorkRestriction maps the recognized statement to the closest
+// printed work restriction, leaving unknown statements as read
+func normalizeWorkRestriction(text string) string {
+	compact := strings.Join(strings.Fields(text), "")
+	for _, restriction := range workRestrictions {
+		if strings.Contains(compact, restriction) {
+			return restriction
+		}
+	}
+
+	switch {
+	case strings.Contains(compact, "制限なし"):
+		return workRestrictions[0]
+	case strings.Contains(compact, "不可"):
+		return workRestrictions[1]
+	case strings.Contains(compact, "指定書記載"):
+		return workRestrictions[3]
+	case strings.Contains(compact, "指定書"):
+		return workRestrictions[4]
+	case strings.Contains(compact, "在留資格"):
+		return workRestrictions[2]
+	}
+	return compact
+}
+
+// initResidenceCardPatterns initializes regex patterns for residence card fields.
+// Labels are printed in Japanese followed by English, e.g. 住居地 ADDRESS.
+func initResidenceCardPatterns() map[string]*regexp.Regexp {
+	patterns := make(map[string]*regexp.Regexp)
+
+	// Card number (番号) - two letters, eight digits, two letters
+	patterns["card_number"] = regexp.MustCompile(`([A-Z]{2}\s*\d{8}\s*[A-Z]{2})`)
+
+	// Name (氏名 NAME) in Latin script
+	patterns["name"] = regexp.MustCompile(`(?:氏\s*名|NAME)\s*(?:NAME)?\s*[:：]?\s*([A-Z][A-Z ,.'\-]+)`)
+
+	// Date of birth (生年月日 DATE OF BIRTH), printed in the Gregorian calendar
+	patterns["birth_date"] = regexp.MustCompile(`(?:生年月日|DATE\s*OF\s*BIRTH)[^\d\r\n]*(\d{4}\s*年\s*\d{1,2}\s*月\s*\d{1,2}\s*日)`)
+
+	// Sex (性別 SEX)
+	patterns["gender"] = regexp.MustCompile(`(?:性\s*別|SEX)\s*(?:SEX)?\s*[:：]?\s*([男女]|[MF]\.)`)
+
+	// Nationality/region (国籍・地域 NATIONALITY/REGION)
+	patterns["nationality"] = regexp.MustCompile(`(?:国籍\s*・?\s*地域|国籍)\s*(?:NATIONALITY\s*/\s*REGION)?\s*[:：]?\s*([^\s\r\n]+)`)
+
+	// Address (住居地 ADDRESS)
+	patterns["address"] = regexp.MustCompile(`住居地\s*(?:ADDRESS)?\s*[:：]?\s*([^\r\n]+)`)
+
+	// Status of residence (在留資格 STATUS)
+	patterns["status_of_residence"] = regexp.MustCompile(`在留資格\s*(?:STATUS)?\s*[:：]?\s*([^\s\r\n]+)`)
+
+	// Work restriction (就労制限の有無)
+	patterns["work_restriction"] = regexp.MustCompile(`(就労制限なし|就労不可|指定書記載機関での在留資格に基づく就労活動のみ可|在留資格に基づく就労活動のみ可|指定書により指定された就労活動のみ可)`)
+
+	// Period of stay with its expiry (在留期間(満了日)), e.g. 3年3月(2025年06月01日)
+	patterns["period_of_stay"] = regexp.MustCompile(`在留期間[^\r\n]*?((?:\d+\s*年)?\s*(?:\d+\s*月)?\s*(?:\d+\s*日)?\s*[(（]\s*\d{4}\s*年\s*\d{1,2}\s*月\s*\d{1,2}\s*日\s*[)）]|無期限)`)
+
+	return patterns
+}
+
+// validateExtractedData validates the extracted data for required fields
+func (p *ResidenceCardParser) validateExtractedData(data map[string]string) error {
+	if err := checkRequiredFields(data, "name"); err != nil {
+		return err
+	}
+
+	// Gender validation
+	if gender, exists := data["gender"]; exists {
+		if gender != "男" && gender != "女" {
+			return invalidFieldError("gender", "expected '男' or '女'")
+		}
+	}
+
+	return nil
+}
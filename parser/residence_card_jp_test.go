@@ -0,0 +1,82 @@
+package parser
+
+import "testing"
+
+// TestValidateResidenceCardNumber tests the residence card number format check
+func TestValidateResidenceCardNumber(t *testing.T) {
+	valid := []string{"AB12345678CD", "ab12345678cd", "AB 1234 5678 CD"}
+	for _, number := range valid {
+		if err := validateResidenceCardNumber(number); err != nil {
+			t.Errorf("Expected %q to be valid, got error: %v", number, err)
+		}
+	}
+
+	invalid := []string{"", "AB1234567CD", "A123456789CD", "AB12345678C1", "ＡＢ12345678CD"}
+	for _, number := range invalid {
+		if err := validateResidenceCardNumber(number); err == nil {
+			t.Errorf("Expected %q to be invalid", number)
+		}
+	}
+}
+
+// TestResidenceCardNumberField tests that letter/digit confusions are repaired
+func TestResidenceCardNumberField(t *testing.T) {
+	field := &Field{Value: "A8I23456O8CD", Type: FieldTypeString}
+	validateResidenceCardNumberField(field)
+	if field.Value != "AB12345608CD" || !field.Corrected || field.Original != "A8I23456O8CD" {
+		t.Errorf("Unexpected corrected field: %+v", field)
+	}
+	if field.Valid == nil || !*field.Valid {
+		t.Errorf("Expected corrected number to be valid")
+	}
+
+	field = &Field{Value: "AB123456CD", Type: FieldTypeString}
+	validateResidenceCardNumberField(field)
+	if field.Valid == nil || *field.Valid || field.Error == "" {
+		t.Errorf("Expected short number to be invalid, got %+v", field)
+	}
+}
+
+// TestResidenceCardRegex tests field extraction from full-page OCR text
+func TestResidenceCardRegex(t *testing.T) {
+	text := "在留カード 番号 AB12345678CD\n" +
+		"氏名 NAME SMITH JOHN\n" +
+		"生年月日 DATE OF BIRTH 1990年01月15日 性別 SEX 男 M.\n" +
+		"国籍・地域 NATIONALITY/REGION 米国\n" +
+		"住居地 ADDRESS 東京都新宿区西新宿2-8-1\n" +
+		"在留資格 STATUS 技術・人文知識・国際業務\n" +
+		"就労制限の有無 在留資格に基づく就労活動のみ可\n" +
+		"在留期間(満了日) PERIOD OF STAY (DATE OF EXPIRATION) 3年(2026年04月01日)\n"
+
+	data, err := NewResidenceCardParser(nil).parseTextWithRegex(text)
+	if err != nil {
+		t.Fatalf("Expected text to be parsed, got error: %v", err)
+	}
+
+	expected := map[string]string{
+		"card_number":           "AB12345678CD",
+		"name":                  "SMITH JOHN",
+		"birth_date":            "1990年01月15日",
+		"gender":                "男",
+		"nationality":           "米国",
+		"address":               "東京都新宿区西新宿2-8-1",
+		"status_of_residence":   "技術・人文知識・国際業務",
+		"work_restriction":      "在留資格に基づく就労活動のみ可",
+		"period_of_stay":        "3年",
+		"period_of_stay_expiry": "2026年04月01日",
+	}
+	for key, value := range expected {
+		if data[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, data[key])
+		}
+	}
+
+	result := NewResidenceCardParser(nil).buildResult(data, nil)
+	doc := result.Fields.(*ResidenceCardResult)
+	if doc.PeriodOfStayExpiry.Normalized != "2026-04-01" {
+		t.Errorf("Expected normalized expiry 2026-04-01, got %q", doc.PeriodOfStayExpiry.Normalized)
+	}
+	if doc.CardNumber.Valid == nil || !*doc.CardNumber.Valid {
+		t.Errorf("Expected card number to be valid, got %+v", doc.CardNumber)
+	}
+}
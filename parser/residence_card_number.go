@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// residenceCardNumberPattern is the format of a residence card number:
+// two letters, eight digits and two letters, e.g. AB12345678CD
+var residenceCardNumberPattern = regexp.MustCompile(`^[A-Z]{2}[0-9]{8}[A-Z]{2}$`)
+
+// Characters OCR commonly confuses between letters and digits, used to
+// repair a card number position by position
+var (
+	letterToDigit = map[rune]rune{'O': '0', 'D': '0', 'Q': '0', 'I': '1', 'L': '1', 'Z': '2', 'S': '5', 'G': '6', 'B': '8'}
+	digitToLetter = map[rune]rune{'0': 'O', '1': 'I', '2': 'Z', '5': 'S', '6': 'G', '8': 'B'}
+)
+
+// validateResidenceCardNumber checks the format of a residence card number.
+// Spaces and hyphens are ignored.
+func validateResidenceCardNumber(number string) error {
+	cleaned := strings.ToUpper(stripNumberSeparators(number))
+	if n := len([]rune(cleaned)); n != 12 {
+		return fmt.Errorf("expected 12 characters, got %d", n)
+	}
+	if !residenceCardNumberPattern.MatchString(cleaned) {
+		return fmt.Errorf("expected two letters, eight digits and two letters, got %s", cleaned)
+	}
+	return nil
+}
+
+// correctResidenceCardNumber replaces digits read in letter positions and
+// letters read in digit positions with the character they are commonly
+// confused with. It reports whether the result is a well-formed number.
+func correctResidenceCardNumber(number string) (string, bool) {
+	runes := []rune(strings.ToUpper(stripNumberSeparators(number)))
+	if len(runes) != 12 {
+		return "", false
+	}
+
+	for i, r := range runes {
+		isLetterPosition := i < 2 || i >= 10
+		if replacement, ok := digitToLetter[r]; ok && isLetterPosition {
+			runes[i] = replacement
+		}
+		if replacement, ok := letterToDigit[r]; ok && !isLetterPosition {
+			runes[i] = replacement
+		}
+	}
+
+	corrected := string(runes)
+	return corrected, validateResidenceCardNumber(corrected) == nil
+}
+
+// validateResidenceCardNumberField validates the card number field in place,
+// repairing letter/digit confusions and marking the field as corrected
+func validateResidenceCardNumberField(field *Field) {
+	if field == nil {
+		return
+	}
+
+	err := validateResidenceCardNumber(field.Value)
+	if err == nil {
+		field.Value = strings.ToUpper(stripNumberSeparators(field.Value))
+		field.setValid()
+		return
+	}
+
+	if corrected, ok := correctResidenceCardNumber(field.Value); ok {
+		field.Original = field.Value
+		field.Value = corrected
+		field.Corrected = true
+		field.setValid()
+		return
+	}
+
+	field.setInvalid("invalid residence card number: " + err.Error())
+}
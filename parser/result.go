@@ -0,0 +1,481 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SchemaVersion is the version of the typed extraction result schema.
+// It must be bumped whenever a field is renamed, removed or changes type.
+const SchemaVersion = "1.0"
+
+// Document type identifiers handled by the parsers in this package
+const (
+	DocumentTypeDriversLicenseJP     = "drivers_license_jp"
+	DocumentTypeIndividualNumberCard = "individual_number_card_jp"
+	DocumentTypeResidenceCardJP      = "residence_card_jp"
+	DocumentTypePassport             = "passport"
+	DocumentTypeHealthInsuranceCard  = "health_insurance_card_jp"
+)
+
+// FieldType describes the kind of value carried by a Field
+type FieldType string
+
+const (
+	FieldTypeString FieldType = "string" // Free text such as names and addresses
+	FieldTypeDate   FieldType = "date"   // Calendar dates as printed on the document
+	FieldTypeNumber FieldType = "number" // Digit-only identifiers such as license numbers
+	FieldTypeEnum   FieldType = "enum"   // Values from a closed set such as gender
+)
+
+// Field represents a single extracted value together with its type.
+// A nil *Field means the field was not found on the document, while a
+// non-nil Field with an empty Value means it was found but empty.
+type Field struct {
+	Value      string    `json:"value"`
+	Type       FieldType `json:"type"`
+	Confidence float64   `json:"confidence"`           // Aggregated OCR confidence (0.0-1.0), 0 when it could not be determined
+	Normalized string    `json:"normalized,omitempty"` // Canonical form of Value, such as YYYY-MM-DD for dates
+	Valid      *bool     `json:"valid,omitempty"`      // Result of format validation, nil when the field is not validated
+	Error      string    `json:"error,omitempty"`      // Reason the value failed validation
+	Corrected  bool      `json:"corrected,omitempty"`  // Value was repaired from a misread OCR result
+	Original   string    `json:"original,omitempty"`   // OCR result before correction
+	Source     string    `json:"source,omitempty"`     // Side the value was read from when both sides were parsed
+	Redaction  string    `json:"redaction,omitempty"`  // How the value was redacted for the client, such as "mask"
+}
+
+// Document sides reported in Field.Source
+const (
+	SourceFront = "front"
+	SourceBack  = "back"
+)
+
+// setValid marks the field as having passed validation
+func (f *Field) setValid() {
+	valid := true
+	f.Valid = &valid
+	f.Error = ""
+}
+
+// setInvalid marks the field as having failed validation for the given reason
+func (f *Field) setInvalid(reason string) {
+	valid := false
+	f.Valid = &valid
+	f.Error = reason
+}
+
+// Document is implemented by every per-document result struct
+type Document interface {
+	// FieldMap returns the document fields keyed by their flat field name
+	FieldMap() map[string]*Field
+	// Flatten returns the document as the legacy flat key/value map
+	Flatten() map[string]string
+}
+
+// Result is the common envelope returned by every DocumentParser
+type Result struct {
+	SchemaVersion string   `json:"schemaVersion"`
+	DocumentType  string   `json:"documentType"`
+	Fields        Document `json:"fields"`
+}
+
+// NewResult wraps a parsed document in a versioned result envelope
+func NewResult(documentType string, doc Document) *Result {
+	return &Result{
+		SchemaVersion: SchemaVersion,
+		DocumentType:  documentType,
+		Fields:        doc,
+	}
+}
+
+// NewDocument returns an empty result struct of the given document type,
+// into which a JSON encoded result can be decoded
+func NewDocument(documentType string) (Document, error) {
+	switch documentType {
+	case DocumentTypeDriversLicenseJP:
+		return &DriversLicenseResult{}, nil
+	case DocumentTypeIndividualNumberCard:
+		return &IndividualNumberCardResult{}, nil
+	case DocumentTypeResidenceCardJP:
+		return &ResidenceCardResult{}, nil
+	case DocumentTypePassport:
+		return &PassportResult{}, nil
+	case DocumentTypeHealthInsuranceCard:
+		return &HealthInsuranceCardResult{}, nil
+	default:
+		return nil, &UnsupportedDocumentTypeError{DocumentType: documentType}
+	}
+}
+
+// Flatten returns the result fields as the legacy flat key/value map
+func (r *Result) Flatten() map[string]string {
+	if r == nil || r.Fields == nil {
+		return map[string]string{}
+	}
+	return r.Fields.Flatten()
+}
+
+// fieldSources maps the fields that copy or are decoded from another field
+// of the same document to that field, per document type. Whoever may not see
+// the source field may not see what was derived from it either.
+var fieldSources = map[string]map[string]string{
+	DocumentTypeDriversLicenseJP: {
+		"municipality":       "address",
+		"current_address":    "address",
+		"issuing_prefecture": "license_number",
+		"first_license_year": "license_number",
+		"reissue_count":      "license_number",
+	},
+	DocumentTypeIndividualNumberCard: {
+		"municipality": "address",
+	},
+}
+
+// SourceField returns the field the named field of a document type is
+// derived from, or "" when it is read from the document on its own
+func SourceField(documentType, name string) string {
+	return fieldSources[documentType][name]
+}
+
+// DriversLicenseResult holds the fields extracted from a Japanese driver's license
+type DriversLicenseResult struct {
+	Name          *Field `json:"name"`
+	Address       *Field `json:"address"`
+	BirthDate     *Field `json:"birth_date"`
+	LicenseNumber *Field `json:"license_number"`
+	IssueDate     *Field `json:"issue_date"`
+	ExpiryDate    *Field `json:"expiry_date"`
+	LicenseClass  *Field `json:"license_class"`
+	Municipality  *Field `json:"municipality"`
+
+	// Values decoded from a structurally valid license number
+	IssuingPrefecture *Field `json:"issuing_prefecture"`
+	FirstLicenseYear  *Field `json:"first_license_year"`
+	ReissueCount      *Field `json:"reissue_count"`
+
+	// Address in effect: the latest address change on the back, or the printed address
+	CurrentAddress *Field `json:"current_address"`
+
+	// Change records of the remarks (備考) area, present when the back was parsed
+	Changes []LicenseChangeRecord `json:"changes,omitempty"`
+}
+
+// Kinds of driver's license change records
+const (
+	LicenseChangeAddress      = "address"
+	LicenseChangeName         = "name"
+	LicenseChangeLicenseClass = "license_class"
+	LicenseChangeOther        = "other"
+)
+
+// LicenseChangeRecord is an entry of the remarks (備考) area on the back of
+// a driver's license, such as an address change
+type LicenseChangeRecord struct {
+	Date  *Field `json:"date"`
+	Kind  string `json:"kind"`  // One of the LicenseChange kinds
+	Value *Field `json:"value"` // New address, name or license class
+	Stamp string `json:"stamp"` // Authority of the seal, e.g. 東京都公安委員会
+	Text  string `json:"text"`  // Record as recognized
+}
+
+// SourceField returns the field of the document the record changes. Records
+// of other kinds, whose text may hold anything, count as address changes.
+func (r *LicenseChangeRecord) SourceField() string {
+	switch r.Kind {
+	case LicenseChangeName, LicenseChangeLicenseClass:
+		return r.Kind
+	default:
+		return "address"
+	}
+}
+
+// newDriversLicenseResult builds a typed driver's license result from extracted data
+func newDriversLicenseResult(data map[string]string) *DriversLicenseResult {
+	return &DriversLicenseResult{
+		Name:          fieldFrom(data, "name", FieldTypeString),
+		Address:       fieldFrom(data, "address", FieldTypeString),
+		BirthDate:     fieldFrom(data, "birth_date", FieldTypeDate),
+		LicenseNumber: fieldFrom(data, "license_number", FieldTypeNumber),
+		IssueDate:     fieldFrom(data, "issue_date", FieldTypeDate),
+		ExpiryDate:    fieldFrom(data, "expiry_date", FieldTypeDate),
+		LicenseClass:  fieldFrom(data, "license_class", FieldTypeString),
+		Municipality:  fieldFrom(data, "municipality", FieldTypeString),
+
+		CurrentAddress: fieldFrom(data, "address", FieldTypeString),
+	}
+}
+
+// FieldMap returns the driver's license fields keyed by their flat field name
+func (d *DriversLicenseResult) FieldMap() map[string]*Field {
+	return map[string]*Field{
+		"name":           d.Name,
+		"address":        d.Address,
+		"birth_date":     d.BirthDate,
+		"license_number": d.LicenseNumber,
+		"issue_date":     d.IssueDate,
+		"expiry_date":    d.ExpiryDate,
+		"license_class":  d.LicenseClass,
+		"municipality":   d.Municipality,
+
+		"issuing_prefecture": d.IssuingPrefecture,
+		"first_license_year": d.FirstLicenseYear,
+		"reissue_count":      d.ReissueCount,
+
+		"current_address": d.CurrentAddress,
+	}
+}
+
+// Flatten returns the driver's license fields as a flat key/value map
+func (d *DriversLicenseResult) Flatten() map[string]string {
+	return flattenFields(d.FieldMap())
+}
+
+// IndividualNumberCardResult holds the fields extracted from an Individual Number Card
+type IndividualNumberCardResult struct {
+	Name             *Field `json:"name"`
+	Address          *Field `json:"address"`
+	BirthDate        *Field `json:"birth_date"`
+	Gender           *Field `json:"gender"`
+	IndividualNumber *Field `json:"individual_number"`
+	IssueDate        *Field `json:"issue_date"`
+	ExpiryDate       *Field `json:"expiry_date"`
+	Municipality     *Field `json:"municipality"`
+}
+
+// newIndividualNumberCardResult builds a typed Individual Number Card result from extracted data
+func newIndividualNumberCardResult(data map[string]string) *IndividualNumberCardResult {
+	return &IndividualNumberCardResult{
+		Name:             fieldFrom(data, "name", FieldTypeString),
+		Address:          fieldFrom(data, "address", FieldTypeString),
+		BirthDate:        fieldFrom(data, "birth_date", FieldTypeDate),
+		Gender:           fieldFrom(data, "gender", FieldTypeEnum),
+		IndividualNumber: fieldFrom(data, "individual_number", FieldTypeNumber),
+		IssueDate:        fieldFrom(data, "issue_date", FieldTypeDate),
+		ExpiryDate:       fieldFrom(data, "expiry_date", FieldTypeDate),
+		Municipality:     fieldFrom(data, "municipality", FieldTypeString),
+	}
+}
+
+// FieldMap returns the Individual Number Card fields keyed by their flat field name
+func (d *IndividualNumberCardResult) FieldMap() map[string]*Field {
+	return map[string]*Field{
+		"name":              d.Name,
+		"address":           d.Address,
+		"birth_date":        d.BirthDate,
+		"gender":            d.Gender,
+		"individual_number": d.IndividualNumber,
+		"issue_date":        d.IssueDate,
+		"expiry_date":       d.ExpiryDate,
+		"municipality":      d.Municipality,
+	}
+}
+
+// Flatten returns the Individual Number Card fields as a flat key/value map
+func (d *IndividualNumberCardResult) Flatten() map[string]string {
+	return flattenFields(d.FieldMap())
+}
+
+// ResidenceCardResult holds the fields extracted from a residence card (在留カード)
+type ResidenceCardResult struct {
+	Name               *Field `json:"name"` // Latin script, as printed on the card
+	Nationality        *Field `json:"nationality"`
+	BirthDate          *Field `json:"birth_date"`
+	Gender             *Field `json:"gender"`
+	StatusOfResidence  *Field `json:"status_of_residence"`
+	PeriodOfStay       *Field `json:"period_of_stay"`
+	PeriodOfStayExpiry *Field `json:"period_of_stay_expiry"`
+	WorkRestriction    *Field `json:"work_restriction"`
+	Address            *Field `json:"address"`
+	CardNumber         *Field `json:"card_number"`
+}
+
+// newResidenceCardResult builds a typed residence card result from extracted data
+func newResidenceCardResult(data map[string]string) *ResidenceCardResult {
+	return &ResidenceCardResult{
+		Name:               fieldFrom(data, "name", FieldTypeString),
+		Nationality:        fieldFrom(data, "nationality", FieldTypeString),
+		BirthDate:          fieldFrom(data, "birth_date", FieldTypeDate),
+		Gender:             fieldFrom(data, "gender", FieldTypeEnum),
+		StatusOfResidence:  fieldFrom(data, "status_of_residence", FieldTypeString),
+		PeriodOfStay:       fieldFrom(data, "period_of_stay", FieldTypeString),
+		PeriodOfStayExpiry: fieldFrom(data, "period_of_stay_expiry", FieldTypeDate),
+		WorkRestriction:    fieldFrom(data, "work_restriction", FieldTypeEnum),
+		Address:            fieldFrom(data, "address", FieldTypeString),
+		CardNumber:         fieldFrom(data, "card_number", FieldTypeString),
+	}
+}
+
+// FieldMap returns the residence card fields keyed by their flat field name
+func (d *ResidenceCardResult) FieldMap() map[string]*Field {
+	return map[string]*Field{
+		"name":                  d.Name,
+		"nationality":           d.Nationality,
+		"birth_date":            d.BirthDate,
+		"gender":                d.Gender,
+		"status_of_residence":   d.StatusOfResidence,
+		"period_of_stay":        d.PeriodOfStay,
+		"period_of_stay_expiry": d.PeriodOfStayExpiry,
+		"work_restriction":      d.WorkRestriction,
+		"address":               d.Address,
+		"card_number":           d.CardNumber,
+	}
+}
+
+// Flatten returns the residence card fields as a flat key/value map
+func (d *ResidenceCardResult) Flatten() map[string]string {
+	return flattenFields(d.FieldMap())
+}
+
+// Health insurance certificate variants
+const (
+	HealthInsuranceVariantCard  = "card"  // ID-1 plastic card
+	HealthInsuranceVariantPaper = "paper" // Paper certificate of no fixed size
+)
+
+// HealthInsuranceCardResult holds the fields extracted from a health insurance
+// certificate (健康保険被保険者証), issued as a card or on paper
+type HealthInsuranceCardResult struct {
+	Name          *Field `json:"name"`
+	BirthDate     *Field `json:"birth_date"`
+	Gender        *Field `json:"gender"`
+	InsurerNumber *Field `json:"insurer_number"` // 保険者番号
+	Symbol        *Field `json:"symbol"`         // 記号
+	Number        *Field `json:"number"`         // 番号
+	BranchNumber  *Field `json:"branch_number"`  // 枝番, printed since 2021
+	IssueDate     *Field `json:"issue_date"`
+	InsurerName   *Field `json:"insurer_name"`
+	Variant       *Field `json:"variant"` // HealthInsuranceVariantCard or HealthInsuranceVariantPaper
+}
+
+// newHealthInsuranceCardResult builds a typed health insurance result from extracted data
+func newHealthInsuranceCardResult(data map[string]string) *HealthInsuranceCardResult {
+	return &HealthInsuranceCardResult{
+		Name:          fieldFrom(data, "name", FieldTypeString),
+		BirthDate:     fieldFrom(data, "birth_date", FieldTypeDate),
+		Gender:        fieldFrom(data, "gender", FieldTypeEnum),
+		InsurerNumber: fieldFrom(data, "insurer_number", FieldTypeNumber),
+		Symbol:        fieldFrom(data, "symbol", FieldTypeString),
+		Number:        fieldFrom(data, "number", FieldTypeString),
+		BranchNumber:  fieldFrom(data, "branch_number", FieldTypeNumber),
+		IssueDate:     fieldFrom(data, "issue_date", FieldTypeDate),
+		InsurerName:   fieldFrom(data, "insurer_name", FieldTypeString),
+		Variant:       fieldFrom(data, "variant", FieldTypeEnum),
+	}
+}
+
+// FieldMap returns the health insurance fields keyed by their flat field name
+func (d *HealthInsuranceCardResult) FieldMap() map[string]*Field {
+	return map[string]*Field{
+		"name":           d.Name,
+		"birth_date":     d.BirthDate,
+		"gender":         d.Gender,
+		"insurer_number": d.InsurerNumber,
+		"symbol":         d.Symbol,
+		"number":         d.Number,
+		"branch_number":  d.BranchNumber,
+		"issue_date":     d.IssueDate,
+		"insurer_name":   d.InsurerName,
+		"variant":        d.Variant,
+	}
+}
+
+// Flatten returns the health insurance fields as a flat key/value map
+func (d *HealthInsuranceCardResult) Flatten() map[string]string {
+	return flattenFields(d.FieldMap())
+}
+
+// PassportResult holds the fields decoded from the machine readable zone (MRZ) of a passport
+type PassportResult struct {
+	DocumentCode   *Field `json:"document_code"`
+	IssuingCountry *Field `json:"issuing_country"`
+	Surname        *Field `json:"surname"`
+	GivenNames     *Field `json:"given_names"`
+	DocumentNumber *Field `json:"document_number"`
+	Nationality    *Field `json:"nationality"`
+	BirthDate      *Field `json:"birth_date"`
+	Sex            *Field `json:"sex"`
+	ExpiryDate     *Field `json:"expiry_date"`
+	PersonalNumber *Field `json:"personal_number"`
+
+	// Verification of every check digit, including the composite one
+	CheckDigits []CheckDigitResult `json:"check_digits"`
+}
+
+// FieldMap returns the passport fields keyed by their flat field name
+func (d *PassportResult) FieldMap() map[string]*Field {
+	return map[string]*Field{
+		"document_code":   d.DocumentCode,
+		"issuing_country": d.IssuingCountry,
+		"surname":         d.Surname,
+		"given_names":     d.GivenNames,
+		"document_number": d.DocumentNumber,
+		"nationality":     d.Nationality,
+		"birth_date":      d.BirthDate,
+		"sex":             d.Sex,
+		"expiry_date":     d.ExpiryDate,
+		"personal_number": d.PersonalNumber,
+	}
+}
+
+// Flatten returns the passport fields as a flat key/value map, with the
+// check digit results as "<name>_check" set to "valid" or "invalid"
+func (d *PassportResult) Flatten() map[string]string {
+	flat := flattenFields(d.FieldMap())
+	for _, check := range d.CheckDigits {
+		status := "invalid"
+		if check.Valid {
+			status = "valid"
+		}
+		flat[check.Name+"_check"] = status
+	}
+	return flat
+}
+
+// CheckDigitResult reports the verification of one MRZ check digit
+type CheckDigitResult struct {
+	Name     string `json:"name"`     // Field the check digit protects, or "composite"
+	Expected string `json:"expected"` // Check digit computed from the data
+	Actual   string `json:"actual"`   // Check digit printed in the MRZ
+	Valid    bool   `json:"valid"`
+}
+
+// fieldFrom returns the named value from extracted data as a typed Field,
+// or nil when the value was not extracted
+func fieldFrom(data map[string]string, key string, fieldType FieldType) *Field {
+	value, exists := data[key]
+	if !exists {
+		return nil
+	}
+	return &Field{Value: value, Type: fieldType}
+}
+
+// flattenFields converts named fields to a flat map, skipping missing ones
+func flattenFields(fields map[string]*Field) map[string]string {
+	flat := make(map[string]string, len(fields))
+	for key, field := range fields {
+		if field != nil {
+			flat[key] = field.Value
+		}
+	}
+	return flat
+}
+
+// fieldPointerType is the type of the document fields of result structs
+var fieldPointerType = reflect.TypeOf((*Field)(nil))
+
+// RemoveField removes the field with the given flat name from doc, which is
+// then reported as not found
+func RemoveField(doc Document, name string) {
+	v := reflect.ValueOf(doc)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if tag == name && v.Field(i).Type() == fieldPointerType {
+			v.Field(i).SetZero()
+			return
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package redact masks, hashes or removes personal data in extraction
+// results before they are returned to a client, following a policy that
+// names the fields to redact per document type.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"ocr-web-api/parser"
+	"strings"
+	"unicode"
+)
+
+// Mode is how a field is redacted
+type Mode string
+
+// Redaction modes, from the least to the most strict
+const (
+	ModeNone     Mode = "none"     // Return the value as extracted
+	ModeMask     Mode = "mask"     // Replace all but the last characters with *, e.g. ****-****-9012
+	ModeHash     Mode = "hash"     // Replace the value with a keyed hash, so that values can be matched
+	ModePresence Mode = "presence" // Only report that the field was found and whether it was valid
+	ModeDrop     Mode = "drop"     // Remove the field, as if it had not been found
+)
+
+// strictness orders the modes; the stricter mode wins when policies are merged
+var strictness = map[Mode]int{
+	ModeNone:     0,
+	ModeMask:     1,
+	ModeHash:     2,
+	ModePresence: 3,
+	ModeDrop:     4,
+}
+
+// HashPrefix starts every hashed value
+const HashPrefix = "hmac-sha256:"
+
+// maskKeep is the number of trailing characters mask leaves visible, for
+// values with at least twice as many maskable characters
+const maskKeep = 4
+
+// Wildcard is the document type of rules that apply to every document type
+const Wildcard = "*"
+
+// Policy maps fields to the mode they are redacted with. Keys are
+// "<document type>.<field>" or "*.<field>", where a rule for the document
+// type takes precedence over a wildcard rule for the same field.
+type Policy map[string]Mode
+
+// Rule is a single entry of a policy
+type Rule struct {
+	DocumentType string // Document type, or Wildcard
+	Field        string // Flat field name
+	Mode         Mode
+}
+
+// Parse parses a policy of comma separated rules such as
+// "individual_number_card_jp.individual_number:mask,birth_date:presence",
+// where a rule without a document type applies to every document type
+func Parse(spec string) (Policy, error) {
+	policy := make(Policy)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		target, mode, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("redaction rule %q: expected <field>:<mode>", entry)
+		}
+		if _, ok := strictness[Mode(mode)]; !ok {
+			return nil, fmt.Errorf("redaction rule %q: unknown mode %q", entry, mode)
+		}
+		documentType, field, ok := strings.Cut(target, ".")
+		if !ok {
+			documentType, field = Wildcard, target
+		}
+		if documentType == "" || field == "" {
+			return nil, fmt.Errorf("redaction rule %q: document type and field must not be empty", entry)
+		}
+		policy[documentType+"."+field] = Mode(mode)
+	}
+	return policy, nil
+}
+
+// Rules returns the rules of the policy
+func (p Policy) Rules() []Rule {
+	rules := make([]Rule, 0, len(p))
+	for key, mode := range p {
+		documentType, field, _ := strings.Cut(key, ".")
+		rules = append(rules, Rule{DocumentType: documentType, Field: field, Mode: mode})
+	}
+	return rules
+}
+
+// Mode returns the mode a field of a document type is redacted with
+func (p Policy) Mode(documentType, field string) Mode {
+	if mode, ok := p[documentType+"."+field]; ok {
+		return mode
+	}
+	if mode, ok := p[Wildcard+"."+field]; ok {
+		return mode
+	}
+	return ModeNone
+}
+
+// Uses reports whether any rule of the policy uses mode
+func (p Policy) Uses(mode Mode) bool {
+	for _, m := range p {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns a policy that redacts every field with the strictest mode
+// any of the policies redacts it with
+func Merge(policies ...Policy) Policy {
+	merged := make(Policy)
+	for _, p := range policies {
+		for key := range p {
+			merged[key] = ModeNone
+		}
+	}
+	for key := range merged {
+		documentType, field, _ := strings.Cut(key, ".")
+		for _, p := range policies {
+			mode := p[key]
+			if documentType != Wildcard {
+				mode = p.Mode(documentType, field)
+			}
+			merged[key] = Stricter(merged[key], mode)
+		}
+	}
+	return merged
+}
+
+// Stricter returns the stricter of two modes
+func Stricter(a, b Mode) Mode {
+	if strictness[b] > strictness[a] {
+		return b
+	}
+	return a
+}
+
+// Redactor applies a policy to extraction results
+type Redactor struct {
+	hashKey []byte
+}
+
+// NewRedactor creates a redactor that hashes values with the given key.
+// Without a key, policies that hash values cannot be applied.
+func NewRedactor(hashKey []byte) *Redactor {
+	return &Redactor{hashKey: hashKey}
+}
+
+// CanHash reports whether the redactor has a key to hash values with
+func (r *Redactor) CanHash() bool {
+	return len(r.hashKey) > 0
+}
+
+// Document redacts the fields of a typed document of the given type in place,
+// including the change records of a driver's license
+func (r *Redactor) Document(policy Policy, documentType string, doc parser.Document) {
+	for name, field := range doc.FieldMap() {
+		mode := fieldMode(policy, documentType, name)
+		switch {
+		case field == nil || mode == ModeNone:
+		case mode == ModeDrop:
+			parser.RemoveField(doc, name)
+		default:
+			r.field(field, mode)
+		}
+	}
+	if license, ok := doc.(*parser.DriversLicenseResult); ok {
+		license.Changes = r.changes(policy, documentType, license.Changes)
+	}
+}
+
+// changes redacts the change records of a driver's license with the mode of
+// the field each record changes. The text and stamp repeat or hint at the
+// new value, so they are redacted as well. Dropped records are removed.
+func (r *Redactor) changes(policy Policy, documentType string, records []parser.LicenseChangeRecord) []parser.LicenseChangeRecord {
+	kept := records[:0]
+	for _, record := range records {
+		switch mode := policy.Mode(documentType, record.SourceField()); mode {
+		case ModeNone:
+		case ModeDrop:
+			continue
+		default:
+			if record.Value != nil {
+				r.field(record.Value, mode)
+			}
+			record.Text = r.value(record.Text, mode)
+			record.Stamp = "" // Names the prefecture of the address
+		}
+		kept = append(kept, record)
+	}
+	return kept
+}
+
+// Flat redacts the fields of a flat result of the given type in place
+func (r *Redactor) Flat(policy Policy, documentType string, data map[string]string) {
+	for name, value := range data {
+		switch mode := fieldMode(policy, documentType, name); mode {
+		case ModeNone:
+		case ModeDrop:
+			delete(data, name)
+		default:
+			data[name] = r.value(value, mode)
+		}
+	}
+}
+
+// fieldMode returns the mode a field is redacted with: the stricter of its
+// own mode and that of the field it is derived from, if any
+func fieldMode(policy Policy, documentType, name string) Mode {
+	mode := policy.Mode(documentType, name)
+	if source := parser.SourceField(documentType, name); source != "" {
+		mode = Stricter(mode, policy.Mode(documentType, source))
+	}
+	return mode
+}
+
+// field redacts a typed field. The validation result is kept, but anything
+// that may repeat the value, such as the reason validation failed, is cleared.
+func (r *Redactor) field(f *parser.Field, mode Mode) {
+	f.Value = r.value(f.Value, mode)
+	f.Normalized = ""
+	f.Original = ""
+	f.Error = ""
+	f.Redaction = string(mode)
+}
+
+// value returns the redacted form of a value
+func (r *Redactor) value(value string, mode Mode) string {
+	switch mode {
+	case ModeMask:
+		return mask(value)
+	case ModeHash:
+		return r.hash(value)
+	default:
+		return ""
+	}
+}
+
+// hash returns the keyed hash of a value. Spaces and hyphens are ignored, so
+// that the same number hashes the same however it was printed.
+func (r *Redactor) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(strings.Map(func(c rune) rune {
+		if isSeparator(c) {
+			return -1
+		}
+		return c
+	}, value)))
+	return HashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// mask replaces every character but separators with *, leaving the last
+// maskKeep characters visible when at most half of the value is revealed
+func mask(value string) string {
+	runes := []rune(value)
+	maskable := 0
+	for _, c := range runes {
+		if !isSeparator(c) {
+			maskable++
+		}
+	}
+
+	keep := 0
+	if maskable >= 2*maskKeep {
+		keep = maskKeep
+	}
+	for i := len(runes) - 1; i >= 0; i-- {
+		if isSeparator(runes[i]) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// isSeparator reports characters that mask and hash leave out, such as the
+// hyphens between the groups of a number
+func isSeparator(c rune) bool {
+	return c == '-' || c == '/' || unicode.IsSpace(c)
+}
@@ -0,0 +1,206 @@
+package redact
+
+import (
+	"encoding/json"
+	"ocr-web-api/parser"
+	"strings"
+	"testing"
+)
+
+// TestParse tests parsing of policies and the precedence of their rules
+func TestParse(t *testing.T) {
+	policy, err := Parse(" individual_number_card_jp.individual_number:mask, birth_date:presence ,passport.birth_date:none")
+	if err != nil {
+		t.Fatalf("Failed to parse policy: %v", err)
+	}
+
+	tests := []struct {
+		documentType string
+		field        string
+		expected     Mode
+	}{
+		{"individual_number_card_jp", "individual_number", ModeMask},
+		{"individual_number_card_jp", "birth_date", ModePresence},
+		{"passport", "birth_date", ModeNone},
+		{"passport", "surname", ModeNone},
+	}
+	for _, tt := range tests {
+		if mode := policy.Mode(tt.documentType, tt.field); mode != tt.expected {
+			t.Errorf("Mode(%s, %s) = %q, expected %q", tt.documentType, tt.field, mode, tt.expected)
+		}
+	}
+
+	for _, spec := range []string{"individual_number", "name:blur", ".name:mask", "passport.:drop"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected error for policy %q", spec)
+		}
+	}
+}
+
+// TestMerge tests that merged policies redact every field with the strictest mode
+func TestMerge(t *testing.T) {
+	server, _ := Parse("individual_number_card_jp.individual_number:hash,name:mask")
+	request, _ := Parse("individual_number:mask,passport.surname:drop,address:presence")
+	merged := Merge(server, request)
+
+	tests := []struct {
+		documentType string
+		field        string
+		expected     Mode
+	}{
+		{"individual_number_card_jp", "individual_number", ModeHash},
+		{"drivers_license_jp", "individual_number", ModeMask},
+		{"passport", "surname", ModeDrop},
+		{"passport", "given_names", ModeNone},
+		{"residence_card_jp", "name", ModeMask},
+		{"residence_card_jp", "address", ModePresence},
+	}
+	for _, tt := range tests {
+		if mode := merged.Mode(tt.documentType, tt.field); mode != tt.expected {
+			t.Errorf("Mode(%s, %s) = %q, expected %q", tt.documentType, tt.field, mode, tt.expected)
+		}
+	}
+}
+
+// TestRedactor tests each mode on typed and flat results
+func TestRedactor(t *testing.T) {
+	policy, _ := Parse("individual_number:mask,name:hash,birth_date:presence,address:drop")
+	redactor := NewRedactor([]byte("secret"))
+	valid := true
+
+	doc := &parser.IndividualNumberCardResult{
+		Name:             &parser.Field{Value: "山田 太郎", Type: parser.FieldTypeString},
+		Address:          &parser.Field{Value: "東京都千代田区", Type: parser.FieldTypeString},
+		BirthDate:        &parser.Field{Value: "平成2年1月1日", Normalized: "1990-01-01", Type: parser.FieldTypeDate, Valid: &valid},
+		IndividualNumber: &parser.Field{Value: "1234-5678-9012", Original: "1234-5678-90l2", Corrected: true, Type: parser.FieldTypeNumber},
+		Gender:           &parser.Field{Value: "男", Type: parser.FieldTypeEnum},
+	}
+	redactor.Document(policy, parser.DocumentTypeIndividualNumberCard, doc)
+
+	if doc.IndividualNumber.Value != "****-****-9012" || doc.IndividualNumber.Original != "" || doc.IndividualNumber.Redaction != "mask" {
+		t.Errorf("Expected masked individual number, got %+v", doc.IndividualNumber)
+	}
+	if !strings.HasPrefix(doc.Name.Value, HashPrefix) || doc.Name.Value != redactor.hash("山田太郎") {
+		t.Errorf("Expected hashed name, got %+v", doc.Name)
+	}
+	if doc.BirthDate.Value != "" || doc.BirthDate.Normalized != "" || doc.BirthDate.Valid == nil || !*doc.BirthDate.Valid {
+		t.Errorf("Expected birth date reduced to its presence and validity, got %+v", doc.BirthDate)
+	}
+	if doc.Address != nil {
+		t.Errorf("Expected address to be dropped, got %+v", doc.Address)
+	}
+	if doc.Gender.Value != "男" || doc.Gender.Redaction != "" {
+		t.Errorf("Expected gender to be kept, got %+v", doc.Gender)
+	}
+
+	flat := map[string]string{
+		"name":              "山田 太郎",
+		"address":           "東京都千代田区",
+		"birth_date":        "平成2年1月1日",
+		"individual_number": "123456789012",
+		"gender":            "男",
+	}
+	redactor.Flat(policy, parser.DocumentTypeIndividualNumberCard, flat)
+	expected := map[string]string{
+		"name":              doc.Name.Value,
+		"birth_date":        "",
+		"individual_number": "********9012",
+		"gender":            "男",
+	}
+	if len(flat) != len(expected) {
+		t.Errorf("Expected flat result %v, got %v", expected, flat)
+	}
+	for name, value := range expected {
+		if flat[name] != value {
+			t.Errorf("Expected flat %s %q, got %q", name, value, flat[name])
+		}
+	}
+}
+
+// TestRedactorDerivedFields tests that fields copied or decoded from a
+// redacted field, and the change records of the back, are redacted with it
+func TestRedactorDerivedFields(t *testing.T) {
+	newLicense := func() *parser.DriversLicenseResult {
+		return &parser.DriversLicenseResult{
+			Name:              &parser.Field{Value: "山田太郎", Type: parser.FieldTypeString},
+			Address:           &parser.Field{Value: "東京都千代田区霞が関1-1", Type: parser.FieldTypeString},
+			LicenseNumber:     &parser.Field{Value: "301234567890", Type: parser.FieldTypeNumber},
+			Municipality:      &parser.Field{Value: "大阪府大阪市", Type: parser.FieldTypeString},
+			IssuingPrefecture: &parser.Field{Value: "東京", Type: parser.FieldTypeString},
+			FirstLicenseYear:  &parser.Field{Value: "2012", Type: parser.FieldTypeNumber},
+			ReissueCount:      &parser.Field{Value: "0", Type: parser.FieldTypeNumber},
+			CurrentAddress:    &parser.Field{Value: "大阪府大阪市中央区大手前2-1", Type: parser.FieldTypeString},
+			Changes: []parser.LicenseChangeRecord{
+				{
+					Date:  &parser.Field{Value: "令和5年4月1日", Type: parser.FieldTypeDate},
+					Kind:  parser.LicenseChangeAddress,
+					Value: &parser.Field{Value: "大阪府大阪市中央区大手前2-1", Type: parser.FieldTypeString},
+					Stamp: "大阪府公安委員会",
+					Text:  "令和5年4月1日 住所 大阪府大阪市中央区大手前2-1 大阪府公安委員会",
+				},
+				{
+					Date:  &parser.Field{Value: "令和6年1月5日", Type: parser.FieldTypeDate},
+					Kind:  parser.LicenseChangeName,
+					Value: &parser.Field{Value: "佐藤太郎", Type: parser.FieldTypeString},
+					Text:  "令和6年1月5日 氏名 佐藤太郎",
+				},
+			},
+		}
+	}
+	redactor := NewRedactor(nil)
+
+	for _, mode := range []Mode{ModeMask, ModePresence, ModeDrop} {
+		policy, _ := Parse("drivers_license_jp.address:" + string(mode))
+		doc := newLicense()
+		redactor.Document(policy, parser.DocumentTypeDriversLicenseJP, doc)
+		data, _ := json.Marshal(doc)
+		for _, text := range []string{"東京都", "千代田", "大阪", "大手前", "公安委員会"} {
+			if strings.Contains(string(data), text) {
+				t.Errorf("Expected no address text with address:%s, found %q in %s", mode, text, data)
+			}
+		}
+		if doc.Name.Value != "山田太郎" || len(doc.Changes) == 0 || doc.Changes[len(doc.Changes)-1].Value.Value != "佐藤太郎" {
+			t.Errorf("Expected name and name change to be kept with address:%s, got %s", mode, data)
+		}
+
+		flat := newLicense().Flatten()
+		redactor.Flat(policy, parser.DocumentTypeDriversLicenseJP, flat)
+		for _, name := range []string{"address", "current_address", "municipality"} {
+			if value, ok := flat[name]; (mode == ModeDrop && ok) || strings.Contains(value, "大阪") {
+				t.Errorf("Expected flat %s to be redacted with address:%s, got %q", name, mode, value)
+			}
+		}
+	}
+
+	policy, _ := Parse("drivers_license_jp.license_number:mask,name:drop")
+	doc := newLicense()
+	redactor.Document(policy, parser.DocumentTypeDriversLicenseJP, doc)
+	for name, field := range map[string]*parser.Field{
+		"issuing_prefecture": doc.IssuingPrefecture,
+		"first_license_year": doc.FirstLicenseYear,
+		"reissue_count":      doc.ReissueCount,
+	} {
+		if field.Redaction != string(ModeMask) || strings.ContainsAny(field.Value, "東京0123456789") {
+			t.Errorf("Expected %s decoded from the license number to be masked, got %+v", name, field)
+		}
+	}
+	if len(doc.Changes) != 1 || doc.Changes[0].Kind != parser.LicenseChangeAddress {
+		t.Errorf("Expected the name change to be dropped with the name, got %+v", doc.Changes)
+	}
+}
+
+// TestMask tests that short values are masked completely
+func TestMask(t *testing.T) {
+	tests := map[string]string{
+		"1234-5678-9012": "****-****-9012",
+		"AB1234567":      "*****4567",
+		"1234567":        "*******",
+		"山田 太郎":          "** **",
+		"":               "",
+	}
+	for value, expected := range tests {
+		if masked := mask(value); masked != expected {
+			t.Errorf("mask(%q) = %q, expected %q", value, masked, expected)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"ocr-web-api/auth"
+	"ocr-web-api/parser"
+	"ocr-web-api/redact"
+	"os"
+)
+
+// getRedactionFromEnv reads the server redaction policy from REDACTION_POLICY
+// and the key of hashed values from REDACTION_HASH_KEY. An invalid policy is
+// an error rather than a warning, since ignoring it would expose the fields
+// it was meant to protect.
+func getRedactionFromEnv() (redact.Policy, *redact.Redactor, error) {
+	redactor := redact.NewRedactor([]byte(os.Getenv("REDACTION_HASH_KEY")))
+
+	spec := os.Getenv("REDACTION_POLICY")
+	policy, err := parseRedactionPolicy(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid REDACTION_POLICY: %w", err)
+	}
+	if policy.Uses(redact.ModeHash) && !redactor.CanHash() {
+		return nil, nil, fmt.Errorf("REDACTION_POLICY hashes fields but REDACTION_HASH_KEY is not set")
+	}
+
+	if len(policy) > 0 {
+		AppLogger.Info("Redacting response fields", "policy", spec)
+	}
+	return policy, redactor, nil
+}
+
+// parseRedactionPolicy parses a redaction policy and checks that its rules
+// name supported document types and fields, so that a misspelled field is
+// not left unredacted
+func parseRedactionPolicy(spec string) (redact.Policy, error) {
+	policy, err := redact.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range policy.Rules() {
+		if !isRedactableField(rule.DocumentType, rule.Field) {
+			return nil, fmt.Errorf("unknown field %s of document type %s", rule.Field, rule.DocumentType)
+		}
+	}
+	return policy, nil
+}
+
+// redactableDocumentTypes are the document types whose fields policies can name
+var redactableDocumentTypes = []string{
+	DocumentTypeDriversLicenseJP,
+	DocumentTypeIndividualNumberCard,
+	DocumentTypeResidenceCardJP,
+	DocumentTypePassport,
+	DocumentTypeHealthInsuranceCard,
+}
+
+// isRedactableField reports whether the document type, or any document type
+// for redact.Wildcard, has a field with the given name
+func isRedactableField(documentType, field string) bool {
+	for _, candidate := range redactableDocumentTypes {
+		if documentType != redact.Wildcard && documentType != candidate {
+			continue
+		}
+		doc, _ := parser.NewDocument(candidate)
+		if _, ok := doc.FieldMap()[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRedaction checks the redact option of a request
+func validateRedaction(spec string) *APIError {
+	if _, err := parseRedactionPolicy(spec); err != nil {
+		return invalidRedactionError(err)
+	}
+	return nil
+}
+
+// invalidRedactionError reports a redact option that cannot be parsed
+func invalidRedactionError(err error) *APIError {
+	return newAPIError(http.StatusBadRequest, ErrCodeInvalidField, "invalid redact: "+err.Error(),
+		ErrorDetail{Field: "redact", Reason: ReasonInvalid})
+}
+
+// redactionPolicy returns the policy for a request: the server policy,
+// made stricter by the policy of the API key of ctx and the redact option
+// of the request
+func (h *OCRHandler) redactionPolicy(ctx context.Context, req *OCRRequest) (redact.Policy, error) {
+	policies := []redact.Policy{h.redaction}
+	if key, ok := auth.FromContext(ctx); ok && key.Redact != "" {
+		// Key policies are validated when the keys file is loaded
+		policy, _ := parseRedactionPolicy(key.Redact)
+		policies = append(policies, policy)
+	}
+	if req.Redact == "" {
+		return redact.Merge(policies...), nil
+	}
+
+	requested, err := parseRedactionPolicy(req.Redact)
+	if err != nil {
+		return nil, invalidRedactionError(err)
+	}
+	if requested.Uses(redact.ModeHash) && !h.redactor.CanHash() {
+		return nil, newAPIError(http.StatusUnprocessableEntity, ErrCodeInvalidField, "hash redaction is not enabled on this server",
+			ErrorDetail{Field: "redact", Reason: ReasonUnsupported})
+	}
+	return redact.Merge(append(policies, requested)...), nil
+}
+
+// redactResponse redacts the fields of a response following policy
+func (h *OCRHandler) redactResponse(policy redact.Policy, response *OCRResponse) {
+	if len(policy) == 0 {
+		return
+	}
+	if response.Fields != nil {
+		h.redactor.Document(policy, response.DocumentType, response.Fields)
+	}
+	if response.Data != nil {
+		h.redactor.Flat(policy, response.DocumentType, response.Data)
+	}
+}
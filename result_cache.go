@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ocr-web-api/cache"
+	"ocr-web-api/parser"
+	"os"
+	"strings"
+	"time"
+)
+
+// Result cache backends selected with the RESULT_CACHE environment variable
+const (
+	ResultCacheMemory = "memory"
+	ResultCacheDisk   = "disk"
+	ResultCacheOff    = "off"
+)
+
+// resultCacheVersion is part of every result cache key. Bump it when a
+// change to the parsers makes earlier results stale.
+const resultCacheVersion = "1"
+
+// Defaults of the result cache settings
+const (
+	defaultResultCacheTTL        = 15 * time.Minute
+	defaultResultCacheMaxEntries = 1000
+	defaultResultCacheMaxMB      = 64
+)
+
+// getResultCacheFromEnv creates the result cache selected by RESULT_CACHE,
+// or returns nil when caching is off. The disk cache keeps its files in
+// RESULT_CACHE_DIR, encrypted with RESULT_CACHE_KEY; when it has no key or
+// cannot be opened the memory cache is used.
+func getResultCacheFromEnv() cache.Cache {
+	ttl := getDurationFromEnv("RESULT_CACHE_TTL", defaultResultCacheTTL)
+	maxEntries := getPositiveIntFromEnv("RESULT_CACHE_MAX_ENTRIES", defaultResultCacheMaxEntries)
+	maxBytes := int64(getPositiveIntFromEnv("RESULT_CACHE_MAX_MB", defaultResultCacheMaxMB)) << 20
+
+	switch backend := os.Getenv("RESULT_CACHE"); backend {
+	case "", ResultCacheMemory:
+		return cache.NewMemory(ttl, maxEntries, maxBytes)
+	case ResultCacheOff:
+		AppLogger.Info("Result cache disabled")
+		return nil
+	case ResultCacheDisk:
+		dir := os.Getenv("RESULT_CACHE_DIR")
+		if dir == "" {
+			dir = "data/cache"
+		}
+		disk, err := cache.NewDisk(dir, os.Getenv("RESULT_CACHE_KEY"), ttl, maxEntries, maxBytes)
+		if err != nil {
+			AppLogger.Warn("Failed to open result cache, using memory cache", "dir", dir, "error", err)
+			return cache.NewMemory(ttl, maxEntries, maxBytes)
+		}
+		AppLogger.Info("Using disk result cache", "dir", dir)
+		return disk
+	default:
+		AppLogger.Warn("Invalid RESULT_CACHE, using "+ResultCacheMemory+" cache", "value", backend)
+		return cache.NewMemory(ttl, maxEntries, maxBytes)
+	}
+}
+
+// resultCacheConfig returns the part of the cache keys that describes how
+// results are produced: the cache and result schema versions, the
+// preprocessing pipeline and the OCR engine
+func resultCacheConfig(pipeline, engine string) string {
+	return strings.Join([]string{resultCacheVersion, parser.SchemaVersion, pipeline, engine}, "|")
+}
+
+// resultCacheKey returns the cache key of a request. The images are decoded
+// into the request first, so the key depends on the image content rather
+// than its encoding and processing does not decode them again. It returns
+// false when an image cannot be decoded; processing reports that error.
+func (h *OCRHandler) resultCacheKey(ctx context.Context, req *OCRRequest) (string, bool) {
+	image, err := h.decodeImage(ctx, req.Image, req.imageData)
+	if err != nil {
+		return "", false
+	}
+	req.imageData = image
+
+	var back []byte
+	if req.BackImage != "" || req.backImageData != nil {
+		back, err = h.decodeImage(ctx, req.BackImage, req.backImageData)
+		if err != nil {
+			return "", false
+		}
+		req.backImageData = back
+	}
+
+	return cache.Key(h.cacheConfig, image, back, []byte(req.DocumentType), []byte(req.Format)), true
+}
+
+// cachedResponse returns the cached response under key, or nil when there is none
+func (h *OCRHandler) cachedResponse(ctx context.Context, key string) *OCRResponse {
+	data, err := h.resultCache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrMiss) {
+			AppLogger.WarnContext(ctx, "Failed to read result cache", "error", err)
+		}
+		return nil
+	}
+
+	var response OCRResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		AppLogger.WarnContext(ctx, "Ignoring unreadable result cache entry", "error", err)
+		return nil
+	}
+	response.Cached = true
+	return &response
+}
+
+// storeResponse caches a successful response under key
+func (h *OCRHandler) storeResponse(ctx context.Context, key string, response *OCRResponse) {
+	data, err := json.Marshal(response)
+	if err == nil {
+		err = h.resultCache.Set(ctx, key, data)
+	}
+	if err != nil {
+		AppLogger.WarnContext(ctx, "Failed to write result cache", "error", err)
+	}
+}
+
+// cacheStatus returns the X-Cache header value of a response
+func cacheStatus(cached bool) string {
+	if cached {
+		return "HIT"
+	}
+	return "MISS"
+}
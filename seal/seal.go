@@ -0,0 +1,67 @@
+// Package seal encrypts the files the service keeps on disk, such as cached
+// results and queued jobs, which hold personal data and document images.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// ErrNoKey is returned when a box is created without a secret
+var ErrNoKey = errors.New("encryption key is not set")
+
+// Box encrypts data with AES-256-GCM under a key derived from a secret.
+// Sealed data is bound to a label, such as the name of its file, so that it
+// cannot be moved to another file without failing to open.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a box whose key is derived from secret, which must not be empty
+func New(secret string) (*Box, error) {
+	if secret == "" {
+		return nil, ErrNoKey
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Overhead is the number of bytes sealing adds to the data
+func (b *Box) Overhead() int {
+	return b.aead.NonceSize() + b.aead.Overhead()
+}
+
+// Seal encrypts data for label as a random nonce followed by the ciphertext
+func (b *Box) Seal(label string, data []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.Overhead()+len(data))
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %w", err)
+	}
+	return b.aead.Seal(nonce, nonce, data, []byte(label)), nil
+}
+
+// Open decrypts data sealed for label. It fails for data sealed with another
+// key or label, and for data that was changed or is not sealed at all.
+func (b *Box) Open(label string, sealed []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, errors.New("sealed data is truncated")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	data, err := b.aead.Open(nil, nonce, ciphertext, []byte(label))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,39 @@
+package seal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestBox tests that sealed data opens only with the same key and label
+func TestBox(t *testing.T) {
+	if _, err := New(""); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey without a secret, got %v", err)
+	}
+
+	box, _ := New("secret")
+	data := []byte("1234-5678-9012")
+	sealed, err := box.Seal("a.json", data)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if bytes.Contains(sealed, data) || len(sealed) != len(data)+box.Overhead() {
+		t.Errorf("Expected %d encrypted bytes, got %q", len(data)+box.Overhead(), sealed)
+	}
+	if opened, err := box.Open("a.json", sealed); err != nil || !bytes.Equal(opened, data) {
+		t.Errorf("Expected sealed data to open, got %q (%v)", opened, err)
+	}
+
+	other, _ := New("other")
+	for name, open := range map[string]func() ([]byte, error){
+		"other key":   func() ([]byte, error) { return other.Open("a.json", sealed) },
+		"other label": func() ([]byte, error) { return box.Open("b.json", sealed) },
+		"plaintext":   func() ([]byte, error) { return box.Open("a.json", data) },
+		"truncated":   func() ([]byte, error) { return box.Open("a.json", sealed[:4]) },
+	} {
+		if _, err := open(); err == nil {
+			t.Errorf("Expected %s to fail to open", name)
+		}
+	}
+}
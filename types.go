@@ -2,27 +2,133 @@ package main
 
 import (
 	"encoding/base64"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"ocr-web-api/parser"
 	"strings"
 )
 
 // OCRRequest represents the incoming request structure for OCR processing
 type OCRRequest struct {
-	Image        string `json:"image"`        // Base64 encoded image data
-	DocumentType string `json:"documentType"` // Document type identifier
+	Image        string `json:"image"`               // Base64 encoded image data
+	BackImage    string `json:"backImage,omitempty"` // Optional Base64 encoded image of the back side
+	DocumentType string `json:"documentType"`        // Document type identifier
+	Format       string `json:"format,omitempty"`    // Response format ("flat" or "typed"), defaults to flat
+	Redact       string `json:"redact,omitempty"`    // Fields to redact in the response, such as "individual_number:mask"
+
+	// Image data of multipart and raw uploads, which is not base64 encoded
+	imageData     []byte
+	backImageData []byte
 }
 
-// OCRResponse represents the response structure after OCR processing
+// OCRResponse represents the response structure after OCR processing.
+// Flat responses, the default, only carry Data, while typed responses carry
+// SchemaVersion and Fields.
 type OCRResponse struct {
-	DocumentType string            `json:"documentType"` // Document type that was processed
-	Data         map[string]string `json:"data"`         // Extracted field data
+	SchemaVersion string            `json:"schemaVersion,omitempty"` // Version of the typed result schema
+	DocumentType  string            `json:"documentType"`            // Document type that was processed
+	Fields        parser.Document   `json:"fields,omitempty"`        // Typed extracted fields
+	Data          map[string]string `json:"data,omitempty"`          // Extracted field data (flat format)
+
+	// Ranked document type candidates, present when documentType was "auto"
+	Classification []parser.Classification `json:"classification,omitempty"`
+
+	// Whether the response was served from the result cache
+	Cached bool `json:"cached,omitempty"`
+}
+
+// UnmarshalJSON decodes a response, including the typed fields, whose
+// struct depends on the document type
+func (r *OCRResponse) UnmarshalJSON(data []byte) error {
+	type plain OCRResponse
+	var decoded struct {
+		*plain
+		Fields json.RawMessage `json:"fields,omitempty"`
+	}
+	decoded.plain = (*plain)(r)
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	r.Fields = nil
+	if len(decoded.Fields) == 0 || string(decoded.Fields) == "null" {
+		return nil
+	}
+	fields, err := parser.NewDocument(r.DocumentType)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(decoded.Fields, fields); err != nil {
+		return err
+	}
+	r.Fields = fields
+	return nil
+}
+
+// BatchRequest represents a batch of OCR requests processed together
+type BatchRequest struct {
+	Items  []BatchItem `json:"items"`            // Requests to process
+	Format string      `json:"format,omitempty"` // Response format for items that do not set one
+	Redact string      `json:"redact,omitempty"` // Fields to redact for items that do not set any
+}
+
+// BatchItem is a single OCR request in a batch, identified by a client ID
+type BatchItem struct {
+	ID string `json:"id"` // Client supplied identifier, unique within the batch
+	OCRRequest
+}
+
+// BatchItemResult is the outcome of a single batch item. Exactly one of
+// Result and Error is set; Error has the shape of ErrorResponse.
+type BatchItemResult struct {
+	ID     string       `json:"id"`
+	Result *OCRResponse `json:"result,omitempty"`
+	Error  *APIError    `json:"error,omitempty"`
+}
+
+// BatchResponse holds the results of a batch in the order of its items
+type BatchResponse struct {
+	Results   []BatchItemResult `json:"results"`
+	Succeeded int               `json:"succeeded"` // Number of items with a result
+	Failed    int               `json:"failed"`    // Number of items with an error
+}
+
+// JobRequest represents an OCR request that is processed asynchronously
+type JobRequest struct {
+	OCRRequest
+	CallbackURL string `json:"callbackUrl,omitempty"` // Optional URL notified when the job is done
+}
+
+// ClassifyRequest represents the request structure for document type classification
+type ClassifyRequest struct {
+	Image string `json:"image"` // Base64 encoded image data
+}
+
+// ClassifyResponse represents the ranked document types for an image
+type ClassifyResponse struct {
+	Candidates []parser.Classification `json:"candidates"` // Document types by descending score
 }
 
-// APIError represents error information in API responses
+// APIError represents error information in API responses. It is also the
+// error returned by request validation, so that it reaches the client as is.
 type APIError struct {
-	Code    int    `json:"code"`    // HTTP status code
-	Message string `json:"message"` // Error message
+	Code    string        `json:"code"`              // Machine-readable error code such as IMAGE_TOO_LARGE
+	Status  int           `json:"status"`            // HTTP status code
+	Message string        `json:"message"`           // Human-readable error message
+	Details []ErrorDetail `json:"details,omitempty"` // Fields the error is about
+}
+
+// ErrorDetail names a field that caused an error
+type ErrorDetail struct {
+	Field  string `json:"field"`  // Request or document field name
+	Reason string `json:"reason"` // Why the field failed, e.g. "missing" or "invalid"
+}
+
+// Error returns the error message
+func (e *APIError) Error() string {
+	return e.Message
 }
 
 // ErrorResponse represents the complete error response structure
@@ -34,47 +140,198 @@ type ErrorResponse struct {
 const (
 	DocumentTypeDriversLicenseJP      = "drivers_license_jp"
 	DocumentTypeIndividualNumberCard  = "individual_number_card_jp"
+	DocumentTypeResidenceCardJP       = "residence_card_jp"
+	DocumentTypePassport              = "passport"
+	DocumentTypeHealthInsuranceCard   = "health_insurance_card_jp"
+
+	// DocumentTypeAuto selects the document type by classifying the image
+	DocumentTypeAuto = "auto"
+)
+
+// Supported response formats
+const (
+	ResponseFormatTyped = "typed"
+	ResponseFormatFlat  = "flat"
 )
 
 // Maximum image size in bytes (10MB)
 const MaxImageSize = 10 * 1024 * 1024
 
+// Maximum number of items in a batch request
+const MaxBatchItems = 100
+
 // Validate validates the OCR request data
 func (req *OCRRequest) Validate() error {
 	// Check if required fields are present
-	if strings.TrimSpace(req.Image) == "" {
-		return errors.New("image field is required")
+	if strings.TrimSpace(req.Image) == "" && len(req.imageData) == 0 {
+		return requiredFieldError("image")
 	}
 	
 	if strings.TrimSpace(req.DocumentType) == "" {
-		return errors.New("documentType field is required")
+		return requiredFieldError("documentType")
 	}
 	
 	// Validate document type
 	if !isValidDocumentType(req.DocumentType) {
-		return fmt.Errorf("unsupported document type: %s", req.DocumentType)
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeUnsupportedDocumentType, "unsupported document type: "+req.DocumentType,
+			ErrorDetail{Field: "documentType", Reason: ReasonUnsupported})
 	}
 	
-	// Validate base64 image data
-	if err := validateBase64Image(req.Image); err != nil {
+	// Validate response format
+	if err := validateResponseFormat(req.Format); err != nil {
+		return err
+	}
+
+	// Validate the fields to redact
+	if err := validateRedaction(req.Redact); err != nil {
 		return err
 	}
 	
+	// Validate image data
+	if err := validateImage("image", req.Image, req.imageData); err != nil {
+		return err
+	}
+
+	// The back image is optional but must pass the same checks
+	if req.BackImage != "" || req.backImageData != nil {
+		if err := validateImage("backImage", req.BackImage, req.backImageData); err != nil {
+			err.Message = "backImage: " + err.Message
+			return err
+		}
+	}
+	
 	return nil
 }
 
+// batchTooLargeError reports a batch of more than MaxBatchItems items
+func batchTooLargeError() *APIError {
+	return newAPIError(http.StatusUnprocessableEntity, ErrCodeBatchTooLarge, fmt.Sprintf("batch size exceeds maximum limit of %d items", MaxBatchItems),
+		ErrorDetail{Field: "items", Reason: ReasonTooLarge})
+}
+
+// Validate validates the batch as a whole; items are validated one by one
+// while the batch is processed, so that one bad item does not fail the rest
+func (req *BatchRequest) Validate() error {
+	if len(req.Items) == 0 {
+		return requiredFieldError("items")
+	}
+
+	if len(req.Items) > MaxBatchItems {
+		return batchTooLargeError()
+	}
+
+	if err := validateResponseFormat(req.Format); err != nil {
+		return err
+	}
+
+	if err := validateRedaction(req.Redact); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(req.Items))
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d].id", i)
+		if strings.TrimSpace(item.ID) == "" {
+			return newAPIError(http.StatusBadRequest, ErrCodeRequiredFieldMissing, fmt.Sprintf("items[%d]: id field is required", i),
+				ErrorDetail{Field: field, Reason: ReasonMissing})
+		}
+		if seen[item.ID] {
+			return newAPIError(http.StatusBadRequest, ErrCodeInvalidField, fmt.Sprintf("items[%d]: duplicate id %q", i, item.ID),
+				ErrorDetail{Field: field, Reason: ReasonDuplicate})
+		}
+		seen[item.ID] = true
+	}
+
+	return nil
+}
+
+// Validate validates the job request data
+func (req *JobRequest) Validate() error {
+	if err := req.OCRRequest.Validate(); err != nil {
+		return err
+	}
+
+	if req.CallbackURL != "" {
+		callbackURL, err := url.Parse(req.CallbackURL)
+		if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+			return newAPIError(http.StatusBadRequest, ErrCodeInvalidField, "invalid callbackUrl: must be an absolute http or https URL",
+				ErrorDetail{Field: "callbackUrl", Reason: ReasonInvalid})
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the classification request data
+func (req *ClassifyRequest) Validate() error {
+	if strings.TrimSpace(req.Image) == "" {
+		return requiredFieldError("image")
+	}
+
+	if err := validateBase64Image("image", req.Image); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateResponseFormat checks that the response format is supported
+func validateResponseFormat(format string) *APIError {
+	if !isValidResponseFormat(format) {
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeUnsupportedFormat, "unsupported response format: "+format,
+			ErrorDetail{Field: "format", Reason: ReasonUnsupported})
+	}
+	return nil
+}
+
+// isValidResponseFormat checks if the response format is supported
+func isValidResponseFormat(format string) bool {
+	switch format {
+	case "", ResponseFormatTyped, ResponseFormatFlat:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewOCRResponse builds the response for a parse result in the requested
+// format. Responses are flat unless the typed format is requested, so that
+// existing clients of the data map keep working.
+func NewOCRResponse(result *parser.Result, format string) *OCRResponse {
+	if format == ResponseFormatTyped {
+		return &OCRResponse{
+			SchemaVersion: result.SchemaVersion,
+			DocumentType:  result.DocumentType,
+			Fields:        result.Fields,
+		}
+	}
+
+	return &OCRResponse{
+		DocumentType: result.DocumentType,
+		Data:         result.Flatten(),
+	}
+}
+
 // isValidDocumentType checks if the document type is supported
 func isValidDocumentType(docType string) bool {
 	switch docType {
-	case DocumentTypeDriversLicenseJP, DocumentTypeIndividualNumberCard:
+	case DocumentTypeDriversLicenseJP, DocumentTypeIndividualNumberCard, DocumentTypeResidenceCardJP, DocumentTypePassport, DocumentTypeHealthInsuranceCard, DocumentTypeAuto:
 		return true
 	default:
 		return false
 	}
 }
 
+// validateImage validates an image that was either uploaded as binary data
+// or sent base64 encoded in the given request field
+func validateImage(field, base64Image string, data []byte) *APIError {
+	if data != nil {
+		return validateImageData(field, data)
+	}
+	return validateBase64Image(field, base64Image)
+}
+
 // validateBase64Image validates the base64 encoded image data
-func validateBase64Image(imageData string) error {
+func validateBase64Image(field, imageData string) *APIError {
 	// Remove data URL prefix if present (e.g., "data:image/jpeg;base64,")
 	if strings.Contains(imageData, ",") {
 		parts := strings.Split(imageData, ",")
@@ -86,17 +343,25 @@ func validateBase64Image(imageData string) error {
 	// Decode base64 data
 	decodedData, err := base64.StdEncoding.DecodeString(imageData)
 	if err != nil {
-		return errors.New("invalid base64 encoding")
+		return newAPIError(http.StatusBadRequest, ErrCodeInvalidBase64, "invalid base64 encoding",
+			ErrorDetail{Field: field, Reason: ReasonInvalid})
 	}
 	
+	return validateImageData(field, decodedData)
+}
+
+// validateImageData checks the size limit and format of decoded image data
+func validateImageData(field string, data []byte) *APIError {
 	// Check image size limit (10MB)
-	if len(decodedData) > MaxImageSize {
-		return fmt.Errorf("image size exceeds maximum limit of %d bytes", MaxImageSize)
+	if len(data) > MaxImageSize {
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeImageTooLarge, fmt.Sprintf("image size exceeds maximum limit of %d bytes", MaxImageSize),
+			ErrorDetail{Field: field, Reason: ReasonTooLarge})
 	}
 	
 	// Check if it's a valid image format (PNG or JPEG)
-	if !isValidImageFormat(decodedData) {
-		return errors.New("unsupported image format, only PNG and JPEG are supported")
+	if !isValidImageFormat(data) {
+		return newAPIError(http.StatusUnprocessableEntity, ErrCodeUnsupportedImageFormat, "unsupported image format, only PNG and JPEG are supported",
+			ErrorDetail{Field: field, Reason: ReasonUnsupported})
 	}
 	
 	return nil
@@ -122,11 +387,6 @@ func isValidImageFormat(data []byte) bool {
 }
 
 // NewErrorResponse creates a new error response
-func NewErrorResponse(code int, message string) ErrorResponse {
-	return ErrorResponse{
-		Error: APIError{
-			Code:    code,
-			Message: message,
-		},
-	}
+func NewErrorResponse(apiErr *APIError) ErrorResponse {
+	return ErrorResponse{Error: *apiErr}
 }
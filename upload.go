@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Content types accepted by the OCR endpoint
+const (
+	contentTypeJSON      = "application/json"
+	contentTypeMultipart = "multipart/form-data"
+	contentTypeJPEG      = "image/jpeg"
+	contentTypePNG       = "image/png"
+)
+
+const (
+	// maxMultipartSize bounds a whole multipart body: both images plus the form fields
+	maxMultipartSize = 2*MaxImageSize + 1<<20
+
+	// maxJSONSize bounds a JSON request: both images as base64 plus the other fields
+	maxJSONSize = 2*((MaxImageSize+2)/3*4) + 1<<20
+
+	// maxBatchSize bounds a whole batch request. It holds a few requests with
+	// images of the maximum size, or MaxBatchItems of typical card photos;
+	// larger sets of images are sent as several batches or as jobs.
+	maxBatchSize = 4 * maxJSONSize
+
+	// maxFormValueSize bounds the text parts of a multipart body
+	maxFormValueSize = 1 << 10
+)
+
+// unsupportedMediaTypeMessage is returned for request bodies in a content
+// type the OCR endpoint does not accept
+const unsupportedMediaTypeMessage = "unsupported content type, use application/json, multipart/form-data, image/jpeg or image/png"
+
+// decodeOCRRequest reads an OCR request from a JSON body with base64 images,
+// a multipart/form-data body or a raw JPEG or PNG body. Multipart and raw
+// uploads may take the document type from the documentType query parameter.
+func decodeOCRRequest(w http.ResponseWriter, r *http.Request) (*OCRRequest, *APIError) {
+	// Clients that send no content type have always been treated as JSON
+	mediaType := contentTypeJSON
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, newAPIError(http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, unsupportedMediaTypeMessage)
+		}
+	}
+
+	var req OCRRequest
+	switch mediaType {
+	case contentTypeJSON:
+		if apiErr := decodeJSONBody(w, r, maxJSONSize, &req); apiErr != nil {
+			return nil, apiErr
+		}
+		return &req, nil
+
+	case contentTypeMultipart:
+		r.Body = http.MaxBytesReader(w, r.Body, maxMultipartSize)
+		if err := readMultipartRequest(r, &req); err != nil {
+			if tooLarge := requestTooLargeError(err, maxMultipartSize); tooLarge != nil {
+				return nil, tooLarge
+			}
+			return nil, newAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid multipart form: "+err.Error())
+		}
+
+	case contentTypeJPEG, contentTypePNG:
+		// Reading one byte past the limit lets validation report oversized images
+		data, err := io.ReadAll(io.LimitReader(r.Body, MaxImageSize+1))
+		if err != nil {
+			return nil, newAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "failed to read image: "+err.Error())
+		}
+		req.imageData = data
+
+	default:
+		return nil, newAPIError(http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, unsupportedMediaTypeMessage)
+	}
+
+	if req.DocumentType == "" {
+		req.DocumentType = r.URL.Query().Get("documentType")
+	}
+	return &req, nil
+}
+
+// readMultipartRequest reads the image, back_image, documentType and format
+// parts of a multipart body. Images are streamed rather than buffered on
+// disk, and unknown parts are skipped.
+func readMultipartRequest(r *http.Request, req *OCRRequest) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch part.FormName() {
+		case "image":
+			req.imageData, err = io.ReadAll(io.LimitReader(part, MaxImageSize+1))
+		case "back_image":
+			req.backImageData, err = io.ReadAll(io.LimitReader(part, MaxImageSize+1))
+		case "documentType":
+			req.DocumentType, err = readFormValue(part)
+		case "format":
+			req.Format, err = readFormValue(part)
+		case "redact":
+			req.Redact, err = readFormValue(part)
+		}
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readFormValue reads a text part of a multipart body
+func readFormValue(r io.Reader) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(r, maxFormValueSize))
+	return string(value), err
+}
+
+// decodeJSONBody decodes a JSON body of at most limit bytes into v
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, limit int64, v any) *APIError {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		if tooLarge := requestTooLargeError(err, limit); tooLarge != nil {
+			return tooLarge
+		}
+		return invalidJSONError(err)
+	}
+	return nil
+}
+
+// requestTooLargeError reports a body that was cut off at limit bytes, or
+// returns nil when err has another cause
+func requestTooLargeError(err error, limit int64) *APIError {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return nil
+	}
+	return newAPIError(http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge,
+		fmt.Sprintf("request body exceeds maximum limit of %d bytes", limit))
+}
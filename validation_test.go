@@ -2,11 +2,30 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"ocr-web-api/auth"
+	"ocr-web-api/cache"
+	"ocr-web-api/imageprocessor"
+	"ocr-web-api/jobs"
+	"ocr-web-api/logging"
+	"ocr-web-api/ocr"
+	"ocr-web-api/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestRequestValidationAndErrorHandling tests the comprehensive request validation
@@ -53,6 +72,33 @@ func TestRequestValidationAndErrorHandling(t *testing.T) {
 			expectedStatus: http.StatusUnprocessableEntity,
 			expectedError:  "unsupported document type",
 		},
+		{
+			name: "valid request with automatic document type",
+			request: OCRRequest{
+				Image:        "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==",
+				DocumentType: DocumentTypeAuto,
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "valid request with flat response format",
+			request: OCRRequest{
+				Image:        "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==",
+				DocumentType: "drivers_license_jp",
+				Format:       ResponseFormatFlat,
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "unsupported response format",
+			request: OCRRequest{
+				Image:        "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==",
+				DocumentType: "drivers_license_jp",
+				Format:       "xml",
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "unsupported response format",
+		},
 		{
 			name: "invalid base64 encoding",
 			request: OCRRequest{
@@ -62,6 +108,25 @@ func TestRequestValidationAndErrorHandling(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "invalid base64 encoding",
 		},
+		{
+			name: "valid request with back image",
+			request: OCRRequest{
+				Image:        "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==",
+				BackImage:    "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==",
+				DocumentType: "drivers_license_jp",
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "unsupported back image format",
+			request: OCRRequest{
+				Image:        "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==",
+				BackImage:    "dGhpcyBpcyBub3QgYW4gaW1hZ2U=",
+				DocumentType: "drivers_license_jp",
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "backImage: unsupported image format",
+		},
 		{
 			name: "unsupported image format",
 			request: OCRRequest{
@@ -93,6 +158,10 @@ func TestRequestValidationAndErrorHandling(t *testing.T) {
 				if !strings.Contains(err.Error(), tt.expectedError) {
 					t.Errorf("Expected error containing '%s', got '%s'", tt.expectedError, err.Error())
 				}
+
+				if status := toAPIError(err).Status; status != tt.expectedStatus {
+					t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+				}
 			}
 		})
 	}
@@ -139,24 +208,17 @@ func TestJSONPayloadValidation(t *testing.T) {
 
 				var req OCRRequest
 				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-					w.WriteHeader(http.StatusBadRequest)
-					errorResponse := NewErrorResponse(http.StatusBadRequest, "Invalid JSON format: "+err.Error())
-					json.NewEncoder(w).Encode(errorResponse)
+					apiErr := invalidJSONError(err)
+					w.WriteHeader(apiErr.Status)
+					json.NewEncoder(w).Encode(NewErrorResponse(apiErr))
 					return
 				}
 
 				// Validate request
 				if err := req.Validate(); err != nil {
-					statusCode := http.StatusBadRequest
-					if strings.Contains(err.Error(), "unsupported document type") ||
-						strings.Contains(err.Error(), "unsupported image format") ||
-						strings.Contains(err.Error(), "image size exceeds maximum limit") {
-						statusCode = http.StatusUnprocessableEntity
-					}
-
-					w.WriteHeader(statusCode)
-					errorResponse := NewErrorResponse(statusCode, err.Error())
-					json.NewEncoder(w).Encode(errorResponse)
+					apiErr := toAPIError(err)
+					w.WriteHeader(apiErr.Status)
+					json.NewEncoder(w).Encode(NewErrorResponse(apiErr))
 					return
 				}
 
@@ -247,7 +309,7 @@ func TestHTTPMethodValidation(t *testing.T) {
 				// Only accept POST requests
 				if r.Method != "POST" {
 					w.WriteHeader(http.StatusMethodNotAllowed)
-					errorResponse := NewErrorResponse(http.StatusMethodNotAllowed, "Method not allowed. Use POST.")
+					errorResponse := NewErrorResponse(methodNotAllowedError("POST"))
 					json.NewEncoder(w).Encode(errorResponse)
 					return
 				}
@@ -304,38 +366,40 @@ func TestHTTPMethodValidation(t *testing.T) {
 // TestErrorResponseFormat tests that error responses are properly formatted
 func TestErrorResponseFormat(t *testing.T) {
 	tests := []struct {
-		name         string
-		statusCode   int
-		message      string
-		expectedCode int
+		name       string
+		statusCode int
+		code       string
+		message    string
+		details    []ErrorDetail
 	}{
 		{
-			name:         "400 Bad Request error",
-			statusCode:   http.StatusBadRequest,
-			message:      "Invalid request data",
-			expectedCode: http.StatusBadRequest,
+			name:       "400 Bad Request error",
+			statusCode: http.StatusBadRequest,
+			code:       ErrCodeRequiredFieldMissing,
+			message:    "image field is required",
+			details:    []ErrorDetail{{Field: "image", Reason: ReasonMissing}},
 		},
 		{
-			name:         "422 Unprocessable Entity error",
-			statusCode:   http.StatusUnprocessableEntity,
-			message:      "Unsupported document type",
-			expectedCode: http.StatusUnprocessableEntity,
+			name:       "422 Unprocessable Entity error",
+			statusCode: http.StatusUnprocessableEntity,
+			code:       ErrCodeCardNotDetected,
+			message:    cardNotDetectedMessage,
 		},
 		{
-			name:         "500 Internal Server Error",
-			statusCode:   http.StatusInternalServerError,
-			message:      "Internal server error",
-			expectedCode: http.StatusInternalServerError,
+			name:       "500 Internal Server Error",
+			statusCode: http.StatusInternalServerError,
+			code:       ErrCodeInternal,
+			message:    "internal server error",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Test the NewErrorResponse function
-			errorResponse := NewErrorResponse(tt.statusCode, tt.message)
+			errorResponse := NewErrorResponse(newAPIError(tt.statusCode, tt.code, tt.message, tt.details...))
 
-			if errorResponse.Error.Code != tt.expectedCode {
-				t.Errorf("Expected error code %d, got %d", tt.expectedCode, errorResponse.Error.Code)
+			if errorResponse.Error.Code != tt.code || errorResponse.Error.Status != tt.statusCode {
+				t.Errorf("Expected error %s (%d), got %s (%d)", tt.code, tt.statusCode, errorResponse.Error.Code, errorResponse.Error.Status)
 			}
 
 			if errorResponse.Error.Message != tt.message {
@@ -354,8 +418,12 @@ func TestErrorResponseFormat(t *testing.T) {
 				t.Fatalf("Failed to unmarshal error response: %v", err)
 			}
 
-			if deserializedResponse.Error.Code != tt.expectedCode {
-				t.Errorf("After JSON round-trip, expected error code %d, got %d", tt.expectedCode, deserializedResponse.Error.Code)
+			if deserializedResponse.Error.Code != tt.code || deserializedResponse.Error.Status != tt.statusCode {
+				t.Errorf("After JSON round-trip, expected error %s (%d), got %s (%d)", tt.code, tt.statusCode, deserializedResponse.Error.Code, deserializedResponse.Error.Status)
+			}
+
+			if !reflect.DeepEqual(deserializedResponse.Error.Details, tt.details) {
+				t.Errorf("After JSON round-trip, expected details %+v, got %+v", tt.details, deserializedResponse.Error.Details)
 			}
 
 			if deserializedResponse.Error.Message != tt.message {
@@ -364,3 +432,999 @@ func TestErrorResponseFormat(t *testing.T) {
 		})
 	}
 }
+
+// TestOCRResponseFormats tests that parse results serialize in both typed and flat formats
+func TestOCRResponseFormats(t *testing.T) {
+	result := parser.NewResult(DocumentTypeDriversLicenseJP, &parser.DriversLicenseResult{
+		Name:    &parser.Field{Value: "山田 太郎", Type: parser.FieldTypeString},
+		Address: &parser.Field{Value: "", Type: parser.FieldTypeString},
+	})
+
+	t.Run("typed format", func(t *testing.T) {
+		jsonData, err := json.Marshal(NewOCRResponse(result, ResponseFormatTyped))
+		if err != nil {
+			t.Fatalf("Failed to marshal typed response: %v", err)
+		}
+
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(jsonData, &decoded); err != nil {
+			t.Fatalf("Failed to unmarshal typed response: %v", err)
+		}
+
+		if decoded["schemaVersion"] != parser.SchemaVersion {
+			t.Errorf("Expected schemaVersion %s, got %v", parser.SchemaVersion, decoded["schemaVersion"])
+		}
+		if _, exists := decoded["data"]; exists {
+			t.Errorf("Typed response should not contain flat data")
+		}
+
+		fields, ok := decoded["fields"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected fields object, got %v", decoded["fields"])
+		}
+		if fields["birth_date"] != nil {
+			t.Errorf("Expected missing field to be null, got %v", fields["birth_date"])
+		}
+		address, ok := fields["address"].(map[string]interface{})
+		if !ok || address["value"] != "" {
+			t.Errorf("Expected empty address to be present with empty value, got %v", fields["address"])
+		}
+	})
+
+	t.Run("flat format", func(t *testing.T) {
+		response := NewOCRResponse(result, ResponseFormatFlat)
+
+		if response.Fields != nil || response.SchemaVersion != "" {
+			t.Errorf("Flat response should not contain typed fields")
+		}
+		if response.Data["name"] != "山田 太郎" {
+			t.Errorf("Expected flat name '山田 太郎', got '%s'", response.Data["name"])
+		}
+		if _, exists := response.Data["birth_date"]; exists {
+			t.Errorf("Flat response should not contain missing fields")
+		}
+	})
+
+	t.Run("default format", func(t *testing.T) {
+		if response := NewOCRResponse(result, ""); response.Fields != nil || response.Data["name"] != "山田 太郎" {
+			t.Errorf("Expected flat response by default, got %+v", response)
+		}
+	})
+}
+
+// TestClassifyHandler tests request handling of the classification endpoint
+func TestClassifyHandler(t *testing.T) {
+	handler := NewOCRHandler()
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "GET method not allowed",
+			method:         "GET",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "invalid JSON",
+			method:         "POST",
+			body:           `{"image":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid JSON format",
+		},
+		{
+			name:           "missing image",
+			method:         "POST",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "image field is required",
+		},
+		{
+			name:           "unsupported image format",
+			method:         "POST",
+			body:           `{"image":"dGhpcyBpcyBub3QgYW4gaW1hZ2U="}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "unsupported image format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/classify", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.HandleClassify(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			var errorResponse ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&errorResponse); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if !strings.Contains(errorResponse.Error.Message, tt.expectedError) {
+				t.Errorf("Expected error containing '%s', got '%s'", tt.expectedError, errorResponse.Error.Message)
+			}
+		})
+	}
+}
+
+// TestOCRRequestUploads tests that multipart and raw image bodies are decoded
+// and validated like JSON requests
+func TestOCRRequestUploads(t *testing.T) {
+	png, err := base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==")
+	if err != nil {
+		t.Fatalf("Failed to decode test image: %v", err)
+	}
+	oversized := append(append([]byte{}, png...), make([]byte, MaxImageSize)...)
+
+	multipartBody := func(parts map[string][]byte) (string, *bytes.Buffer) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for name, data := range parts {
+			part, err := writer.CreateFormFile(name, name+".png")
+			if err != nil {
+				t.Fatalf("Failed to create form part: %v", err)
+			}
+			part.Write(data)
+		}
+		writer.Close()
+		return writer.FormDataContentType(), &body
+	}
+
+	bothSidesType, bothSides := multipartBody(map[string][]byte{"image": png, "back_image": png, "documentType": []byte("drivers_license_jp")})
+	invalidBackType, invalidBack := multipartBody(map[string][]byte{"image": png, "back_image": []byte("this is not an image")})
+
+	tests := []struct {
+		name          string
+		contentType   string
+		body          *bytes.Buffer
+		query         string
+		expectedType  string
+		expectedError string
+	}{
+		{
+			name:         "multipart with both sides",
+			contentType:  bothSidesType,
+			body:         bothSides,
+			expectedType: "drivers_license_jp",
+		},
+		{
+			name:          "multipart with invalid back image",
+			contentType:   invalidBackType,
+			body:          invalidBack,
+			query:         "?documentType=auto",
+			expectedError: "backImage: unsupported image format",
+		},
+		{
+			name:         "raw PNG body",
+			contentType:  "image/png",
+			body:         bytes.NewBuffer(png),
+			query:        "?documentType=drivers_license_jp",
+			expectedType: "drivers_license_jp",
+		},
+		{
+			name:          "raw body without document type",
+			contentType:   "image/jpeg",
+			body:          bytes.NewBuffer(png),
+			expectedError: "documentType field is required",
+		},
+		{
+			name:          "raw body that is not an image",
+			contentType:   "image/jpeg",
+			body:          bytes.NewBufferString("this is not an image"),
+			query:         "?documentType=drivers_license_jp",
+			expectedError: "unsupported image format",
+		},
+		{
+			name:          "oversized raw body",
+			contentType:   "image/png",
+			body:          bytes.NewBuffer(oversized),
+			query:         "?documentType=drivers_license_jp",
+			expectedError: "image size exceeds maximum limit",
+		},
+		{
+			name:          "empty raw body",
+			contentType:   "image/png",
+			body:          &bytes.Buffer{},
+			query:         "?documentType=drivers_license_jp",
+			expectedError: "image field is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/ocr"+tt.query, tt.body)
+			r.Header.Set("Content-Type", tt.contentType)
+
+			req, apiErr := decodeOCRRequest(httptest.NewRecorder(), r)
+			if apiErr != nil {
+				t.Fatalf("Expected body to be decoded, got error: %v", apiErr)
+			}
+
+			err := req.Validate()
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing '%s', got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected validation to pass, got error: %v", err)
+			}
+			if req.DocumentType != tt.expectedType || !bytes.Equal(req.imageData, png) {
+				t.Errorf("Expected %s request with the uploaded image, got %s with %d bytes", tt.expectedType, req.DocumentType, len(req.imageData))
+			}
+		})
+	}
+}
+
+// TestOCRUnsupportedContentType tests that unknown request bodies are rejected
+func TestOCRUnsupportedContentType(t *testing.T) {
+	handler := NewOCRHandler()
+
+	r := httptest.NewRequest("POST", "/ocr", strings.NewReader("image=abc"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.HandleOCR(rr, r)
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status %d, got %d", http.StatusUnsupportedMediaType, rr.Code)
+	}
+
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errorResponse); err != nil || errorResponse.Error.Code != ErrCodeUnsupportedMediaType {
+		t.Errorf("Expected %s error, got %s (%v)", ErrCodeUnsupportedMediaType, rr.Body.String(), err)
+	}
+}
+
+// TestJSONBodyLimit tests that JSON bodies are cut off at their size limit
+func TestJSONBodyLimit(t *testing.T) {
+	body := io.MultiReader(strings.NewReader(`{"image": "`), strings.NewReader(strings.Repeat("A", maxJSONSize)), strings.NewReader(`"}`))
+	r := httptest.NewRequest("POST", "/ocr", body)
+	r.Header.Set("Content-Type", "application/json")
+	if _, apiErr := decodeOCRRequest(httptest.NewRecorder(), r); apiErr == nil || apiErr.Code != ErrCodeRequestTooLarge {
+		t.Errorf("Expected %s error for oversized JSON body, got %v", ErrCodeRequestTooLarge, apiErr)
+	}
+
+	var req BatchRequest
+	r = httptest.NewRequest("POST", "/ocr/batch", strings.NewReader(`{"items": [{"image": "abc"}]}`))
+	if apiErr := decodeJSONBody(httptest.NewRecorder(), r, 16, &req); apiErr == nil || apiErr.Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for body over the limit, got %v", http.StatusRequestEntityTooLarge, apiErr)
+	}
+	r = httptest.NewRequest("POST", "/ocr/batch", strings.NewReader(`{"items": [`))
+	if apiErr := decodeJSONBody(httptest.NewRecorder(), r, 16, &req); apiErr == nil || apiErr.Code != ErrCodeInvalidRequest {
+		t.Errorf("Expected %s error for truncated JSON within the limit, got %v", ErrCodeInvalidRequest, apiErr)
+	}
+}
+
+// TestDecodeBatchRequest tests that batches decoded item by item read like
+// json.Unmarshal and stop at the first item that is not admitted
+func TestDecodeBatchRequest(t *testing.T) {
+	admitAll := func(int) *APIError { return nil }
+	decode := func(body string, admit func(int) *APIError) (*BatchRequest, *APIError) {
+		var req BatchRequest
+		apiErr := decodeBatchRequest(httptest.NewRecorder(), httptest.NewRequest("POST", "/ocr/batch", strings.NewReader(body)), &req, admit)
+		return &req, apiErr
+	}
+
+	req, apiErr := decode(`{"Items":[{"id":"a"},{"id":"b"}],"extra":{"x":[1]},"format":"flat","redact":"name:mask"}`, admitAll)
+	if apiErr != nil || len(req.Items) != 2 || req.Items[1].ID != "b" || req.Format != "flat" || req.Redact != "name:mask" {
+		t.Errorf("Unexpected batch %+v (%v)", req, apiErr)
+	}
+	if req, apiErr := decode(`{"items":null}`, admitAll); apiErr != nil || req.Items != nil {
+		t.Errorf("Expected null items to decode as none, got %+v (%v)", req, apiErr)
+	}
+	for _, body := range []string{`{"items":{}}`, `["items"]`, `{"items":[{"id":"a"}]`} {
+		if _, apiErr := decode(body, admitAll); apiErr == nil || apiErr.Code != ErrCodeInvalidRequest {
+			t.Errorf("Expected %s for %s, got %v", ErrCodeInvalidRequest, body, apiErr)
+		}
+	}
+
+	var admitted []int
+	refuse := newAPIError(http.StatusTooManyRequests, ErrCodeRateLimited, "refused")
+	admit := func(items int) *APIError {
+		admitted = append(admitted, items)
+		if items == 2 {
+			return refuse
+		}
+		return nil
+	}
+	if _, apiErr := decode(`{"items":[{"id":"a"},{"id":"b"},not json`, admit); apiErr != refuse || !reflect.DeepEqual(admitted, []int{1, 2}) {
+		t.Errorf("Expected decoding to stop at the refused item, got %v after %v", apiErr, admitted)
+	}
+}
+
+// TestBatchHandler tests batch validation and per-item error results. The
+// items carry invalid images, so they fail before reaching the OCR engine.
+func TestBatchHandler(t *testing.T) {
+	handler := NewOCRHandler()
+
+	t.Run("batch validation", func(t *testing.T) {
+		tooMany := BatchRequest{Items: make([]BatchItem, MaxBatchItems+1)}
+		for i := range tooMany.Items {
+			tooMany.Items[i].ID = strconv.Itoa(i)
+		}
+		tooManyBody, _ := json.Marshal(tooMany)
+
+		tests := []struct {
+			name           string
+			body           string
+			expectedStatus int
+			expectedError  string
+		}{
+			{"invalid JSON", `{"items":`, http.StatusBadRequest, "Invalid JSON format"},
+			{"no items", `{"items":[]}`, http.StatusBadRequest, "items field is required"},
+			{"missing id", `{"items":[{"documentType":"passport"}]}`, http.StatusBadRequest, "items[0]: id field is required"},
+			{"duplicate id", `{"items":[{"id":"a"},{"id":"a"}]}`, http.StatusBadRequest, `items[1]: duplicate id "a"`},
+			{"too many items", string(tooManyBody), http.StatusUnprocessableEntity, "batch size exceeds maximum limit"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rr := httptest.NewRecorder()
+				handler.HandleBatch(rr, httptest.NewRequest("POST", "/ocr/batch", strings.NewReader(tt.body)))
+
+				if rr.Code != tt.expectedStatus {
+					t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+				}
+				var errorResponse ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&errorResponse); err != nil {
+					t.Fatalf("Failed to decode error response: %v", err)
+				}
+				if !strings.Contains(errorResponse.Error.Message, tt.expectedError) {
+					t.Errorf("Expected error containing '%s', got '%s'", tt.expectedError, errorResponse.Error.Message)
+				}
+			})
+		}
+	})
+
+	body := `{"items":[` +
+		`{"id":"first","image":"dGhpcyBpcyBub3QgYW4gaW1hZ2U=","documentType":"drivers_license_jp"},` +
+		`{"id":"second","image":"iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==","documentType":"unknown"}]}`
+	expected := map[string]APIError{
+		"first": {Code: ErrCodeUnsupportedImageFormat, Status: http.StatusUnprocessableEntity, Message: "unsupported image format, only PNG and JPEG are supported",
+			Details: []ErrorDetail{{Field: "image", Reason: ReasonUnsupported}}},
+		"second": {Code: ErrCodeUnsupportedDocumentType, Status: http.StatusUnprocessableEntity, Message: "unsupported document type: unknown",
+			Details: []ErrorDetail{{Field: "documentType", Reason: ReasonUnsupported}}},
+	}
+
+	t.Run("per-item results", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.HandleBatch(rr, httptest.NewRequest("POST", "/ocr/batch", strings.NewReader(body)))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response BatchResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode batch response: %v", err)
+		}
+		if len(response.Results) != 2 || response.Results[0].ID != "first" || response.Results[1].ID != "second" {
+			t.Fatalf("Expected results in item order, got %+v", response.Results)
+		}
+		if response.Failed != 2 || response.Succeeded != 0 {
+			t.Errorf("Expected 2 failed items, got %d failed and %d succeeded", response.Failed, response.Succeeded)
+		}
+		for _, result := range response.Results {
+			if result.Error == nil || !reflect.DeepEqual(*result.Error, expected[result.ID]) {
+				t.Errorf("%s: expected error %+v, got %+v", result.ID, expected[result.ID], result.Error)
+			}
+		}
+	})
+
+	t.Run("NDJSON stream", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/ocr/batch", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json;q=0.5, application/x-ndjson")
+		rr := httptest.NewRecorder()
+		handler.HandleBatch(rr, req)
+
+		if contentType := rr.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+			t.Errorf("Expected NDJSON content type, got %s", contentType)
+		}
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected one line per item, got %q", rr.Body.String())
+		}
+		for _, line := range lines {
+			var result BatchItemResult
+			if err := json.Unmarshal([]byte(line), &result); err != nil {
+				t.Fatalf("Failed to decode result line %q: %v", line, err)
+			}
+			if result.Error == nil || !reflect.DeepEqual(*result.Error, expected[result.ID]) {
+				t.Errorf("%s: expected error %+v, got %+v", result.ID, expected[result.ID], result.Error)
+			}
+		}
+	})
+}
+
+// TestJobHandler tests submitting a job and polling it to completion. The
+// tiny image contains no card, so the job fails quickly without OCR.
+func TestJobHandler(t *testing.T) {
+	handler := newJobHandler(NewOCRHandler(), jobs.NewMemoryStore(), jobs.Config{Workers: 1})
+	if err := handler.manager.Start(); err != nil {
+		t.Fatalf("Failed to start job manager: %v", err)
+	}
+	defer handler.Close()
+
+	validImage := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+	t.Run("request validation", func(t *testing.T) {
+		tests := []struct {
+			name           string
+			body           string
+			expectedStatus int
+			expectedError  string
+		}{
+			{"invalid JSON", `{"image":`, http.StatusBadRequest, "Invalid JSON format"},
+			{"missing image", `{"documentType":"passport"}`, http.StatusBadRequest, "image field is required"},
+			{"invalid callback URL", `{"image":"` + validImage + `","documentType":"passport","callbackUrl":"ftp://example.com"}`, http.StatusBadRequest, "invalid callbackUrl"},
+			{"callback without secret", `{"image":"` + validImage + `","documentType":"passport","callbackUrl":"https://example.com/hook"}`, http.StatusUnprocessableEntity, "WEBHOOK_SECRET"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rr := httptest.NewRecorder()
+				handler.HandleJobs(rr, httptest.NewRequest("POST", "/jobs", strings.NewReader(tt.body)))
+
+				if rr.Code != tt.expectedStatus {
+					t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+				}
+				var errorResponse ErrorResponse
+				json.NewDecoder(rr.Body).Decode(&errorResponse)
+				if !strings.Contains(errorResponse.Error.Message, tt.expectedError) {
+					t.Errorf("Expected error containing '%s', got '%s'", tt.expectedError, errorResponse.Error.Message)
+				}
+			})
+		}
+	})
+
+	t.Run("callback to internal address", func(t *testing.T) {
+		callbacks := newJobHandler(handler.ocrHandler, jobs.NewMemoryStore(), jobs.Config{Notifier: jobs.NewNotifier("secret")})
+		body := `{"image":"` + validImage + `","documentType":"passport","callbackUrl":"https://169.254.169.254/latest/meta-data"}`
+		rr := httptest.NewRecorder()
+		callbacks.HandleJobs(rr, httptest.NewRequest("POST", "/jobs", strings.NewReader(body)))
+
+		var errorResponse ErrorResponse
+		json.NewDecoder(rr.Body).Decode(&errorResponse)
+		if rr.Code != http.StatusBadRequest || errorResponse.Error.Code != ErrCodeInvalidField {
+			t.Errorf("Expected %s error with status %d, got %d: %+v", ErrCodeInvalidField, http.StatusBadRequest, rr.Code, errorResponse.Error)
+		}
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.HandleJob(rr, httptest.NewRequest("GET", "/jobs/0123456789abcdef0123456789abcdef", nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("job lifecycle", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		body := `{"image":"` + validImage + `","documentType":"drivers_license_jp"}`
+		handler.HandleJobs(rr, httptest.NewRequest("POST", "/jobs", strings.NewReader(body)))
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+		}
+
+		var job jobs.Job
+		if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+			t.Fatalf("Failed to decode job: %v", err)
+		}
+		if job.Status != jobs.StatusQueued || rr.Header().Get("Location") != "/jobs/"+job.ID {
+			t.Fatalf("Expected queued job with location, got %+v at %s", job, rr.Header().Get("Location"))
+		}
+
+		deadline := time.Now().Add(10 * time.Second)
+		for !job.Status.Done() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			rr = httptest.NewRecorder()
+			handler.HandleJob(rr, httptest.NewRequest("GET", "/jobs/"+job.ID, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			json.NewDecoder(rr.Body).Decode(&job)
+		}
+
+		var apiErr APIError
+		if err := json.Unmarshal(job.Error, &apiErr); err != nil || job.Status != jobs.StatusFailed {
+			t.Fatalf("Expected failed job with error, got %+v", job)
+		}
+		if apiErr.Code != ErrCodeCardNotDetected || apiErr.Status != http.StatusUnprocessableEntity || apiErr.Message != cardNotDetectedMessage {
+			t.Errorf("Expected card not detected error, got %+v", apiErr)
+		}
+	})
+}
+
+// TestToAPIError tests that processing errors get a stable code and that
+// messages of internal errors do not reach the client
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		expectedStatus  int
+		expectedCode    string
+		expectedDetails []ErrorDetail
+	}{
+		{
+			name:           "card not detected",
+			err:            fmt.Errorf("failed to process image: %w", imageprocessor.ErrCardNotDetected),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   ErrCodeCardNotDetected,
+		},
+		{
+			name:           "OCR engine failure",
+			err:            fmt.Errorf("%w: tesseract OCR command failed: %w", ocr.ErrEngineFailure, errors.New("exec: \"tesseract\": executable file not found in $PATH")),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeOCREngineFailure,
+		},
+		{
+			name:           "OCR pool saturated",
+			err:            fmt.Errorf("failed to parse document: %w", ocr.ErrPoolSaturated),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedCode:   ErrCodeOCRBusy,
+		},
+		{
+			name:           "no text",
+			err:            fmt.Errorf("failed to parse document: %w", ocr.ErrNoText),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   ErrCodeNoTextDetected,
+		},
+		{
+			name:            "missing document fields",
+			err:             fmt.Errorf("failed to parse document: %w", &parser.FieldError{Err: parser.ErrRequiredFieldMissing, Fields: []string{"name", "birthDate"}}),
+			expectedStatus:  http.StatusUnprocessableEntity,
+			expectedCode:    ErrCodeRequiredFieldMissing,
+			expectedDetails: []ErrorDetail{{Field: "name", Reason: ReasonMissing}, {Field: "birthDate", Reason: ReasonMissing}},
+		},
+		{
+			name:           "unknown error",
+			err:            errors.New("open /tmp/ocr_image_123.png: no such file or directory"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := toAPIError(tt.err)
+
+			if apiErr.Status != tt.expectedStatus || apiErr.Code != tt.expectedCode {
+				t.Errorf("Expected %s (%d), got %s (%d)", tt.expectedCode, tt.expectedStatus, apiErr.Code, apiErr.Status)
+			}
+			if !reflect.DeepEqual(apiErr.Details, tt.expectedDetails) {
+				t.Errorf("Expected details %+v, got %+v", tt.expectedDetails, apiErr.Details)
+			}
+			if strings.Contains(apiErr.Message, "/tmp") || strings.Contains(apiErr.Message, "exec") {
+				t.Errorf("Expected sanitized message, got %q", apiErr.Message)
+			}
+		})
+	}
+}
+
+// TestOCRBackpressure tests that /health reports the OCR pool and that
+// requests rejected by a saturated pool are answered with 429 and Retry-After
+func TestOCRBackpressure(t *testing.T) {
+	handler := NewOCRHandler()
+	handler.ocrPool = ocr.NewPool(handler.ocrPool, 1, 1)
+
+	rr := httptest.NewRecorder()
+	handler.HealthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	var health struct {
+		Status string        `json:"status"`
+		OCR    ocr.PoolStats `json:"ocr"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil || health.Status != "healthy" || health.OCR.Size != 1 {
+		t.Errorf("Expected healthy status with pool stats, got %s (%v)", rr.Body.String(), err)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.sendErrorResponse(rr, toAPIError(ocr.ErrPoolSaturated))
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+// TestOCRResultCache tests that a request whose image content was processed
+// before is answered from the result cache, however the image is sent
+func TestOCRResultCache(t *testing.T) {
+	const image = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+	png, _ := base64.StdEncoding.DecodeString(image)
+
+	handler := NewOCRHandler()
+	handler.resultCache = cache.NewMemory(time.Minute, 10, 1<<20)
+
+	key, ok := handler.resultCacheKey(context.Background(), &OCRRequest{Image: image, DocumentType: DocumentTypePassport})
+	if !ok {
+		t.Fatal("Expected the test image to be cacheable")
+	}
+	result := parser.NewResult(DocumentTypePassport, &parser.PassportResult{
+		Surname: &parser.Field{Value: "YAMADA", Type: parser.FieldTypeString},
+	})
+	handler.storeResponse(context.Background(), key, NewOCRResponse(result, ""))
+
+	requests := map[string]*http.Request{
+		"base64": httptest.NewRequest("POST", "/ocr", strings.NewReader(`{"image":"`+image+`","documentType":"passport"}`)),
+		"binary": httptest.NewRequest("POST", "/ocr?documentType=passport", bytes.NewReader(png)),
+	}
+	requests["base64"].Header.Set("Content-Type", "application/json")
+	requests["binary"].Header.Set("Content-Type", "image/png")
+
+	for name, req := range requests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.HandleOCR(rr, req)
+			if rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != "HIT" {
+				t.Fatalf("Expected cached 200 response, got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+			}
+
+			var response OCRResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !response.Cached || response.Data["surname"] != "YAMADA" {
+				t.Errorf("Expected cached passport result, got %s", rr.Body.String())
+			}
+		})
+	}
+
+	if stats := handler.resultCache.Stats(); stats.Hits != 2 {
+		t.Errorf("Expected 2 cache hits, got %+v", stats)
+	}
+}
+
+// TestMetricsHandler tests that requests are counted and exposed in the
+// Prometheus text format together with the pool and cache state
+func TestMetricsHandler(t *testing.T) {
+	const image = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+	handler := NewOCRHandler()
+	handler.resultCache = cache.NewMemory(time.Minute, 10, 1<<20)
+	handler.metrics = newHandlerMetrics(handler)
+
+	key, _ := handler.resultCacheKey(context.Background(), &OCRRequest{Image: image, DocumentType: DocumentTypePassport})
+	handler.storeResponse(context.Background(), key, &OCRResponse{DocumentType: DocumentTypePassport})
+
+	for _, body := range []string{
+		`{"image":"` + image + `","documentType":"passport"}`,
+		`{"image":"` + image + `","documentType":"library_card"}`,
+	} {
+		req := httptest.NewRequest("POST", "/ocr", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		handler.HandleOCR(httptest.NewRecorder(), req)
+	}
+	recordFields(parser.NewResult(DocumentTypePassport, &parser.PassportResult{
+		Surname: &parser.Field{Value: "YAMADA", Type: parser.FieldTypeString},
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Expected text exposition, got %d %v", rr.Code, rr.Header())
+	}
+
+	for _, expected := range []string{
+		"# TYPE ocr_requests_total counter",
+		`ocr_requests_total{endpoint="ocr",document_type="passport",code="200"} `,
+		`ocr_requests_total{endpoint="ocr",document_type="unsupported",code="422"} `,
+		`ocr_requests_in_flight{endpoint="ocr"} 0`,
+		"# TYPE ocr_stage_duration_seconds histogram",
+		`ocr_stage_duration_seconds_count{stage="decode"} `,
+		`ocr_fields_total{document_type="passport",field="surname",result="extracted"} `,
+		`ocr_fields_total{document_type="passport",field="given_names",result="missing"} `,
+		"ocr_pool_workers ",
+		"ocr_cache_hits_total 1",
+	} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, rr.Body.String())
+		}
+	}
+}
+
+// TestWithRequestID tests that request IDs are echoed, generated and carried by the request context
+func TestWithRequestID(t *testing.T) {
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		slog.New(logging.NewHandler(&buf, slog.LevelInfo)).InfoContext(r.Context(), "test")
+		seen = buf.String()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string // Empty when a new ID must be generated
+	}{
+		{"client ID", "req-123", "req-123"},
+		{"missing", "", ""},
+		{"invalid", "bad id\r\nx", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/health", nil)
+			if tt.header != "" {
+				req.Header.Set(logging.RequestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(logging.RequestIDHeader)
+			if tt.expected != "" && id != tt.expected {
+				t.Errorf("Expected request ID %q, got %q", tt.expected, id)
+			}
+			if tt.expected == "" && len(id) != 32 {
+				t.Errorf("Expected a generated request ID, got %q", id)
+			}
+			if !strings.Contains(seen, `"request_id":"`+id+`"`) {
+				t.Errorf("Expected log record with request ID %q, got %s", id, seen)
+			}
+			if rr.Code != http.StatusAccepted {
+				t.Errorf("Expected status %d, got %d", http.StatusAccepted, rr.Code)
+			}
+		})
+	}
+}
+
+// TestOCRRedaction tests that responses are redacted following the server
+// policy and the redact option of the request, without changing the cached result
+func TestOCRRedaction(t *testing.T) {
+	const image = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+	handler := NewOCRHandler()
+	handler.resultCache = cache.NewMemory(time.Minute, 10, 1<<20)
+	handler.redaction, _ = parseRedactionPolicy("individual_number_card_jp.individual_number:mask")
+
+	for _, format := range []string{ResponseFormatTyped, ResponseFormatFlat} {
+		key, _ := handler.resultCacheKey(context.Background(), &OCRRequest{Image: image, DocumentType: DocumentTypeIndividualNumberCard, Format: format})
+		result := parser.NewResult(DocumentTypeIndividualNumberCard, &parser.IndividualNumberCardResult{
+			Name:             &parser.Field{Value: "山田 太郎", Type: parser.FieldTypeString},
+			Address:          &parser.Field{Value: "東京都千代田区", Type: parser.FieldTypeString},
+			IndividualNumber: &parser.Field{Value: "1234-5678-9012", Type: parser.FieldTypeNumber},
+		})
+		handler.storeResponse(context.Background(), key, NewOCRResponse(result, format))
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		redact   string
+		expected map[string]string // Expected values by field; absent fields must be missing
+	}{
+		{"server policy", ResponseFormatTyped, "", map[string]string{"name": "山田 太郎", "address": "東京都千代田区", "individual_number": "****-****-9012"}},
+		{"request option", ResponseFormatTyped, "address:drop,name:presence", map[string]string{"name": "", "individual_number": "****-****-9012"}},
+		{"not weaker than server", ResponseFormatTyped, "individual_number:none", map[string]string{"name": "山田 太郎", "address": "東京都千代田区", "individual_number": "****-****-9012"}},
+		{"flat", ResponseFormatFlat, "address:drop", map[string]string{"name": "山田 太郎", "individual_number": "****-****-9012"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"image":%q,"documentType":"individual_number_card_jp","format":%q,"redact":%q}`, image, tt.format, tt.redact)
+			req := httptest.NewRequest("POST", "/ocr", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			handler.HandleOCR(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			var response OCRResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			values := response.Data
+			if response.Fields != nil {
+				values = make(map[string]string)
+				for name, field := range response.Fields.FieldMap() {
+					if field != nil {
+						values[name] = field.Value
+					}
+				}
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("Expected fields %v, got %v", tt.expected, values)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name   string
+		redact string
+		status int
+	}{
+		{"unknown field", "individual_numbr:mask", http.StatusBadRequest},
+		{"unknown mode", "individual_number:blur", http.StatusBadRequest},
+		{"hash without key", "individual_number:hash", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"image":%q,"documentType":"individual_number_card_jp","redact":%q}`, image, tt.redact)
+			req := httptest.NewRequest("POST", "/ocr", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			handler.HandleOCR(rr, req)
+
+			var errorResponse ErrorResponse
+			json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+			if rr.Code != tt.status || errorResponse.Error.Code != ErrCodeInvalidField || len(errorResponse.Error.Details) == 0 || errorResponse.Error.Details[0].Field != "redact" {
+				t.Errorf("Expected %d redact error, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestAPIKeyAuth tests authentication, origins, document types, rate limits
+// of requests and batch items, redaction and job ownership of API keys
+func TestAPIKeyAuth(t *testing.T) {
+	const image = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+	handler := NewOCRHandler()
+	handler.resultCache = cache.NewMemory(time.Minute, 10, 1<<20)
+	key, _ := handler.resultCacheKey(context.Background(), &OCRRequest{Image: image, DocumentType: DocumentTypeIndividualNumberCard})
+	handler.storeResponse(context.Background(), key, NewOCRResponse(parser.NewResult(DocumentTypeIndividualNumberCard, &parser.IndividualNumberCardResult{
+		IndividualNumber: &parser.Field{Value: "1234-5678-9012", Type: parser.FieldTypeNumber},
+	}), ""))
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"keys": [
+		{"id": "partner", "secretHash": "` + auth.HashSecret("partner-secret") + `", "documentTypes": ["individual_number_card_jp"],
+		 "origins": ["https://partner.example"], "rateLimit": "4/m", "redact": "individual_number:mask"},
+		{"id": "passport-only", "secretHash": "` + auth.HashSecret("passport-secret") + `", "documentTypes": ["passport"]},
+		{"id": "batch", "secretHash": "` + auth.HashSecret("batch-secret") + `", "rateLimit": "3/m"},
+		{"id": "small-batch", "secretHash": "` + auth.HashSecret("small-batch-secret") + `", "rateLimit": "2/m"}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	validate := func(key *auth.Key) error { return validateAPIKey(key, handler.redactor) }
+	keys, err := auth.Load(path, validate)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	handler.apiKeys = keys
+	serve := handler.requireAPIKey(handler.HandleOCR)
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"missing key", nil, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"unknown key", map[string]string{"X-API-Key": "guess"}, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"unknown key from origin", map[string]string{"X-API-Key": "guess", "Origin": "https://partner.example"}, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"document type not allowed", map[string]string{"Authorization": "Bearer passport-secret"}, http.StatusForbidden, ErrCodeDocumentTypeNotAllowed},
+		{"origin not allowed", map[string]string{"X-API-Key": "partner-secret", "Origin": "https://evil.example"}, http.StatusForbidden, ErrCodeOriginNotAllowed},
+		{"origin of another key", map[string]string{"X-API-Key": "passport-secret", "Origin": "https://partner.example"}, http.StatusForbidden, ErrCodeOriginNotAllowed},
+		{"bearer key", map[string]string{"Authorization": "Bearer partner-secret"}, http.StatusOK, ""},
+		{"key from origin", map[string]string{"X-API-Key": "partner-secret", "Origin": "https://partner.example"}, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/ocr", strings.NewReader(`{"image":"`+image+`","documentType":"individual_number_card_jp"}`))
+			req.Header.Set("Content-Type", "application/json")
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			serve(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			// Errors are readable from origins of any key, but not from others
+			origin := tt.headers["Origin"]
+			if origin == "https://evil.example" {
+				origin = ""
+			}
+			if rr.Header().Get("Access-Control-Allow-Origin") != origin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", origin, rr.Header().Get("Access-Control-Allow-Origin"))
+			}
+			if tt.expectedCode != "" {
+				var errorResponse ErrorResponse
+				json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				if errorResponse.Error.Code != tt.expectedCode {
+					t.Errorf("Expected error code %s, got %s", tt.expectedCode, rr.Body.String())
+				}
+				if tt.expectedStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+					t.Error("Expected WWW-Authenticate header")
+				}
+				return
+			}
+
+			var response OCRResponse
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			if response.Data["individual_number"] != "****-****-9012" {
+				t.Errorf("Expected individual number masked by the key policy, got %s", rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/ocr", nil)
+		req.Header.Set("Origin", "https://partner.example")
+		rr := httptest.NewRecorder()
+		serve(rr, req)
+		if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "https://partner.example" {
+			t.Errorf("Expected preflight allowed for partner origin, got %d %v", rr.Code, rr.Header())
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		// Two of the four requests of the partner key were used above
+		var rr *httptest.ResponseRecorder
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest("POST", "/ocr", strings.NewReader(`{"image":"`+image+`","documentType":"individual_number_card_jp"}`))
+			req.Header.Set("X-API-Key", "partner-secret")
+			rr = httptest.NewRecorder()
+			serve(rr, req)
+		}
+		if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), ErrCodeRateLimited) || rr.Header().Get("Retry-After") != "15" {
+			t.Errorf("Expected 429 with Retry-After 15, got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+		}
+	})
+
+	t.Run("batch rate limit", func(t *testing.T) {
+		serveBatch := handler.requireAPIKey(handler.HandleBatch)
+		// The items are followed by invalid JSON, which is only reported once every item was admitted
+		batch := func(secret string, items int) *httptest.ResponseRecorder {
+			list := make([]string, items)
+			for i := range list {
+				list[i] = fmt.Sprintf(`{"id":"%d","image":"%s","documentType":"passport"}`, i, image)
+			}
+			req := httptest.NewRequest("POST", "/ocr/batch", strings.NewReader(`{"items":[`+strings.Join(list, ",")+`,`))
+			req.Header.Set("X-API-Key", secret)
+			rr := httptest.NewRecorder()
+			serveBatch(rr, req)
+			return rr
+		}
+
+		// Each item counts, and items are refused before they are read
+		if rr := batch("batch-secret", 2); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Invalid JSON") {
+			t.Errorf("Expected batch within the limit to be read to the end, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if rr := batch("batch-secret", 2); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected 429 once the items used up the limit, got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+		}
+		if rr := batch("small-batch-secret", 3); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), ErrCodeBatchTooLarge) {
+			t.Errorf("Expected batch beyond the whole limit to be rejected, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("job of another key", func(t *testing.T) {
+		jobHandler := newJobHandler(handler, jobs.NewMemoryStore(), jobs.Config{Workers: 1})
+		as := func(id string, req *http.Request) *http.Request {
+			key, _ := keys.Get(id)
+			return req.WithContext(auth.WithKey(req.Context(), key))
+		}
+
+		rr := httptest.NewRecorder()
+		jobHandler.HandleJobs(rr, as("passport-only", httptest.NewRequest("POST", "/jobs", strings.NewReader(`{"image":"`+image+`","documentType":"passport"}`))))
+		var job jobs.Job
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil || rr.Code != http.StatusAccepted || job.Owner != "passport-only" {
+			t.Fatalf("Expected job owned by the key, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		for id, expectedStatus := range map[string]int{"passport-only": http.StatusOK, "partner": http.StatusNotFound} {
+			rr := httptest.NewRecorder()
+			jobHandler.HandleJob(rr, as(id, httptest.NewRequest("GET", "/jobs/"+job.ID, nil)))
+			if rr.Code != expectedStatus {
+				t.Errorf("Expected status %d reading the job with key %s, got %d: %s", expectedStatus, id, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("invalid keys file", func(t *testing.T) {
+		for _, key := range []auth.Key{{DocumentTypes: []string{"auto"}}, {Redact: "individual_number:hash"}} {
+			if err := validateAPIKey(&key, handler.redactor); err == nil {
+				t.Errorf("Expected error for key %+v", key)
+			}
+		}
+	})
+}